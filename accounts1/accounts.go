@@ -53,7 +53,7 @@ func (d *Daemon) Start() error {
 	d.manager = NewManager(service)
 	_accountsManager = d.manager
 
-	err := service.Export(dbusPath, d.manager)
+	err := d.Export(dbusPath, d.manager)
 	if err != nil {
 		if d.manager.watcher != nil {
 			d.manager.watcher.EndWatch()
@@ -67,7 +67,7 @@ func (d *Daemon) Start() error {
 	d.imageBlur = newImageBlur(service)
 	_imageBlur = d.imageBlur
 
-	err = service.Export(imageBlurDBusPath, d.imageBlur)
+	err = d.Export(imageBlurDBusPath, d.imageBlur)
 	if err != nil {
 		d.imageBlur = nil
 		return err
@@ -78,7 +78,7 @@ func (d *Daemon) Start() error {
 		logger.Error("Failed to create logined manager:", err)
 		return err
 	}
-	err = service.Export(logined.DBusPath, d.loginedManager)
+	err = d.Export(logined.DBusPath, d.loginedManager)
 	if err != nil {
 		logined.Unregister(d.loginedManager)
 		d.loginedManager = nil
@@ -33,6 +33,7 @@ import (
 	dbus "github.com/godbus/dbus/v5"
 	"github.com/linuxdeepin/dde-api/lang_info"
 	"github.com/linuxdeepin/dde-daemon/accounts1/users"
+	"github.com/linuxdeepin/dde-daemon/common/audit"
 	"github.com/linuxdeepin/dde-daemon/common/sessionmsg"
 	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/gdkpixbuf"
@@ -149,12 +150,19 @@ func (u *User) SetShell(sender dbus.Sender, shell string) *dbus.Error {
 	return nil
 }
 
-func (u *User) SetPassword(sender dbus.Sender, password string) *dbus.Error {
+func (u *User) SetPassword(sender dbus.Sender, password string) (busErr *dbus.Error) {
 	logger.Debug("[SetPassword] start ...")
+	call := audit.Begin(u.service, sender, "Accounts1.User.SetPassword",
+		audit.NewArg("user", u.UserName), audit.NewSecretArg("password", password))
+	defer func() {
+		call.End(busErr)
+	}()
 
 	// set password from UnionID
 	if password == "" {
+		// 不经过 polkit 鉴权，由 setPwdWithUnionID 检查调用者，失败时记为拒绝
 		err := u.setPwdWithUnionID(sender)
+		call.SetAuthResult(err)
 		if err != nil {
 			return dbusutil.ToError(err)
 		} else {
@@ -163,6 +171,7 @@ func (u *User) SetPassword(sender dbus.Sender, password string) *dbus.Error {
 	}
 
 	err := u.checkAuth(sender, false, "")
+	call.SetAuthResult(err)
 	if err != nil {
 		logger.Debug("[SetPassword] access denied:", err)
 		return dbusutil.ToError(err)
@@ -44,7 +44,7 @@ func (d *Daemon) Start() error {
 	}
 
 	// export recorder and watcher
-	err = service.Export(dbusPath, d.recorder, d.watcher)
+	err = d.Export(dbusPath, d.recorder, d.watcher)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,385 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// 按应用的音频路由规则
+// 根据应用名、可执行文件名、媒体角色匹配 sink-input/source-output，将其移动到规则指定的端口上，
+// 指定的端口不可用时按照优先级策略依次尝试其它端口。
+// 用户手动移动到其它设备的音频流不再按照规则移动，见 appRouteTracker。
+type AppRouteRule struct {
+	Id        string
+	AppName   string // application.name
+	Binary    string // application.process.binary
+	Role      string // media.role
+	Direction int32  // pulse.DirectionSink 或 pulse.DirectionSource
+	CardName  string // pulse.Card.Name
+	PortName  string // pulse.CardPortInfo.Name
+}
+
+// 用于匹配规则和记住应用音量的音频流信息
+type appStreamInfo struct {
+	appId   string
+	appName string
+	binary  string
+	role    string
+}
+
+func newAppStreamInfo(propList map[string]string) appStreamInfo {
+	return appStreamInfo{
+		appId:   propList[pulse.PA_PROP_APPLICATION_ID],
+		appName: propList[pulse.PA_PROP_APPLICATION_NAME],
+		binary:  propList[pulse.PA_PROP_APPLICATION_PROCESS_BINARY],
+		role:    propList[pulse.PA_PROP_MEDIA_ROLE],
+	}
+}
+
+func (r *AppRouteRule) check() error {
+	if r.Direction != int32(pulse.DirectionSink) && r.Direction != int32(pulse.DirectionSource) {
+		return fmt.Errorf("invalid direction %d", r.Direction)
+	}
+	if r.AppName == "" && r.Binary == "" && r.Role == "" {
+		return errors.New("at least one of AppName, Binary and Role is required")
+	}
+	if r.CardName == "" || r.PortName == "" {
+		return errors.New("CardName and PortName are required")
+	}
+	return nil
+}
+
+// 规则中非空的字段都需要匹配，忽略大小写
+func (r *AppRouteRule) match(direction int32, info appStreamInfo) bool {
+	if r.Direction != direction {
+		return false
+	}
+	if r.AppName != "" && !strings.EqualFold(r.AppName, info.appName) {
+		return false
+	}
+	if r.Binary != "" && !strings.EqualFold(r.Binary, info.binary) {
+		return false
+	}
+	if r.Role != "" && !strings.EqualFold(r.Role, info.role) {
+		return false
+	}
+	return true
+}
+
+// 返回规则指定的端口，后面依次是优先级策略中未屏蔽的其它端口
+func appRouteCandidates(rule *AppRouteRule, policy *PriorityPolicy) []PriorityPort {
+	candidates := []PriorityPort{{
+		CardName: rule.CardName,
+		PortName: rule.PortName,
+		PortType: PortTypeInvalid,
+	}}
+	if policy == nil {
+		return candidates
+	}
+	for _, port := range policy.Ports {
+		// 规则指定的端口已经在最前面，屏蔽的端口不作为备选
+		if (port.CardName == rule.CardName && port.PortName == rule.PortName) || policy.Blocked.hasElement(port) {
+			continue
+		}
+		candidates = append(candidates, *port)
+	}
+	return candidates
+}
+
+type AppRouteKeeper struct {
+	Rules []*AppRouteRule // 按顺序匹配，先匹配到的规则生效
+	file  string          // 配置文件路径
+	mu    sync.Mutex
+}
+
+func NewAppRouteKeeper(path string) *AppRouteKeeper {
+	return &AppRouteKeeper{
+		Rules: make([]*AppRouteRule, 0),
+		file:  path,
+	}
+}
+
+// 创建单例
+func createAppRouteKeeperSingleton(path string) func() *AppRouteKeeper {
+	var rk *AppRouteKeeper = nil
+	return func() *AppRouteKeeper {
+		if rk == nil {
+			rk = NewAppRouteKeeper(path)
+		}
+		return rk
+	}
+}
+
+// 获取单例，配置文件和 ConfigKeeper 的放在一起
+var globalAppRouteKeeperFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/audio-app-routes.json")
+var GetAppRouteKeeper = createAppRouteKeeperSingleton(globalAppRouteKeeperFile)
+
+// 调用前需要持有 rk.mu
+func (rk *AppRouteKeeper) save() error {
+	data, err := json.MarshalIndent(rk.Rules, "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(rk.file), 0755) // #nosec G301
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.WriteFile(rk.file, data, 0644) // #nosec G306
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	return nil
+}
+
+func (rk *AppRouteKeeper) Load() error {
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+
+	data, err := os.ReadFile(rk.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return err
+	}
+
+	var rules []*AppRouteRule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	rk.Rules = rk.Rules[:0]
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		if err := rule.check(); err != nil {
+			logger.Warningf("ignore app route rule %q: %v", rule.Id, err)
+			continue
+		}
+		rk.Rules = append(rk.Rules, rule)
+	}
+	return nil
+}
+
+// 调用前需要持有 rk.mu
+func (rk *AppRouteKeeper) nextId() string {
+	maxId := 0
+	for _, rule := range rk.Rules {
+		id, err := strconv.Atoi(rule.Id)
+		if err == nil && id > maxId {
+			maxId = id
+		}
+	}
+	return strconv.Itoa(maxId + 1)
+}
+
+// SetRule 添加规则，Id 已存在时替换原来的规则，返回规则的 Id
+func (rk *AppRouteKeeper) SetRule(rule AppRouteRule) (string, error) {
+	err := rule.check()
+	if err != nil {
+		return "", err
+	}
+
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+
+	if rule.Id != "" {
+		for i, r := range rk.Rules {
+			if r.Id == rule.Id {
+				rk.Rules[i] = &rule
+				return rule.Id, rk.save()
+			}
+		}
+	} else {
+		rule.Id = rk.nextId()
+	}
+	rk.Rules = append(rk.Rules, &rule)
+	return rule.Id, rk.save()
+}
+
+func (rk *AppRouteKeeper) RemoveRule(id string) error {
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+
+	for i, r := range rk.Rules {
+		if r.Id == id {
+			rk.Rules = append(rk.Rules[:i], rk.Rules[i+1:]...)
+			return rk.save()
+		}
+	}
+	return fmt.Errorf("app route rule %q not found", id)
+}
+
+// Match 返回第一个匹配的规则的副本
+func (rk *AppRouteKeeper) Match(direction int32, info appStreamInfo) *AppRouteRule {
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+
+	for _, r := range rk.Rules {
+		if r.match(direction, info) {
+			rule := *r
+			return &rule
+		}
+	}
+	return nil
+}
+
+func (rk *AppRouteKeeper) HasRules(direction int32) bool {
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+
+	for _, r := range rk.Rules {
+		if r.Direction == direction {
+			return true
+		}
+	}
+	return false
+}
+
+func (rk *AppRouteKeeper) String() string {
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+	return toJSON(rk.Rules)
+}
+
+// appRouteTracker 记录音频流所在的设备和 daemon 发起的移动，用于识别用户手动移动的音频流。
+// 音频流从仍然存在的设备上移走，且不是 daemon 发起的移动时，认为是用户手动移动的，
+// 原设备被移除时由 pulse 移动的音频流不算在内。
+type appRouteTracker struct {
+	devices   map[uint32]uint32 // 音频流 => 最近一次看到的设备
+	pending   map[uint32]uint32 // 音频流 => daemon 移动的目标设备
+	userMoved map[uint32]bool
+}
+
+func newAppRouteTracker() *appRouteTracker {
+	return &appRouteTracker{
+		devices:   make(map[uint32]uint32),
+		pending:   make(map[uint32]uint32),
+		userMoved: make(map[uint32]bool),
+	}
+}
+
+// moving 记录 daemon 将音频流 stream 移动到设备 device
+func (t *appRouteTracker) moving(stream uint32, device uint32) {
+	t.pending[stream] = device
+}
+
+// update 记录音频流 stream 当前所在的设备 device，deviceExists 判断设备是否仍然存在
+func (t *appRouteTracker) update(stream uint32, device uint32, deviceExists func(uint32) bool) {
+	old, ok := t.devices[stream]
+	t.devices[stream] = device
+	if target, ok := t.pending[stream]; ok {
+		// 移动的事件可能还没有到达
+		if target == device {
+			delete(t.pending, stream)
+		}
+		return
+	}
+	if ok && old != device && deviceExists(old) {
+		logger.Debugf("stream #%d is moved from #%d to #%d by user", stream, old, device)
+		t.userMoved[stream] = true
+	}
+}
+
+func (t *appRouteTracker) isUserMoved(stream uint32) bool {
+	return t.userMoved[stream]
+}
+
+func (t *appRouteTracker) remove(stream uint32) {
+	delete(t.devices, stream)
+	delete(t.pending, stream)
+	delete(t.userMoved, stream)
+}
+
+// go-lib 的 pulse.SourceOutput 中没有任何信息，source-output 的属性通过 pactl 获取，
+// 不能在 pulse 的事件处理中调用，见 routeSourceOutputs
+type sourceOutputInfo struct {
+	index    uint32
+	source   uint32
+	propList map[string]string
+}
+
+func listSourceOutputs() ([]*sourceOutputInfo, error) {
+	cmd := exec.Command("pactl", "list", "source-outputs")
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseSourceOutputs(string(out)), nil
+}
+
+// 解析 pactl list source-outputs 的输出，形如：
+// Source Output #42
+//
+//	Source: 3
+//	Properties:
+//		application.name = "ZOOM VoiceEngine"
+func parseSourceOutputs(output string) []*sourceOutputInfo {
+	var result []*sourceOutputInfo
+	var cur *sourceOutputInfo
+	inProps := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Source Output #") {
+			idx, err := strconv.ParseUint(strings.TrimPrefix(line, "Source Output #"), 10, 32)
+			if err != nil {
+				cur = nil
+				continue
+			}
+			cur = &sourceOutputInfo{
+				index:    uint32(idx),
+				propList: make(map[string]string),
+			}
+			result = append(result, cur)
+			inProps = false
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "\t\t") && inProps {
+			kv := strings.SplitN(trimmed, " = ", 2)
+			if len(kv) == 2 {
+				cur.propList[kv[0]] = strings.Trim(kv[1], "\"")
+			}
+			continue
+		}
+
+		inProps = trimmed == "Properties:"
+		if strings.HasPrefix(trimmed, "Source: ") {
+			idx, err := strconv.ParseUint(strings.TrimPrefix(trimmed, "Source: "), 10, 32)
+			if err == nil {
+				cur.source = uint32(idx)
+			}
+		}
+	}
+	return result
+}
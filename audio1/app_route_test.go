@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AppRouteRule(t *testing.T) {
+	rule := &AppRouteRule{
+		Binary:    "zoom",
+		Direction: int32(pulse.DirectionSink),
+		CardName:  "alsa_card.usb-headset",
+		PortName:  "analog-output",
+	}
+	assert.NoError(t, rule.check())
+
+	zoom := appStreamInfo{appName: "ZOOM VoiceEngine", binary: "Zoom"}
+	assert.True(t, rule.match(int32(pulse.DirectionSink), zoom))
+	assert.False(t, rule.match(int32(pulse.DirectionSource), zoom))
+	assert.False(t, rule.match(int32(pulse.DirectionSink), appStreamInfo{binary: "firefox"}))
+
+	rule.Role = "phone"
+	assert.False(t, rule.match(int32(pulse.DirectionSink), zoom))
+	zoom.role = "phone"
+	assert.True(t, rule.match(int32(pulse.DirectionSink), zoom))
+
+	assert.Error(t, (&AppRouteRule{Direction: int32(pulse.DirectionSink), CardName: "a", PortName: "b"}).check())
+	assert.Error(t, (&AppRouteRule{Binary: "zoom", CardName: "a", PortName: "b"}).check())
+	assert.Error(t, (&AppRouteRule{Binary: "zoom", Direction: int32(pulse.DirectionSink)}).check())
+}
+
+func Test_AppRouteCandidates(t *testing.T) {
+	policy := NewPriorityPolicy()
+	policy.Ports = PriorityPortList{
+		{CardName: "pci", PortName: "speaker", PortType: PortTypeBuiltin},
+		{CardName: "usb", PortName: "analog-output", PortType: PortTypeUsb},
+	}
+	rule := &AppRouteRule{CardName: "usb", PortName: "analog-output"}
+
+	candidates := appRouteCandidates(rule, policy)
+	require.Len(t, candidates, 2)
+	assert.Equal(t, "usb", candidates[0].CardName)
+	assert.Equal(t, "pci", candidates[1].CardName)
+
+	assert.Len(t, appRouteCandidates(rule, nil), 1)
+}
+
+func Test_AppRouteKeeper(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audio-app-routes.json")
+	rk := NewAppRouteKeeper(file)
+
+	id, err := rk.SetRule(AppRouteRule{
+		AppName:   "ZOOM VoiceEngine",
+		Direction: int32(pulse.DirectionSource),
+		CardName:  "usb",
+		PortName:  "analog-input",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1", id)
+
+	id, err = rk.SetRule(AppRouteRule{
+		Role:      "music",
+		Direction: int32(pulse.DirectionSink),
+		CardName:  "pci",
+		PortName:  "speaker",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2", id)
+
+	_, err = rk.SetRule(AppRouteRule{Direction: int32(pulse.DirectionSink)})
+	assert.Error(t, err)
+
+	// 修改已有的规则
+	_, err = rk.SetRule(AppRouteRule{
+		Id:        "2",
+		Role:      "music",
+		Direction: int32(pulse.DirectionSink),
+		CardName:  "pci",
+		PortName:  "headphone",
+	})
+	require.NoError(t, err)
+
+	rk2 := NewAppRouteKeeper(file)
+	require.NoError(t, rk2.Load())
+	require.Len(t, rk2.Rules, 2)
+	rule := rk2.Match(int32(pulse.DirectionSink), appStreamInfo{role: "music"})
+	require.NotNil(t, rule)
+	assert.Equal(t, "headphone", rule.PortName)
+	assert.True(t, rk2.HasRules(int32(pulse.DirectionSource)))
+
+	assert.NoError(t, rk2.RemoveRule("1"))
+	assert.Error(t, rk2.RemoveRule("1"))
+	assert.False(t, rk2.HasRules(int32(pulse.DirectionSource)))
+}
+
+func Test_ParseSourceOutputs(t *testing.T) {
+	output := `Source Output #42
+	Driver: protocol-native.c
+	Owner Module: 10
+	Client: 55
+	Source: 3
+	Sample Specification: s16le 1ch 48000Hz
+	Properties:
+		media.name = "RecordStream"
+		application.name = "ZOOM VoiceEngine"
+		application.process.binary = "zoom"
+	Format: pcm, format.sample_format = "\"s16le\""
+
+Source Output #43
+	Source: 1
+	Properties:
+		media.role = "phone"
+`
+	list := parseSourceOutputs(output)
+	require.Len(t, list, 2)
+	assert.Equal(t, uint32(42), list[0].index)
+	assert.Equal(t, uint32(3), list[0].source)
+	assert.Equal(t, appStreamInfo{appName: "ZOOM VoiceEngine", binary: "zoom"}, newAppStreamInfo(list[0].propList))
+	assert.Len(t, list[0].propList, 3)
+	assert.Equal(t, uint32(1), list[1].source)
+	assert.Equal(t, "phone", list[1].propList[pulse.PA_PROP_MEDIA_ROLE])
+}
+
+func Test_AppRouteTracker(t *testing.T) {
+	exists := map[uint32]bool{1: true, 2: true, 3: true}
+	deviceExists := func(idx uint32) bool { return exists[idx] }
+	tr := newAppRouteTracker()
+
+	// daemon 发起的移动不算用户移动，移动的事件到达前看到的还是原来的设备
+	tr.update(10, 1, deviceExists)
+	tr.moving(10, 2)
+	tr.update(10, 1, deviceExists)
+	tr.update(10, 2, deviceExists)
+	assert.False(t, tr.isUserMoved(10))
+
+	// 原设备被移除时由 pulse 移动的不算用户移动
+	exists[2] = false
+	tr.update(10, 3, deviceExists)
+	assert.False(t, tr.isUserMoved(10))
+
+	// 从仍然存在的设备上移走的是用户移动的
+	tr.update(10, 1, deviceExists)
+	assert.True(t, tr.isUserMoved(10))
+
+	tr.remove(10)
+	assert.False(t, tr.isUserMoved(10))
+	tr.update(10, 3, deviceExists)
+	assert.False(t, tr.isUserMoved(10))
+}
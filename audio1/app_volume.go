@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// 应用的音量记忆，应用重新打开音频流时恢复上次的音量和静音状态
+type AppVolumeConfig struct {
+	Name   string // application.name，用于展示
+	Volume float64
+	Mute   bool
+}
+
+type AppVolumeKeeper struct {
+	Apps map[string]*AppVolumeConfig // 应用标识 => AppVolumeConfig
+	file string                      // 配置文件路径
+	mu   sync.Mutex
+}
+
+// 应用标识依次使用 application.id、application.process.binary、application.name
+func (info appStreamInfo) identity() string {
+	if info.appId != "" {
+		return info.appId
+	}
+	if info.binary != "" {
+		return info.binary
+	}
+	return info.appName
+}
+
+func NewAppVolumeKeeper(path string) *AppVolumeKeeper {
+	return &AppVolumeKeeper{
+		Apps: make(map[string]*AppVolumeConfig),
+		file: path,
+	}
+}
+
+// 创建单例
+func createAppVolumeKeeperSingleton(path string) func() *AppVolumeKeeper {
+	var vk *AppVolumeKeeper = nil
+	return func() *AppVolumeKeeper {
+		if vk == nil {
+			vk = NewAppVolumeKeeper(path)
+		}
+		return vk
+	}
+}
+
+// 获取单例，配置文件和 ConfigKeeper 的放在一起
+var globalAppVolumeKeeperFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/audio-app-volumes.json")
+var GetAppVolumeKeeper = createAppVolumeKeeperSingleton(globalAppVolumeKeeperFile)
+
+// 调用前需要持有 vk.mu
+func (vk *AppVolumeKeeper) save() error {
+	data, err := json.MarshalIndent(vk.Apps, "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(vk.file), 0755) // #nosec G301
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.WriteFile(vk.file, data, 0644) // #nosec G306
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	return nil
+}
+
+func (vk *AppVolumeKeeper) Load() error {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+
+	data, err := os.ReadFile(vk.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return err
+	}
+
+	apps := make(map[string]*AppVolumeConfig)
+	err = json.Unmarshal(data, &apps)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	for app, cfg := range apps {
+		// 增强音量可能已经关闭，这里按照增强后的最大音量检查，恢复时再限制
+		if app == "" || cfg == nil || cfg.Volume < 0 || cfg.Volume > increaseMaxVolume {
+			logger.Warningf("ignore invalid volume config of app %q", app)
+			delete(apps, app)
+		}
+	}
+	vk.Apps = apps
+	return nil
+}
+
+// GetAppVolume 返回应用记住的音量
+func (vk *AppVolumeKeeper) GetAppVolume(app string) (AppVolumeConfig, bool) {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+
+	cfg, ok := vk.Apps[app]
+	if !ok {
+		return AppVolumeConfig{}, false
+	}
+	return *cfg, true
+}
+
+// SetAppVolume 记住应用的音量，没有变化时不写配置文件
+func (vk *AppVolumeKeeper) SetAppVolume(app string, name string, volume float64, mute bool) {
+	if app == "" {
+		return
+	}
+
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+
+	cfg, ok := vk.Apps[app]
+	if ok && cfg.Name == name && floatPrecision(cfg.Volume) == floatPrecision(volume) && cfg.Mute == mute {
+		return
+	}
+	vk.Apps[app] = &AppVolumeConfig{
+		Name:   name,
+		Volume: volume,
+		Mute:   mute,
+	}
+	_ = vk.save()
+}
+
+// Reset 忘记应用的音量，app 为空时忘记所有应用的音量
+func (vk *AppVolumeKeeper) Reset(app string) error {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+
+	if app == "" {
+		vk.Apps = make(map[string]*AppVolumeConfig)
+		return vk.save()
+	}
+
+	if _, ok := vk.Apps[app]; !ok {
+		return fmt.Errorf("no volume remembered for app %q", app)
+	}
+	delete(vk.Apps, app)
+	return vk.save()
+}
+
+func (vk *AppVolumeKeeper) String() string {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	return toJSON(vk.Apps)
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AppStreamIdentity(t *testing.T) {
+	assert.Equal(t, "org.deepin.music", appStreamInfo{appId: "org.deepin.music", binary: "deepin-music"}.identity())
+	assert.Equal(t, "zoom", appStreamInfo{appName: "ZOOM VoiceEngine", binary: "zoom"}.identity())
+	assert.Equal(t, "mpv", appStreamInfo{appName: "mpv"}.identity())
+}
+
+func Test_AppVolumeKeeper(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audio-app-volumes.json")
+	vk := NewAppVolumeKeeper(file)
+
+	vk.SetAppVolume("", "", 0.5, false)
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	vk.SetAppVolume("zoom", "ZOOM VoiceEngine", 0.3, false)
+	vk.SetAppVolume("mpv", "mpv", 0.8, true)
+
+	vk2 := NewAppVolumeKeeper(file)
+	require.NoError(t, vk2.Load())
+	cfg, ok := vk2.GetAppVolume("mpv")
+	require.True(t, ok)
+	assert.Equal(t, AppVolumeConfig{Name: "mpv", Volume: 0.8, Mute: true}, cfg)
+	_, ok = vk2.GetAppVolume("firefox")
+	assert.False(t, ok)
+
+	assert.NoError(t, vk2.Reset("mpv"))
+	assert.Error(t, vk2.Reset("mpv"))
+	assert.Len(t, vk2.Apps, 1)
+	assert.NoError(t, vk2.Reset(""))
+	assert.Len(t, vk2.Apps, 0)
+
+	// 无效的音量在读取时忽略
+	err = os.WriteFile(file, []byte(`{"a":{"Volume":0.5},"b":{"Volume":9}}`), 0644)
+	require.NoError(t, err)
+	require.NoError(t, vk2.Load())
+	assert.Len(t, vk2.Apps, 1)
+}
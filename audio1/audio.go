@@ -127,6 +127,7 @@ func isStrvEqual(l1, l2 []string) bool {
 
 type Audio struct {
 	service *dbusutil.Service
+	safeGo  func(fn func()) // 启动长期运行的协程，崩溃时由 loader 重启模块
 	PropsMu sync.RWMutex
 	// dbusutil-gen: equal=objectPathSliceEqual
 	SinkInputs []dbus.ObjectPath
@@ -189,6 +190,12 @@ type Audio struct {
 
 	portLocker sync.Mutex
 
+	sourceOutputRouteMu sync.Mutex // 串行化 source-output 的路由
+
+	// 识别用户手动移动的音频流，由 mu 保护
+	sinkInputRoutes    *appRouteTracker
+	sourceOutputRoutes *appRouteTracker
+
 	syncConfig     *dsync.Config
 	sessionSigLoop *dbusutil.SignalLoop
 
@@ -215,6 +222,9 @@ type Audio struct {
 	// 用来进一步断是否需要暂停播放的信息
 	misc uint32
 
+	// 当前加载的均衡器
+	equalizer equalizerState
+
 	// nolint
 	signals *struct {
 		PortEnabledChanged struct {
@@ -234,13 +244,17 @@ func isStringInSlice(list []string, str string) bool {
 	return false
 }
 
-func newAudio(service *dbusutil.Service) *Audio {
+func newAudio(service *dbusutil.Service, safeGo func(fn func())) *Audio {
 	a := &Audio{
 		service:          service,
+		safeGo:           safeGo,
 		meters:           make(map[string]*Meter),
 		MaxUIVolume:      pulse.VolumeUIMax,
 		enableSource:     true,
 		AudioServerState: AudioStateChanged,
+
+		sinkInputRoutes:    newAppRouteTracker(),
+		sourceOutputRoutes: newAppRouteTracker(),
 	}
 
 	a.settings = gio.NewSettings(gsSchemaAudio)
@@ -827,8 +841,20 @@ func (a *Audio) autoPause() {
 // 同一张声卡可能存在多个端口，用户也可能切换过端口
 // 通过PriorityManager获取最高优先级对应的卡，然后根据配置获取期望端口
 func (a *Audio) tryGetPreferOutPut() PriorityPort {
+	pm := GetPriorityManager()
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return a.getPreferOutPut(pm.Output)
+}
+
+// 按照输出端口的优先级策略 policy 获取用户期望的端口
+func (a *Audio) getPreferOutPut(policy *PriorityPolicy) PriorityPort {
 	// 获取PriorityManager获取最高优先级的端口以及对应的声卡
-	firstOutput := GetPriorityManager().Output.GetTheFirstPort()
+	firstOutput := policy.GetTheFirstPort()
+	// 合并输出没有声卡配置
+	if isCombinedSinkName(firstOutput.CardName) {
+		return firstOutput
+	}
 	// 获取声卡配置期望的端口
 	preferPort := GetConfigKeeper().GetCardPreferPort(firstOutput.CardName)
 	if preferPort == "" {
@@ -846,7 +872,9 @@ func (a *Audio) tryGetPreferOutPut() PriorityPort {
 			for _, port := range card.Ports {
 				if port.Available != pulse.AvailableTypeNo &&
 					port.Direction == pulse.DirectionSink &&
-					port.Profiles.Exists(preferProfile.Name) {
+					port.Profiles.Exists(preferProfile.Name) &&
+					// 跳过不在优先级列表中的端口，例如模拟拔出的端口
+					policy.FindPortIndex(firstOutput.CardName, port.Name) >= 0 {
 					return PriorityPort{
 						CardName: firstOutput.CardName,
 						PortName: port.Name,
@@ -862,7 +890,7 @@ func (a *Audio) tryGetPreferOutPut() PriorityPort {
 		return firstOutput
 	}
 	// 查找PriorityManager中对应端口
-	for _, pp := range GetPriorityManager().Output.Ports {
+	for _, pp := range policy.Ports {
 		if pp.PortName == preferPort {
 			return *pp
 		}
@@ -884,7 +912,26 @@ func (a *Audio) refreshDefaultSinkSource() {
 		logger.Warningf("refresh defaultSink failed, defaultSink %v not found,", defaultSink)
 		return
 	}
+	// 均衡器等虚拟 sink 按照其主设备判断
+	if !isPhysicalDevice(sinkInfo.Name) {
+		masterSinkInfo := a.getSinkInfoByName(sinkInfo.PropList["device.master_device"])
+		if masterSinkInfo != nil {
+			sinkInfo = masterSinkInfo
+			defaultSink = masterSinkInfo.Name
+		}
+	}
 	logger.Debug("refreshDefaultSinkSource, defaultSink: ", sinkInfo.Index, sinkInfo.Name, a.getCardNameById(sinkInfo.Card), sinkInfo.ActivePort.Name)
+	// 合并输出没有声卡，直接按照 sink 名称设置默认 sink
+	if isCombinedSinkName(preferPort.CardName) {
+		if defaultSink != preferPort.CardName {
+			logger.Debugf("update default sink to combined sink %s", preferPort.CardName)
+			a.setDefaultCombinedSink(preferPort.CardName)
+		} else {
+			logger.Debugf("keep default as %s", defaultSink)
+		}
+		a.refreshDefaultSource(defaultSource)
+		return
+	}
 	card, err := a.cards.getByName(preferPort.CardName)
 	if err != nil || card == nil {
 		logger.Warningf("card not found %v, cards:%v", preferPort.CardName, a.cards)
@@ -942,6 +989,10 @@ func (a *Audio) refreshDefaultSinkSource() {
 		}
 	}
 
+	a.refreshDefaultSource(defaultSource)
+}
+
+func (a *Audio) refreshDefaultSource(defaultSource string) {
 	if a.defaultSource != nil && a.defaultSource.Name != defaultSource {
 		logger.Debugf("update default source to %s", defaultSource)
 		a.updateDefaultSource(defaultSource)
@@ -1041,6 +1092,11 @@ func (a *Audio) init() error {
 	}
 
 	GetConfigKeeper().Load()
+	GetAppRouteKeeper().Load()
+	GetAppVolumeKeeper().Load()
+	GetCombinedSinkManager().Load()
+	a.cleanupEqualizer()
+	a.cleanupCombinedSinks()
 
 	logger.Debug("init cards")
 	a.PropsMu.Lock()
@@ -1060,8 +1116,8 @@ func (a *Audio) init() error {
 	GetPriorityManager().Init(a.cards)
 	GetPriorityManager().Print()
 
-	go a.handleEvent()
-	go a.handleStateChanged()
+	a.safeGo(a.handleEvent)
+	a.safeGo(a.handleStateChanged)
 	logger.Debug("init done")
 
 	firstRun := a.settings.GetBoolean(gsKeyFirstRun)
@@ -1084,6 +1140,8 @@ func (a *Audio) init() error {
 
 	a.fixActivePortNotAvailable()
 	a.moveSinkInputsToDefaultSink()
+	a.applyAppRoutes()
+	a.applyCombinedSinks()
 
 	// 蓝牙支持的模式
 	a.setPropBluetoothAudioModeOpts([]string{"a2dp", "headset", "handsfree"})
@@ -1121,6 +1179,9 @@ func (a *Audio) destroyCtxRelated() {
 		}
 	}
 	a.sinkInputs = nil
+	// 重新连接后音频流的序号会被重新分配
+	a.sinkInputRoutes = newAppRouteTracker()
+	a.sourceOutputRoutes = newAppRouteTracker()
 
 	for _, meter := range a.meters {
 		err := a.service.StopExport(meter)
@@ -1136,6 +1197,8 @@ func (a *Audio) destroy() {
 	a.sessionSigLoop.Stop()
 	a.systemSigLoop.Stop()
 	a.syncConfig.Destroy()
+	a.destroyEqualizer()
+	a.destroyCombinedSinks()
 	a.destroyCtxRelated()
 }
 
@@ -1513,8 +1576,15 @@ func (a *Audio) moveSinkInputsToSink(sinkId uint32) {
 		if sinkInput.getPropSinkIndex() == sinkId {
 			continue
 		}
+		// 有路由规则的应用由 routeSinkInputs 处理，用户手动移动过的除外
+		if !a.sinkInputRoutes.isUserMoved(sinkInput.index) {
+			if _, ok := a.getAppRouteDevice(int32(pulse.DirectionSink), sinkInput.appInfo); ok {
+				continue
+			}
+		}
 
 		list = append(list, sinkInput.index)
+		a.sinkInputRoutes.moving(sinkInput.index, sinkId)
 	}
 	a.mu.Unlock()
 	if len(list) == 0 {
@@ -1568,6 +1638,8 @@ func (a *Audio) resumeSinkConfig(s *Sink) {
 		// 意外原因切换到被禁用的端口上，例如没有可用端口
 		s.setMute(true)
 	}
+
+	a.applyEqualizer(s)
 }
 
 func (a *Audio) resumeSourceConfig(s *Source, isPhyDev bool) {
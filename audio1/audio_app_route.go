@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"strings"
+
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// 查找当前使用指定端口的 sink 或 source，调用前需要持有 a.mu
+func (a *Audio) findDeviceByPort(cardName string, portName string, direction int32) (uint32, bool) {
+	card, err := a.cards.getByName(cardName)
+	if err != nil {
+		return 0, false
+	}
+	_, portConfig := GetConfigKeeper().GetCardAndPortConfig(cardName, portName)
+	if !portConfig.Enabled {
+		return 0, false
+	}
+
+	if direction == int32(pulse.DirectionSink) {
+		sinks := a.findSinks(card.Id, portName)
+		if len(sinks) > 0 {
+			return sinks[0].index, true
+		}
+	} else {
+		for _, source := range a.findSources(card.Id, portName) {
+			if strings.HasSuffix(source.Name, ".monitor") {
+				continue
+			}
+			return source.index, true
+		}
+	}
+	return 0, false
+}
+
+// 根据路由规则获取音频流应该使用的 sink 或 source，调用前需要持有 a.mu
+func (a *Audio) getAppRouteDevice(direction int32, info appStreamInfo) (uint32, bool) {
+	rule := GetAppRouteKeeper().Match(direction, info)
+	if rule == nil {
+		return 0, false
+	}
+
+	pm := GetPriorityManager()
+	pm.mu.Lock()
+	policy := pm.Output
+	if direction == int32(pulse.DirectionSource) {
+		policy = pm.Input
+	}
+	candidates := appRouteCandidates(rule, policy)
+	pm.mu.Unlock()
+	for _, port := range candidates {
+		idx, ok := a.findDeviceByPort(port.CardName, port.PortName, direction)
+		if ok {
+			return idx, true
+		}
+	}
+	logger.Debugf("no available port for app route rule %s", rule.Id)
+	return 0, false
+}
+
+// 判断 sink 是否存在，调用前需要持有 a.mu
+func (a *Audio) hasSink(idx uint32) bool {
+	_, ok := a.sinks[idx]
+	return ok
+}
+
+// 判断 source 是否存在，调用前需要持有 a.mu
+func (a *Audio) hasSource(idx uint32) bool {
+	_, ok := a.sources[idx]
+	return ok
+}
+
+// 记录 sink-input 所在的 sink，识别用户手动移动的 sink-input
+func (a *Audio) trackSinkInput(idx uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if sinkInput, ok := a.sinkInputs[idx]; ok {
+		a.sinkInputRoutes.update(idx, sinkInput.getPropSinkIndex(), a.hasSink)
+	}
+}
+
+// 将匹配规则的 sink-input 移动到规则指定的 sink 上，idx 无效时处理所有的 sink-input
+func (a *Audio) routeSinkInputs(idx *uint32) {
+	if !GetAppRouteKeeper().HasRules(int32(pulse.DirectionSink)) {
+		return
+	}
+
+	moves := make(map[uint32][]uint32) // sink => sink-inputs
+	a.mu.Lock()
+	for _, sinkInput := range a.sinkInputs {
+		if idx != nil && sinkInput.index != *idx {
+			continue
+		}
+		a.sinkInputRoutes.update(sinkInput.index, sinkInput.getPropSinkIndex(), a.hasSink)
+		if a.sinkInputRoutes.isUserMoved(sinkInput.index) {
+			continue
+		}
+		sinkIdx, ok := a.getAppRouteDevice(int32(pulse.DirectionSink), sinkInput.appInfo)
+		if ok && sinkIdx != sinkInput.getPropSinkIndex() {
+			moves[sinkIdx] = append(moves[sinkIdx], sinkInput.index)
+			a.sinkInputRoutes.moving(sinkInput.index, sinkIdx)
+		}
+	}
+	a.mu.Unlock()
+
+	ctx := a.context()
+	if ctx == nil {
+		return
+	}
+	for sinkIdx, list := range moves {
+		logger.Debugf("route sink inputs %v to sink #%d", list, sinkIdx)
+		ctx.MoveSinkInputsByIndex(list, sinkIdx)
+	}
+}
+
+// 将匹配规则的 source-output 移动到规则指定的 source 上，idx 无效时处理所有的 source-output。
+// source-output 的属性需要执行 pactl 获取，不能阻塞 pulse 的事件处理，因此在新的 goroutine 中执行，
+// 多次调用按顺序依次执行。
+func (a *Audio) routeSourceOutputs(idx *uint32) {
+	if !GetAppRouteKeeper().HasRules(int32(pulse.DirectionSource)) {
+		return
+	}
+
+	var index *uint32
+	if idx != nil {
+		i := *idx
+		index = &i
+	}
+	go func() {
+		a.sourceOutputRouteMu.Lock()
+		defer a.sourceOutputRouteMu.Unlock()
+		a.doRouteSourceOutputs(index)
+	}()
+}
+
+func (a *Audio) doRouteSourceOutputs(idx *uint32) {
+	sourceOutputs, err := listSourceOutputs()
+	if err != nil {
+		logger.Warning("failed to list source outputs:", err)
+		return
+	}
+
+	moves := make(map[uint32][]uint32) // source => source-outputs
+	a.mu.Lock()
+	for _, so := range sourceOutputs {
+		if idx != nil && so.index != *idx {
+			continue
+		}
+		// 录制 monitor 的应用由用户自己选择了设备，不做处理
+		if source, ok := a.sources[so.source]; ok && strings.HasSuffix(source.Name, ".monitor") {
+			continue
+		}
+		// source-output 的移动没有缓存的数据可以比较，在每次路由时检查
+		a.sourceOutputRoutes.update(so.index, so.source, a.hasSource)
+		if a.sourceOutputRoutes.isUserMoved(so.index) {
+			continue
+		}
+		sourceIdx, ok := a.getAppRouteDevice(int32(pulse.DirectionSource), newAppStreamInfo(so.propList))
+		if ok && sourceIdx != so.source {
+			moves[sourceIdx] = append(moves[sourceIdx], so.index)
+			a.sourceOutputRoutes.moving(so.index, sourceIdx)
+		}
+	}
+	a.mu.Unlock()
+
+	ctx := a.context()
+	if ctx == nil {
+		return
+	}
+	for sourceIdx, list := range moves {
+		logger.Debugf("route source outputs %v to source #%d", list, sourceIdx)
+		ctx.MoveSourceOutputsByIndex(list, sourceIdx)
+	}
+}
+
+// 设备变化或规则变化后重新路由所有的音频流，用户手动移动到其它设备的音频流保持不变。
+func (a *Audio) applyAppRoutes() {
+	a.routeSinkInputs(nil)
+	a.routeSourceOutputs(nil)
+}
+
+// 添加或修改应用的音频路由规则，rule 是 AppRouteRule 的 json，Id 为空时添加新规则。
+// 规则在音频流创建、设备变化和规则变化时生效，不移动用户手动移动过的音频流。
+func (a *Audio) SetAppRouteRule(rule string) (id string, busErr *dbus.Error) {
+	logger.Infof("dbus call SetAppRouteRule with rule %s", rule)
+
+	var r AppRouteRule
+	err := json.Unmarshal([]byte(rule), &r)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+
+	id, err = GetAppRouteKeeper().SetRule(r)
+	if err != nil {
+		logger.Warning(err)
+		return "", dbusutil.ToError(err)
+	}
+
+	a.applyAppRoutes()
+	return id, nil
+}
+
+func (a *Audio) RemoveAppRouteRule(id string) *dbus.Error {
+	logger.Infof("dbus call RemoveAppRouteRule with id %s", id)
+
+	err := GetAppRouteKeeper().RemoveRule(id)
+	if err != nil {
+		logger.Warning(err)
+		return dbusutil.ToError(err)
+	}
+	return nil
+}
+
+func (a *Audio) GetAppRouteRules() (rules string, busErr *dbus.Error) {
+	return GetAppRouteKeeper().String(), nil
+}
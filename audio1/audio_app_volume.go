@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+func (a *Audio) getSinkInput(idx uint32) (*SinkInput, bool) {
+	a.mu.Lock()
+	sinkInput, ok := a.sinkInputs[idx]
+	a.mu.Unlock()
+	return sinkInput, ok
+}
+
+// 新的 sink-input 恢复应用上次的音量和静音状态
+func (a *Audio) restoreAppVolume(idx uint32) {
+	sinkInput, ok := a.getSinkInput(idx)
+	if !ok || !sinkInput.visible {
+		return
+	}
+	app := sinkInput.appInfo.identity()
+	cfg, ok := GetAppVolumeKeeper().GetAppVolume(app)
+	if !ok {
+		return
+	}
+	ctx := a.context()
+	if ctx == nil {
+		return
+	}
+
+	volume := cfg.Volume
+	if volume > gMaxUIVolume {
+		volume = gMaxUIVolume
+	}
+	sinkInput.PropsMu.Lock()
+	// 恢复前的 change 事件中是默认音量，不能记下来；没有变化时不会有 change 事件
+	sinkInput.volumeRestoring = floatPrecision(sinkInput.Volume) != floatPrecision(volume) ||
+		sinkInput.Mute != cfg.Mute
+	cv := sinkInput.cVolume.SetAvg(volume)
+	sinkInput.PropsMu.Unlock()
+
+	logger.Debugf("restore volume %v and mute %v of app %q for sink-input #%d", volume, cfg.Mute, app, idx)
+	ctx.SetSinkInputVolume(idx, cv)
+	ctx.SetSinkInputMute(idx, cfg.Mute)
+}
+
+// 记住 sink-input 所属应用的音量和静音状态
+func (a *Audio) rememberAppVolume(idx uint32) {
+	sinkInput, ok := a.getSinkInput(idx)
+	if !ok || !sinkInput.visible {
+		return
+	}
+
+	sinkInput.PropsMu.Lock()
+	if sinkInput.volumeRestoring {
+		sinkInput.volumeRestoring = false
+		sinkInput.PropsMu.Unlock()
+		return
+	}
+	name := sinkInput.Name
+	volume := sinkInput.Volume
+	mute := sinkInput.Mute
+	sinkInput.PropsMu.Unlock()
+
+	GetAppVolumeKeeper().SetAppVolume(sinkInput.appInfo.identity(), name, volume, mute)
+}
+
+// 获取记住的应用音量，返回应用标识到 AppVolumeConfig 的 json
+func (a *Audio) GetAppVolumes() (volumes string, busErr *dbus.Error) {
+	return GetAppVolumeKeeper().String(), nil
+}
+
+// 忘记应用的音量，app 为空时忘记所有应用的音量
+func (a *Audio) ResetAppVolume(app string) *dbus.Error {
+	logger.Infof("dbus call ResetAppVolume with app %q", app)
+
+	err := GetAppVolumeKeeper().Reset(app)
+	if err != nil {
+		logger.Warning(err)
+		return dbusutil.ToError(err)
+	}
+	return nil
+}
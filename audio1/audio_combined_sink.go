@@ -0,0 +1,251 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// 查找合并输出当前可用的 sink，端口需要是对应 sink 的当前端口，调用前需要持有 a.mu
+func (a *Audio) getCombinedSinkSlaves(cfg *CombinedSinkConfig) []string {
+	slaves := make([]string, 0, len(cfg.Ports))
+	for _, port := range cfg.Ports {
+		idx, ok := a.findDeviceByPort(port.CardName, port.PortName, int32(pulse.DirectionSink))
+		if ok {
+			slaves = append(slaves, a.sinks[idx].Name)
+		}
+	}
+	return slaves
+}
+
+// 按照当前可用的端口加载、重新加载或卸载合并输出，可用端口少于两个时卸载
+func (a *Audio) applyCombinedSinks() {
+	cm := GetCombinedSinkManager()
+	cm.moduleMu.Lock()
+	defer cm.moduleMu.Unlock()
+
+	for _, cfg := range cm.List() {
+		a.mu.Lock()
+		slaves := a.getCombinedSinkSlaves(&cfg)
+		a.mu.Unlock()
+
+		module, loaded := cm.getModule(cfg.Id)
+		if len(slaves) < 2 {
+			if loaded {
+				logger.Debugf("combined sink %s has less than two available ports", cfg.Id)
+				a.unloadCombinedSink(cfg.Id)
+			}
+			continue
+		}
+		if loaded && strings.Join(module.slaves, ",") == strings.Join(slaves, ",") {
+			continue
+		}
+
+		if loaded {
+			a.unloadCombinedSink(cfg.Id)
+		}
+		err := a.loadCombinedSink(&cfg, slaves)
+		if err != nil {
+			logger.Warningf("failed to load combined sink %s: %v", cfg.Id, err)
+		}
+	}
+}
+
+// 调用前需要持有 cm.moduleMu
+func (a *Audio) loadCombinedSink(cfg *CombinedSinkConfig, slaves []string) error {
+	args := append([]string{"load-module"}, makeCombineSinkArgs(cfg, slaves)...)
+	out, err := exec.Command("pactl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %s", err, out)
+	}
+	logger.Debugf("load combined sink %s on sinks %v", cfg.sinkName(), slaves)
+	// sink 出现后由 handleEvent 加入优先级列表
+	GetCombinedSinkManager().setModule(cfg.Id, &combinedSinkModule{
+		moduleId: strings.TrimSpace(string(out)),
+		slaves:   slaves,
+	})
+	return nil
+}
+
+// 调用前需要持有 cm.moduleMu，卸载后音频流会移动到默认 sink 上
+func (a *Audio) unloadCombinedSink(id string) {
+	cm := GetCombinedSinkManager()
+	module, ok := cm.getModule(id)
+	if !ok {
+		return
+	}
+	logger.Debug("unload combined sink", id)
+	out, err := exec.Command("pactl", "unload-module", module.moduleId).CombinedOutput()
+	if err != nil {
+		logger.Warningf("failed to unload combined sink module %v %s", err, out)
+	}
+	cm.setModule(id, nil)
+}
+
+func (a *Audio) destroyCombinedSinks() {
+	cm := GetCombinedSinkManager()
+	cm.moduleMu.Lock()
+	defer cm.moduleMu.Unlock()
+
+	for _, cfg := range cm.List() {
+		a.unloadCombinedSink(cfg.Id)
+	}
+}
+
+// 模块在 dde-daemon 重启后仍然存在，启动时卸载上次加载的合并输出
+func (a *Audio) cleanupCombinedSinks() {
+	out, err := exec.Command("pactl", "list", "short", "modules").Output()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	for _, id := range findSinkModules(string(out), "module-combine-sink", combinedSinkPrefix) {
+		logger.Debug("unload stale combined sink module", id)
+		out, err := exec.Command("pactl", "unload-module", id).CombinedOutput()
+		if err != nil {
+			logger.Warningf("failed to unload combined sink module %v %s", err, out)
+		}
+	}
+}
+
+// 合并输出的 sink 出现时已经加入了优先级列表，是优先级最高的输出时切换过去
+func (a *Audio) handleCombinedSinkAdded(idx uint32) {
+	a.mu.Lock()
+	sink, ok := a.sinks[idx]
+	a.mu.Unlock()
+	if !ok || !isCombinedSinkName(sink.Name) {
+		return
+	}
+	logger.Debug("combined sink added", sink.Name)
+	a.autoSwitchPort()
+}
+
+// 合并输出没有声卡，直接设置为默认 sink
+func (a *Audio) setDefaultCombinedSink(sinkName string) {
+	if a.getSinkInfoByName(sinkName) == nil {
+		logger.Warningf("combined sink %s not found", sinkName)
+		return
+	}
+	ctx := a.context()
+	if ctx == nil {
+		logger.Warning("failed to get context")
+		return
+	}
+	ctx.SetDefaultSink(sinkName)
+	a.updateDefaultSink(sinkName)
+}
+
+// 同一声卡的端口只有在当前配置文件下各自是一个 sink 的当前端口时才能同时使用，
+// 比如扬声器和 HDMI 通常属于不同的配置文件，无法合并输出，调用前需要持有 a.mu
+func (a *Audio) checkCombinedSinkPorts(cardIds []uint32, portNames []string) error {
+	portCounts := make(map[uint32]int)
+	for _, cardId := range cardIds {
+		portCounts[cardId]++
+	}
+	for i, cardId := range cardIds {
+		if portCounts[cardId] < 2 {
+			continue
+		}
+		if len(a.findSinks(cardId, portNames[i])) == 0 {
+			return fmt.Errorf("port %s can not be used together with other ports of card %d in current profile",
+				portNames[i], cardId)
+		}
+	}
+	return nil
+}
+
+// 创建合并输出，cardIds 和 portNames 一一对应，至少需要两个输出端口
+func (a *Audio) CreateCombinedSink(description string, cardIds []uint32, portNames []string) (id string, busErr *dbus.Error) {
+	logger.Infof("dbus call CreateCombinedSink with description %s, cardIds %v and portNames %v",
+		description, cardIds, portNames)
+
+	if len(cardIds) != len(portNames) {
+		return "", dbusutil.ToError(errors.New("cardIds and portNames have different length"))
+	}
+
+	ports := make([]CombinedSinkPort, len(cardIds))
+	for i, cardId := range cardIds {
+		card, err := a.cards.get(cardId)
+		if err != nil {
+			logger.Warning(err)
+			return "", dbusutil.ToError(err)
+		}
+		_, err = card.Ports.Get(portNames[i], pulse.DirectionSink)
+		if err != nil {
+			logger.Warning(err)
+			return "", dbusutil.ToError(err)
+		}
+		ports[i] = CombinedSinkPort{
+			CardName: card.core.Name,
+			PortName: portNames[i],
+		}
+	}
+
+	a.mu.Lock()
+	err := a.checkCombinedSinkPorts(cardIds, portNames)
+	a.mu.Unlock()
+	if err != nil {
+		logger.Warning(err)
+		return "", dbusutil.ToError(err)
+	}
+
+	id, err = GetCombinedSinkManager().Add(description, ports)
+	if err != nil {
+		logger.Warning(err)
+		return "", dbusutil.ToError(err)
+	}
+
+	a.applyCombinedSinks()
+	return id, nil
+}
+
+func (a *Audio) DestroyCombinedSink(id string) *dbus.Error {
+	logger.Infof("dbus call DestroyCombinedSink with id %s", id)
+
+	cm := GetCombinedSinkManager()
+	err := cm.Remove(id)
+	if err != nil {
+		logger.Warning(err)
+		return dbusutil.ToError(err)
+	}
+
+	cm.moduleMu.Lock()
+	a.unloadCombinedSink(id)
+	cm.moduleMu.Unlock()
+	return nil
+}
+
+// 获取所有的合并输出，返回 CombinedSinkConfig 列表的 json
+func (a *Audio) GetCombinedSinks() (sinks string, busErr *dbus.Error) {
+	return GetCombinedSinkManager().String(), nil
+}
+
+// 将合并输出设为优先级最高的输出
+func (a *Audio) SetCombinedSinkPreferred(id string) *dbus.Error {
+	logger.Infof("dbus call SetCombinedSinkPreferred with id %s", id)
+
+	cfg := CombinedSinkConfig{Id: id}
+	name := cfg.sinkName()
+	pm := GetPriorityManager()
+	pm.mu.Lock()
+	index := pm.Output.FindPortIndex(name, name)
+	pm.mu.Unlock()
+	if index < 0 {
+		err := fmt.Errorf("combined sink %q is not available", id)
+		logger.Warning(err)
+		return dbusutil.ToError(err)
+	}
+
+	pm.SetFirstOutputPort(name, name)
+	a.autoSwitchPort()
+	return nil
+}
@@ -0,0 +1,319 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// 当前加载的均衡器
+type equalizerState struct {
+	mu       sync.Mutex
+	master   string    // 均衡器输出到的 sink
+	key      string    // 加载时的配置，用于判断是否需要重新加载
+	moduleId string    // PulseAudio 下 module-ladspa-sink 的索引
+	cmd      *exec.Cmd // PipeWire 下运行 filter-chain 的进程
+}
+
+func (a *Audio) isPipeWire() bool {
+	a.PropsMu.RLock()
+	defer a.PropsMu.RUnlock()
+	return a.CurrentAudioServer == strings.Split(pipewireService, ".")[0]
+}
+
+func (a *Audio) getEqualizerMaster() string {
+	a.equalizer.mu.Lock()
+	defer a.equalizer.mu.Unlock()
+	return a.equalizer.master
+}
+
+// 按照 master 当前端口的配置加载或卸载均衡器
+func (a *Audio) applyEqualizer(master *Sink) {
+	if master == nil {
+		return
+	}
+	master.PropsMu.RLock()
+	name := master.Name
+	cardId := master.Card
+	portName := master.ActivePort.Name
+	master.PropsMu.RUnlock()
+	if portName == "" || !isPhysicalDevice(name) {
+		return
+	}
+
+	eq := GetConfigKeeper().GetEqualizer(a.getCardNameById(cardId), portName)
+	a.equalizer.mu.Lock()
+	defer a.equalizer.mu.Unlock()
+
+	if !eq.Enabled || eq.isFlat() {
+		a.unloadEqualizer()
+		return
+	}
+
+	pipewire := a.isPipeWire()
+	key := fmt.Sprintf("%v %s %s", pipewire, name, toJSON(eq.Bands))
+	if key == a.equalizer.key {
+		// 默认 sink 被切换到了主设备上，重新切回均衡器
+		ctx := a.context()
+		if ctx != nil && ctx.GetDefaultSink() != equalizerSinkName && a.getSinkInfoByName(equalizerSinkName) != nil {
+			logger.Debug("set default sink back to equalizer")
+			ctx.SetDefaultSink(equalizerSinkName)
+		}
+		return
+	}
+
+	a.unloadEqualizer()
+	var err error
+	if pipewire {
+		err = a.loadEqualizerFilterChain(eq, name)
+	} else {
+		err = a.loadEqualizerLadspa(eq, name)
+	}
+	if err != nil {
+		logger.Warning("failed to load equalizer:", err)
+		return
+	}
+	logger.Debugf("load equalizer on sink %s, preset %s", name, eq.Preset)
+	// 均衡器的 sink 出现后在 handleSinkAdded 中设置为默认 sink
+	a.equalizer.master = name
+	a.equalizer.key = key
+}
+
+// 调用前需要持有 a.equalizer.mu
+func (a *Audio) loadEqualizerLadspa(eq *EqualizerConfig, master string) error {
+	args := append([]string{"load-module"}, makeEqualizerLadspaArgs(eq, master)...)
+	out, err := exec.Command("pactl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %s", err, out)
+	}
+	a.equalizer.moduleId = strings.TrimSpace(string(out))
+	return nil
+}
+
+// 调用前需要持有 a.equalizer.mu
+func (a *Audio) loadEqualizerFilterChain(eq *EqualizerConfig, master string) error {
+	dir, err := basedir.GetUserRuntimeDir(false)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, "dde-equalizer.conf")
+	err = os.WriteFile(file, []byte(makeEqualizerFilterChainConfig(eq, master)), 0600)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("pipewire", "-c", file)
+	// dde-daemon 退出时结束 filter-chain
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	return a.startEqualizerProcess(cmd)
+}
+
+// 启动运行 filter-chain 的进程，进程意外退出时清除均衡器的状态，下次应用配置时重新加载。
+// Pdeathsig 在创建子进程的线程退出时就会触发，因此在锁定线程的 goroutine 中启动进程，直到进程退出。
+// 调用前需要持有 a.equalizer.mu
+func (a *Audio) startEqualizerProcess(cmd *exec.Cmd) error {
+	started := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		err := cmd.Start()
+		started <- err
+		if err != nil {
+			return
+		}
+		err = cmd.Wait()
+		logger.Debug("equalizer filter-chain exited:", err)
+		a.handleEqualizerProcessExited(cmd)
+	}()
+
+	err := <-started
+	if err != nil {
+		return err
+	}
+	a.equalizer.cmd = cmd
+	return nil
+}
+
+func (a *Audio) handleEqualizerProcessExited(cmd *exec.Cmd) {
+	a.equalizer.mu.Lock()
+	defer a.equalizer.mu.Unlock()
+	// 卸载均衡器时结束的进程
+	if a.equalizer.cmd != cmd {
+		return
+	}
+	logger.Warning("equalizer filter-chain exited unexpectedly")
+	a.equalizer.cmd = nil
+	a.unloadEqualizer()
+}
+
+// 调用前需要持有 a.equalizer.mu
+func (a *Audio) unloadEqualizer() {
+	if a.equalizer.key == "" {
+		return
+	}
+	logger.Debug("unload equalizer on sink", a.equalizer.master)
+
+	// 先把默认 sink 切回主设备，卸载后音频流会移动到默认 sink 上
+	ctx := a.context()
+	if ctx != nil && ctx.GetDefaultSink() == equalizerSinkName {
+		ctx.SetDefaultSink(a.equalizer.master)
+	}
+
+	if a.equalizer.cmd != nil {
+		err := a.equalizer.cmd.Process.Signal(syscall.SIGTERM)
+		if err != nil {
+			logger.Warning(err)
+		}
+		a.equalizer.cmd = nil
+	}
+	if a.equalizer.moduleId != "" {
+		out, err := exec.Command("pactl", "unload-module", a.equalizer.moduleId).CombinedOutput()
+		if err != nil {
+			logger.Warningf("failed to unload equalizer module %v %s", err, out)
+		}
+		a.equalizer.moduleId = ""
+	}
+	a.equalizer.master = ""
+	a.equalizer.key = ""
+}
+
+func (a *Audio) destroyEqualizer() {
+	a.equalizer.mu.Lock()
+	a.unloadEqualizer()
+	a.equalizer.mu.Unlock()
+}
+
+// PulseAudio 的模块在 dde-daemon 重启后仍然存在，启动时卸载上次加载的均衡器
+func (a *Audio) cleanupEqualizer() {
+	if a.isPipeWire() {
+		return
+	}
+	out, err := exec.Command("pactl", "list", "short", "modules").Output()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	for _, id := range findSinkModules(string(out), "module-ladspa-sink", equalizerSinkName) {
+		logger.Debug("unload stale equalizer module", id)
+		out, err := exec.Command("pactl", "unload-module", id).CombinedOutput()
+		if err != nil {
+			logger.Warningf("failed to unload equalizer module %v %s", err, out)
+		}
+	}
+}
+
+// 均衡器的 sink 出现后设置为默认 sink
+func (a *Audio) handleEqualizerSinkAdded(idx uint32) {
+	a.mu.Lock()
+	sink, ok := a.sinks[idx]
+	a.mu.Unlock()
+	if !ok || sink.Name != equalizerSinkName || a.getEqualizerMaster() == "" {
+		return
+	}
+	ctx := a.context()
+	if ctx == nil {
+		return
+	}
+	logger.Debug("equalizer sink added, set it as default sink")
+	ctx.SetDefaultSink(equalizerSinkName)
+}
+
+func (s *Sink) getEqualizerPort() (cardName string, portName string, err error) {
+	s.PropsMu.RLock()
+	name := s.Name
+	cardId := s.Card
+	portName = s.ActivePort.Name
+	s.PropsMu.RUnlock()
+
+	if !isPhysicalDevice(name) {
+		return "", "", errors.New("equalizer is not supported on virtual sink")
+	}
+	if portName == "" {
+		return "", "", errors.New("sink has no active port")
+	}
+	return s.audio.getCardNameById(cardId), portName, nil
+}
+
+// 修改当前端口的均衡器配置，当前是默认输出设备时立即生效
+func (s *Sink) updateEqualizer(fn func(eq *EqualizerConfig) error) *dbus.Error {
+	cardName, portName, err := s.getEqualizerPort()
+	if err != nil {
+		logger.Warning(err)
+		return dbusutil.ToError(err)
+	}
+
+	eq := GetConfigKeeper().GetEqualizer(cardName, portName)
+	err = fn(eq)
+	if err != nil {
+		logger.Warning(err)
+		return dbusutil.ToError(err)
+	}
+	GetConfigKeeper().SetEqualizer(cardName, portName, eq)
+
+	if s.audio.getDefaultSink() == s {
+		s.audio.applyEqualizer(s)
+	}
+	return nil
+}
+
+// 获取均衡器的预设
+func (s *Sink) GetEqualizerPresets() (presets []string, busErr *dbus.Error) {
+	return append([]string(nil), equalizerPresetNames...), nil
+}
+
+// 获取当前端口的均衡器配置，返回 EqualizerConfig 的 json
+func (s *Sink) GetEqualizer() (equalizer string, busErr *dbus.Error) {
+	cardName, portName, err := s.getEqualizerPort()
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	data, err := json.Marshal(GetConfigKeeper().GetEqualizer(cardName, portName))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+func (s *Sink) SetEqualizerEnabled(enabled bool) *dbus.Error {
+	logger.Infof("dbus call SetEqualizerEnabled with enabled %t, the sink name is %s", enabled, s.Name)
+
+	return s.updateEqualizer(func(eq *EqualizerConfig) error {
+		eq.Enabled = enabled
+		return nil
+	})
+}
+
+func (s *Sink) SetEqualizerPreset(preset string) *dbus.Error {
+	logger.Infof("dbus call SetEqualizerPreset with preset %s, the sink name is %s", preset, s.Name)
+
+	return s.updateEqualizer(func(eq *EqualizerConfig) error {
+		return eq.setPreset(preset)
+	})
+}
+
+func (s *Sink) SetEqualizerBand(index int32, freq float64, gain float64, q float64) *dbus.Error {
+	logger.Infof("dbus call SetEqualizerBand with index %d, freq %v, gain %v and q %v, the sink name is %s",
+		index, freq, gain, q, s.Name)
+
+	return s.updateEqualizer(func(eq *EqualizerConfig) error {
+		return eq.setBand(int(index), EqualizerBand{
+			Freq: freq,
+			Gain: gain,
+			Q:    q,
+		})
+	})
+}
@@ -40,6 +40,7 @@ FOR:
 // 事件分发
 func (a *Audio) dispatchEvents(events []*pulse.Event) {
 	logger.Debugf("dispatch %d events", len(events))
+	devicesChanged := false
 	for i, event := range events {
 		logger.Debugf("dispatch %dth event: type<%d> index<%d>", i, event.Type, event.Index)
 		switch event.Facility {
@@ -49,16 +50,26 @@ func (a *Audio) dispatchEvents(events []*pulse.Event) {
 		case pulse.FacilityCard:
 			a.handleCardEvent(event.Type, event.Index)
 			a.saveConfig()
+			devicesChanged = true
 		case pulse.FacilitySink:
 			a.handleSinkEvent(event.Type, event.Index)
 			a.saveConfig()
+			devicesChanged = devicesChanged || event.Type != pulse.EventTypeChange
 		case pulse.FacilitySource:
 			a.handleSourceEvent(event.Type, event.Index)
 			a.saveConfig()
+			devicesChanged = devicesChanged || event.Type != pulse.EventTypeChange
 		case pulse.FacilitySinkInput:
 			a.handleSinkInputEvent(event.Type, event.Index)
+		case pulse.FacilitySourceOutput:
+			a.handleSourceOutputEvent(event.Type, event.Index)
 		}
 	}
+	// 设备增删或声卡端口变化后，应用路由规则和合并输出指定的端口可能变得可用或不可用
+	if devicesChanged {
+		a.applyAppRoutes()
+		a.applyCombinedSinks()
+	}
 	logger.Debug("dispatch events done")
 }
 
@@ -125,8 +136,7 @@ func (a *Audio) needAutoSwitchInputPort() bool {
 		return false
 	}
 
-	inputs := GetPriorityManager().Input
-	firstPort := inputs.GetTheFirstPort()
+	firstPort := GetPriorityManager().getFirstInputPort()
 
 	// 没有可用端口
 	if firstPort.PortType == PortTypeInvalid {
@@ -188,6 +198,15 @@ func (a *Audio) needAutoSwitchOutputPort() bool {
 		return false
 	}
 
+	// 合并输出没有声卡和端口，按照 sink 名称判断
+	if isCombinedSinkName(firstPort.CardName) {
+		if a.defaultSink.Name == firstPort.CardName {
+			logger.Debugf("current output %s is already the first", firstPort.CardName)
+			return false
+		}
+		return a.getSinkInfoByName(firstPort.CardName) != nil
+	}
+
 	// 当前端口就是优先级最高的端口
 	currentCardName := a.getCardNameById(a.defaultSink.Card)
 	currentPortName := a.defaultSink.ActivePort.Name
@@ -208,7 +227,10 @@ func (a *Audio) autoSwitchPort() {
 		firstOutput := a.tryGetPreferOutPut()
 		card, err := a.cards.getByName(firstOutput.CardName)
 
-		if err == nil {
+		if isCombinedSinkName(firstOutput.CardName) {
+			logger.Warningf("auto switch output to combined sink %s", firstOutput.CardName)
+			a.setDefaultCombinedSink(firstOutput.CardName)
+		} else if err == nil {
 			logger.Warningf("auto switch output to #%d %s:%s", card.Id, card.core.Name, firstOutput.PortName)
 			a.setPort(card.Id, firstOutput.PortName, pulse.DirectionSink)
 		} else {
@@ -227,8 +249,7 @@ func (a *Audio) autoSwitchPort() {
 
 	if a.needAutoSwitchInputPort() {
 		logger.Warning("auto switch input")
-		inputs := GetPriorityManager().Input
-		firstInput := inputs.GetTheFirstPort()
+		firstInput := GetPriorityManager().getFirstInputPort()
 		card, err := a.cards.getByName(firstInput.CardName)
 
 		if err == nil {
@@ -331,6 +352,8 @@ func (a *Audio) handleSinkEvent(eventType int, idx uint32) {
 func (a *Audio) handleSinkAdded(idx uint32) {
 	// 数据更新在refreshSinks中统一处理，这里只做业务逻辑上的响应
 	logger.Debugf("sink %d added", idx)
+	a.handleEqualizerSinkAdded(idx)
+	a.handleCombinedSinkAdded(idx)
 }
 
 func (a *Audio) handleSinkRemoved(idx uint32) {
@@ -406,17 +429,37 @@ func (a *Audio) handleSinkInputEvent(eventType int, idx uint32) {
 func (a *Audio) handleSinkInputAdded(idx uint32) {
 	// 数据更新在refreshSinkInputs中统一处理，这里只做业务逻辑上的响应
 	logger.Debugf("sink-input %d added", idx)
+	a.restoreAppVolume(idx)
+	a.routeSinkInputs(&idx)
 }
 
 func (a *Audio) handleSinkInputRemoved(idx uint32) {
 	// 数据更新在refreshSinkInputs中统一处理，这里只做业务逻辑上的响应
 	// 注意，此时idx已经失效了，无法获取已经失去的数据，如果业务需要，应当在refresh前进行数据备份
 	logger.Debugf("sink-input %d removed", idx)
+	a.mu.Lock()
+	a.sinkInputRoutes.remove(idx)
+	a.mu.Unlock()
 }
 
 func (a *Audio) handleSinkInputChanged(idx uint32) {
 	// 数据更新在refreshSinkInputs中统一处理，这里只做业务逻辑上的响应
 	logger.Debugf("sink-input %d changed", idx)
+	a.rememberAppVolume(idx)
+	a.trackSinkInput(idx)
+}
+
+func (a *Audio) handleSourceOutputEvent(eventType int, idx uint32) {
+	// source-output 没有缓存数据，只处理新增和删除的情况
+	switch eventType {
+	case pulse.EventTypeNew:
+		logger.Debugf("source-output %d added", idx)
+		a.routeSourceOutputs(&idx)
+	case pulse.EventTypeRemove:
+		a.mu.Lock()
+		a.sourceOutputRoutes.remove(idx)
+		a.mu.Unlock()
+	}
 }
 
 /* 创建开启端口的命令，提供给notification调用 */
@@ -509,6 +552,7 @@ func (a *Audio) updatePropSinkInputs() {
 func isPhysicalDevice(deviceName string) bool {
 	for _, virtualDeviceKey := range []string{
 		"echoCancelSource", "echo-cancel", "Echo-Cancel", // virtual key
+		equalizerSinkName,
 	} {
 		if strings.Contains(deviceName, virtualDeviceKey) {
 			return false
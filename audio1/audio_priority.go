@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// 修改优先级后保存，并按照新的优先级切换端口
+func (a *Audio) updatePriorityPolicy(direction int32, fn func(pp *PriorityPolicy) error) *dbus.Error {
+	pm := GetPriorityManager()
+	err := pm.update(int(direction), fn)
+	if err != nil {
+		logger.Warning(err)
+		return dbusutil.ToError(err)
+	}
+
+	pm.Print()
+	pm.Save()
+	a.autoSwitchPort()
+	return nil
+}
+
+// 获取输入输出的优先级，返回 PriorityManager 的 json
+func (a *Audio) GetPortPriorities() (priorities string, busErr *dbus.Error) {
+	return GetPriorityManager().toJSON(), nil
+}
+
+// 调整端口优先级，ports 是 PriorityPort 列表的 json，只需要 CardName 和 PortName
+func (a *Audio) SetPortPriorities(direction int32, ports string) *dbus.Error {
+	logger.Infof("dbus call SetPortPriorities with direction %d and ports %s", direction, ports)
+
+	var order PriorityPortList
+	err := json.Unmarshal([]byte(ports), &order)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	for _, p := range order {
+		if p == nil {
+			return dbusutil.ToError(errors.New("invalid port"))
+		}
+	}
+
+	return a.updatePriorityPolicy(direction, func(pp *PriorityPolicy) error {
+		return pp.SetPortOrder(order)
+	})
+}
+
+// 固定端口，固定的端口可用时总是优先被选择，端口可以是当前未插入的设备
+func (a *Audio) SetPortPinned(direction int32, cardName string, portName string, pinned bool) *dbus.Error {
+	logger.Infof("dbus call SetPortPinned with direction %d, cardName %s, portName %s and pinned %t",
+		direction, cardName, portName, pinned)
+
+	if cardName == "" || portName == "" {
+		return dbusutil.ToError(errors.New("card name and port name must not be empty"))
+	}
+	return a.updatePriorityPolicy(direction, func(pp *PriorityPolicy) error {
+		pp.SetPortPinned(cardName, portName, pinned)
+		return nil
+	})
+}
+
+// 屏蔽端口，屏蔽的端口不会被自动选择，通过 SetPort 主动选择时取消屏蔽
+func (a *Audio) SetPortBlocked(direction int32, cardName string, portName string, blocked bool) *dbus.Error {
+	logger.Infof("dbus call SetPortBlocked with direction %d, cardName %s, portName %s and blocked %t",
+		direction, cardName, portName, blocked)
+
+	if cardName == "" || portName == "" {
+		return dbusutil.ToError(errors.New("card name and port name must not be empty"))
+	}
+	return a.updatePriorityPolicy(direction, func(pp *PriorityPolicy) error {
+		pp.SetPortBlocked(cardName, portName, blocked)
+		return nil
+	})
+}
+
+// 模拟拔出设备后会选择的端口，portName 为空时表示拔出整个声卡，返回 PriorityPort 的 json，
+// 没有可用端口时 PortType 为 PortTypeInvalid
+func (a *Audio) SimulateUnplug(direction int32, cardName string, portName string) (port string, busErr *dbus.Error) {
+	var policy *PriorityPolicy
+	err := GetPriorityManager().update(int(direction), func(pp *PriorityPolicy) error {
+		policy = pp.simulateRemove(cardName, portName)
+		return nil
+	})
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+
+	// 输出端口与自动切换时相同，考虑声卡配置中期望的端口
+	var p PriorityPort
+	if int(direction) == pulse.DirectionSink {
+		p = a.getPreferOutPut(policy)
+	} else {
+		p = policy.GetTheFirstPort()
+	}
+	logger.Debugf("if <%s:%s> is unplugged, <%s:%s> will be selected", cardName, portName, p.CardName, p.PortName)
+	return toJSON(p), nil
+}
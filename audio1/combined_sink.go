@@ -0,0 +1,281 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// 合并输出，使用 module-combine-sink 将音频同时输出到多个端口，
+// PipeWire 下由 pipewire-pulse 提供相同的模块。
+// 合并输出的 sink 没有声卡，在优先级列表中使用 sink 名称作为 CardName 和 PortName。
+
+const combinedSinkPrefix = "dde_combined_"
+
+type CombinedSinkPort struct {
+	CardName string // pulse.Card.Name
+	PortName string // pulse.CardPortInfo.Name
+}
+
+type CombinedSinkConfig struct {
+	Id          string
+	Description string
+	Ports       []CombinedSinkPort
+}
+
+// 已经加载的合并输出模块
+type combinedSinkModule struct {
+	moduleId string
+	slaves   []string // 加载时使用的 sink，变化时需要重新加载
+}
+
+func isCombinedSinkName(name string) bool {
+	return strings.HasPrefix(name, combinedSinkPrefix)
+}
+
+func (cfg *CombinedSinkConfig) sinkName() string {
+	return combinedSinkPrefix + cfg.Id
+}
+
+func (cfg *CombinedSinkConfig) check() error {
+	if len(cfg.Ports) < 2 {
+		return errors.New("combined sink needs at least two ports")
+	}
+	for i, port := range cfg.Ports {
+		if port.CardName == "" || port.PortName == "" {
+			return errors.New("card name and port name of combined sink must not be empty")
+		}
+		for _, p := range cfg.Ports[:i] {
+			if p == port {
+				return fmt.Errorf("duplicate port <%s:%s> in combined sink", port.CardName, port.PortName)
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg *CombinedSinkConfig) clone() CombinedSinkConfig {
+	c := *cfg
+	c.Ports = append([]CombinedSinkPort(nil), cfg.Ports...)
+	return c
+}
+
+// 加载 module-combine-sink 的参数，描述中的引号会破坏参数解析，需要去掉
+func makeCombineSinkArgs(cfg *CombinedSinkConfig, slaves []string) []string {
+	description := strings.NewReplacer(`"`, "", "'", "", `\`, "").Replace(cfg.Description)
+	if description == "" {
+		description = "Combined Output"
+	}
+	return []string{
+		"module-combine-sink",
+		"sink_name=" + cfg.sinkName(),
+		"slaves=" + strings.Join(slaves, ","),
+		"sink_properties=\"device.description='" + description + "'\"",
+	}
+}
+
+type CombinedSinkManager struct {
+	Sinks   []*CombinedSinkConfig
+	file    string                         // 配置文件路径
+	modules map[string]*combinedSinkModule // Id => 已加载的模块，不保存
+	mu      sync.Mutex
+
+	moduleMu sync.Mutex // 串行化模块的加载和卸载
+}
+
+func NewCombinedSinkManager(path string) *CombinedSinkManager {
+	return &CombinedSinkManager{
+		Sinks:   make([]*CombinedSinkConfig, 0),
+		file:    path,
+		modules: make(map[string]*combinedSinkModule),
+	}
+}
+
+// 创建单例
+func createCombinedSinkManagerSingleton(path string) func() *CombinedSinkManager {
+	var cm *CombinedSinkManager = nil
+	return func() *CombinedSinkManager {
+		if cm == nil {
+			cm = NewCombinedSinkManager(path)
+		}
+		return cm
+	}
+}
+
+// 获取单例，配置文件和 ConfigKeeper 的放在一起
+var globalCombinedSinkManagerFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/audio-combined-sinks.json")
+var GetCombinedSinkManager = createCombinedSinkManagerSingleton(globalCombinedSinkManagerFile)
+
+// 调用前需要持有 cm.mu
+func (cm *CombinedSinkManager) save() error {
+	data, err := json.MarshalIndent(cm.Sinks, "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(cm.file), 0755) // #nosec G301
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.WriteFile(cm.file, data, 0644) // #nosec G306
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	return nil
+}
+
+func (cm *CombinedSinkManager) Load() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	data, err := os.ReadFile(cm.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return err
+	}
+
+	var sinks []*CombinedSinkConfig
+	err = json.Unmarshal(data, &sinks)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	cm.Sinks = cm.Sinks[:0]
+	for _, cfg := range sinks {
+		if cfg == nil {
+			continue
+		}
+		if _, err := strconv.Atoi(cfg.Id); err != nil {
+			logger.Warningf("ignore combined sink with invalid id %q", cfg.Id)
+			continue
+		}
+		if err := cfg.check(); err != nil {
+			logger.Warningf("ignore combined sink %q: %v", cfg.Id, err)
+			continue
+		}
+		cm.Sinks = append(cm.Sinks, cfg)
+	}
+	return nil
+}
+
+// 调用前需要持有 cm.mu
+func (cm *CombinedSinkManager) nextId() string {
+	maxId := 0
+	for _, cfg := range cm.Sinks {
+		id, err := strconv.Atoi(cfg.Id)
+		if err == nil && id > maxId {
+			maxId = id
+		}
+	}
+	return strconv.Itoa(maxId + 1)
+}
+
+// Add 添加合并输出，返回分配的 Id
+func (cm *CombinedSinkManager) Add(description string, ports []CombinedSinkPort) (string, error) {
+	cfg := &CombinedSinkConfig{
+		Description: description,
+		Ports:       ports,
+	}
+	err := cfg.check()
+	if err != nil {
+		return "", err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg.Id = cm.nextId()
+	cm.Sinks = append(cm.Sinks, cfg)
+	return cfg.Id, cm.save()
+}
+
+// Remove 删除合并输出，模块需要调用方先卸载
+func (cm *CombinedSinkManager) Remove(id string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for i, cfg := range cm.Sinks {
+		if cfg.Id == id {
+			cm.Sinks = append(cm.Sinks[:i], cm.Sinks[i+1:]...)
+			return cm.save()
+		}
+	}
+	return fmt.Errorf("combined sink %q not found", id)
+}
+
+// List 返回所有合并输出配置的副本
+func (cm *CombinedSinkManager) List() []CombinedSinkConfig {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	list := make([]CombinedSinkConfig, len(cm.Sinks))
+	for i, cfg := range cm.Sinks {
+		list[i] = cfg.clone()
+	}
+	return list
+}
+
+func (cm *CombinedSinkManager) getModule(id string) (combinedSinkModule, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	module, ok := cm.modules[id]
+	if !ok {
+		return combinedSinkModule{}, false
+	}
+	return *module, true
+}
+
+func (cm *CombinedSinkManager) setModule(id string, module *combinedSinkModule) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if module == nil {
+		delete(cm.modules, id)
+		return
+	}
+	cm.modules[id] = module
+}
+
+// 已加载的合并输出作为输出端口参与优先级排序
+func (cm *CombinedSinkManager) priorityPorts() PriorityPortList {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	ports := make(PriorityPortList, 0, len(cm.modules))
+	for _, cfg := range cm.Sinks {
+		if _, ok := cm.modules[cfg.Id]; !ok {
+			continue
+		}
+		ports = append(ports, &PriorityPort{
+			CardName: cfg.sinkName(),
+			PortName: cfg.sinkName(),
+			PortType: PortTypeCombined,
+		})
+	}
+	return ports
+}
+
+func (cm *CombinedSinkManager) String() string {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return toJSON(cm.Sinks)
+}
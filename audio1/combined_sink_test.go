@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CombinedSinkConfig(t *testing.T) {
+	cfg := &CombinedSinkConfig{
+		Id:          "1",
+		Description: `Speaker "and" HDMI`,
+		Ports: []CombinedSinkPort{
+			{CardName: "alsa_card.pci", PortName: "analog-output-speaker"},
+			{CardName: "alsa_card.pci", PortName: "hdmi-output-0"},
+		},
+	}
+	assert.NoError(t, cfg.check())
+	assert.Equal(t, "dde_combined_1", cfg.sinkName())
+	assert.True(t, isCombinedSinkName(cfg.sinkName()))
+	assert.False(t, isCombinedSinkName("alsa_output.pci.analog-stereo"))
+
+	args := makeCombineSinkArgs(cfg, []string{"alsa_output.pci.analog-stereo", "alsa_output.pci.hdmi-stereo"})
+	assert.Equal(t, []string{
+		"module-combine-sink",
+		"sink_name=dde_combined_1",
+		"slaves=alsa_output.pci.analog-stereo,alsa_output.pci.hdmi-stereo",
+		`sink_properties="device.description='Speaker and HDMI'"`,
+	}, args)
+
+	cfg.Ports = append(cfg.Ports, cfg.Ports[0])
+	assert.Error(t, cfg.check())
+	cfg.Ports = cfg.Ports[:1]
+	assert.Error(t, cfg.check())
+}
+
+func Test_CombinedSinkManager(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audio-combined-sinks.json")
+	cm := NewCombinedSinkManager(file)
+
+	ports := []CombinedSinkPort{
+		{CardName: "alsa_card.pci", PortName: "analog-output-speaker"},
+		{CardName: "alsa_card.usb", PortName: "analog-output"},
+	}
+	id, err := cm.Add("Speaker + USB", ports)
+	require.NoError(t, err)
+	assert.Equal(t, "1", id)
+	_, err = cm.Add("invalid", ports[:1])
+	assert.Error(t, err)
+
+	cm2 := NewCombinedSinkManager(file)
+	require.NoError(t, cm2.Load())
+	list := cm2.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, ports, list[0].Ports)
+
+	// 只有已加载的合并输出参与优先级排序
+	assert.Empty(t, cm2.priorityPorts())
+	cm2.setModule("1", &combinedSinkModule{moduleId: "30"})
+	pp := cm2.priorityPorts()
+	require.Len(t, pp, 1)
+	assert.Equal(t, "dde_combined_1", pp[0].CardName)
+	assert.Equal(t, PortTypeCombined, pp[0].PortType)
+
+	assert.NoError(t, cm2.Remove("1"))
+	assert.Error(t, cm2.Remove("1"))
+	assert.Empty(t, cm2.priorityPorts())
+}
+
+func Test_FindCombinedSinkModules(t *testing.T) {
+	modules := "0\tmodule-device-restore\t\t\n" +
+		"30\tmodule-combine-sink\tsink_name=dde_combined_1 slaves=a,b sink_properties=\"device.description='x'\"\t\n" +
+		"31\tmodule-combine-sink\tsink_name=combined\t\n"
+	assert.Equal(t, []string{"30"}, findSinkModules(modules, "module-combine-sink", combinedSinkPrefix))
+}
+
+func Test_checkCombinedSinkPorts(t *testing.T) {
+	a := &Audio{
+		sinks: map[uint32]*Sink{
+			1: {Card: 0, ActivePort: Port{Name: "analog-output-speaker"}},
+			2: {Card: 1, ActivePort: Port{Name: "analog-output"}},
+		},
+	}
+	// 不同声卡的端口可以在之后可用时再加载
+	assert.NoError(t, a.checkCombinedSinkPorts([]uint32{0, 2}, []string{"analog-output-speaker", "hdmi-output-0"}))
+	// 扬声器和 HDMI 在同一声卡上没有同时存在的 sink
+	assert.Error(t, a.checkCombinedSinkPorts([]uint32{0, 0}, []string{"analog-output-speaker", "hdmi-output-0"}))
+
+	a.sinks[3] = &Sink{Card: 0, ActivePort: Port{Name: "hdmi-output-0"}}
+	assert.NoError(t, a.checkCombinedSinkPorts([]uint32{0, 0, 1}, []string{"analog-output-speaker", "hdmi-output-0", "analog-output"}))
+}
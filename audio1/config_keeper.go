@@ -21,8 +21,9 @@ type PortConfig struct {
 	IncreaseVolume bool
 	Balance        float64
 	ReduceNoise    bool
-	Mute           bool   // 静音改为全局，此配置废弃
-	PreferProfile  string //优先设置的配置文件
+	Mute           bool             // 静音改为全局，此配置废弃
+	PreferProfile  string           //优先设置的配置文件
+	Equalizer      *EqualizerConfig // 均衡器，只用于输出端口
 }
 
 type CardConfig struct {
@@ -105,6 +106,7 @@ func NewPortConfig(name string) *PortConfig {
 		Balance:        0.0,
 		ReduceNoise:    defaultReduceNoise,
 		Mute:           false,
+		Equalizer:      NewEqualizerConfig(),
 	}
 }
 
@@ -273,6 +275,29 @@ func (ck *ConfigKeeper) SetReduceNoise(cardName string, portName string, reduce
 	ck.Save()
 }
 
+func (ck *ConfigKeeper) SetEqualizer(cardName string, portName string, eq *EqualizerConfig) {
+	ck.mu.Lock()
+	defer ck.mu.Unlock()
+
+	_, port := ck.GetCardAndPortConfig(cardName, portName)
+	port.Equalizer = eq.clone()
+	ck.Save()
+}
+
+// 返回端口均衡器配置的副本，旧版本的配置中没有均衡器
+func (ck *ConfigKeeper) GetEqualizer(cardName string, portName string) *EqualizerConfig {
+	ck.mu.Lock()
+	defer ck.mu.Unlock()
+
+	_, port := ck.GetCardAndPortConfig(cardName, portName)
+	if port.Equalizer == nil {
+		return NewEqualizerConfig()
+	}
+	eq := port.Equalizer.clone()
+	eq.fix()
+	return eq
+}
+
 func (ck *ConfigKeeper) SetMuteOutput(mute bool) {
 	ck.mu.Lock()
 	defer ck.mu.Unlock()
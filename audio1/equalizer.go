@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 系统均衡器，每个输出端口一套配置，保存在 ConfigKeeper 中。
+// PipeWire 下使用 filter-chain 的 bq_peaking 实现 10 段参数均衡器，
+// PulseAudio 下使用 module-ladspa-sink 加载 caps 的 Eq10，频点固定，只有增益生效。
+
+const (
+	equalizerSinkName     = "dde_equalizer"
+	equalizerBandCount    = 10
+	equalizerPresetFlat   = "flat"
+	equalizerPresetCustom = "custom"
+
+	equalizerMinFreq  = 20.0
+	equalizerMaxFreq  = 20000.0
+	equalizerMinGain  = -24.0
+	equalizerMaxGain  = 24.0
+	equalizerMinQ     = 0.1
+	equalizerMaxQ     = 10.0
+	equalizerDefaultQ = 1.41 // 一个倍频程的带宽
+)
+
+var equalizerFreqs = [equalizerBandCount]float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// 预设的各频段增益，单位 dB
+var equalizerPresets = map[string][equalizerBandCount]float64{
+	equalizerPresetFlat: {0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	"bass":              {6, 5, 4, 2, 0, 0, 0, 0, 0, 0},
+	"treble":            {0, 0, 0, 0, 0, 0, 2, 4, 5, 6},
+	"rock":              {5, 4, 3, 1, -1, -1, 1, 3, 4, 5},
+	"pop":               {-1, 1, 3, 4, 3, 0, -1, -1, 0, 1},
+	"jazz":              {3, 2, 1, 2, -1, -1, 0, 1, 2, 3},
+	"classical":         {4, 3, 2, 1, 0, 0, 0, 1, 2, 3},
+	"vocal":             {-2, -1, 0, 2, 4, 4, 3, 1, 0, -1},
+}
+
+// 预设的显示顺序
+var equalizerPresetNames = []string{equalizerPresetFlat, "bass", "treble", "rock", "pop", "jazz", "classical", "vocal"}
+
+type EqualizerBand struct {
+	Freq float64 // 中心频率，Hz
+	Gain float64 // 增益，dB
+	Q    float64
+}
+
+type EqualizerConfig struct {
+	Enabled bool
+	Preset  string // 预设名称，修改过频段后为 custom
+	Bands   []EqualizerBand
+}
+
+func NewEqualizerConfig() *EqualizerConfig {
+	eq := &EqualizerConfig{}
+	_ = eq.setPreset(equalizerPresetFlat)
+	return eq
+}
+
+func (eq *EqualizerConfig) setPreset(preset string) error {
+	gains, ok := equalizerPresets[preset]
+	if !ok {
+		return fmt.Errorf("invalid equalizer preset %q", preset)
+	}
+	eq.Preset = preset
+	eq.Bands = make([]EqualizerBand, equalizerBandCount)
+	for i := range eq.Bands {
+		eq.Bands[i] = EqualizerBand{
+			Freq: equalizerFreqs[i],
+			Gain: gains[i],
+			Q:    equalizerDefaultQ,
+		}
+	}
+	return nil
+}
+
+func (eq *EqualizerConfig) setBand(index int, band EqualizerBand) error {
+	if index < 0 || index >= len(eq.Bands) {
+		return fmt.Errorf("invalid equalizer band index %d", index)
+	}
+	err := band.check()
+	if err != nil {
+		return err
+	}
+	eq.Bands[index] = band
+	eq.Preset = equalizerPresetCustom
+	return nil
+}
+
+func (band *EqualizerBand) check() error {
+	if band.Freq < equalizerMinFreq || band.Freq > equalizerMaxFreq {
+		return fmt.Errorf("invalid equalizer frequency %v", band.Freq)
+	}
+	if band.Gain < equalizerMinGain || band.Gain > equalizerMaxGain {
+		return fmt.Errorf("invalid equalizer gain %v", band.Gain)
+	}
+	if band.Q < equalizerMinQ || band.Q > equalizerMaxQ {
+		return fmt.Errorf("invalid equalizer Q %v", band.Q)
+	}
+	return nil
+}
+
+// 修正从配置文件中读出的无效配置
+func (eq *EqualizerConfig) fix() {
+	valid := len(eq.Bands) == equalizerBandCount
+	for i := 0; valid && i < len(eq.Bands); i++ {
+		valid = eq.Bands[i].check() == nil
+	}
+	if valid {
+		return
+	}
+	if eq.setPreset(eq.Preset) != nil {
+		_ = eq.setPreset(equalizerPresetFlat)
+	}
+}
+
+// 所有频段增益为 0 时不需要加载均衡器
+func (eq *EqualizerConfig) isFlat() bool {
+	for _, band := range eq.Bands {
+		if band.Gain != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (eq *EqualizerConfig) clone() *EqualizerConfig {
+	c := *eq
+	c.Bands = append([]EqualizerBand(nil), eq.Bands...)
+	return &c
+}
+
+func formatEqualizerFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// 生成 PipeWire 的 filter-chain 配置，10 个 bq_peaking 串联，输出到 masterSink
+func makeEqualizerFilterChainConfig(eq *EqualizerConfig, masterSink string) string {
+	var sb strings.Builder
+	sb.WriteString(`context.properties = {
+    log.level = 0
+}
+context.spa-libs = {
+    audio.convert.* = audioconvert/libspa-audioconvert
+    support.*       = support/libspa-support
+}
+context.modules = [
+    { name = libpipewire-module-rt flags = [ ifexists nofail ] }
+    { name = libpipewire-module-protocol-native }
+    { name = libpipewire-module-client-node }
+    { name = libpipewire-module-adapter }
+    { name = libpipewire-module-filter-chain
+        args = {
+            node.description = "DDE Equalizer"
+            media.name       = "DDE Equalizer"
+            filter.graph = {
+                nodes = [
+`)
+	for i, band := range eq.Bands {
+		fmt.Fprintf(&sb, "                    { type = builtin name = eq_band_%d label = bq_peaking control = { \"Freq\" = %s \"Q\" = %s \"Gain\" = %s } }\n",
+			i+1, formatEqualizerFloat(band.Freq), formatEqualizerFloat(band.Q), formatEqualizerFloat(band.Gain))
+	}
+	sb.WriteString("                ]\n                links = [\n")
+	for i := 1; i < len(eq.Bands); i++ {
+		fmt.Fprintf(&sb, "                    { output = \"eq_band_%d:Out\" input = \"eq_band_%d:In\" }\n", i, i+1)
+	}
+	fmt.Fprintf(&sb, `                ]
+            }
+            audio.channels = 2
+            audio.position = [ FL FR ]
+            capture.props = {
+                node.name            = "%s"
+                media.class          = Audio/Sink
+                device.master_device = "%s"
+            }
+            playback.props = {
+                node.name     = "%s.output"
+                node.passive  = true
+                target.object = "%s"
+            }
+        }
+    }
+]
+`, equalizerSinkName, masterSink, equalizerSinkName, masterSink)
+	return sb.String()
+}
+
+// PulseAudio 加载 module-ladspa-sink 的参数，caps Eq10 的增益范围是 -48 到 24 dB
+func makeEqualizerLadspaArgs(eq *EqualizerConfig, masterSink string) []string {
+	gains := make([]string, len(eq.Bands))
+	for i, band := range eq.Bands {
+		gains[i] = formatEqualizerFloat(band.Gain)
+	}
+	return []string{
+		"module-ladspa-sink",
+		"sink_name=" + equalizerSinkName,
+		"sink_master=" + masterSink,
+		"plugin=caps",
+		"label=Eq10",
+		"control=" + strings.Join(gains, ","),
+	}
+}
+
+// 从 pactl list short modules 的输出中找到 sink 名称以 sinkNamePrefix 开头的模块的索引
+func findSinkModules(output string, moduleName string, sinkNamePrefix string) []string {
+	var ids []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != moduleName {
+			continue
+		}
+		for _, arg := range fields[2:] {
+			if strings.HasPrefix(arg, "sink_name="+sinkNamePrefix) {
+				ids = append(ids, fields[0])
+				break
+			}
+		}
+	}
+	return ids
+}
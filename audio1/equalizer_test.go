@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EqualizerConfig(t *testing.T) {
+	eq := NewEqualizerConfig()
+	assert.False(t, eq.Enabled)
+	assert.Equal(t, equalizerPresetFlat, eq.Preset)
+	require.Len(t, eq.Bands, equalizerBandCount)
+	assert.True(t, eq.isFlat())
+
+	for _, preset := range equalizerPresetNames {
+		assert.NoError(t, eq.setPreset(preset))
+	}
+	assert.Error(t, eq.setPreset("unknown"))
+	assert.Equal(t, "vocal", eq.Preset)
+	assert.False(t, eq.isFlat())
+
+	assert.NoError(t, eq.setBand(9, EqualizerBand{Freq: 12000, Gain: -3, Q: 0.7}))
+	assert.Equal(t, equalizerPresetCustom, eq.Preset)
+	assert.Equal(t, 12000.0, eq.Bands[9].Freq)
+	assert.Error(t, eq.setBand(10, EqualizerBand{Freq: 1000, Q: 1}))
+	assert.Error(t, eq.setBand(0, EqualizerBand{Freq: 10, Q: 1}))
+	assert.Error(t, eq.setBand(0, EqualizerBand{Freq: 1000, Gain: 30, Q: 1}))
+	assert.Error(t, eq.setBand(0, EqualizerBand{Freq: 1000, Q: 0}))
+
+	c := eq.clone()
+	c.Bands[0].Gain = 1
+	assert.NotEqual(t, c.Bands[0].Gain, eq.Bands[0].Gain)
+
+	// 无效的配置恢复为预设
+	eq = &EqualizerConfig{Preset: "rock", Bands: []EqualizerBand{{Freq: 1000}}}
+	eq.fix()
+	assert.Equal(t, "rock", eq.Preset)
+	assert.Len(t, eq.Bands, equalizerBandCount)
+	eq = &EqualizerConfig{Preset: equalizerPresetCustom}
+	eq.fix()
+	assert.Equal(t, equalizerPresetFlat, eq.Preset)
+}
+
+func Test_EqualizerModuleArgs(t *testing.T) {
+	eq := NewEqualizerConfig()
+	require.NoError(t, eq.setPreset("bass"))
+
+	conf := makeEqualizerFilterChainConfig(eq, "alsa_output.pci.analog-stereo")
+	assert.Equal(t, equalizerBandCount, strings.Count(conf, "label = bq_peaking"))
+	assert.Contains(t, conf, `{ type = builtin name = eq_band_1 label = bq_peaking control = { "Freq" = 31 "Q" = 1.41 "Gain" = 6 } }`)
+	assert.Contains(t, conf, `{ output = "eq_band_9:Out" input = "eq_band_10:In" }`)
+	assert.Contains(t, conf, `target.object = "alsa_output.pci.analog-stereo"`)
+
+	args := makeEqualizerLadspaArgs(eq, "alsa_output.pci.analog-stereo")
+	assert.Equal(t, []string{
+		"module-ladspa-sink",
+		"sink_name=dde_equalizer",
+		"sink_master=alsa_output.pci.analog-stereo",
+		"plugin=caps",
+		"label=Eq10",
+		"control=6,5,4,2,0,0,0,0,0,0",
+	}, args)
+
+	modules := "0\tmodule-device-restore\t\t\n" +
+		"25\tmodule-ladspa-sink\tsink_name=dde_equalizer sink_master=alsa_output.pci plugin=caps label=Eq10\t\n" +
+		"26\tmodule-ladspa-sink\tsink_name=other plugin=caps label=Eq10\t\n"
+	assert.Equal(t, []string{"25"}, findSinkModules(modules, "module-ladspa-sink", equalizerSinkName))
+}
+
+func Test_EqualizerProcessExited(t *testing.T) {
+	a := &Audio{}
+	a.equalizer.mu.Lock()
+	a.equalizer.master = "alsa_output.pci-0000_00_1f.3.analog-stereo"
+	a.equalizer.key = "true"
+	err := a.startEqualizerProcess(exec.Command("true"))
+	a.equalizer.mu.Unlock()
+	require.NoError(t, err)
+
+	// 进程退出后清除均衡器的状态，下次应用配置时重新加载
+	assert.Eventually(t, func() bool {
+		a.equalizer.mu.Lock()
+		defer a.equalizer.mu.Unlock()
+		return a.equalizer.key == "" && a.equalizer.cmd == nil && a.equalizer.master == ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	a.equalizer.mu.Lock()
+	err = a.startEqualizerProcess(exec.Command("/nonexistent/pipewire"))
+	a.equalizer.mu.Unlock()
+	assert.Error(t, err)
+}
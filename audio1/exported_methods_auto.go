@@ -8,6 +8,37 @@ import (
 
 func (v *Audio) GetExportedMethods() dbusutil.ExportedMethods {
 	return dbusutil.ExportedMethods{
+		{
+			Name:    "CreateCombinedSink",
+			Fn:      v.CreateCombinedSink,
+			InArgs:  []string{"description", "cardIds", "portNames"},
+			OutArgs: []string{"id"},
+		},
+		{
+			Name:   "DestroyCombinedSink",
+			Fn:     v.DestroyCombinedSink,
+			InArgs: []string{"id"},
+		},
+		{
+			Name:    "GetAppRouteRules",
+			Fn:      v.GetAppRouteRules,
+			OutArgs: []string{"rules"},
+		},
+		{
+			Name:    "GetAppVolumes",
+			Fn:      v.GetAppVolumes,
+			OutArgs: []string{"volumes"},
+		},
+		{
+			Name:    "GetCombinedSinks",
+			Fn:      v.GetCombinedSinks,
+			OutArgs: []string{"sinks"},
+		},
+		{
+			Name:    "GetPortPriorities",
+			Fn:      v.GetPortPriorities,
+			OutArgs: []string{"priorities"},
+		},
 		{
 			Name:    "IsPortEnabled",
 			Fn:      v.IsPortEnabled,
@@ -18,25 +49,61 @@ func (v *Audio) GetExportedMethods() dbusutil.ExportedMethods {
 			Name: "NoRestartPulseAudio",
 			Fn:   v.NoRestartPulseAudio,
 		},
+		{
+			Name:   "RemoveAppRouteRule",
+			Fn:     v.RemoveAppRouteRule,
+			InArgs: []string{"id"},
+		},
 		{
 			Name: "Reset",
 			Fn:   v.Reset,
 		},
+		{
+			Name:   "ResetAppVolume",
+			Fn:     v.ResetAppVolume,
+			InArgs: []string{"app"},
+		},
+		{
+			Name:    "SetAppRouteRule",
+			Fn:      v.SetAppRouteRule,
+			InArgs:  []string{"rule"},
+			OutArgs: []string{"id"},
+		},
 		{
 			Name:   "SetBluetoothAudioMode",
 			Fn:     v.SetBluetoothAudioMode,
 			InArgs: []string{"mode"},
 		},
+		{
+			Name:   "SetCombinedSinkPreferred",
+			Fn:     v.SetCombinedSinkPreferred,
+			InArgs: []string{"id"},
+		},
 		{
 			Name:   "SetPort",
 			Fn:     v.SetPort,
 			InArgs: []string{"cardId", "portName", "direction"},
 		},
+		{
+			Name:   "SetPortBlocked",
+			Fn:     v.SetPortBlocked,
+			InArgs: []string{"direction", "cardName", "portName", "blocked"},
+		},
 		{
 			Name:   "SetPortEnabled",
 			Fn:     v.SetPortEnabled,
 			InArgs: []string{"cardId", "portName", "enabled"},
 		},
+		{
+			Name:   "SetPortPinned",
+			Fn:     v.SetPortPinned,
+			InArgs: []string{"direction", "cardName", "portName", "pinned"},
+		},
+		{
+			Name:   "SetPortPriorities",
+			Fn:     v.SetPortPriorities,
+			InArgs: []string{"direction", "ports"},
+		},
 		{
 			Name:   "SetCurrentAudioServer",
 			Fn:     v.SetCurrentAudioServer,
@@ -47,6 +114,12 @@ func (v *Audio) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.SetMono,
 			InArgs: []string{"enable"},
 		},
+		{
+			Name:    "SimulateUnplug",
+			Fn:      v.SimulateUnplug,
+			InArgs:  []string{"direction", "cardName", "portName"},
+			OutArgs: []string{"port"},
+		},
 	}
 }
 func (v *Meter) GetExportedMethods() dbusutil.ExportedMethods {
@@ -59,6 +132,16 @@ func (v *Meter) GetExportedMethods() dbusutil.ExportedMethods {
 }
 func (v *Sink) GetExportedMethods() dbusutil.ExportedMethods {
 	return dbusutil.ExportedMethods{
+		{
+			Name:    "GetEqualizer",
+			Fn:      v.GetEqualizer,
+			OutArgs: []string{"equalizer"},
+		},
+		{
+			Name:    "GetEqualizerPresets",
+			Fn:      v.GetEqualizerPresets,
+			OutArgs: []string{"presets"},
+		},
 		{
 			Name:    "GetMeter",
 			Fn:      v.GetMeter,
@@ -69,6 +152,21 @@ func (v *Sink) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.SetBalance,
 			InArgs: []string{"value", "isPlay"},
 		},
+		{
+			Name:   "SetEqualizerBand",
+			Fn:     v.SetEqualizerBand,
+			InArgs: []string{"index", "freq", "gain", "q"},
+		},
+		{
+			Name:   "SetEqualizerEnabled",
+			Fn:     v.SetEqualizerEnabled,
+			InArgs: []string{"enabled"},
+		},
+		{
+			Name:   "SetEqualizerPreset",
+			Fn:     v.SetEqualizerPreset,
+			InArgs: []string{"preset"},
+		},
 		{
 			Name:   "SetFade",
 			Fn:     v.SetFade,
@@ -45,14 +45,14 @@ func (m *Module) start() error {
 		return err
 	}
 
-	m.audio = newAudio(service)
+	m.audio = newAudio(service, m.Go)
 	err = m.audio.init()
 	if err != nil {
 		logger.Warning("failed to init audio module:", err)
 		return nil
 	}
 
-	err = service.Export(dbusPath, m.audio, m.audio.syncConfig)
+	err = m.Export(dbusPath, m.audio, m.audio.syncConfig)
 	if err != nil {
 		return err
 	}
@@ -6,8 +6,10 @@ package audio
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/linuxdeepin/go-lib/pulse"
 	"github.com/linuxdeepin/go-lib/xdg/basedir"
@@ -25,6 +27,9 @@ type PriorityManager struct {
 	Input  *PriorityPolicy
 
 	file string // 配置文件的路径，私有成员不会被json导出
+
+	// 保护 Output 和 Input，D-Bus 方法与事件处理在不同的 goroutine 中读写优先级
+	mu sync.Mutex
 }
 
 // 创建优先级组
@@ -54,7 +59,9 @@ var GetPriorityManager = createPriorityManagerSingleton(globalPrioritiesFilePath
 
 // 打印优先级列表，用于调试
 func (pm *PriorityManager) Print() {
+	pm.mu.Lock()
 	data, err := json.MarshalIndent(pm, "", "  ")
+	pm.mu.Unlock()
 	if err != nil {
 		logger.Warning(err)
 		return
@@ -65,7 +72,9 @@ func (pm *PriorityManager) Print() {
 
 // 保存配置文件
 func (pm *PriorityManager) Save() {
+	pm.mu.Lock()
 	data, err := json.MarshalIndent(pm, "", "  ")
+	pm.mu.Unlock()
 	if err != nil {
 		logger.Warning(err)
 		return
@@ -172,6 +181,9 @@ func (pm *PriorityManager) SetPorts(cards CardList) {
 			}
 		}
 	}
+	outputPorts = append(outputPorts, GetCombinedSinkManager().priorityPorts()...)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	pm.Output.SetPorts(outputPorts)
 	pm.Input.SetPorts(inputPorts)
 }
@@ -199,6 +211,7 @@ func (pm *PriorityManager) Init(cards CardList) {
 
 // 设置优先级最高的端口（自动识别输入输出）
 func (pm *PriorityManager) SetTheFirstPort(card *pulse.Card, port *pulse.CardPortInfo) {
+	pm.mu.Lock()
 	if port.Direction == pulse.DirectionSink {
 		pm.Output.SetTheFirstPort(card.Name, port.Name)
 	} else if port.Direction == pulse.DirectionSource {
@@ -207,6 +220,7 @@ func (pm *PriorityManager) SetTheFirstPort(card *pulse.Card, port *pulse.CardPor
 		logger.Warningf("unexpected direction %d of port <%s:%s>",
 			port.Direction, card.Name, port.Name)
 	}
+	pm.mu.Unlock()
 
 	// 打印并保存
 	pm.Print()
@@ -219,7 +233,9 @@ func (pm *PriorityManager) SetTheFirstPort(card *pulse.Card, port *pulse.CardPor
 // 形似："alsa_card.pci-0000_00_1f.3" 和 "hdmi-output-0"
 // 而不是: "HDA Intel PCH" 和 "HDMI / DisplayPort"
 func (pm *PriorityManager) SetFirstOutputPort(cardName string, portName string) {
+	pm.mu.Lock()
 	pm.Output.SetTheFirstPort(cardName, portName)
+	pm.mu.Unlock()
 	pm.Print()
 	pm.Save()
 }
@@ -230,7 +246,46 @@ func (pm *PriorityManager) SetFirstOutputPort(cardName string, portName string)
 // 形似："alsa_card.pci-0000_00_1f.3" 和 "hdmi-output-0"
 // 而不是: "HDA Intel PCH" 和 "HDMI / DisplayPort"
 func (pm *PriorityManager) SetFirstInputPort(cardName string, portName string) {
+	pm.mu.Lock()
 	pm.Input.SetTheFirstPort(cardName, portName)
+	pm.mu.Unlock()
 	pm.Print()
 	pm.Save()
 }
+
+// 根据方向获取优先级策略
+func (pm *PriorityManager) getPolicy(direction int) (*PriorityPolicy, error) {
+	switch direction {
+	case pulse.DirectionSink:
+		return pm.Output, nil
+	case pulse.DirectionSource:
+		return pm.Input, nil
+	default:
+		return nil, fmt.Errorf("invalid direction %d", direction)
+	}
+}
+
+// 持有锁修改指定方向的优先级策略
+func (pm *PriorityManager) update(direction int, fn func(pp *PriorityPolicy) error) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	policy, err := pm.getPolicy(direction)
+	if err != nil {
+		return err
+	}
+	return fn(policy)
+}
+
+// 获取优先级最高的输入端口
+func (pm *PriorityManager) getFirstInputPort() PriorityPort {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.Input.GetTheFirstPort()
+}
+
+// 获取优先级列表的 json
+func (pm *PriorityManager) toJSON() string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return toJSON(pm)
+}
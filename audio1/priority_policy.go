@@ -5,6 +5,7 @@
 package audio
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/linuxdeepin/go-lib/pulse"
@@ -19,6 +20,7 @@ const (
 	PortTypeLineIO                  // 线缆输入输出
 	PortTypeMultiChannel            // 多声道
 	PortTypeUnknown                 // 其他类型
+	PortTypeCombined                // 合并输出
 
 	PortTypeCount        // 有效的端口类型个数
 	PortTypeInvalid = -1 // 表示无效的类型
@@ -103,6 +105,18 @@ func (portList *PriorityPortList) hasElement(port *PriorityPort) bool {
 	return false
 }
 
+// 从端口实例优先级列表中删除一个端口，判断时只考虑CardName和PortName
+func (portList *PriorityPortList) remove(cardName string, portName string) bool {
+	for i, p := range *portList {
+		if p.CardName == cardName && p.PortName == portName {
+			*portList = append((*portList)[:i], (*portList)[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
 // 端口类型优先级列表
 type PriorityTypeList []int
 
@@ -119,15 +133,19 @@ func (typeList *PriorityTypeList) hasElement(value int) bool {
 
 // 管理一组实例和类型的优先级
 type PriorityPolicy struct {
-	Ports PriorityPortList
-	Types PriorityTypeList
+	Ports   PriorityPortList
+	Types   PriorityTypeList
+	Pinned  PriorityPortList // 固定的端口，可用时按照固定的顺序排在最前面
+	Blocked PriorityPortList // 屏蔽的端口，不会被自动选择
 }
 
 // 新建一个PriorityPolicy
 func NewPriorityPolicy() *PriorityPolicy {
 	return &PriorityPolicy{
-		Ports: make(PriorityPortList, 0),
-		Types: make(PriorityTypeList, 0),
+		Ports:   make(PriorityPortList, 0),
+		Types:   make(PriorityTypeList, 0),
+		Pinned:  make(PriorityPortList, 0),
+		Blocked: make(PriorityPortList, 0),
 	}
 }
 
@@ -170,6 +188,23 @@ func (pp *PriorityPolicy) sortPorts() {
 			}
 		}
 	}
+
+	pp.applyPinned()
+}
+
+// 将固定的端口按照固定的顺序移动到最前面
+func (pp *PriorityPolicy) applyPinned() {
+	insertPos := 0
+	for _, pinned := range pp.Pinned {
+		index := pp.FindPortIndex(pinned.CardName, pinned.PortName)
+		if index < 0 {
+			continue
+		}
+		port := pp.Ports[index]
+		pp.RemovePortByIndex(index)
+		pp.InsertPortBeforeIndex(port, insertPos)
+		insertPos++
+	}
 }
 
 // 获取端口数量
@@ -318,19 +353,23 @@ func (pp *PriorityPolicy) SetPorts(ports PriorityPortList) {
 			logger.Debugf("exist port <%s:%s>", port.CardName, port.PortName)
 		}
 	}
+
+	pp.applyPinned()
 }
 
-// 获取优先级最高的端口
+// 获取优先级最高的端口，跳过屏蔽的端口
 func (pp *PriorityPolicy) GetTheFirstPort() PriorityPort {
-	if len(pp.Ports) > 0 {
-		return *(pp.Ports[0])
-	} else {
-		return PriorityPort{
-			"",
-			"",
-			PortTypeInvalid,
+	for _, port := range pp.Ports {
+		if !pp.Blocked.hasElement(port) {
+			return *port
 		}
 	}
+
+	return PriorityPort{
+		"",
+		"",
+		PortTypeInvalid,
+	}
 }
 
 // 获取优先级最高的类型
@@ -359,7 +398,8 @@ func (pp *PriorityPolicy) SetTheFirstType(portType int) bool {
 	return true
 }
 
-// 将指定端口的优先级设为最高，副作用：将该端口类型的优先级设为最高，将同类端口的优先级提高
+// 将指定端口的优先级设为最高，副作用：将该端口类型的优先级设为最高，将同类端口的优先级提高，取消该端口的屏蔽
+// 注意：固定的端口仍然排在最前面
 func (pp *PriorityPolicy) SetTheFirstPort(cardName string, portName string) bool {
 	portIndex := pp.FindPortIndex(cardName, portName)
 	if portIndex < 0 {
@@ -367,6 +407,9 @@ func (pp *PriorityPolicy) SetTheFirstPort(cardName string, portName string) bool
 		return false
 	}
 
+	// 用户主动选择了该端口
+	pp.Blocked.remove(cardName, portName)
+
 	// 类型优先级设为最高
 	portType := pp.Ports[portIndex].PortType
 	pp.SetTheFirstType(portType)
@@ -386,6 +429,7 @@ func (pp *PriorityPolicy) SetTheFirstPort(cardName string, portName string) bool
 		}
 	}
 
+	pp.applyPinned()
 	return true
 }
 
@@ -400,3 +444,107 @@ func (pp *PriorityPolicy) RemoveCard(cardName string) {
 		}
 	}
 }
+
+// 获取端口实例，不在优先级列表中的端口（例如未插入的设备）类型为 PortTypeInvalid
+func (pp *PriorityPolicy) getPort(cardName string, portName string) *PriorityPort {
+	index := pp.FindPortIndex(cardName, portName)
+	if index >= 0 {
+		port := *pp.Ports[index]
+		return &port
+	}
+
+	return &PriorityPort{cardName, portName, PortTypeInvalid}
+}
+
+// 固定或取消固定一个端口，后固定的端口排在先固定的端口之后，固定时取消屏蔽
+func (pp *PriorityPolicy) SetPortPinned(cardName string, portName string, pinned bool) {
+	pp.Pinned.remove(cardName, portName)
+	if pinned {
+		pp.Blocked.remove(cardName, portName)
+		pp.Pinned = append(pp.Pinned, pp.getPort(cardName, portName))
+	}
+
+	pp.applyPinned()
+}
+
+// 屏蔽或取消屏蔽一个端口，屏蔽时取消固定
+func (pp *PriorityPolicy) SetPortBlocked(cardName string, portName string, blocked bool) {
+	pp.Blocked.remove(cardName, portName)
+	if blocked {
+		pp.Pinned.remove(cardName, portName)
+		pp.Blocked = append(pp.Blocked, pp.getPort(cardName, portName))
+	}
+}
+
+// 按照指定的顺序调整端口优先级，未指定的端口保持原来的顺序排在后面
+// 类型优先级会按照新的顺序调整，同类型的端口必须排在一起，固定的端口必须排在最前面，
+// 否则按类型排序后无法保持指定的顺序，返回错误且不做修改
+func (pp *PriorityPolicy) SetPortOrder(order PriorityPortList) error {
+	ports := make(PriorityPortList, 0, len(pp.Ports))
+	for _, p := range order {
+		index := pp.FindPortIndex(p.CardName, p.PortName)
+		if index < 0 {
+			return fmt.Errorf("cannot find <%s:%s> in priority list", p.CardName, p.PortName)
+		}
+		if ports.hasElement(p) {
+			return fmt.Errorf("duplicate port <%s:%s>", p.CardName, p.PortName)
+		}
+		ports = append(ports, pp.Ports[index])
+	}
+	for _, p := range pp.Ports {
+		if !ports.hasElement(p) {
+			ports = append(ports, p)
+		}
+	}
+
+	types := make(PriorityTypeList, 0, len(pp.Types))
+	for _, p := range ports {
+		if !types.hasElement(p.PortType) {
+			types = append(types, p.PortType)
+		}
+	}
+	for _, t := range pp.Types {
+		if !types.hasElement(t) {
+			types = append(types, t)
+		}
+	}
+
+	// 在副本上排序，检查结果与指定的顺序一致
+	policy := &PriorityPolicy{
+		Ports:  append(PriorityPortList{}, ports...),
+		Types:  types,
+		Pinned: pp.Pinned,
+	}
+	policy.sortPorts()
+	for i, p := range policy.Ports {
+		if p != ports[i] {
+			return fmt.Errorf("cannot keep the order of <%s:%s>, ports of the same type must be adjacent and pinned ports must be first",
+				ports[i].CardName, ports[i].PortName)
+		}
+	}
+
+	pp.Ports = policy.Ports
+	pp.Types = types
+	return nil
+}
+
+// 模拟拔出设备后会选择的端口，portName 为空时表示拔出整个声卡
+func (pp *PriorityPolicy) SimulateRemove(cardName string, portName string) PriorityPort {
+	return pp.simulateRemove(cardName, portName).GetTheFirstPort()
+}
+
+// 返回拔出设备后的优先级策略副本，不修改 pp，副本可以在不持有锁时使用
+func (pp *PriorityPolicy) simulateRemove(cardName string, portName string) *PriorityPolicy {
+	policy := &PriorityPolicy{
+		Ports:   append(PriorityPortList{}, pp.Ports...),
+		Types:   append(PriorityTypeList{}, pp.Types...),
+		Pinned:  append(PriorityPortList{}, pp.Pinned...),
+		Blocked: append(PriorityPortList{}, pp.Blocked...),
+	}
+	if portName == "" {
+		policy.RemoveCard(cardName)
+	} else {
+		policy.RemovePortByName(cardName, portName)
+	}
+	return policy
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPriorityPolicy() *PriorityPolicy {
+	pp := NewPriorityPolicy()
+	pp.completeTypes()
+	pp.SetPorts(PriorityPortList{
+		{CardName: "bluez", PortName: "headset-output", PortType: PortTypeBluetooth},
+		{CardName: "usb", PortName: "analog-output", PortType: PortTypeUsb},
+		{CardName: "pci", PortName: "speaker", PortType: PortTypeBuiltin},
+		{CardName: "pci", PortName: "hdmi-output-0", PortType: PortTypeHdmi},
+	})
+	return pp
+}
+
+func portNames(pp *PriorityPolicy) []string {
+	names := make([]string, len(pp.Ports))
+	for i, p := range pp.Ports {
+		names[i] = p.CardName + ":" + p.PortName
+	}
+	return names
+}
+
+func Test_PriorityPolicyPinned(t *testing.T) {
+	pp := newTestPriorityPolicy()
+	assert.Equal(t, "bluez", pp.GetTheFirstPort().CardName)
+
+	pp.SetPortPinned("pci", "hdmi-output-0", true)
+	pp.SetPortPinned("usb", "analog-output", true)
+	assert.Equal(t, []string{"pci:hdmi-output-0", "usb:analog-output", "bluez:headset-output", "pci:speaker"}, portNames(pp))
+
+	// 固定的端口不受 SetTheFirstPort 影响
+	assert.True(t, pp.SetTheFirstPort("pci", "speaker"))
+	assert.Equal(t, "pci:hdmi-output-0", portNames(pp)[0])
+
+	// 固定的端口拔出后再插入，仍然排在最前面
+	pp.SetPorts(PriorityPortList{
+		{CardName: "pci", PortName: "speaker", PortType: PortTypeBuiltin},
+		{CardName: "usb", PortName: "analog-output", PortType: PortTypeUsb},
+	})
+	assert.Equal(t, "usb", pp.GetTheFirstPort().CardName)
+	pp.SetPorts(PriorityPortList{
+		{CardName: "pci", PortName: "speaker", PortType: PortTypeBuiltin},
+		{CardName: "usb", PortName: "analog-output", PortType: PortTypeUsb},
+		{CardName: "pci", PortName: "hdmi-output-0", PortType: PortTypeHdmi},
+	})
+	assert.Equal(t, "hdmi-output-0", pp.GetTheFirstPort().PortName)
+
+	pp.SetPortPinned("pci", "hdmi-output-0", false)
+	assert.Equal(t, "usb", pp.GetTheFirstPort().CardName)
+	require.Len(t, pp.Pinned, 1)
+}
+
+func Test_PriorityPolicyBlocked(t *testing.T) {
+	pp := newTestPriorityPolicy()
+	pp.SetPortBlocked("bluez", "headset-output", true)
+	assert.Equal(t, "usb", pp.GetTheFirstPort().CardName)
+	// 屏蔽的端口仍然在列表中
+	assert.Equal(t, 0, pp.FindPortIndex("bluez", "headset-output"))
+
+	// 固定和屏蔽互斥
+	pp.SetPortPinned("bluez", "headset-output", true)
+	assert.Empty(t, pp.Blocked)
+	pp.SetPortBlocked("bluez", "headset-output", true)
+	assert.Empty(t, pp.Pinned)
+
+	// 主动选择时取消屏蔽
+	assert.True(t, pp.SetTheFirstPort("bluez", "headset-output"))
+	assert.Empty(t, pp.Blocked)
+	assert.Equal(t, "bluez", pp.GetTheFirstPort().CardName)
+
+	for _, p := range pp.Ports {
+		pp.SetPortBlocked(p.CardName, p.PortName, true)
+	}
+	assert.Equal(t, PortTypeInvalid, pp.GetTheFirstPort().PortType)
+}
+
+func Test_PriorityPolicySetPortOrder(t *testing.T) {
+	pp := newTestPriorityPolicy()
+	err := pp.SetPortOrder(PriorityPortList{
+		{CardName: "pci", PortName: "hdmi-output-0"},
+		{CardName: "pci", PortName: "speaker"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pci:hdmi-output-0", "pci:speaker", "bluez:headset-output", "usb:analog-output"}, portNames(pp))
+	assert.Equal(t, PortTypeHdmi, pp.GetTheFirstType())
+
+	// 新插入的端口按照调整后的类型优先级排序
+	ports := append(PriorityPortList{}, pp.Ports...)
+	pp.SetPorts(append(ports, &PriorityPort{CardName: "pci2", PortName: "speaker", PortType: PortTypeBuiltin}))
+	assert.Equal(t, 1, pp.FindPortIndex("pci2", "speaker"))
+
+	// 同类型的端口被其他类型隔开时无法保持顺序，返回错误且不修改
+	ports = append(PriorityPortList{}, pp.Ports...)
+	pp.SetPorts(append(ports, &PriorityPort{CardName: "pci", PortName: "hdmi-output-1", PortType: PortTypeHdmi}))
+	before := portNames(pp)
+	assert.Error(t, pp.SetPortOrder(PriorityPortList{
+		{CardName: "pci", PortName: "hdmi-output-0"},
+		{CardName: "usb", PortName: "analog-output"},
+		{CardName: "pci", PortName: "hdmi-output-1"},
+	}))
+	assert.Equal(t, before, portNames(pp))
+
+	// 固定的端口必须排在最前面
+	pp.SetPortPinned("usb", "analog-output", true)
+	before = portNames(pp)
+	assert.Error(t, pp.SetPortOrder(PriorityPortList{{CardName: "pci", PortName: "speaker"}}))
+	assert.Equal(t, before, portNames(pp))
+	require.NoError(t, pp.SetPortOrder(PriorityPortList{
+		{CardName: "usb", PortName: "analog-output"},
+		{CardName: "bluez", PortName: "headset-output"},
+	}))
+	assert.Equal(t, []string{"usb:analog-output", "bluez:headset-output", "pci:hdmi-output-1", "pci:hdmi-output-0", "pci2:speaker", "pci:speaker"}, portNames(pp))
+
+	assert.Error(t, pp.SetPortOrder(PriorityPortList{{CardName: "none", PortName: "speaker"}}))
+	assert.Error(t, pp.SetPortOrder(PriorityPortList{
+		{CardName: "pci", PortName: "speaker"},
+		{CardName: "pci", PortName: "speaker"},
+	}))
+}
+
+func Test_PriorityPolicySimulateRemove(t *testing.T) {
+	pp := newTestPriorityPolicy()
+	assert.Equal(t, "usb", pp.SimulateRemove("bluez", "headset-output").CardName)
+	assert.Equal(t, "bluez", pp.SimulateRemove("pci", "").CardName)
+	assert.Len(t, pp.Ports, 4)
+
+	pp.SetPortBlocked("usb", "analog-output", true)
+	assert.Equal(t, "speaker", pp.SimulateRemove("bluez", "").PortName)
+	assert.Len(t, pp.Ports, 4)
+}
+
+func Test_PriorityManagerUpdate(t *testing.T) {
+	pm := NewPriorityManager(filepath.Join(t.TempDir(), "priorities.json"))
+	pm.Output = newTestPriorityPolicy()
+	assert.Error(t, pm.update(-1, func(pp *PriorityPolicy) error { return nil }))
+
+	// 模拟拔出得到的副本与原策略互不影响
+	var policy *PriorityPolicy
+	require.NoError(t, pm.update(pulse.DirectionSink, func(pp *PriorityPolicy) error {
+		policy = pp.simulateRemove("bluez", "")
+		return nil
+	}))
+	require.NoError(t, pm.update(pulse.DirectionSink, func(pp *PriorityPolicy) error {
+		pp.SetPortBlocked("usb", "analog-output", true)
+		return nil
+	}))
+	assert.Len(t, pm.Output.Ports, 4)
+	assert.Len(t, policy.Ports, 3)
+	assert.Empty(t, policy.Blocked)
+	assert.Equal(t, "usb", policy.GetTheFirstPort().CardName)
+	assert.Equal(t, "bluez", pm.Output.GetTheFirstPort().CardName)
+}
+
+func Test_PriorityPolicyLoadOldConfig(t *testing.T) {
+	pp := NewPriorityPolicy()
+	err := json.Unmarshal([]byte(`{"Ports":[{"CardName":"pci","PortName":"speaker","PortType":3}],"Types":[3]}`), pp)
+	require.NoError(t, err)
+	assert.Empty(t, pp.Pinned)
+	assert.Empty(t, pp.Blocked)
+	assert.Equal(t, "speaker", pp.GetTheFirstPort().PortName)
+}
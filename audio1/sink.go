@@ -282,7 +282,8 @@ func (s *Sink) update(sinkInfo *pulse.Sink) {
 	s.props = sinkInfo.PropList
 	s.PropsMu.Unlock()
 
-	if activePortChanged && s.audio.defaultSinkName == s.Name {
+	// 使用均衡器时默认 sink 是均衡器，均衡器的主设备端口变化时同样需要恢复配置
+	if activePortChanged && (s.audio.defaultSinkName == s.Name || s.audio.getEqualizerMaster() == s.Name) {
 		logger.Debugf("default sink update active port %s", sinkInfo.ActivePort.Name)
 		s.audio.resumeSinkConfig(s)
 	}
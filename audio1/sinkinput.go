@@ -31,6 +31,8 @@ type SinkInput struct {
 	correctIconCalled bool
 	correctedIcon     string
 	visible           bool
+	appInfo           appStreamInfo // 用于匹配应用的音频路由规则和记住应用的音量
+	volumeRestoring   bool          // 正在恢复应用记住的音量
 	cVolume           pulse.CVolume
 	channelMap        pulse.ChannelMap
 	// Name process name
@@ -54,6 +56,7 @@ func newSinkInput(sinkInputInfo *pulse.SinkInput, audio *Audio) *SinkInput {
 		service: audio.service,
 		index:   sinkInputInfo.Index,
 		visible: getSinkInputVisible(sinkInputInfo),
+		appInfo: newAppStreamInfo(sinkInputInfo.PropList),
 	}
 	sinkInput.update(sinkInputInfo)
 	return sinkInput
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -67,6 +68,15 @@ type SessionDaemon struct {
 
 	configManagerPath dbus.ObjectPath
 	systemSigLoop     *dbusutil.SignalLoop
+
+	signals *struct { // nolint
+		ModuleFailed struct {
+			name         string
+			reason       string
+			restartCount uint32
+			willRestart  bool
+		}
+	}
 }
 
 func (*SessionDaemon) GetInterfaceName() string {
@@ -78,6 +88,7 @@ func NewSessionDaemon(logger *log.Logger) *SessionDaemon {
 		flags: &Flags{
 			IgnoreMissingModules: _options.ignore,
 			ForceStart:           _options.force,
+			ProfileStartup:       _options.profileStartup,
 		},
 		log: logger,
 	}
@@ -118,6 +129,10 @@ func (s *SessionDaemon) initDsgConfig() error {
 			strings.Contains(string(sig.Path), "org_deepin_dde_daemon_loader") && len(sig.Body) >= 1 {
 			key, ok := sig.Body[0].(string)
 			if ok {
+				if key == loader.DSettingsKeyModuleMaxRestarts || key == loader.DSettingsKeyModuleRestartBackoff {
+					// 重启策略由 loader 自行监听
+					return
+				}
 				// dconfig key names must keep consistent with module names
 				moduleLocker.Lock()
 				defer moduleLocker.Unlock()
@@ -172,6 +187,13 @@ func (s *SessionDaemon) register(service *dbusutil.Service) error {
 	if err != nil {
 		return err
 	}
+
+	loader.SetModuleFailedHandler(func(name string, reason string, restartCount int, willRestart bool) {
+		err := service.Emit(s, "ModuleFailed", name, reason, uint32(restartCount), willRestart)
+		if err != nil {
+			logger.Warning(err)
+		}
+	})
 	return nil
 }
 
@@ -309,6 +331,70 @@ func (s *SessionDaemon) StartPart2() *dbus.Error {
 	}
 	// start part2
 	err := loader.EnableModules(s.part2EnabledModules, s.part2DisabledModules, 0)
+	if err == nil && s.flags.ProfileStartup {
+		s.dumpStartupProfile()
+	}
+	return dbusutil.ToError(err)
+}
+
+func (s *SessionDaemon) GetStartupProfile() (profile string, busErr *dbus.Error) {
+	data, err := json.Marshal(loader.GetStartupProfile())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+func (s *SessionDaemon) dumpStartupProfile() {
+	data, err := json.MarshalIndent(loader.GetStartupProfile(), "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+func (s *SessionDaemon) ListModules() (modules string, busErr *dbus.Error) {
+	data, err := json.Marshal(loader.ListModuleInfos())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+func (s *SessionDaemon) StartModule(name string) *dbus.Error {
+	moduleLocker.Lock()
+	defer moduleLocker.Unlock()
+
+	logger.Info("StartModule:", name)
+	err := loader.StartModule(name)
+	if err != nil {
+		logger.Warning(err)
+	}
+	return dbusutil.ToError(err)
+}
+
+func (s *SessionDaemon) StopModule(name string) *dbus.Error {
+	moduleLocker.Lock()
+	defer moduleLocker.Unlock()
+
+	logger.Info("StopModule:", name)
+	err := loader.StopModule(name)
+	if err != nil {
+		logger.Warning(err)
+	}
+	return dbusutil.ToError(err)
+}
+
+func (s *SessionDaemon) RestartModule(name string) *dbus.Error {
+	moduleLocker.Lock()
+	defer moduleLocker.Unlock()
+
+	logger.Info("RestartModule:", name)
+	err := loader.RestartModule(name)
+	if err != nil {
+		logger.Warning(err)
+	}
 	return dbusutil.ToError(err)
 }
 
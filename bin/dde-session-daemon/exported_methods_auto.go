@@ -13,9 +13,34 @@ func (v *SessionDaemon) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.CallTrace,
 			InArgs: []string{"times", "seconds"},
 		},
+		{
+			Name:    "GetStartupProfile",
+			Fn:      v.GetStartupProfile,
+			OutArgs: []string{"profile"},
+		},
+		{
+			Name:    "ListModules",
+			Fn:      v.ListModules,
+			OutArgs: []string{"modules"},
+		},
+		{
+			Name:   "RestartModule",
+			Fn:     v.RestartModule,
+			InArgs: []string{"name"},
+		},
+		{
+			Name:   "StartModule",
+			Fn:     v.StartModule,
+			InArgs: []string{"name"},
+		},
 		{
 			Name: "StartPart2",
 			Fn:   v.StartPart2,
 		},
+		{
+			Name:   "StopModule",
+			Fn:     v.StopModule,
+			InArgs: []string{"name"},
+		},
 	}
 }
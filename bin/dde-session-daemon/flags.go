@@ -7,4 +7,5 @@ package main
 type Flags struct {
 	IgnoreMissingModules bool
 	ForceStart           bool
+	ProfileStartup       bool
 }
@@ -92,6 +92,8 @@ var _options struct {
 	ignore   bool
 	force    bool
 
+	profileStartup bool
+
 	enablingModules []string
 	disableModules  []string
 }
@@ -154,6 +156,10 @@ func init() {
 	// -disable
 	flag.StringVar(&_options.disable, "disable", "", "Disable modules, ignore settings.")
 
+	// -profile-startup
+	flag.BoolVar(&_options.profileStartup, "profile-startup", false,
+		"Print the startup cost of each module and the critical path through the dependency graph as JSON.")
+
 }
 
 func main() {
@@ -219,6 +225,7 @@ func main() {
 	}
 
 	loader.SetService(service)
+	loader.LoadRestartPolicy()
 
 	if _options.logLevel == "" &&
 		(utils.IsEnvExists(log.DebugLevelEnv) || utils.IsEnvExists(log.DebugMatchEnv)) {
@@ -255,6 +262,10 @@ func main() {
 		os.Exit(1)
 	}
 
+	if app.flags.ProfileStartup {
+		app.dumpStartupProfile()
+	}
+
 	err = migrateUserEnv()
 	if err != nil {
 		logger.Warning("failed to migrate user env:", err)
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/common/audit"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+// GetAuditRecords 查询特权方法的审计记录，since 为 unix 时间戳（秒），limit 为 0 表示不限制条数，仅允许 root 进程调用
+func (d *Daemon) GetAuditRecords(sender dbus.Sender, since int64, limit int32) (records string, busErr *dbus.Error) {
+	uid, err := d.service.GetConnUID(string(sender))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	if uid != 0 {
+		return "", dbusutil.ToError(fmt.Errorf("not allow uid %d to call GetAuditRecords", uid))
+	}
+
+	entries, err := audit.Query(time.Unix(since, 0), int(limit))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
@@ -28,6 +28,12 @@ func (v *Daemon) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.DeleteCustomWallPaper,
 			InArgs: []string{"username", "file"},
 		},
+		{
+			Name:    "GetAuditRecords",
+			Fn:      v.GetAuditRecords,
+			InArgs:  []string{"since", "limit"},
+			OutArgs: []string{"records"},
+		},
 		{
 			Name:    "GetCustomWallPapers",
 			Fn:      v.GetCustomWallPapers,
@@ -40,6 +46,11 @@ func (v *Daemon) GetExportedMethods() dbusutil.ExportedMethods {
 			InArgs:  []string{"pid"},
 			OutArgs: []string{"isVM"},
 		},
+		{
+			Name:    "ListModules",
+			Fn:      v.ListModules,
+			OutArgs: []string{"modules"},
+		},
 		{
 			Name:    "NetworkGetConnections",
 			Fn:      v.NetworkGetConnections,
@@ -50,6 +61,11 @@ func (v *Daemon) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.NetworkSetConnections,
 			InArgs: []string{"data"},
 		},
+		{
+			Name:   "RestartModule",
+			Fn:     v.RestartModule,
+			InArgs: []string{"name"},
+		},
 		{
 			Name:    "SaveCustomWallPaper",
 			Fn:      v.SaveCustomWallPaper,
@@ -76,5 +92,15 @@ func (v *Daemon) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.SetPlymouthTheme,
 			InArgs: []string{"themeName"},
 		},
+		{
+			Name:   "StartModule",
+			Fn:     v.StartModule,
+			InArgs: []string{"name"},
+		},
+		{
+			Name:   "StopModule",
+			Fn:     v.StopModule,
+			InArgs: []string{"name"},
+		},
 	}
 }
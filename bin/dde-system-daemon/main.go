@@ -50,6 +50,13 @@ type Daemon struct {
 		HandleForSleep struct {
 			start bool
 		}
+
+		ModuleFailed struct {
+			name         string
+			reason       string
+			restartCount uint32
+			willRestart  bool
+		}
 	}
 }
 
@@ -115,6 +122,13 @@ func main() {
 
 	startBacklightHelperAsync(service.Conn())
 	loader.SetService(service)
+	loader.LoadRestartPolicy()
+	loader.SetModuleFailedHandler(func(name string, reason string, restartCount int, willRestart bool) {
+		err := service.Emit(_daemon, "ModuleFailed", name, reason, uint32(restartCount), willRestart)
+		if err != nil {
+			logger.Warning(err)
+		}
+	})
 	loader.StartAll()
 	defer loader.StopAll()
 
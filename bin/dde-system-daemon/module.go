@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/loader"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+var moduleLocker sync.Mutex
+
+func (d *Daemon) ListModules() (modules string, busErr *dbus.Error) {
+	data, err := json.Marshal(loader.ListModuleInfos())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+func (d *Daemon) StartModule(sender dbus.Sender, name string) *dbus.Error {
+	return d.controlModule(sender, "StartModule", name, loader.StartModule)
+}
+
+func (d *Daemon) StopModule(sender dbus.Sender, name string) *dbus.Error {
+	return d.controlModule(sender, "StopModule", name, loader.StopModule)
+}
+
+func (d *Daemon) RestartModule(sender dbus.Sender, name string) *dbus.Error {
+	return d.controlModule(sender, "RestartModule", name, loader.RestartModule)
+}
+
+// controlModule 仅允许 root 进程启停系统服务的模块
+func (d *Daemon) controlModule(sender dbus.Sender, method, name string, fn func(string) error) *dbus.Error {
+	uid, err := d.service.GetConnUID(string(sender))
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	if uid != 0 {
+		return dbusutil.ToError(fmt.Errorf("not allow uid %d to call %s", uid, method))
+	}
+
+	moduleLocker.Lock()
+	defer moduleLocker.Unlock()
+
+	logger.Infof("%s: %s", method, name)
+	err = fn(name)
+	if err != nil {
+		logger.Warning(err)
+	}
+	return dbusutil.ToError(err)
+}
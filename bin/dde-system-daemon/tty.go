@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	dbus "github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/common/audit"
 	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/keyfile"
 	"github.com/linuxdeepin/go-lib/procfs"
@@ -98,7 +99,13 @@ const (
 // NAutoVTs:默认最多可以自动启动多少个终端;若设为"0"则表示禁止自动启动任何虚拟终端,也就是禁止自动从 autovt@.service 模版实例化.
 // resetCustom:重置自定义设置
 // live:实时生效tty控制
-func (d *Daemon) SetLogindTTY(sender dbus.Sender, NAutoVTs int, resetCustom bool, live bool) *dbus.Error {
+func (d *Daemon) SetLogindTTY(sender dbus.Sender, NAutoVTs int, resetCustom bool, live bool) (busErr *dbus.Error) {
+	call := audit.Begin(d.service, sender, "Daemon1.SetLogindTTY", audit.NewArg("NAutoVTs", NAutoVTs),
+		audit.NewArg("resetCustom", resetCustom), audit.NewArg("live", live))
+	defer func() {
+		call.End(busErr)
+	}()
+
 	// checkAuth root进程和dde组件管控应用可以调用
 	var cmd string
 	uid, err := d.service.GetConnUID(string(sender))
@@ -13,6 +13,8 @@ import (
 	"github.com/linuxdeepin/go-lib/log"
 )
 
+// daemon 不按需启动：蓝牙模块需要向 BlueZ 注册配对代理并监听设备信号，
+// 以便响应配对请求和自动重连设备，这些都不经过模块自己的 D-Bus 接口。
 type daemon struct {
 	*loader.ModuleBase
 }
@@ -38,7 +40,7 @@ func (d *daemon) Start() error {
 	service := loader.GetService()
 	globalBluetooth = newBluetooth(service)
 
-	err := service.Export(dbusPath, globalBluetooth)
+	err := d.Export(dbusPath, globalBluetooth)
 	if err != nil {
 		globalBluetooth = nil
 		return fmt.Errorf("failed to export bluetooth: %s", err)
@@ -64,7 +66,7 @@ func (d *daemon) Start() error {
 	}
 
 	obexAgent := newObexAgent(service, globalBluetooth)
-	err = service.Export(obexAgentDBusPath, obexAgent)
+	err = d.Export(obexAgentDBusPath, obexAgent)
 	if err != nil {
 		return fmt.Errorf("failed to export obex agent: %s", err)
 	}
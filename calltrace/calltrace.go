@@ -16,6 +16,8 @@ var (
 	logger = log.NewLogger("daemon/calltrace")
 )
 
+// Daemon 定时检查 CPU 和内存占用，过高时记录调用栈。
+// 它不导出 D-Bus 对象，没有可以触发启动的调用，因此不能按需启动。
 type Daemon struct {
 	ct   *Manager
 	quit chan bool
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"errors"
+
+	x "github.com/linuxdeepin/go-x11-client"
+)
+
+var (
+	errOnlyX11             = errors.New("only supported on X11")
+	errClipboardNotManaged = errors.New("clipboard is not managed in this session")
+)
+
+// backend 剪贴板的底层实现，X11 下基于 selection，Wayland 下基于 data-control 协议。
+// 两者都在剪贴板内容变化时保存全部格式的数据，在所有者退出后接管剪贴板。
+type backend interface {
+	start() error
+	// setSelection 以 targets 作为剪贴板内容并成为剪贴板的所有者
+	setSelection(targets []historyTarget) error
+	// clearSelection 清空保存的内容并成为剪贴板的所有者
+	clearSelection() error
+	// stop 断开与显示服务的连接，事件循环随之退出
+	stop()
+}
+
+type x11Backend struct {
+	m *Manager
+}
+
+func (b *x11Backend) start() error {
+	return b.m.startX11()
+}
+
+func (b *x11Backend) stop() {
+	b.m.xc.Conn().Close()
+}
+
+func (b *x11Backend) setSelection(targets []historyTarget) error {
+	m := b.m
+	targetDataMap := make(map[x.Atom]*TargetData, len(targets)+1)
+	for _, t := range targets {
+		target, err := m.xc.GetAtom(t.Name)
+		if err != nil {
+			return err
+		}
+		typ, err := m.xc.GetAtom(t.Type)
+		if err != nil {
+			return err
+		}
+		targetDataMap[target] = &TargetData{
+			Target: target,
+			Type:   typ,
+			Format: t.Format,
+			Data:   t.Data,
+		}
+	}
+	m.setContent(targetDataMap)
+
+	ts, err := m.getTimestamp()
+	if err != nil {
+		return err
+	}
+	return m.becomeClipboardOwner(ts)
+}
+
+func (b *x11Backend) clearSelection() error {
+	return b.m.clearX11Clipboard()
+}
+
+// noopBackend 在 Wayland 下无法连接 compositor 或 compositor 不支持 data-control 协议时使用，
+// 不监视剪贴板，历史记录等 D-Bus 接口仍然可用
+type noopBackend struct{}
+
+func (noopBackend) start() error {
+	return nil
+}
+
+func (noopBackend) setSelection(targets []historyTarget) error {
+	return errClipboardNotManaged
+}
+
+func (noopBackend) clearSelection() error {
+	return errClipboardNotManaged
+}
+
+func (noopBackend) stop() {}
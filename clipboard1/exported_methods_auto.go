@@ -8,10 +8,34 @@ import (
 
 func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 	return dbusutil.ExportedMethods{
+		{
+			Name:   "ActivateHistoryEntry",
+			Fn:     v.ActivateHistoryEntry,
+			InArgs: []string{"id"},
+		},
 		{
 			Name: "BecomeClipboardOwner",
 			Fn:   v.BecomeClipboardOwner,
 		},
+		{
+			Name: "ClearHistory",
+			Fn:   v.ClearHistory,
+		},
+		{
+			Name:   "DeleteHistoryEntry",
+			Fn:     v.DeleteHistoryEntry,
+			InArgs: []string{"id"},
+		},
+		{
+			Name:    "ListHistory",
+			Fn:      v.ListHistory,
+			OutArgs: []string{"entries"},
+		},
+		{
+			Name:   "PinHistoryEntry",
+			Fn:     v.PinHistoryEntry,
+			InArgs: []string{"id", "pinned"},
+		},
 		{
 			Name:   "RemoveTarget",
 			Fn:     v.RemoveTarget,
@@ -21,6 +45,12 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Name: "SaveClipboard",
 			Fn:   v.SaveClipboard,
 		},
+		{
+			Name:    "SearchHistory",
+			Fn:      v.SearchHistory,
+			InArgs:  []string{"keyword"},
+			OutArgs: []string{"entries"},
+		},
 		{
 			Name: "WriteContent",
 			Fn:   v.WriteContent,
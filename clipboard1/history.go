@@ -0,0 +1,574 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	historyKindText  = "text"
+	historyKindImage = "image"
+	historyKindURIs  = "uris"
+
+	defaultHistoryMaxEntries = 50
+	historyMaxEntrySize      = 8 * 1024 * 1024
+	historyMaxTotalSize      = 64 * 1024 * 1024 // 所有记录的数据总量上限，超出时删除最旧的未固定记录
+	historyBlobMinSize       = 64 * 1024        // 超过这个大小的数据单独保存，修改记录时不需要重新写入
+	historyPreviewLength     = 256
+	historySaveDelay         = time.Second
+)
+
+var errHistoryEntryNotFound = errors.New("history entry not found")
+
+// HistoryEntry 剪贴板历史记录，通过 D-Bus 以 JSON 格式导出，不包含数据本身
+type HistoryEntry struct {
+	Id           uint64
+	Time         int64 // unix 毫秒
+	Kind         string
+	Preview      string
+	Size         int
+	SourceWindow uint32
+	Pinned       bool
+	Targets      []string
+}
+
+// historyTarget 以名称保存 target 和 type，atom 的值在 X 重启后会改变。
+// 较大的数据单独加密保存在 Blob 文件中，历史记录文件中不包含 Data。
+type historyTarget struct {
+	Name   string
+	Type   string
+	Format uint8
+	Data   []byte `json:",omitempty"`
+	Blob   string `json:",omitempty"`
+}
+
+type historyEntry struct {
+	HistoryEntry
+	Md5  string
+	Data []historyTarget
+}
+
+func (e *historyEntry) dataSize() int {
+	size := 0
+	for _, t := range e.Data {
+		size += len(t.Data)
+	}
+	return size
+}
+
+type historyFile struct {
+	NextId  uint64
+	Entries []*historyEntry
+}
+
+type history struct {
+	mu         sync.Mutex
+	entries    []*historyEntry // 从新到旧排列
+	nextId     uint64
+	enabled    bool
+	maxEntries int
+	file       string
+	key        []byte // 为空时只在内存中保存
+	saveTimer  *time.Timer
+	saveMu     sync.Mutex // 串行化 save，避免同时写入和清理 blob 文件
+}
+
+func newHistory(file string) *history {
+	return &history{
+		nextId:     1,
+		enabled:    true,
+		maxEntries: defaultHistoryMaxEntries,
+		file:       file,
+	}
+}
+
+func (h *history) setEnabled(enabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.enabled = enabled
+}
+
+func (h *history) setMaxEntries(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n <= 0 {
+		n = defaultHistoryMaxEntries
+	}
+	h.maxEntries = n
+	if h.trim() {
+		h.scheduleSave()
+	}
+}
+
+// add 新增记录，与已有记录内容相同时只将其移到最前面
+func (h *history) add(entry *historyEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.enabled {
+		return
+	}
+
+	for i, e := range h.entries {
+		if e.Md5 == entry.Md5 {
+			entry.Id = e.Id
+			entry.Pinned = e.Pinned
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	if entry.Id == 0 {
+		entry.Id = h.nextId
+		h.nextId++
+	}
+	h.entries = append([]*historyEntry{entry}, h.entries...)
+	h.trim()
+	h.scheduleSave()
+}
+
+// trim 删除超出数量上限的最旧的记录，固定的记录不计数也不删除；
+// 数据总量超出上限时继续删除最旧的未固定记录。调用者需要持有 h.mu。
+func (h *history) trim() bool {
+	count := 0
+	changed := false
+	entries := h.entries[:0]
+	for _, e := range h.entries {
+		if !e.Pinned {
+			count++
+			if count > h.maxEntries {
+				changed = true
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+	h.entries = entries
+
+	total := 0
+	for _, e := range h.entries {
+		total += e.dataSize()
+	}
+	for i := len(h.entries) - 1; i >= 0 && total > historyMaxTotalSize; i-- {
+		e := h.entries[i]
+		if e.Pinned {
+			continue
+		}
+		total -= e.dataSize()
+		h.entries = append(h.entries[:i], h.entries[i+1:]...)
+		changed = true
+	}
+	return changed
+}
+
+func (h *history) list() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]HistoryEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		result = append(result, e.HistoryEntry)
+	}
+	return result
+}
+
+// search 在文本内容和预览中不区分大小写地查找 keyword
+func (h *history) search(keyword string) []HistoryEntry {
+	keyword = strings.ToLower(keyword)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]HistoryEntry, 0)
+	for _, e := range h.entries {
+		if e.match(keyword) {
+			result = append(result, e.HistoryEntry)
+		}
+	}
+	return result
+}
+
+func (e *historyEntry) match(keyword string) bool {
+	if strings.Contains(strings.ToLower(e.Preview), keyword) {
+		return true
+	}
+	if e.Kind == historyKindImage {
+		return false
+	}
+	for _, t := range e.Data {
+		if isTextTarget(t.Name) && strings.Contains(strings.ToLower(string(t.Data)), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// get 返回记录的副本
+func (h *history) get(id uint64) (*historyEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.entries {
+		if e.Id == id {
+			entry := *e
+			return &entry, nil
+		}
+	}
+	return nil, errHistoryEntryNotFound
+}
+
+// touch 更新记录的时间并移到最前面
+func (h *history) touch(id uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, e := range h.entries {
+		if e.Id == id {
+			e.Time = time.Now().UnixMilli()
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			h.entries = append([]*historyEntry{e}, h.entries...)
+			h.scheduleSave()
+			return
+		}
+	}
+}
+
+func (h *history) setPinned(id uint64, pinned bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.entries {
+		if e.Id == id {
+			e.Pinned = pinned
+			h.trim()
+			h.scheduleSave()
+			return nil
+		}
+	}
+	return errHistoryEntryNotFound
+}
+
+func (h *history) remove(id uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, e := range h.entries {
+		if e.Id == id {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			h.scheduleSave()
+			return nil
+		}
+	}
+	return errHistoryEntryNotFound
+}
+
+// clear 删除所有未固定的记录
+func (h *history) clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := h.entries[:0]
+	for _, e := range h.entries {
+		if e.Pinned {
+			entries = append(entries, e)
+		}
+	}
+	h.entries = entries
+	h.scheduleSave()
+}
+
+// scheduleSave 合并短时间内的多次修改。调用者需要持有 h.mu。
+func (h *history) scheduleSave() {
+	if h.key == nil {
+		return
+	}
+	if h.saveTimer != nil {
+		h.saveTimer.Stop()
+	}
+	h.saveTimer = time.AfterFunc(historySaveDelay, func() {
+		err := h.save()
+		if err != nil {
+			logger.Warning("save clipboard history failed:", err)
+		}
+	})
+}
+
+func (h *history) blobDir() string {
+	return h.file + ".d"
+}
+
+type historyBlob struct {
+	target *historyTarget
+	name   string
+	data   []byte
+}
+
+func (h *history) save() error {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+
+	// 较大的数据保存到单独的文件，已经保存过的不再写入
+	h.mu.Lock()
+	var blobs []historyBlob
+	entries := make([]*historyEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		entry := *e
+		entry.Data = make([]historyTarget, len(e.Data))
+		for i := range e.Data {
+			t := e.Data[i]
+			if len(t.Data) >= historyBlobMinSize {
+				if t.Blob == "" {
+					t.Blob = fmt.Sprintf("%d-%d", e.Id, i)
+					blobs = append(blobs, historyBlob{target: &e.Data[i], name: t.Blob, data: t.Data})
+				}
+				t.Data = nil
+			}
+			entry.Data[i] = t
+		}
+		entries = append(entries, &entry)
+	}
+	data, err := json.Marshal(&historyFile{
+		NextId:  h.nextId,
+		Entries: entries,
+	})
+	key := h.key
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+
+	err = os.MkdirAll(h.blobDir(), 0700)
+	if err != nil {
+		return err
+	}
+	for _, b := range blobs {
+		err = writeHistoryFile(key, filepath.Join(h.blobDir(), b.name), b.data)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeHistoryFile(key, h.file, data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	for _, b := range blobs {
+		b.target.Blob = b.name
+	}
+	h.mu.Unlock()
+	h.removeUnusedBlobs(entries)
+	return nil
+}
+
+func writeHistoryFile(key []byte, file string, data []byte) error {
+	data, err := encryptHistory(key, data)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// removeUnusedBlobs 删除已保存的记录中不再使用的 blob 文件
+func (h *history) removeUnusedBlobs(entries []*historyEntry) {
+	used := make(map[string]struct{})
+	for _, e := range entries {
+		for _, t := range e.Data {
+			if t.Blob != "" {
+				used[t.Blob] = struct{}{}
+			}
+		}
+	}
+	files, err := os.ReadDir(h.blobDir())
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	for _, f := range files {
+		if _, ok := used[f.Name()]; ok {
+			continue
+		}
+		err = os.Remove(filepath.Join(h.blobDir(), f.Name()))
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+}
+
+// loadBlobs 读取记录中单独保存的数据，无法读取时返回错误
+func (h *history) loadBlobs(key []byte, e *historyEntry) error {
+	for i := range e.Data {
+		t := &e.Data[i]
+		if t.Blob == "" {
+			continue
+		}
+		if filepath.Base(t.Blob) != t.Blob {
+			return fmt.Errorf("invalid blob name %q", t.Blob)
+		}
+		data, err := os.ReadFile(filepath.Join(h.blobDir(), t.Blob))
+		if err != nil {
+			return err
+		}
+		t.Data, err = decryptHistory(key, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load 使用 key 解密并加载历史记录，之后的修改会以同一个 key 加密保存
+func (h *history) load(key []byte) error {
+	data, err := os.ReadFile(h.file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var hf historyFile
+	if err == nil {
+		data, err = decryptHistory(key, data)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(data, &hf)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 单独保存的数据丢失时跳过这条记录
+	loaded := hf.Entries[:0]
+	for _, e := range hf.Entries {
+		err := h.loadBlobs(key, e)
+		if err != nil {
+			logger.Warningf("skip clipboard history entry %d: %v", e.Id, err)
+			continue
+		}
+		loaded = append(loaded, e)
+	}
+	changed := len(loaded) != len(hf.Entries)
+	hf.Entries = loaded
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.key = key
+	// 加载完成之前新增的记录排在前面
+	existed := make(map[string]struct{}, len(h.entries))
+	for _, e := range h.entries {
+		existed[e.Md5] = struct{}{}
+	}
+	if hf.NextId > 1 {
+		// 加载前新增的记录的 id 排在已保存的记录之后
+		offset := hf.NextId - 1
+		for _, e := range h.entries {
+			e.Id += offset
+		}
+		h.nextId += offset
+	}
+	for _, e := range hf.Entries {
+		if _, ok := existed[e.Md5]; !ok {
+			h.entries = append(h.entries, e)
+		}
+	}
+	h.trim()
+	if changed || len(h.entries) != len(hf.Entries) {
+		h.scheduleSave()
+	}
+	return nil
+}
+
+func encryptHistory(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func decryptHistory(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("history file is too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+var textTargets = []string{"UTF8_STRING", "text/plain;charset=utf-8", "text/plain", "STRING", "TEXT"}
+
+func isTextTarget(name string) bool {
+	for _, t := range textTargets {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyHistory 根据 targets 判断内容类型并生成预览，不支持的内容返回空字符串
+func classifyHistory(targets []historyTarget) (kind, preview string) {
+	byName := make(map[string]*historyTarget, len(targets))
+	for i := range targets {
+		byName[targets[i].Name] = &targets[i]
+	}
+
+	if t, ok := byName["text/uri-list"]; ok {
+		var uris []string
+		for _, line := range strings.Split(string(t.Data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				uris = append(uris, line)
+			}
+		}
+		if len(uris) > 0 {
+			return historyKindURIs, truncatePreview(strings.Join(uris, "\n"))
+		}
+	}
+	for _, name := range []string{"image/png", "image/jpeg", "image/bmp"} {
+		if _, ok := byName[name]; ok {
+			return historyKindImage, name
+		}
+	}
+	for _, name := range textTargets {
+		if t, ok := byName[name]; ok && len(t.Data) > 0 {
+			return historyKindText, truncatePreview(string(t.Data))
+		}
+	}
+	return "", ""
+}
+
+func truncatePreview(s string) string {
+	runes := []rune(s)
+	if len(runes) > historyPreviewLength {
+		return string(runes[:historyPreviewLength])
+	}
+	return s
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/dde-daemon/clipboard1/mocks"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTextEntry(text string) *historyEntry {
+	targets := []historyTarget{{Name: "UTF8_STRING", Type: "UTF8_STRING", Format: 8, Data: []byte(text)}}
+	kind, preview := classifyHistory(targets)
+	return &historyEntry{
+		HistoryEntry: HistoryEntry{Kind: kind, Preview: preview},
+		Md5:          kind + ":" + getBytesMd5sum([]byte(text)),
+		Data:         targets,
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := newHistory(filepath.Join(t.TempDir(), "history"))
+	h.setMaxEntries(2)
+
+	h.add(newTextEntry("first"))
+	h.add(newTextEntry("second"))
+	h.add(newTextEntry("first"))
+	entries := h.list()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "first", entries[0].Preview)
+	assert.Equal(t, uint64(1), entries[0].Id)
+
+	require.NoError(t, h.setPinned(2, true))
+	h.add(newTextEntry("third"))
+	h.add(newTextEntry("fourth"))
+	entries = h.list()
+	require.Len(t, entries, 3)
+	assert.Equal(t, "fourth", entries[0].Preview)
+	assert.Equal(t, "third", entries[1].Preview)
+	assert.Equal(t, "second", entries[2].Preview)
+	assert.True(t, entries[2].Pinned)
+
+	assert.Len(t, h.search("THIRD"), 1)
+	assert.Empty(t, h.search("missing"))
+
+	h.touch(2)
+	assert.Equal(t, "second", h.list()[0].Preview)
+
+	require.NoError(t, h.remove(3))
+	assert.Equal(t, errHistoryEntryNotFound, h.remove(3))
+
+	h.clear()
+	entries = h.list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", entries[0].Preview)
+
+	h.setEnabled(false)
+	h.add(newTextEntry("ignored"))
+	assert.Len(t, h.list(), 1)
+}
+
+func TestHistorySaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+
+	h := newHistory(file)
+	require.NoError(t, h.load(key))
+	h.add(newTextEntry("secret text"))
+	require.NoError(t, h.save())
+
+	h2 := newHistory(file)
+	h2.add(newTextEntry("before load"))
+	require.NoError(t, h2.load(key))
+	entries := h2.list()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "before load", entries[0].Preview)
+	assert.Equal(t, "secret text", entries[1].Preview)
+	assert.NotEqual(t, entries[0].Id, entries[1].Id)
+
+	wrongKey := make([]byte, 32)
+	assert.Error(t, newHistory(file).load(wrongKey))
+}
+
+func newImageEntry(name string, image []byte) *historyEntry {
+	targets := []historyTarget{{Name: "image/png", Type: "image/png", Format: 8, Data: image}}
+	return &historyEntry{
+		HistoryEntry: HistoryEntry{Kind: historyKindImage, Preview: "image/png"},
+		Md5:          historyKindImage + ":" + name,
+		Data:         targets,
+	}
+}
+
+func TestHistoryTotalSize(t *testing.T) {
+	h := newHistory(filepath.Join(t.TempDir(), "history"))
+	// 共用同一块数据，只按长度计算总量
+	image := make([]byte, historyMaxEntrySize)
+	pinned := newImageEntry("pinned", image)
+	h.add(pinned)
+	require.NoError(t, h.setPinned(pinned.Id, true))
+	for i := 0; i < 10; i++ {
+		h.add(newImageEntry(fmt.Sprint(i), image))
+	}
+
+	entries := h.list()
+	require.Len(t, entries, historyMaxTotalSize/historyMaxEntrySize)
+	assert.Equal(t, historyKindImage+":9", h.entries[0].Md5)
+	// 固定的记录不会被删除
+	assert.True(t, entries[len(entries)-1].Pinned)
+}
+
+func TestHistoryBlob(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	key := make([]byte, 32)
+	image := make([]byte, historyBlobMinSize)
+	for i := range image {
+		image[i] = byte(i)
+	}
+
+	h := newHistory(file)
+	require.NoError(t, h.load(key))
+	h.add(newImageEntry("image", image))
+	h.add(newTextEntry("text"))
+	require.NoError(t, h.save())
+
+	// 较大的数据单独保存，历史记录文件中只有较小的数据
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(historyBlobMinSize))
+	blobs, err := os.ReadDir(h.blobDir())
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+	blobInfo, err := blobs[0].Info()
+	require.NoError(t, err)
+	modTime := blobInfo.ModTime()
+
+	// 再次保存时不重写已保存的数据
+	h.touch(1)
+	require.NoError(t, h.save())
+	blobInfo, err = os.Stat(filepath.Join(h.blobDir(), blobs[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, modTime, blobInfo.ModTime())
+
+	h2 := newHistory(file)
+	require.NoError(t, h2.load(key))
+	entry, err := h2.get(1)
+	require.NoError(t, err)
+	assert.Equal(t, image, entry.Data[0].Data)
+
+	// 删除记录后清理不再使用的数据
+	require.NoError(t, h2.remove(1))
+	require.NoError(t, h2.save())
+	blobs, err = os.ReadDir(h.blobDir())
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+
+	// 数据丢失的记录被跳过
+	require.NoError(t, h.save())
+	require.NoError(t, os.RemoveAll(h.blobDir()))
+	h3 := newHistory(file)
+	require.NoError(t, h3.load(key))
+	entries := h3.list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "text", entries[0].Preview)
+}
+
+func TestClassifyHistory(t *testing.T) {
+	kind, preview := classifyHistory([]historyTarget{
+		{Name: "text/plain", Data: []byte("/home/a.txt")},
+		{Name: "text/uri-list", Data: []byte("# comment\r\nfile:///home/a.txt\r\n")},
+	})
+	assert.Equal(t, historyKindURIs, kind)
+	assert.Equal(t, "file:///home/a.txt", preview)
+
+	kind, preview = classifyHistory([]historyTarget{
+		{Name: "text/html", Data: []byte("<img>")},
+		{Name: "image/png", Data: []byte{0x89}},
+	})
+	assert.Equal(t, historyKindImage, kind)
+	assert.Equal(t, "image/png", preview)
+
+	kind, _ = classifyHistory([]historyTarget{{Name: "application/x-private"}})
+	assert.Equal(t, "", kind)
+}
+
+func TestManager_recordHistory(t *testing.T) {
+	initAtomsForTest()
+	xc := &mocks.XClient{}
+	m := &Manager{xc: xc, history: newHistory(filepath.Join(t.TempDir(), "history"))}
+
+	atomUTF8 := x.Atom(200)
+	atomOther := x.Atom(201)
+	xc.On("GetAtomName", atomUTF8).Return("UTF8_STRING", nil)
+	xc.On("GetAtomName", atomOther).Return("application/x-private", nil)
+
+	m.recordHistory(map[x.Atom]*TargetData{
+		atomUTF8:  {Target: atomUTF8, Type: atomUTF8, Format: 8, Data: []byte("hello")},
+		atomOther: {Target: atomOther, Type: atomUTF8, Format: 8, Data: []byte("data")},
+	}, 42)
+
+	entries := m.history.list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, historyKindText, entries[0].Kind)
+	assert.Equal(t, "hello", entries[0].Preview)
+	assert.Equal(t, uint32(42), entries[0].SourceWindow)
+	assert.Equal(t, 9, entries[0].Size)
+
+	data, busErr := m.ListHistory()
+	assert.Nil(t, busErr)
+	assert.Contains(t, data, fmt.Sprintf(`"Id":%d`, entries[0].Id))
+}
@@ -37,6 +37,7 @@ var (
 	atomNull                 x.Atom //nolint
 	atomTimestampProp        x.Atom
 	atomFromClipboardManager x.Atom
+	atomPrimaryProp          x.Atom
 
 	selectionMaxSize int
 )
@@ -45,6 +46,8 @@ const (
 	dSettingsAppID                      = "org.deepin.dde.daemon"
 	dSettingsClipboardName              = "org.deepin.dde.daemon.clipboard"
 	dSettingsKeySaveAtomIncrDataEnabled = "saveAtomIncrDataEnabled"
+	dSettingsKeyHistoryEnabled          = "historyEnabled"
+	dSettingsKeyHistoryMaxEntries       = "historyMaxEntries"
 )
 
 func initAtoms(xConn *x.Conn) {
@@ -62,6 +65,7 @@ func initAtoms(xConn *x.Conn) {
 	atomTimestampProp, _ = xConn.GetAtom("_TIMESTAMP_PROP")
 	atomNull, _ = xConn.GetAtom("NULL")
 	atomFromClipboardManager, _ = xConn.GetAtom("FROM_DEEPIN_CLIPBOARD_MANAGER")
+	atomPrimaryProp, _ = xConn.GetAtom("_DEEPIN_PRIMARY_PROP")
 	selectionMaxSize = 65432
 	logger.Debug("selectionMaxSize:", selectionMaxSize)
 }
@@ -94,13 +98,37 @@ type Manager struct {
 	saveTargetsRequestor    x.Window
 	dsClipboardManager      ConfigManager.Manager
 	saveAtomIncrDataEnabled bool
+
+	backend backend
+	history *history
+	safeGo  func(fn func()) // 启动长期运行的协程，崩溃时由 loader 重启模块
+
+	policy         savePolicy
+	autoClearMu    sync.Mutex
+	autoClearTimer *time.Timer
+	contentSerial  uint64 // 每次更新内容时加一，用于判断自动清空前内容是否变化
+
+	primaryAcquireTs x.Timestamp   // 获取 PRIMARY selection 的时间戳
+	primaryLostTs    x.Timestamp   // 丢失 PRIMARY selection 的时间戳
+	primaryContent   []*TargetData // 受 contentMu 保护
+	primaryMu        sync.Mutex    // 保证同一时间只保存一次 PRIMARY 的内容
+	primaryConfig    primaryConfig
+	primaryTimerMu   sync.Mutex
+	primaryTimer     *time.Timer
 }
 
-func (m *Manager) getTargetData(target x.Atom) *TargetData {
+// getContent 返回 selection 对应的内容，内容只会被整体替换，返回后可以不加锁读取
+func (m *Manager) getContent(selection x.Atom) []*TargetData {
 	m.contentMu.Lock()
 	defer m.contentMu.Unlock()
+	if selection == x.AtomPrimary {
+		return m.primaryContent
+	}
+	return m.content
+}
 
-	for _, td := range m.content {
+func (m *Manager) getTargetData(selection, target x.Atom) *TargetData {
+	for _, td := range m.getContent(selection) {
 		if td.Target == target {
 			return td
 		}
@@ -124,6 +152,22 @@ func (m *Manager) setContent(targetDataMap map[x.Atom]*TargetData) {
 	m.contentMu.Lock()
 	m.content = targetDataSlice
 	m.contentMu.Unlock()
+	m.contentChanged()
+}
+
+// contentChanged 在剪贴板内容更新后调用，重新开始自动清空的计时
+func (m *Manager) contentChanged() {
+	m.autoClearMu.Lock()
+	m.contentSerial++
+	m.autoClearMu.Unlock()
+	m.scheduleAutoClear()
+}
+
+// saveContent 保存从其他应用获取的剪贴板内容，source 为内容的来源窗口
+func (m *Manager) saveContent(targetDataMap map[x.Atom]*TargetData, source x.Window) {
+	m.recordHistory(targetDataMap, source)
+	m.setContent(targetDataMap)
+	m.syncClipboardToPrimary()
 }
 
 func mapToSliceTargetData(dataMap map[x.Atom]*TargetData) []*TargetData {
@@ -168,10 +212,88 @@ func (m *Manager) getConfigFromDSettings() error {
 		logger.Warning(err)
 	}
 
+	getHistoryConfig := func() {
+		if m.history == nil {
+			return
+		}
+		v, err := m.dsClipboardManager.Value(0, dSettingsKeyHistoryEnabled)
+		if err == nil {
+			if enabled, ok := v.Value().(bool); ok {
+				m.history.setEnabled(enabled)
+			}
+		}
+		v, err = m.dsClipboardManager.Value(0, dSettingsKeyHistoryMaxEntries)
+		if err == nil {
+			switch val := v.Value().(type) {
+			case int64:
+				m.history.setMaxEntries(int(val))
+			case float64:
+				m.history.setMaxEntries(int(val))
+			}
+		}
+	}
+
+	getPolicyConfig := func() {
+		v, err := m.dsClipboardManager.Value(0, dSettingsKeyDenyApps)
+		if err == nil {
+			var apps []string
+			if items, ok := v.Value().([]dbus.Variant); ok {
+				for _, item := range items {
+					if app, ok := item.Value().(string); ok {
+						apps = append(apps, app)
+					}
+				}
+			}
+			m.policy.setDenyApps(apps)
+		}
+		v, err = m.dsClipboardManager.Value(0, dSettingsKeyMaxTargetSize)
+		if err == nil {
+			switch val := v.Value().(type) {
+			case int64:
+				m.policy.setMaxTargetSize(int(val))
+			case float64:
+				m.policy.setMaxTargetSize(int(val))
+			}
+		}
+		v, err = m.dsClipboardManager.Value(0, dSettingsKeyAutoClearTimeout)
+		if err == nil {
+			switch val := v.Value().(type) {
+			case int64:
+				m.policy.setAutoClearTimeout(time.Duration(val) * time.Second)
+			case float64:
+				m.policy.setAutoClearTimeout(time.Duration(val) * time.Second)
+			}
+		}
+	}
+
+	getPrimaryConfig := func() {
+		v, err := m.dsClipboardManager.Value(0, dSettingsKeyPrimarySyncMode)
+		if err == nil {
+			if mode, ok := v.Value().(string); ok {
+				m.primaryConfig.setSyncMode(mode)
+			}
+		}
+		v, err = m.dsClipboardManager.Value(0, dSettingsKeyPrimaryPersistEnabled)
+		if err == nil {
+			if enabled, ok := v.Value().(bool); ok {
+				m.primaryConfig.setPersistEnabled(enabled)
+			}
+		}
+	}
+
 	_, err = m.dsClipboardManager.ConnectValueChanged(func(key string) {
 		switch key {
 		case dSettingsKeySaveAtomIncrDataEnabled:
 			getSaveAtomIncrDataEnabled()
+		case dSettingsKeyHistoryEnabled, dSettingsKeyHistoryMaxEntries:
+			getHistoryConfig()
+		case dSettingsKeyDenyApps, dSettingsKeyMaxTargetSize:
+			getPolicyConfig()
+		case dSettingsKeyAutoClearTimeout:
+			getPolicyConfig()
+			m.scheduleAutoClear()
+		case dSettingsKeyPrimarySyncMode, dSettingsKeyPrimaryPersistEnabled:
+			getPrimaryConfig()
 		}
 	})
 
@@ -180,6 +302,9 @@ func (m *Manager) getConfigFromDSettings() error {
 	}
 
 	getSaveAtomIncrDataEnabled()
+	getHistoryConfig()
+	getPolicyConfig()
+	getPrimaryConfig()
 
 	return nil
 }
@@ -191,6 +316,10 @@ func (m *Manager) start() error {
 		logger.Warning(err)
 	}
 
+	return m.backend.start()
+}
+
+func (m *Manager) startX11() error {
 	owner, err := m.xc.GetSelectionOwner(atomClipboardManager)
 	if err != nil {
 		return err
@@ -213,6 +342,14 @@ func (m *Manager) start() error {
 		logger.Warning(err)
 	}
 
+	err = m.xc.SelectSelectionInputE(m.window, x.AtomPrimary,
+		xfixes.SelectionEventMaskSetSelectionOwner|
+			xfixes.SelectionEventMaskSelectionClientClose|
+			xfixes.SelectionEventMaskSelectionWindowDestroy)
+	if err != nil {
+		logger.Warning(err)
+	}
+
 	err = m.xc.SelectSelectionInputE(m.window, atomClipboardManager,
 		xfixes.SelectionEventMaskSetSelectionOwner)
 	if err != nil {
@@ -222,11 +359,11 @@ func (m *Manager) start() error {
 	m.ec = newEventCaptor()
 	eventChan := make(chan x.GenericEvent, 50)
 	m.xc.Conn().AddEventChan(eventChan)
-	go func() {
+	m.safeGo(func() {
 		for ev := range eventChan {
 			m.handleEvent(ev)
 		}
-	}()
+	})
 
 	ts, err := m.getTimestamp()
 	if err != nil {
@@ -258,7 +395,7 @@ func (m *Manager) handleEvent(ev x.GenericEvent) {
 
 		if event.Selection == atomClipboardManager {
 			go m.convertClipboardManager(event)
-		} else if event.Selection == atomClipboard {
+		} else if event.Selection == atomClipboard || event.Selection == x.AtomPrimary {
 			go m.convertClipboard(event)
 		}
 
@@ -320,12 +457,14 @@ func (m *Manager) handleEvent(ev x.GenericEvent) {
 							logger.Debug("do not call handleClipboardUpdated")
 							return
 						}
-						err := m.handleClipboardUpdated(event.SelectionTimestamp)
+						err := m.handleClipboardUpdated(event.SelectionTimestamp, event.Owner)
 						if err != nil {
 							logger.Warning("handle clipboard updated err:", err)
 						}
 					})
 				}
+			} else if event.Selection == x.AtomPrimary {
+				m.handlePrimaryOwnerChanged(event.Owner, event.SelectionTimestamp)
 			} else if event.Selection == atomClipboardManager {
 				if event.Owner == m.window {
 					logger.Debug("i have become the owner of CLIPBOARD_MANAGER selection, ts:", event.SelectionTimestamp)
@@ -344,13 +483,15 @@ func (m *Manager) handleEvent(ev x.GenericEvent) {
 				if err != nil {
 					logger.Warning(err)
 				}
+			} else if event.Selection == x.AtomPrimary {
+				m.handlePrimaryOwnerLost(event.Timestamp)
 			}
 		}
 	}
 }
 
 // 处理剪贴板数据更新
-func (m *Manager) handleClipboardUpdated(ts x.Timestamp) error {
+func (m *Manager) handleClipboardUpdated(ts x.Timestamp, owner x.Window) error {
 	logger.Debug("handleClipboardUpdated", ts)
 
 	targets, err := m.getClipboardTargets(ts)
@@ -359,6 +500,9 @@ func (m *Manager) handleClipboardUpdated(ts x.Timestamp) error {
 	}
 	logger.Debug("targets:", targets)
 
+	// 过滤密码等敏感内容和禁止保存的应用复制的数据
+	filter := m.newSaveFilter(targets, owner)
+
 	// 过滤云桌面复制的数据
 	// 判断是否从wps复制的数据并且是否包含text格式
 	var tmpTarget x.Atom
@@ -384,20 +528,22 @@ func (m *Manager) handleClipboardUpdated(ts x.Timestamp) error {
 
 	// 如果 是从wps复制的数据并且包含text格式数据，则先读取text数据大小
 	// 如果text数据大小超过10M，则只缓存text数据，否则所有格式都缓存
-	if hasKingsoftData && hasTextData {
+	if hasKingsoftData && hasTextData && !m.shouldIgnoreSaveTarget(tmpTarget, "text/plain", filter) {
 		td, err := m.saveTarget(tmpTarget, ts)
-		if err == nil && len(td.Data) > 10*1024*1024 {
-			m.setContent(map[x.Atom]*TargetData{
+		if err == nil && td != nil && len(td.Data) > 10*1024*1024 {
+			targetDataMap := map[x.Atom]*TargetData{
 				td.Target: td,
-			})
+			}
+			m.saveContent(targetDataMap, owner)
 
 			logger.Debug("handleClipboardUpdated  wps text format finish", ts)
 			return nil
 		}
 	}
 
-	targetDataMap := m.saveTargets(targets, ts)
-	m.setContent(targetDataMap)
+	// 内容被过滤时保存空内容，清除之前保存的数据，避免所有者退出后接管剪贴板时提供旧的内容
+	targetDataMap := m.saveTargets(targets, ts, filter)
+	m.saveContent(targetDataMap, owner)
 
 	logger.Debug("handleClipboardUpdated all format finish", ts)
 	return nil
@@ -426,13 +572,18 @@ func (m *Manager) becomeClipboardOwner(ts x.Timestamp) error {
 
 // 转换 CLIPBOARD selection 的 TARGETS target，剪贴板获取支持的所有 targets。
 func (m *Manager) getClipboardTargets(ts x.Timestamp) ([]x.Atom, error) {
+	return m.getSelectionTargets(atomClipboard, ts)
+}
+
+func (m *Manager) getSelectionTargets(selection x.Atom, ts x.Timestamp) ([]x.Atom, error) {
+	prop := getSelectionProperty(selection, atomTargets)
 	selNotifyEvent, err := m.ec.captureSelectionNotifyEvent(func() error {
-		m.xc.ConvertSelection(m.window, atomClipboard,
-			atomTargets, atomTargets, ts)
+		m.xc.ConvertSelection(m.window, selection,
+			atomTargets, prop, ts)
 		return m.xc.Flush()
 	}, func(event *x.SelectionNotifyEvent) bool {
 		return event.Target == atomTargets &&
-			event.Selection == atomClipboard &&
+			event.Selection == selection &&
 			event.Requestor == m.window
 	})
 	if err != nil {
@@ -440,7 +591,7 @@ func (m *Manager) getClipboardTargets(ts x.Timestamp) ([]x.Atom, error) {
 	}
 
 	if selNotifyEvent.Property == x.None {
-		return nil, errors.New("failed to convert clipboard targets")
+		return nil, errors.New("failed to convert selection targets")
 	}
 
 	propReply, err := m.getProperty(m.window, selNotifyEvent.Property, true)
@@ -566,6 +717,8 @@ func (m *Manager) covertClipboardManagerSaveTargets(ev *x.SelectionRequestEvent)
 
 	logger.Debug("targets:", targets)
 
+	filter := m.newSaveFilter(targets, ev.Requestor)
+
 	// 过滤云桌面复制的数据
 	// 判断是否从wps复制的数据并且是否包含text格式
 	var tmpTarget x.Atom
@@ -591,12 +744,13 @@ func (m *Manager) covertClipboardManagerSaveTargets(ev *x.SelectionRequestEvent)
 
 	// 如果 是从wps复制的数据并且包含text格式数据，则先读取text数据大小
 	// 如果text数据大小超过10M，则只缓存text数据，否则所有格式都缓存
-	if hasKingsoftData && hasTextData {
+	if hasKingsoftData && hasTextData && !m.shouldIgnoreSaveTarget(tmpTarget, "text/plain", filter) {
 		td, err := m.saveTarget(tmpTarget, ev.Time)
-		if err == nil && len(td.Data) > 10*1024*1024 {
-			m.setContent(map[x.Atom]*TargetData{
+		if err == nil && td != nil && len(td.Data) > 10*1024*1024 {
+			targetDataMap := map[x.Atom]*TargetData{
 				td.Target: td,
-			})
+			}
+			m.saveContent(targetDataMap, ev.Requestor)
 
 			logger.Debug("covertClipboardManagerSaveTargets  text format finish", ev.Time)
 			m.saveTargetsRequestor = ev.Requestor
@@ -605,20 +759,24 @@ func (m *Manager) covertClipboardManagerSaveTargets(ev *x.SelectionRequestEvent)
 		}
 	}
 
-	targetDataMap := m.saveTargets(targets, ev.Time)
-	m.setContent(targetDataMap)
+	targetDataMap := m.saveTargets(targets, ev.Time, filter)
+	m.saveContent(targetDataMap, ev.Requestor)
 
 	m.saveTargetsRequestor = ev.Requestor
 	m.saveTargetsSuccessTime = time.Now()
 	return nil
 }
 
-// 处理 CLIPBOARD selection 的转换请求
+// 处理 CLIPBOARD 和 PRIMARY selection 的转换请求
 func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
 	targetName, _ := m.xc.GetAtomName(ev.Target)
 	logger.Debugf("convert clipboard target %s|%d", targetName, ev.Target)
 
-	if !canConvertSelection(m.clipboardAcquireTs, m.clipboardLostTs, ev.Time) {
+	acquireTs, lostTs := m.clipboardAcquireTs, m.clipboardLostTs
+	if ev.Selection == x.AtomPrimary {
+		acquireTs, lostTs = m.primaryAcquireTs, m.primaryLostTs
+	}
+	if !canConvertSelection(acquireTs, lostTs, ev.Time) {
 		logger.Debug("can not covert selection, ts invalid")
 		m.finishSelectionRequest(ev, false)
 		return
@@ -630,11 +788,9 @@ func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
 		w := x.NewWriter()
 		w.Write4b(uint32(atomTargets))
 		w.Write4b(uint32(atomTimestamp))
-		m.contentMu.Lock()
-		for _, targetData := range m.content {
+		for _, targetData := range m.getContent(ev.Selection) {
 			w.Write4b(uint32(targetData.Target))
 		}
-		m.contentMu.Unlock()
 
 		err := m.xc.ChangePropertyE(x.PropModeReplace, ev.Requestor,
 			ev.Property, x.AtomAtom, 32, w.Bytes())
@@ -645,7 +801,7 @@ func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
 	case atomTimestamp:
 		// TIMESTAMP
 		w := x.NewWriter()
-		w.Write4b(uint32(m.clipboardAcquireTs))
+		w.Write4b(uint32(acquireTs))
 		err := m.xc.ChangePropertyE(x.PropModeReplace, ev.Requestor,
 			ev.Property, x.AtomInteger, 32, w.Bytes())
 		if err != nil {
@@ -654,7 +810,7 @@ func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
 		m.finishSelectionRequest(ev, err == nil)
 		// TODO 支持 MULTIPLE target
 	default:
-		targetData := m.getTargetData(ev.Target)
+		targetData := m.getTargetData(ev.Selection, ev.Target)
 		if targetData == nil {
 			m.finishSelectionRequest(ev, false)
 			return
@@ -785,7 +941,11 @@ func (m *Manager) finishSelectionRequest(ev *x.SelectionRequestEvent, success bo
 	}
 }
 
-func (m *Manager) saveTargets(targets []x.Atom, ts x.Timestamp) map[x.Atom]*TargetData {
+func (m *Manager) saveTargets(targets []x.Atom, ts x.Timestamp, filter saveFilter) map[x.Atom]*TargetData {
+	return m.saveSelectionTargets(atomClipboard, targets, ts, filter)
+}
+
+func (m *Manager) saveSelectionTargets(selection x.Atom, targets []x.Atom, ts x.Timestamp, filter saveFilter) map[x.Atom]*TargetData {
 	result := make(map[x.Atom]*TargetData, len(targets))
 
 	for _, target := range targets {
@@ -794,15 +954,17 @@ func (m *Manager) saveTargets(targets []x.Atom, ts x.Timestamp) map[x.Atom]*Targ
 			logger.Warning(err)
 			continue
 		}
-		if shouldIgnoreSaveTarget(target, targetName) {
+		if m.shouldIgnoreSaveTarget(target, targetName, filter) {
 			logger.Debugf("ignore target %s|%d", targetName, target)
 			continue
 		}
 
 		logger.Debugf("save target %s|%d", targetName, target)
-		td, err := m.saveTarget(target, ts)
+		td, err := m.saveSelectionTarget(selection, target, ts)
 		if err != nil {
 			logger.Warningf("save target failed %s|%d, err: %v", targetName, target, err)
+		} else if td == nil {
+			logger.Debugf("skip incr target %s|%d", targetName, target)
 		} else {
 			result[td.Target] = td
 			logger.Debugf("save target success %s|%d", targetName, target)
@@ -811,7 +973,11 @@ func (m *Manager) saveTargets(targets []x.Atom, ts x.Timestamp) map[x.Atom]*Targ
 	return result
 }
 
-func shouldIgnoreSaveTarget(target x.Atom, targetName string) bool {
+// shouldIgnoreSaveTarget 判断是否跳过 target 的保存，filter 要求忽略整个内容时跳过所有 target
+func (m *Manager) shouldIgnoreSaveTarget(target x.Atom, targetName string, filter saveFilter) bool {
+	if filter.ignoreAll() {
+		return true
+	}
 	switch target {
 	case atomTargets, atomSaveTargets,
 		atomTimestamp, atomMultiple, atomDelete,
@@ -819,6 +985,11 @@ func shouldIgnoreSaveTarget(target x.Atom, targetName string) bool {
 		x.AtomPixmap:
 		return true
 	}
+	return shouldIgnoreTargetName(targetName)
+}
+
+// shouldIgnoreTargetName 只保存常见格式的图片，X11 的 target 名称与 Wayland 的 mime 类型都使用这个规则
+func shouldIgnoreTargetName(targetName string) bool {
 	if strings.HasPrefix(targetName, "image/") {
 		switch targetName {
 		case "image/jpeg", "image/png", "image/bmp":
@@ -831,11 +1002,24 @@ func shouldIgnoreSaveTarget(target x.Atom, targetName string) bool {
 }
 
 func (m *Manager) saveTarget(target x.Atom, ts x.Timestamp) (targetData *TargetData, err error) {
+	return m.saveSelectionTarget(atomClipboard, target, ts)
+}
+
+// getSelectionProperty 返回转换 selection 时使用的属性，PRIMARY 使用单独的属性，避免与同时进行的 CLIPBOARD 转换冲突
+func getSelectionProperty(selection, target x.Atom) x.Atom {
+	if selection == x.AtomPrimary {
+		return atomPrimaryProp
+	}
+	return target
+}
+
+func (m *Manager) saveSelectionTarget(selection, target x.Atom, ts x.Timestamp) (targetData *TargetData, err error) {
+	prop := getSelectionProperty(selection, target)
 	selNotifyEvent, err := m.ec.captureSelectionNotifyEvent(func() error {
-		m.xc.ConvertSelection(m.window, atomClipboard, target, target, ts)
+		m.xc.ConvertSelection(m.window, selection, target, prop, ts)
 		return m.xc.Flush()
 	}, func(event *x.SelectionNotifyEvent) bool {
-		return event.Selection == atomClipboard &&
+		return event.Selection == selection &&
 			event.Requestor == m.window &&
 			event.Target == target
 	})
@@ -853,6 +1037,11 @@ func (m *Manager) saveTarget(target x.Atom, ts x.Timestamp) (targetData *TargetD
 	}
 
 	if propReply.Type == atomIncr {
+		// INCR 属性的值是数据大小的下限
+		if len(propReply.Value) >= 4 && m.policy.isTooLarge(int(x.Get32(propReply.Value))) {
+			err = errTargetTooLarge
+			return
+		}
 		if m.saveAtomIncrDataEnabled {
 			targetData, err = m.receiveTargetIncr(target, selNotifyEvent.Property)
 		}
@@ -862,6 +1051,10 @@ func (m *Manager) saveTarget(target x.Atom, ts x.Timestamp) (targetData *TargetD
 			return
 		}
 		logger.Debug("data len:", len(propReply.Value))
+		if m.policy.isTooLarge(len(propReply.Value)) {
+			err = errTargetTooLarge
+			return
+		}
 		targetData = &TargetData{
 			Target: target,
 			Type:   propReply.Type,
@@ -952,6 +1145,10 @@ func (m *Manager) receiveTargetIncr(target, prop x.Atom) (targetData *TargetData
 			logger.Debugf("incr receive data size: %d", len(propReply.Value))
 		}
 		total += len(propReply.Value)
+		if m.policy.isTooLarge(total) {
+			err = errTargetTooLarge
+			return
+		}
 		data = append(data, propReply.Value)
 	}
 }
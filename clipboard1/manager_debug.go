@@ -17,6 +17,9 @@ import (
 )
 
 func (m *Manager) saveClipboard() error {
+	if m.xc == nil {
+		return errOnlyX11
+	}
 	owner, err := m.xc.GetSelectionOwner(atomClipboard)
 	if err != nil {
 		return err
@@ -35,8 +38,8 @@ func (m *Manager) saveClipboard() error {
 	}
 	logger.Debug("targets:", targets)
 
-	targetDataMap := m.saveTargets(targets, ts)
-	m.setContent(targetDataMap)
+	targetDataMap := m.saveTargets(targets, ts, m.newSaveFilter(targets, owner))
+	m.saveContent(targetDataMap, owner)
 	m.contentMu.Lock()
 	for _, targetData := range m.content {
 		logger.Debugf("target %d type: %v", targetData.Target, targetData.Type)
@@ -46,6 +49,7 @@ func (m *Manager) saveClipboard() error {
 	return nil
 }
 
+// SaveClipboard 立即保存当前剪贴板的内容，只支持 X11，会按 denyApps 配置过滤剪贴板所有者所属的应用
 func (m *Manager) SaveClipboard() *dbus.Error {
 	logger.Info("dbus call SaveClipboard")
 
@@ -59,6 +63,9 @@ func (m *Manager) SaveClipboard() *dbus.Error {
 }
 
 func (m *Manager) writeContent() error {
+	if m.xc == nil {
+		return errOnlyX11
+	}
 	dir := "/tmp/dde-session-daemon-clipboard"
 
 	err := os.Mkdir(dir, 0700)
@@ -112,6 +119,9 @@ func (m *Manager) WriteContent() *dbus.Error {
 
 func (m *Manager) BecomeClipboardOwner() *dbus.Error {
 	logger.Info("dbus call BecomeClipboardOwner")
+	if m.xc == nil {
+		return dbusutil.ToError(errOnlyX11)
+	}
 
 	ts, err := m.getTimestamp()
 	if err != nil {
@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	secrets "github.com/linuxdeepin/go-dbus-factory/session/org.freedesktop.secrets"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	x "github.com/linuxdeepin/go-x11-client"
+)
+
+const historyKeyAttr = "dde-clipboard-history"
+
+// recordHistory 将新的剪贴板内容加入历史记录，source 为剪贴板内容的来源窗口
+func (m *Manager) recordHistory(targetDataMap map[x.Atom]*TargetData, source x.Window) {
+	if m.history == nil {
+		return
+	}
+
+	var targets []historyTarget
+	for _, td := range targetDataMap {
+		if td.Target == atomFromClipboardManager {
+			continue
+		}
+		name, err := m.xc.GetAtomName(td.Target)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		typeName, err := m.xc.GetAtomName(td.Type)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		targets = append(targets, historyTarget{
+			Name:   name,
+			Type:   typeName,
+			Format: td.Format,
+			Data:   td.Data,
+		})
+	}
+	m.recordHistoryTargets(targets, source)
+}
+
+// recordHistoryTargets 将以名称表示的剪贴板内容加入历史记录
+func (m *Manager) recordHistoryTargets(targets []historyTarget, source x.Window) {
+	if m.history == nil {
+		return
+	}
+
+	var md5Data []byte
+	size := 0
+	for _, t := range targets {
+		size += len(t.Data)
+	}
+	if size > historyMaxEntrySize {
+		logger.Debug("clipboard content is too large for history:", size)
+		return
+	}
+
+	kind, preview := classifyHistory(targets)
+	if kind == "" {
+		return
+	}
+	names := make([]string, 0, len(targets))
+	for _, t := range targets {
+		names = append(names, t.Name)
+		if (kind == historyKindImage && t.Name == preview) || (kind != historyKindImage && isTextTarget(t.Name)) {
+			md5Data = t.Data
+		}
+	}
+	if md5Data == nil {
+		md5Data = []byte(preview)
+	}
+
+	m.history.add(&historyEntry{
+		HistoryEntry: HistoryEntry{
+			Time:         time.Now().UnixMilli(),
+			Kind:         kind,
+			Preview:      preview,
+			Size:         size,
+			SourceWindow: uint32(source),
+			Targets:      names,
+		},
+		Md5:  kind + ":" + getBytesMd5sum(md5Data),
+		Data: targets,
+	})
+}
+
+// activateHistoryEntry 将历史记录重新设置为剪贴板内容
+func (m *Manager) activateHistoryEntry(id uint64) error {
+	if m.history == nil {
+		return errHistoryEntryNotFound
+	}
+	entry, err := m.history.get(id)
+	if err != nil {
+		return err
+	}
+	err = m.backend.setSelection(entry.Data)
+	if err != nil {
+		return err
+	}
+	m.history.touch(id)
+	return nil
+}
+
+func historyToJSON(entries []HistoryEntry) (string, error) {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ListHistory 返回历史记录的 json。
+// 按应用禁止保存（denyApps 配置）只在 X11 下生效，Wayland 下无法得知内容来自哪个应用，
+// 所有应用复制的内容都会记入历史，敏感内容标记和大小限制仍然生效。
+func (m *Manager) ListHistory() (entries string, busErr *dbus.Error) {
+	if m.history == nil {
+		return "[]", nil
+	}
+	entries, err := historyToJSON(m.history.list())
+	return entries, dbusutil.ToError(err)
+}
+
+func (m *Manager) SearchHistory(keyword string) (entries string, busErr *dbus.Error) {
+	if m.history == nil {
+		return "[]", nil
+	}
+	entries, err := historyToJSON(m.history.search(keyword))
+	return entries, dbusutil.ToError(err)
+}
+
+func (m *Manager) PinHistoryEntry(id uint64, pinned bool) *dbus.Error {
+	logger.Infof("dbus call PinHistoryEntry %d %v", id, pinned)
+	if m.history == nil {
+		return dbusutil.ToError(errHistoryEntryNotFound)
+	}
+	return dbusutil.ToError(m.history.setPinned(id, pinned))
+}
+
+// ActivateHistoryEntry 将历史记录设为当前的剪贴板内容，
+// Wayland 下 compositor 不支持 data-control 协议时剪贴板不受管理，返回错误。
+func (m *Manager) ActivateHistoryEntry(id uint64) *dbus.Error {
+	logger.Info("dbus call ActivateHistoryEntry", id)
+	err := m.activateHistoryEntry(id)
+	if err != nil {
+		logger.Warning(err)
+	}
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) DeleteHistoryEntry(id uint64) *dbus.Error {
+	logger.Info("dbus call DeleteHistoryEntry", id)
+	if m.history == nil {
+		return dbusutil.ToError(errHistoryEntryNotFound)
+	}
+	return dbusutil.ToError(m.history.remove(id))
+}
+
+func (m *Manager) ClearHistory() *dbus.Error {
+	logger.Info("dbus call ClearHistory")
+	if m.history != nil {
+		m.history.clear()
+	}
+	return nil
+}
+
+// loadHistory 从登录密钥环中获取加密密钥并加载历史记录，密钥环不可用时历史记录只保存在内存中
+func (m *Manager) loadHistory() {
+	key, err := getHistoryKey()
+	if err != nil {
+		logger.Warning("get clipboard history key failed, history will not be saved:", err)
+		return
+	}
+	err = m.history.load(key)
+	if err != nil {
+		logger.Warning("load clipboard history failed:", err)
+	}
+}
+
+func getHistoryKey() ([]byte, error) {
+	sessionBus, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+	service := secrets.NewService(sessionBus)
+	_, sessionPath, err := service.OpenSession(0, "plain", dbus.MakeVariant(""))
+	if err != nil {
+		return nil, err
+	}
+
+	collectionPath, err := service.ReadAlias(0, "default")
+	if err != nil {
+		return nil, err
+	}
+	if collectionPath == "/" {
+		return nil, errors.New("failed to get default collection path")
+	}
+	collection, err := secrets.NewCollection(sessionBus, collectionPath)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]string{historyKeyAttr: "key"}
+	items, err := collection.SearchItems(0, attributes)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		secretData, err := service.GetSecrets(0, items[:1], sessionPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secretData {
+			key, err := base64.StdEncoding.DecodeString(string(secret.Value))
+			if err == nil && len(key) == 32 {
+				return key, nil
+			}
+		}
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant("Clipboard history encryption key"),
+		"org.freedesktop.Secret.Item.Type":       dbus.MakeVariant("org.freedesktop.Secret.Generic"),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(attributes),
+	}
+	_, _, err = collection.CreateItem(0, properties, secrets.Secret{
+		Session:     sessionPath,
+		Value:       []byte(base64.StdEncoding.EncodeToString(key)),
+		ContentType: "text/plain",
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
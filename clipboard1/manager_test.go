@@ -28,6 +28,7 @@ func initAtomsForTest() {
 	atomTimestamp = base + 11
 	atomTimestampProp = base + 12
 	atomNull = base + 13
+	atomPrimaryProp = base + 14
 }
 
 func TestManager_finishSelectionRequest(t *testing.T) {
@@ -184,7 +185,10 @@ func TestManager_getProperty(t *testing.T) {
 
 func Test_shouldIgnoreSaveTarget(t *testing.T) {
 	initAtomsForTest()
-	fn := shouldIgnoreSaveTarget
+	m := &Manager{}
+	fn := func(target x.Atom, targetName string) bool {
+		return m.shouldIgnoreSaveTarget(target, targetName, saveFilter{})
+	}
 	assert.True(t, fn(atomTimestamp, "TIMESTAMP"))
 	assert.True(t, fn(atomTargets, "TARGETS"))
 
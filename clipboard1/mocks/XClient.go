@@ -147,6 +147,22 @@ func (_m *XClient) GetAtom(name string) (x.Atom, error) {
 	return r0, r1
 }
 
+// GetWindowAppNames provides a mock function with given fields: win
+func (_m *XClient) GetWindowAppNames(win x.Window) []string {
+	ret := _m.Called(win)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(x.Window) []string); ok {
+		r0 = rf(win)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	return r0
+}
+
 // GetAtomName provides a mock function with given fields: atom
 func (_m *XClient) GetAtomName(atom x.Atom) (string, error) {
 	ret := _m.Called(atom)
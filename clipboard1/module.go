@@ -5,10 +5,13 @@
 package clipboard
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 
 	"github.com/linuxdeepin/dde-daemon/loader"
 	"github.com/linuxdeepin/go-lib/log"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/xfixes"
 )
@@ -16,6 +19,8 @@ import (
 const (
 	dbusServiceName = "org.deepin.dde.ClipboardManager1"
 	dbusPath        = "/org/deepin/dde/ClipboardManager1"
+
+	historyFileName = "deepin/dde-daemon/clipboard/history"
 )
 
 var logger *log.Logger
@@ -33,6 +38,7 @@ func newModule() *Module {
 
 type Module struct {
 	*loader.ModuleBase
+	manager *Manager
 }
 
 func (*Module) GetDependencies() []string {
@@ -40,40 +46,63 @@ func (*Module) GetDependencies() []string {
 }
 
 func (mo *Module) Start() error {
-	if os.Getenv("WAYLAND_DISPLAY") != "" {
+	logger.Debug("clipboard module start")
+	if mo.manager != nil {
 		return nil
 	}
-	logger.Debug("clipboard module start")
 
-	xConn, err := x.NewConn()
-	if err != nil {
-		return err
+	m := &Manager{
+		safeGo: mo.Go,
 	}
-
-	initAtoms(xConn)
-
-	_, err = xfixes.QueryVersion(xConn, xfixes.MajorVersion, xfixes.MinorVersion).Reply(xConn)
-	if err != nil {
-		logger.Warning(err)
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		conn, err := dialWayland()
+		if err != nil {
+			logger.Warning("failed to connect to wayland compositor, clipboard is not managed:", err)
+			m.backend = noopBackend{}
+		} else {
+			m.backend = newWaylandBackend(m, conn)
+		}
+	} else {
+		xConn, err := x.NewConn()
+		if err != nil {
+			return err
+		}
+
+		initAtoms(xConn)
+
+		_, err = xfixes.QueryVersion(xConn, xfixes.MajorVersion, xfixes.MinorVersion).Reply(xConn)
+		if err != nil {
+			logger.Warning(err)
+		}
+
+		m.xc = &xClient{
+			conn: xConn,
+		}
+		m.backend = &x11Backend{m: m}
 	}
-
-	m := &Manager{}
-	m.xc = &xClient{
-		conn: xConn,
+	m.history = newHistory(filepath.Join(basedir.GetUserDataDir(), historyFileName))
+
+	err := m.start()
+	if errors.Is(err, errDataControlNotSupported) {
+		logger.Warning(err, ", clipboard is not managed")
+		m.backend.stop()
+		m.backend = noopBackend{}
+		err = nil
 	}
-
-	err = m.start()
 	if err != nil {
+		m.backend.stop()
 		return err
 	}
+	mo.Go(m.loadHistory)
 
-	service := loader.GetService()
-	err = service.Export(dbusPath, m)
+	err = mo.Export(dbusPath, m)
 	if err != nil {
+		m.backend.stop()
 		return err
 	}
+	mo.manager = m
 
-	err = service.RequestName(dbusServiceName)
+	err = loader.GetService().RequestName(dbusServiceName)
 	if err != nil {
 		return err
 	}
@@ -81,6 +110,22 @@ func (mo *Module) Start() error {
 	return nil
 }
 
-func (*Module) Stop() error {
+func (mo *Module) Stop() error {
+	if mo.manager == nil {
+		return nil
+	}
+
+	service := loader.GetService()
+	err := service.ReleaseName(dbusServiceName)
+	if err != nil {
+		logger.Warning(err)
+	}
+	err = service.StopExport(mo.manager)
+	if err != nil {
+		logger.Warning(err)
+	}
+
+	mo.manager.backend.stop()
+	mo.manager = nil
 	return nil
 }
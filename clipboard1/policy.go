@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	x "github.com/linuxdeepin/go-x11-client"
+)
+
+const (
+	dSettingsKeyDenyApps         = "denyApps"
+	dSettingsKeyMaxTargetSize    = "maxTargetSize"
+	dSettingsKeyAutoClearTimeout = "autoClearTimeout"
+)
+
+// sensitiveHintTargets 密码管理器等应用用于标记敏感内容的 target，
+// 带有这些 target 的内容不会被保存，也不会记入历史
+var sensitiveHintTargets = []string{
+	"x-kde-passwordManagerHint",
+	"application/x-nspasteboard-concealed-type",
+	"ExcludeClipboardContentFromMonitorProcessing",
+}
+
+var errTargetTooLarge = errors.New("target data is too large")
+
+type savePolicy struct {
+	mu               sync.Mutex
+	denyApps         []string // 应用的可执行文件名或 WM_CLASS，不区分大小写
+	maxTargetSize    int      // 单个 target 数据的最大字节数，0 表示不限制
+	autoClearTimeout time.Duration
+}
+
+func (p *savePolicy) setDenyApps(apps []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.denyApps = p.denyApps[:0]
+	for _, app := range apps {
+		app = strings.ToLower(strings.TrimSpace(app))
+		if app != "" {
+			p.denyApps = append(p.denyApps, app)
+		}
+	}
+}
+
+func (p *savePolicy) hasDenyApps() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.denyApps) > 0
+}
+
+func (p *savePolicy) isAppDenied(names []string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range names {
+		name = strings.ToLower(name)
+		for _, app := range p.denyApps {
+			if name == app {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *savePolicy) setMaxTargetSize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	p.maxTargetSize = size
+}
+
+func (p *savePolicy) isTooLarge(size int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maxTargetSize > 0 && size > p.maxTargetSize
+}
+
+func (p *savePolicy) setAutoClearTimeout(timeout time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.autoClearTimeout = timeout
+}
+
+func (p *savePolicy) getAutoClearTimeout() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.autoClearTimeout
+}
+
+func hasSensitiveHint(targetNames []string) bool {
+	for _, name := range targetNames {
+		for _, hint := range sensitiveHintTargets {
+			if name == hint {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// saveFilter 对本次内容的所有 target 都生效的过滤条件，由 shouldIgnoreSaveTarget 使用
+type saveFilter struct {
+	sensitive bool // 带有敏感内容的标记
+	denied    bool // 由禁止保存的应用复制
+}
+
+func (f saveFilter) ignoreAll() bool {
+	return f.sensitive || f.denied
+}
+
+// newSaveFilter 根据 target 名称和 owner 窗口所属的应用生成过滤条件。
+// owner 为选择的所有者或者 SAVE_TARGETS 的请求者，即数据来源的应用，
+// 它在保存时通常不是激活窗口（比如应用退出时），所以不能用激活窗口判断。
+func (m *Manager) newSaveFilter(targets []x.Atom, owner x.Window) saveFilter {
+	var filter saveFilter
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		name, err := m.xc.GetAtomName(target)
+		if err == nil {
+			names = append(names, name)
+		}
+	}
+	if hasSensitiveHint(names) {
+		logger.Debug("ignore sensitive clipboard content")
+		filter.sensitive = true
+	}
+
+	if owner != 0 && m.policy.hasDenyApps() {
+		appNames := m.xc.GetWindowAppNames(owner)
+		if m.policy.isAppDenied(appNames) {
+			logger.Debug("ignore clipboard content of denied app:", appNames)
+			filter.denied = true
+		}
+	}
+	return filter
+}
+
+// scheduleAutoClear 在内容更新后开始计时，超时后如果内容未变化则清空剪贴板
+func (m *Manager) scheduleAutoClear() {
+	timeout := m.policy.getAutoClearTimeout()
+
+	m.autoClearMu.Lock()
+	defer m.autoClearMu.Unlock()
+	if m.autoClearTimer != nil {
+		m.autoClearTimer.Stop()
+		m.autoClearTimer = nil
+	}
+	if timeout <= 0 {
+		return
+	}
+	serial := m.contentSerial
+	m.autoClearTimer = time.AfterFunc(timeout, func() {
+		m.autoClearMu.Lock()
+		changed := serial != m.contentSerial
+		m.autoClearMu.Unlock()
+		if changed {
+			return
+		}
+		err := m.clearClipboard()
+		if err != nil {
+			logger.Warning("auto clear clipboard failed:", err)
+		}
+	})
+}
+
+// clearClipboard 清空保存的内容，并取得剪贴板的所有权，使其他应用无法再粘贴原来的内容
+func (m *Manager) clearClipboard() error {
+	logger.Debug("clear clipboard")
+	return m.backend.clearSelection()
+}
+
+func (m *Manager) clearX11Clipboard() error {
+	m.contentMu.Lock()
+	m.content = nil
+	if m.primaryConfig.syncToClipboard() || m.primaryConfig.syncFromClipboard() {
+		// 同步时 PRIMARY 中是相同的内容
+		m.primaryContent = nil
+	}
+	m.contentMu.Unlock()
+
+	ts, err := m.getTimestamp()
+	if err != nil {
+		return err
+	}
+	return m.becomeClipboardOwner(ts)
+}
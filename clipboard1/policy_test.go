@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/linuxdeepin/dde-daemon/clipboard1/mocks"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavePolicy(t *testing.T) {
+	var p savePolicy
+	assert.False(t, p.isTooLarge(1<<30))
+	assert.False(t, p.isAppDenied([]string{"keepassxc"}))
+	assert.Equal(t, time.Duration(0), p.getAutoClearTimeout())
+
+	p.setMaxTargetSize(100)
+	assert.False(t, p.isTooLarge(100))
+	assert.True(t, p.isTooLarge(101))
+	p.setMaxTargetSize(-1)
+	assert.False(t, p.isTooLarge(101))
+
+	p.setDenyApps([]string{" KeePassXC ", ""})
+	assert.True(t, p.isAppDenied([]string{"keepassxc"}))
+	assert.True(t, p.isAppDenied([]string{"KeePassXC"}))
+	assert.False(t, p.isAppDenied([]string{"deepin-editor"}))
+	p.setDenyApps(nil)
+	assert.False(t, p.isAppDenied([]string{"keepassxc"}))
+}
+
+func Test_hasSensitiveHint(t *testing.T) {
+	assert.True(t, hasSensitiveHint([]string{"UTF8_STRING", "x-kde-passwordManagerHint"}))
+	assert.True(t, hasSensitiveHint([]string{"application/x-nspasteboard-concealed-type"}))
+	assert.False(t, hasSensitiveHint([]string{"UTF8_STRING", "text/plain"}))
+	assert.False(t, hasSensitiveHint(nil))
+}
+
+func TestManager_newSaveFilter(t *testing.T) {
+	xc := &mocks.XClient{}
+	m := &Manager{xc: xc}
+	xc.On("GetAtomName", x.Atom(200)).Return("UTF8_STRING", nil)
+	xc.On("GetAtomName", x.Atom(201)).Return("x-kde-passwordManagerHint", nil)
+	xc.On("GetWindowAppNames", x.Window(10)).Return([]string{"keepassxc"})
+
+	assert.Equal(t, saveFilter{sensitive: true}, m.newSaveFilter([]x.Atom{200, 201}, 10))
+	// 没有配置禁止保存的应用时不获取窗口所属的应用
+	assert.Equal(t, saveFilter{}, m.newSaveFilter([]x.Atom{200}, 10))
+	xc.AssertNotCalled(t, "GetWindowAppNames", x.Window(10))
+
+	m.policy.setDenyApps([]string{"KeePassXC"})
+	assert.Equal(t, saveFilter{denied: true}, m.newSaveFilter([]x.Atom{200}, 10))
+	assert.Equal(t, saveFilter{}, m.newSaveFilter([]x.Atom{200}, 0))
+	m.policy.setDenyApps([]string{"deepin-editor"})
+	assert.Equal(t, saveFilter{}, m.newSaveFilter([]x.Atom{200}, 10))
+}
+
+func TestManager_newSaveFilterOwnerNotActive(t *testing.T) {
+	xc := &mocks.XClient{}
+	m := &Manager{xc: xc}
+	xc.On("GetAtomName", x.Atom(200)).Return("UTF8_STRING", nil)
+	// 10 为正在退出的 keepassxc 的窗口，20 为当前激活的 deepin-editor 的窗口
+	xc.On("GetWindowAppNames", x.Window(10)).Return([]string{"keepassxc"})
+	xc.On("GetWindowAppNames", x.Window(20)).Return([]string{"deepin-editor"})
+
+	m.policy.setDenyApps([]string{"keepassxc"})
+	assert.Equal(t, saveFilter{denied: true}, m.newSaveFilter([]x.Atom{200}, 10))
+	xc.AssertNotCalled(t, "GetWindowAppNames", x.Window(20))
+
+	m.policy.setDenyApps([]string{"deepin-editor"})
+	assert.Equal(t, saveFilter{}, m.newSaveFilter([]x.Atom{200}, 10))
+	xc.AssertNotCalled(t, "GetWindowAppNames", x.Window(20))
+}
+
+func TestManager_saveIgnoredContent(t *testing.T) {
+	initAtomsForTest()
+	xc := &mocks.XClient{}
+	m := &Manager{xc: xc}
+	xc.On("GetAtomName", x.Atom(200)).Return("UTF8_STRING", nil)
+	xc.On("Conn").Return(nil)
+	m.content = []*TargetData{{Target: 200, Type: 200, Format: 8, Data: []byte("old")}}
+
+	// 被过滤的内容不读取任何 target
+	assert.True(t, m.shouldIgnoreSaveTarget(200, "UTF8_STRING", saveFilter{denied: true}))
+	targetDataMap := m.saveTargets([]x.Atom{200}, 0, saveFilter{sensitive: true})
+	assert.Empty(t, targetDataMap)
+	xc.AssertNotCalled(t, "ConvertSelection")
+
+	// 之前保存的内容被清除，接管剪贴板时不会提供旧的内容
+	m.saveContent(targetDataMap, 0)
+	content := m.getContent(atomClipboard)
+	assert.Len(t, content, 1)
+	assert.Equal(t, atomFromClipboardManager, content[0].Target)
+}
@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"sync"
+	"time"
+
+	x "github.com/linuxdeepin/go-x11-client"
+)
+
+const (
+	dSettingsKeyPrimarySyncMode       = "primarySyncMode"
+	dSettingsKeyPrimaryPersistEnabled = "primaryPersistEnabled"
+
+	primarySyncNone               = "none"
+	primarySyncBoth               = "both"
+	primarySyncPrimaryToClipboard = "primaryToClipboard"
+	primarySyncClipboardToPrimary = "clipboardToPrimary"
+
+	// 用鼠标选择文本时 PRIMARY 的所有者会不断变化，等选择结束后再保存
+	primaryUpdateDelay = 300 * time.Millisecond
+)
+
+type primaryConfig struct {
+	mu             sync.Mutex
+	syncMode       string
+	persistEnabled bool
+}
+
+func (c *primaryConfig) setSyncMode(mode string) {
+	switch mode {
+	case primarySyncBoth, primarySyncPrimaryToClipboard, primarySyncClipboardToPrimary:
+	default:
+		if mode != primarySyncNone && mode != "" {
+			logger.Warningf("unknown primary sync mode %q", mode)
+		}
+		mode = primarySyncNone
+	}
+	c.mu.Lock()
+	c.syncMode = mode
+	c.mu.Unlock()
+}
+
+func (c *primaryConfig) setPersistEnabled(enabled bool) {
+	c.mu.Lock()
+	c.persistEnabled = enabled
+	c.mu.Unlock()
+}
+
+func (c *primaryConfig) syncToClipboard() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.syncMode == primarySyncBoth || c.syncMode == primarySyncPrimaryToClipboard
+}
+
+func (c *primaryConfig) syncFromClipboard() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.syncMode == primarySyncBoth || c.syncMode == primarySyncClipboardToPrimary
+}
+
+func (c *primaryConfig) persist() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.persistEnabled
+}
+
+// needSave 同步到 CLIPBOARD 或者应用退出后保留内容时，才需要在 PRIMARY 变化时保存其内容
+func (c *primaryConfig) needSave() bool {
+	return c.syncToClipboard() || c.persist()
+}
+
+func (m *Manager) becomePrimaryOwner(ts x.Timestamp) error {
+	err := setSelectionOwner(m.xc, m.window, x.AtomPrimary, ts)
+	if err != nil {
+		return err
+	}
+	logger.Debug("set primary selection owner to me")
+	return nil
+}
+
+func (m *Manager) setPrimaryContent(content []*TargetData) {
+	m.contentMu.Lock()
+	m.primaryContent = content
+	m.contentMu.Unlock()
+}
+
+// handlePrimaryOwnerChanged 处理 PRIMARY 所有者变化，在 handleEvent 中调用
+func (m *Manager) handlePrimaryOwnerChanged(owner x.Window, ts x.Timestamp) {
+	if owner == m.window {
+		logger.Debug("i have become the owner of PRIMARY selection, ts:", ts)
+		m.primaryAcquireTs = ts
+		m.primaryLostTs = 0
+		return
+	}
+	if ts >= m.primaryAcquireTs {
+		m.primaryLostTs = ts
+	}
+	if owner == 0 || !m.primaryConfig.needSave() {
+		return
+	}
+
+	m.primaryTimerMu.Lock()
+	defer m.primaryTimerMu.Unlock()
+	if m.primaryTimer != nil {
+		m.primaryTimer.Stop()
+	}
+	m.primaryTimer = time.AfterFunc(primaryUpdateDelay, func() {
+		err := m.handlePrimaryUpdated(ts, owner)
+		if err != nil {
+			logger.Warning("handle primary updated err:", err)
+		}
+	})
+}
+
+// handlePrimaryUpdated 保存 PRIMARY 的内容，并根据配置同步到 CLIPBOARD
+func (m *Manager) handlePrimaryUpdated(ts x.Timestamp, owner x.Window) error {
+	m.primaryMu.Lock()
+	defer m.primaryMu.Unlock()
+	logger.Debug("handlePrimaryUpdated", ts)
+
+	targets, err := m.getSelectionTargets(x.AtomPrimary, ts)
+	if err != nil {
+		return err
+	}
+	logger.Debug("primary targets:", targets)
+
+	targetDataMap := m.saveSelectionTargets(x.AtomPrimary, targets, ts, m.newSaveFilter(targets, owner))
+	if len(targetDataMap) == 0 {
+		// 内容被过滤或者读取失败，不保留之前选择的内容
+		m.setPrimaryContent(nil)
+		return nil
+	}
+	m.setPrimaryContent(mapToSliceTargetData(targetDataMap))
+
+	if !m.primaryConfig.syncToClipboard() {
+		return nil
+	}
+	// 选择的文本变化频繁，不记入剪贴板历史
+	m.setContent(targetDataMap)
+	ts, err = m.getTimestamp()
+	if err != nil {
+		return err
+	}
+	return m.becomeClipboardOwner(ts)
+}
+
+// handlePrimaryOwnerLost PRIMARY 的所有者退出时，根据配置接管 PRIMARY，保留之前选择的内容
+func (m *Manager) handlePrimaryOwnerLost(ts x.Timestamp) {
+	if !m.primaryConfig.persist() || len(m.getContent(x.AtomPrimary)) == 0 {
+		return
+	}
+	err := m.becomePrimaryOwner(ts)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// syncClipboardToPrimary 将新的剪贴板内容同步到 PRIMARY
+func (m *Manager) syncClipboardToPrimary() {
+	if !m.primaryConfig.syncFromClipboard() {
+		return
+	}
+	m.setPrimaryContent(m.getContent(atomClipboard))
+
+	ts, err := m.getTimestamp()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	err = m.becomePrimaryOwner(ts)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
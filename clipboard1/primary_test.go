@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"testing"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimaryConfig(t *testing.T) {
+	var c primaryConfig
+	assert.False(t, c.syncToClipboard())
+	assert.False(t, c.syncFromClipboard())
+	assert.False(t, c.needSave())
+
+	c.setSyncMode(primarySyncBoth)
+	assert.True(t, c.syncToClipboard())
+	assert.True(t, c.syncFromClipboard())
+
+	c.setSyncMode(primarySyncPrimaryToClipboard)
+	assert.True(t, c.syncToClipboard())
+	assert.False(t, c.syncFromClipboard())
+	assert.True(t, c.needSave())
+
+	c.setSyncMode(primarySyncClipboardToPrimary)
+	assert.False(t, c.syncToClipboard())
+	assert.True(t, c.syncFromClipboard())
+	assert.False(t, c.needSave())
+
+	c.setSyncMode("unknown")
+	assert.False(t, c.syncToClipboard())
+	assert.False(t, c.syncFromClipboard())
+
+	c.setPersistEnabled(true)
+	assert.True(t, c.needSave())
+}
+
+func Test_getSelectionProperty(t *testing.T) {
+	initAtomsForTest()
+	assert.Equal(t, x.Atom(200), getSelectionProperty(atomClipboard, 200))
+	assert.Equal(t, atomPrimaryProp, getSelectionProperty(x.AtomPrimary, 200))
+}
+
+func TestManager_getTargetData(t *testing.T) {
+	initAtomsForTest()
+	m := &Manager{}
+	clipboardData := &TargetData{Target: 200, Data: []byte("clipboard")}
+	primaryData := &TargetData{Target: 200, Data: []byte("primary")}
+	m.content = []*TargetData{clipboardData}
+	m.setPrimaryContent([]*TargetData{primaryData})
+
+	assert.Equal(t, clipboardData, m.getTargetData(atomClipboard, 200))
+	assert.Equal(t, primaryData, m.getTargetData(x.AtomPrimary, 200))
+	assert.Nil(t, m.getTargetData(x.AtomPrimary, 201))
+}
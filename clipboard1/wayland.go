@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Wayland 协议的最小实现，只包含 data-control 需要的部分。
+// 消息头为对象 id 和 (长度 << 16 | opcode)，参数按 4 字节对齐，文件描述符通过 SCM_RIGHTS 传递。
+
+const (
+	wlHeaderSize = 8
+	wlMaxFds     = 28 // libwayland 一次最多传递的文件描述符数量
+)
+
+var wlByteOrder binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	// Wayland 使用本机字节序
+	var i uint16 = 1
+	if (*[2]byte)(unsafe.Pointer(&i))[0] == 0 {
+		wlByteOrder = binary.BigEndian
+	}
+}
+
+// wlFd 作为参数时通过 SCM_RIGHTS 发送
+type wlFd int
+
+type wlMessage struct {
+	object uint32
+	opcode uint16
+	data   []byte
+	conn   *wlConn
+}
+
+func (msg *wlMessage) uint32() uint32 {
+	if len(msg.data) < 4 {
+		return 0
+	}
+	v := wlByteOrder.Uint32(msg.data)
+	msg.data = msg.data[4:]
+	return v
+}
+
+func (msg *wlMessage) string() string {
+	n := int(msg.uint32())
+	padded := (n + 3) &^ 3
+	if n == 0 || padded > len(msg.data) {
+		return ""
+	}
+	s := string(msg.data[:n-1]) // 去掉结尾的 NUL
+	msg.data = msg.data[padded:]
+	return s
+}
+
+// fd 返回连接上收到的下一个文件描述符，没有时返回 -1，需要在读取下一条消息之前调用
+func (msg *wlMessage) fd() int {
+	c := msg.conn
+	if len(c.fds) == 0 {
+		return -1
+	}
+	fd := c.fds[0]
+	c.fds = c.fds[1:]
+	return fd
+}
+
+type wlConn struct {
+	conn *net.UnixConn
+
+	mu     sync.Mutex // 保护写入和 nextId
+	nextId uint32
+
+	// 只在读取消息的 goroutine 中使用
+	rbuf []byte
+	fds  []int
+}
+
+func newWlConn(conn *net.UnixConn) *wlConn {
+	return &wlConn{
+		conn:   conn,
+		nextId: wlDisplayId,
+	}
+}
+
+// dialWayland 连接 WAYLAND_DISPLAY 指定的 compositor
+func dialWayland() (*net.UnixConn, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		display = "wayland-0"
+	}
+	if !filepath.IsAbs(display) {
+		runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+		if runtimeDir == "" {
+			return nil, errors.New("XDG_RUNTIME_DIR is not set")
+		}
+		display = filepath.Join(runtimeDir, display)
+	}
+	return net.DialUnix("unix", nil, &net.UnixAddr{Name: display, Net: "unix"})
+}
+
+func (c *wlConn) newId() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextId++
+	return c.nextId
+}
+
+// send 发送消息，args 支持 uint32、int32、string、[]byte 和 wlFd
+func (c *wlConn) send(object uint32, opcode uint16, args ...interface{}) error {
+	buf := make([]byte, wlHeaderSize, 64)
+	var fds []int
+	put := func(v uint32) {
+		buf = append(buf, 0, 0, 0, 0)
+		wlByteOrder.PutUint32(buf[len(buf)-4:], v)
+	}
+	putBytes := func(b []byte) {
+		buf = append(buf, b...)
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+	}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			put(v)
+		case int32:
+			put(uint32(v))
+		case string:
+			put(uint32(len(v) + 1))
+			putBytes(append([]byte(v), 0))
+		case []byte:
+			put(uint32(len(v)))
+			putBytes(v)
+		case wlFd:
+			fds = append(fds, int(v))
+		default:
+			return fmt.Errorf("unsupported wayland argument type %T", arg)
+		}
+	}
+	wlByteOrder.PutUint32(buf[0:], object)
+	wlByteOrder.PutUint32(buf[4:], uint32(len(buf))<<16|uint32(opcode))
+
+	var oob []byte
+	if len(fds) > 0 {
+		oob = syscall.UnixRights(fds...)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _, err := c.conn.WriteMsgUnix(buf, oob, nil)
+	return err
+}
+
+// read 读取一条消息，文件描述符按接收顺序依次分配给消息中的 fd 参数
+func (c *wlConn) read() (*wlMessage, error) {
+	for {
+		if len(c.rbuf) >= wlHeaderSize {
+			size := int(wlByteOrder.Uint32(c.rbuf[4:]) >> 16)
+			if size < wlHeaderSize {
+				return nil, fmt.Errorf("invalid wayland message size %d", size)
+			}
+			if len(c.rbuf) >= size {
+				msg := &wlMessage{
+					object: wlByteOrder.Uint32(c.rbuf),
+					opcode: uint16(wlByteOrder.Uint32(c.rbuf[4:])),
+					data:   append([]byte(nil), c.rbuf[wlHeaderSize:size]...),
+					conn:   c,
+				}
+				c.rbuf = c.rbuf[size:]
+				return msg, nil
+			}
+		}
+
+		buf := make([]byte, 4096)
+		oob := make([]byte, syscall.CmsgSpace(wlMaxFds*4))
+		n, oobn, _, _, err := c.conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, io.EOF
+		}
+		c.rbuf = append(c.rbuf, buf[:n]...)
+		if oobn > 0 {
+			cmsgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			if err != nil {
+				return nil, err
+			}
+			for _, cmsg := range cmsgs {
+				fds, err := syscall.ParseUnixRights(&cmsg)
+				if err == nil {
+					c.fds = append(c.fds, fds...)
+				}
+			}
+		}
+	}
+}
+
+func (c *wlConn) close() error {
+	return c.conn.Close()
+}
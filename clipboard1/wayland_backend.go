@@ -0,0 +1,442 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	wlDisplayId = 1
+
+	// wl_display
+	wlDisplaySync             = 0
+	wlDisplayGetRegistry      = 1
+	wlDisplayEventError       = 0
+	wlDisplayEventDeleteId    = 1
+	wlRegistryBind            = 0
+	wlRegistryEventGlobal     = 0
+	wlCallbackEventDone       = 0
+	wlSeatInterface           = "wl_seat"
+	extDataControlInterface   = "ext_data_control_manager_v1"
+	wlrDataControlInterface   = "zwlr_data_control_manager_v1"
+	dataControlManagerVersion = 1
+
+	// ext_data_control_*_v1 与 zwlr_data_control_*_v1 的请求和事件相同
+	dataControlManagerCreateDataSource = 0
+	dataControlManagerGetDataDevice    = 1
+	dataControlDeviceSetSelection      = 0
+	dataControlDeviceEventDataOffer    = 0
+	dataControlDeviceEventSelection    = 1
+	dataControlDeviceEventFinished     = 2
+	dataControlDeviceEventPrimary      = 3
+	dataControlSourceOffer             = 0
+	dataControlSourceDestroy           = 1
+	dataControlSourceEventSend         = 0
+	dataControlSourceEventCancelled    = 1
+	dataControlOfferReceive            = 0
+	dataControlOfferDestroy            = 1
+	dataControlOfferEventOffer         = 0
+	fromClipboardManagerTarget         = "FROM_DEEPIN_CLIPBOARD_MANAGER"
+	waylandTransferTimeout             = 5 * time.Second
+	waylandReceiveBufferSize           = 32 * 1024
+)
+
+var errDataControlNotSupported = errors.New("compositor does not support data control protocol")
+
+// waylandBackend 通过 data-control 协议监视剪贴板，保存每次新内容的全部格式，
+// 在所有者退出、剪贴板被清空时以保存的内容重新设置剪贴板。
+// Wayland 下无法得知内容来自哪个应用，不支持按应用禁止保存。
+type waylandBackend struct {
+	m *Manager
+	c *wlConn
+
+	mu        sync.Mutex
+	manager   uint32
+	device    uint32
+	offers    map[uint32][]string // offer id -> mime 类型
+	selection uint32              // 当前剪贴板的 offer
+	serial    uint64              // 剪贴板每次变化时加一，用于丢弃过时的读取结果
+	sources   map[uint32][]historyTarget
+	content   []historyTarget
+}
+
+func newWaylandBackend(m *Manager, conn *net.UnixConn) *waylandBackend {
+	return &waylandBackend{
+		m:       m,
+		c:       newWlConn(conn),
+		offers:  make(map[uint32][]string),
+		sources: make(map[uint32][]historyTarget),
+	}
+}
+
+type wlGlobal struct {
+	name    uint32
+	version uint32
+}
+
+func (b *waylandBackend) start() error {
+	registry := b.c.newId()
+	err := b.c.send(wlDisplayId, wlDisplayGetRegistry, registry)
+	if err != nil {
+		return err
+	}
+	callback := b.c.newId()
+	err = b.c.send(wlDisplayId, wlDisplaySync, callback)
+	if err != nil {
+		return err
+	}
+
+	// 等待 sync 完成，此时已经收到所有的 global
+	globals := make(map[string]wlGlobal)
+	for {
+		msg, err := b.c.read()
+		if err != nil {
+			return err
+		}
+		if msg.object == callback && msg.opcode == wlCallbackEventDone {
+			break
+		}
+		if msg.object == registry && msg.opcode == wlRegistryEventGlobal {
+			name := msg.uint32()
+			ifc := msg.string()
+			version := msg.uint32()
+			if _, ok := globals[ifc]; !ok {
+				globals[ifc] = wlGlobal{name: name, version: version}
+			}
+		} else if msg.object == wlDisplayId && msg.opcode == wlDisplayEventError {
+			b.handleDisplayError(msg)
+		}
+	}
+
+	seat, ok := globals[wlSeatInterface]
+	if !ok {
+		return errors.New("compositor has no seat")
+	}
+	managerIfc := extDataControlInterface
+	manager, ok := globals[managerIfc]
+	if !ok {
+		managerIfc = wlrDataControlInterface
+		manager, ok = globals[managerIfc]
+	}
+	if !ok {
+		return errDataControlNotSupported
+	}
+	logger.Debug("use wayland data control interface", managerIfc)
+
+	seatId := b.c.newId()
+	err = b.c.send(registry, wlRegistryBind, seat.name, wlSeatInterface, uint32(1), seatId)
+	if err != nil {
+		return err
+	}
+	b.manager = b.c.newId()
+	err = b.c.send(registry, wlRegistryBind, manager.name, managerIfc, uint32(dataControlManagerVersion), b.manager)
+	if err != nil {
+		return err
+	}
+	b.device = b.c.newId()
+	err = b.c.send(b.manager, dataControlManagerGetDataDevice, b.device, seatId)
+	if err != nil {
+		return err
+	}
+
+	b.m.safeGo(b.loop)
+	return nil
+}
+
+func (b *waylandBackend) stop() {
+	err := b.c.close()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+func (b *waylandBackend) loop() {
+	for {
+		msg, err := b.c.read()
+		if err != nil {
+			logger.Warning("wayland connection closed:", err)
+			return
+		}
+		b.handleMessage(msg)
+	}
+}
+
+func (b *waylandBackend) handleDisplayError(msg *wlMessage) {
+	object := msg.uint32()
+	code := msg.uint32()
+	logger.Warningf("wayland error, object: %d, code: %d, message: %s", object, code, msg.string())
+}
+
+func (b *waylandBackend) handleMessage(msg *wlMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case msg.object == wlDisplayId:
+		if msg.opcode == wlDisplayEventError {
+			b.handleDisplayError(msg)
+		}
+
+	case msg.object == b.device:
+		switch msg.opcode {
+		case dataControlDeviceEventDataOffer:
+			b.offers[msg.uint32()] = nil
+		case dataControlDeviceEventSelection:
+			b.handleSelection(msg.uint32())
+		case dataControlDeviceEventPrimary:
+			// 不处理 PRIMARY
+			offer := msg.uint32()
+			if offer != 0 {
+				b.destroyOffer(offer)
+			}
+		case dataControlDeviceEventFinished:
+			logger.Warning("wayland data control device finished")
+			b.device = 0
+		}
+
+	default:
+		if mimeTypes, ok := b.offers[msg.object]; ok {
+			if msg.opcode == dataControlOfferEventOffer {
+				b.offers[msg.object] = append(mimeTypes, msg.string())
+			}
+		} else if targets, ok := b.sources[msg.object]; ok {
+			switch msg.opcode {
+			case dataControlSourceEventSend:
+				mimeType := msg.string()
+				fd := msg.fd()
+				if fd >= 0 {
+					go sendWaylandData(fd, findTargetData(targets, mimeType))
+				}
+			case dataControlSourceEventCancelled:
+				delete(b.sources, msg.object)
+				err := b.c.send(msg.object, dataControlSourceDestroy)
+				if err != nil {
+					logger.Warning(err)
+				}
+			}
+		}
+	}
+}
+
+func (b *waylandBackend) destroyOffer(offer uint32) {
+	delete(b.offers, offer)
+	err := b.c.send(offer, dataControlOfferDestroy)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// handleSelection 剪贴板内容变化，调用者需要持有 b.mu
+func (b *waylandBackend) handleSelection(offer uint32) {
+	if b.selection != 0 {
+		b.destroyOffer(b.selection)
+	}
+	b.selection = offer
+	b.serial++
+
+	if offer == 0 {
+		// 剪贴板的所有者退出
+		if len(b.content) > 0 {
+			logger.Debug("clipboard is empty, restore saved content")
+			err := b.setSelectionLocked(b.content)
+			if err != nil {
+				logger.Warning(err)
+			}
+		}
+		return
+	}
+
+	mimeTypes := b.offers[offer]
+	for _, mimeType := range mimeTypes {
+		if mimeType == fromClipboardManagerTarget {
+			// 本程序设置的内容
+			return
+		}
+	}
+	if hasSensitiveHint(mimeTypes) {
+		logger.Debug("ignore sensitive clipboard content")
+		// 丢弃之前保存的内容，否则所有者退出后会以更早的内容覆盖剪贴板
+		b.content = nil
+		return
+	}
+	// data-control 协议不提供数据来源的客户端，这里不检查 denyApps
+
+	var names []string
+	var files []*os.File
+	for _, mimeType := range mimeTypes {
+		if shouldIgnoreTargetName(mimeType) {
+			continue
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		err = b.c.send(offer, dataControlOfferReceive, mimeType, wlFd(w.Fd()))
+		_ = w.Close()
+		if err != nil {
+			logger.Warning(err)
+			_ = r.Close()
+			continue
+		}
+		names = append(names, mimeType)
+		files = append(files, r)
+	}
+	go b.receive(b.serial, names, files)
+}
+
+// receive 同时读取所有格式的数据，发送方可能以任意顺序写入
+func (b *waylandBackend) receive(serial uint64, names []string, files []*os.File) {
+	targets := make([]historyTarget, len(names))
+	var wg sync.WaitGroup
+	for i := range files {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := receiveWaylandData(files[i], &b.m.policy)
+			if err != nil {
+				logger.Warningf("receive %s failed: %v", names[i], err)
+				return
+			}
+			targets[i] = historyTarget{Name: names[i], Type: names[i], Format: 8, Data: data}
+		}(i)
+	}
+	wg.Wait()
+
+	content := make([]historyTarget, 0, len(targets))
+	for _, t := range targets {
+		if t.Name != "" {
+			content = append(content, t)
+		}
+	}
+	if len(content) == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	if serial != b.serial {
+		b.mu.Unlock()
+		logger.Debug("clipboard changed while receiving, drop data")
+		return
+	}
+	b.content = content
+	b.mu.Unlock()
+
+	b.m.recordHistoryTargets(content, 0)
+	b.m.contentChanged()
+}
+
+func receiveWaylandData(f *os.File, policy *savePolicy) ([]byte, error) {
+	defer f.Close()
+	err := f.SetReadDeadline(time.Now().Add(waylandTransferTimeout))
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	buf := make([]byte, waylandReceiveBufferSize)
+	for {
+		n, err := f.Read(buf)
+		data = append(data, buf[:n]...)
+		if policy.isTooLarge(len(data)) {
+			return nil, errTargetTooLarge
+		}
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sendWaylandData(fd int, data []byte) {
+	// 设置为非阻塞后 os.NewFile 返回的文件支持超时
+	err := syscall.SetNonblock(fd, true)
+	if err != nil {
+		logger.Warning(err)
+	}
+	f := os.NewFile(uintptr(fd), "wayland-send")
+	defer f.Close()
+	err = f.SetWriteDeadline(time.Now().Add(waylandTransferTimeout))
+	if err != nil {
+		logger.Debug(err)
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		logger.Warning("send clipboard data failed:", err)
+	}
+}
+
+func findTargetData(targets []historyTarget, name string) []byte {
+	if name == fromClipboardManagerTarget {
+		return []byte("1")
+	}
+	for _, t := range targets {
+		if t.Name == name {
+			return t.Data
+		}
+	}
+	return nil
+}
+
+// setSelectionLocked 创建数据源并设置为剪贴板，调用者需要持有 b.mu
+func (b *waylandBackend) setSelectionLocked(targets []historyTarget) error {
+	if b.device == 0 {
+		return errors.New("wayland data control device is not available")
+	}
+	source := b.c.newId()
+	err := b.c.send(b.manager, dataControlManagerCreateDataSource, source)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		err = b.c.send(source, dataControlSourceOffer, t.Name)
+		if err != nil {
+			return err
+		}
+	}
+	// 与 X11 下相同，带上特殊标记让 dde-clipboard 知道是本程序给出的内容
+	err = b.c.send(source, dataControlSourceOffer, fromClipboardManagerTarget)
+	if err != nil {
+		return err
+	}
+	b.sources[source] = targets
+	return b.c.send(b.device, dataControlDeviceSetSelection, source)
+}
+
+func (b *waylandBackend) setSelection(targets []historyTarget) error {
+	b.mu.Lock()
+	b.content = targets
+	err := b.setSelectionLocked(targets)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	b.m.contentChanged()
+	return nil
+}
+
+func (b *waylandBackend) clearSelection() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.content = nil
+	if b.device == 0 {
+		return nil
+	}
+	return b.c.send(b.device, dataControlDeviceSetSelection, uint32(0))
+}
+
+func (b *waylandBackend) getContent() []historyTarget {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.content
+}
@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCompositor 在 socketpair 的另一端扮演 compositor，事件与请求的编码相同，因此复用 wlConn
+type fakeCompositor struct {
+	t *testing.T
+	c *wlConn
+}
+
+func newFakeCompositor(t *testing.T) (*fakeCompositor, *net.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	require.NoError(t, err)
+	newConn := func(fd int) *net.UnixConn {
+		f := os.NewFile(uintptr(fd), "wayland-test")
+		defer f.Close()
+		conn, err := net.FileConn(f)
+		require.NoError(t, err)
+		return conn.(*net.UnixConn)
+	}
+	fc := &fakeCompositor{t: t, c: newWlConn(newConn(fds[0]))}
+	t.Cleanup(func() { _ = fc.c.close() })
+	return fc, newConn(fds[1])
+}
+
+// expect 读取一个请求并检查其对象和 opcode
+func (fc *fakeCompositor) expect(object uint32, opcode uint16) *wlMessage {
+	err := fc.c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	require.NoError(fc.t, err)
+	msg, err := fc.c.read()
+	require.NoError(fc.t, err)
+	require.Equal(fc.t, object, msg.object, "object")
+	require.Equal(fc.t, opcode, msg.opcode, "opcode")
+	return msg
+}
+
+func (fc *fakeCompositor) event(object uint32, opcode uint16, args ...interface{}) {
+	require.NoError(fc.t, fc.c.send(object, opcode, args...))
+}
+
+func TestWlMessage(t *testing.T) {
+	fc, conn := newFakeCompositor(t)
+	c := newWlConn(conn)
+	defer c.close()
+
+	require.NoError(t, c.send(3, 2, uint32(7), "abc", "", []byte{1, 2, 3, 4, 5}, int32(-1)))
+	msg := fc.expect(3, 2)
+	assert.Equal(t, uint32(7), msg.uint32())
+	assert.Equal(t, "abc", msg.string())
+	assert.Equal(t, "", msg.string())
+	assert.Equal(t, uint32(5), msg.uint32())
+	msg.data = msg.data[8:]
+	assert.Equal(t, uint32(0xffffffff), msg.uint32())
+	assert.Empty(t, msg.data)
+}
+
+const (
+	testWlRegistry = 2
+	testWlCallback = 3
+	testWlSeat     = 4
+	testWlManager  = 5
+	testWlDevice   = 6
+	testWlOffer    = 0xff000000
+)
+
+// startTestWaylandBackend 启动 waylandBackend 并完成与 fakeCompositor 的初始化
+func startTestWaylandBackend(t *testing.T) (*fakeCompositor, *waylandBackend, *Manager) {
+	fc, conn := newFakeCompositor(t)
+	m := &Manager{
+		history: newHistory(filepath.Join(t.TempDir(), "history")),
+		safeGo:  func(fn func()) { go fn() },
+	}
+	b := newWaylandBackend(m, conn)
+	m.backend = b
+	t.Cleanup(func() {
+		_ = b.c.close()
+	})
+
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- b.start()
+	}()
+
+	fc.expect(wlDisplayId, wlDisplayGetRegistry)
+	fc.expect(wlDisplayId, wlDisplaySync)
+	fc.event(testWlRegistry, wlRegistryEventGlobal, uint32(1), wlSeatInterface, uint32(7))
+	fc.event(testWlRegistry, wlRegistryEventGlobal, uint32(2), wlrDataControlInterface, uint32(2))
+	fc.event(testWlCallback, wlCallbackEventDone, uint32(0))
+
+	msg := fc.expect(testWlRegistry, wlRegistryBind)
+	assert.Equal(t, uint32(1), msg.uint32())
+	assert.Equal(t, wlSeatInterface, msg.string())
+	msg = fc.expect(testWlRegistry, wlRegistryBind)
+	assert.Equal(t, uint32(2), msg.uint32())
+	assert.Equal(t, wlrDataControlInterface, msg.string())
+	assert.Equal(t, uint32(dataControlManagerVersion), msg.uint32())
+	assert.Equal(t, uint32(testWlManager), msg.uint32())
+	msg = fc.expect(testWlManager, dataControlManagerGetDataDevice)
+	assert.Equal(t, uint32(testWlDevice), msg.uint32())
+	assert.Equal(t, uint32(testWlSeat), msg.uint32())
+	require.NoError(t, <-startErr)
+	return fc, b, m
+}
+
+func TestWaylandBackend(t *testing.T) {
+	fc, b, m := startTestWaylandBackend(t)
+
+	const (
+		manager    = testWlManager
+		device     = testWlDevice
+		offer      = testWlOffer
+		mimeText   = "text/plain;charset=utf-8"
+		mimeCustom = "application/x-custom"
+	)
+	var msg *wlMessage
+
+	// 应用设置剪贴板，保存所有格式的数据
+	fc.event(device, dataControlDeviceEventDataOffer, uint32(offer))
+	fc.event(offer, dataControlOfferEventOffer, mimeText)
+	fc.event(offer, dataControlOfferEventOffer, mimeCustom)
+	fc.event(device, dataControlDeviceEventSelection, uint32(offer))
+	for i := 0; i < 2; i++ {
+		msg = fc.expect(offer, dataControlOfferReceive)
+		mimeType := msg.string()
+		f := os.NewFile(uintptr(msg.fd()), "receive")
+		_, err := f.Write([]byte("data of " + mimeType))
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+	}
+	assert.Eventually(t, func() bool {
+		return len(b.getContent()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []byte("data of "+mimeText), findTargetData(b.getContent(), mimeText))
+	entries := m.history.list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "data of "+mimeText, entries[0].Preview)
+
+	// 应用退出后以保存的内容重新设置剪贴板
+	fc.event(device, dataControlDeviceEventSelection, uint32(0))
+	fc.expect(offer, dataControlOfferDestroy)
+	msg = fc.expect(manager, dataControlManagerCreateDataSource)
+	source := msg.uint32()
+	var offered []string
+	for i := 0; i < 3; i++ {
+		offered = append(offered, fc.expect(source, dataControlSourceOffer).string())
+	}
+	assert.ElementsMatch(t, []string{mimeText, mimeCustom, fromClipboardManagerTarget}, offered)
+	msg = fc.expect(device, dataControlDeviceSetSelection)
+	assert.Equal(t, source, msg.uint32())
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	fc.event(source, dataControlSourceEventSend, mimeCustom, wlFd(w.Fd()))
+	require.NoError(t, w.Close())
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "data of "+mimeCustom, string(data))
+
+	// 本程序设置的内容不会再次保存
+	fc.event(device, dataControlDeviceEventDataOffer, uint32(offer+1))
+	fc.event(offer+1, dataControlOfferEventOffer, fromClipboardManagerTarget)
+	fc.event(device, dataControlDeviceEventSelection, uint32(offer+1))
+
+	// 清空剪贴板
+	require.NoError(t, b.clearSelection())
+	msg = fc.expect(device, dataControlDeviceSetSelection)
+	assert.Equal(t, uint32(0), msg.uint32())
+	assert.Empty(t, b.getContent())
+	assert.Len(t, m.history.list(), 1)
+}
+
+func TestWaylandBackendSensitive(t *testing.T) {
+	fc, b, m := startTestWaylandBackend(t)
+	const mimeText = "text/plain;charset=utf-8"
+
+	// Wayland 下无法得知内容来自哪个应用，配置了 denyApps 也会保存
+	m.policy.setDenyApps([]string{"keepassxc"})
+	fc.event(testWlDevice, dataControlDeviceEventDataOffer, uint32(testWlOffer))
+	fc.event(testWlOffer, dataControlOfferEventOffer, mimeText)
+	fc.event(testWlDevice, dataControlDeviceEventSelection, uint32(testWlOffer))
+	msg := fc.expect(testWlOffer, dataControlOfferReceive)
+	assert.Equal(t, mimeText, msg.string())
+	f := os.NewFile(uintptr(msg.fd()), "receive")
+	_, err := f.Write([]byte("text"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.Eventually(t, func() bool {
+		return len(b.getContent()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// 敏感内容不读取，并丢弃之前保存的内容
+	fc.event(testWlDevice, dataControlDeviceEventDataOffer, uint32(testWlOffer+1))
+	fc.event(testWlOffer+1, dataControlOfferEventOffer, mimeText)
+	fc.event(testWlOffer+1, dataControlOfferEventOffer, "x-kde-passwordManagerHint")
+	fc.event(testWlDevice, dataControlDeviceEventSelection, uint32(testWlOffer+1))
+	fc.expect(testWlOffer, dataControlOfferDestroy)
+
+	// 所有者退出后不会以更早的内容重新设置剪贴板
+	fc.event(testWlDevice, dataControlDeviceEventSelection, uint32(0))
+	fc.expect(testWlOffer+1, dataControlOfferDestroy)
+	require.NoError(t, b.clearSelection())
+	msg = fc.expect(testWlDevice, dataControlDeviceSetSelection)
+	assert.Equal(t, uint32(0), msg.uint32())
+	assert.Empty(t, b.getContent())
+	assert.Len(t, m.history.list(), 1)
+}
+
+func TestWaylandBackendNotSupported(t *testing.T) {
+	fc, conn := newFakeCompositor(t)
+	m := &Manager{
+		history: newHistory(filepath.Join(t.TempDir(), "history")),
+		safeGo:  func(fn func()) { go fn() },
+	}
+	b := newWaylandBackend(m, conn)
+	defer b.c.close()
+
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- b.start()
+	}()
+	fc.expect(wlDisplayId, wlDisplayGetRegistry)
+	fc.expect(wlDisplayId, wlDisplaySync)
+	fc.event(2, wlRegistryEventGlobal, uint32(1), wlSeatInterface, uint32(7))
+	fc.event(3, wlCallbackEventDone, uint32(0))
+	require.ErrorIs(t, <-startErr, errDataControlNotSupported)
+
+	// 模块启动时退回到 noopBackend，历史记录仍然可用，但无法设置剪贴板
+	m.backend = noopBackend{}
+	m.recordHistoryTargets([]historyTarget{{Name: "text/plain", Type: "text/plain", Format: 8, Data: []byte("text")}}, 0)
+	entries := m.history.list()
+	require.Len(t, entries, 1)
+	assert.ErrorIs(t, m.activateHistoryEntry(entries[0].Id), errClipboardNotManaged)
+	assert.Error(t, m.clearClipboard())
+}
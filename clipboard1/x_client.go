@@ -7,6 +7,7 @@ package clipboard
 import (
 	"errors"
 
+	"github.com/linuxdeepin/dde-daemon/common/activewindow"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/xfixes"
 )
@@ -30,6 +31,7 @@ type XClient interface {
 	Flush() error
 	SelectSelectionInputE(window x.Window, selection x.Atom, eventMask uint32) error
 	ChangeWindowEventMask(win x.Window, evMask uint32) error
+	GetWindowAppNames(win x.Window) []string
 }
 
 //go:generate mockery -name XClient
@@ -45,6 +47,10 @@ func (xc *xClient) GetAtomName(atom x.Atom) (string, error) {
 	return xc.conn.GetAtomName(atom)
 }
 
+func (xc *xClient) GetWindowAppNames(win x.Window) []string {
+	return activewindow.GetWindowAppNames(xc.conn, win)
+}
+
 func (xc *xClient) GetSelectionOwner(selection x.Atom) (x.Window, error) {
 	return getSelectionOwner(xc.conn, selection)
 }
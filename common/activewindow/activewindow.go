@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package activewindow 获取 X11 下当前激活窗口所属的进程和应用
+package activewindow
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/wm/ewmh"
+	"github.com/linuxdeepin/go-x11-client/util/wm/icccm"
+)
+
+// GetAppNames 返回激活窗口所属应用的可执行文件名和 WM_CLASS，均为小写，
+// 用于匹配按应用配置的名单。获取不到激活窗口时返回 nil。
+func GetAppNames(conn *x.Conn) []string {
+	win, err := ewmh.GetActiveWindow(conn).Reply(conn)
+	if err != nil || win == 0 {
+		return nil
+	}
+	return GetWindowAppNames(conn, win)
+}
+
+// GetWindowAppNames 返回窗口 win 所属应用的可执行文件名和 WM_CLASS，均为小写
+func GetWindowAppNames(conn *x.Conn, win x.Window) []string {
+	var names []string
+	pid, err := getWindowPid(conn, win)
+	if err == nil {
+		cmd, err := getCmdline(pid)
+		if err == nil {
+			if exe := cmdExeName(cmd); exe != "" {
+				names = append(names, exe)
+			}
+		}
+	}
+	wmClass, err := icccm.GetWMClass(conn, win).Reply(conn)
+	if err == nil {
+		for _, name := range []string{wmClass.Instance, wmClass.Class} {
+			if name != "" {
+				names = append(names, strings.ToLower(name))
+			}
+		}
+	}
+	return names
+}
+
+func getWindowPid(conn *x.Conn, win x.Window) (uint32, error) {
+	pid, err := ewmh.GetWMPid(conn, win).Reply(conn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current window pid: %w", err)
+	}
+	return uint32(pid), nil
+}
+
+func getCmdline(pid uint32) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return "", fmt.Errorf("failed to read cmdline: %w", err)
+	}
+	return string(data), nil
+}
+
+// cmdExeName 返回命令行第一个参数的文件名
+func cmdExeName(cmd string) string {
+	exe, _, _ := strings.Cut(cmd, "\x00")
+	exe = strings.TrimSpace(exe)
+	if exe == "" {
+		return ""
+	}
+	return strings.ToLower(filepath.Base(exe))
+}
@@ -0,0 +1,18 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package activewindow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_cmdExeName(t *testing.T) {
+	assert.Equal(t, "deepin-terminal", cmdExeName("/usr/bin/deepin-terminal\x00-w\x00/home\x00"))
+	assert.Equal(t, "keepassxc", cmdExeName("KeePassXC\x00"))
+	assert.Equal(t, "", cmdExeName(""))
+	assert.Equal(t, "", cmdExeName("\x00-x\x00"))
+}
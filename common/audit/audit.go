@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package audit 记录系统服务中特权方法的调用者、鉴权结果和参数，写入只追加、按大小轮转的审计日志。
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/log"
+	"github.com/linuxdeepin/go-lib/procfs"
+)
+
+const (
+	AuthAuthorized = "authorized"
+	AuthDenied     = "denied"
+
+	redacted = "******"
+
+	defaultMaxSize    = 4 * 1024 * 1024
+	defaultMaxBackups = 4
+)
+
+var (
+	logger = log.NewLogger("daemon/audit")
+
+	// Dir 审计日志所在目录，每个进程写入以进程名命名的文件
+	Dir = "/var/log/dde-daemon/audit"
+
+	_writer     *writer
+	_writerOnce sync.Once
+)
+
+// Entry 一次特权方法调用的审计记录
+type Entry struct {
+	Time   time.Time         `json:"time"`
+	Method string            `json:"method"`
+	Sender string            `json:"sender"`
+	UID    uint32            `json:"uid"`
+	PID    uint32            `json:"pid"`
+	Exe    string            `json:"exe,omitempty"`
+	Auth   string            `json:"auth,omitempty"` // 空表示未进行 polkit 鉴权
+	Args   map[string]string `json:"args,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// Arg 方法参数，Secret 为 true 时只记录是否为空
+type Arg struct {
+	Name   string
+	Value  interface{}
+	Secret bool
+}
+
+func NewArg(name string, value interface{}) Arg {
+	return Arg{Name: name, Value: value}
+}
+
+func NewSecretArg(name string, value interface{}) Arg {
+	return Arg{Name: name, Value: value, Secret: true}
+}
+
+func (a Arg) String() string {
+	if a.Secret {
+		if s, ok := a.Value.(string); ok && s == "" {
+			return ""
+		}
+		return redacted
+	}
+	return fmt.Sprint(a.Value)
+}
+
+// Call 一次正在进行的调用，由 Begin 创建，方法返回时调用 End 写入日志
+type Call struct {
+	entry Entry
+}
+
+// Begin 记录调用者的 uid、pid 和可执行文件路径，method 形如 Accounts1.User.SetPassword
+func Begin(service *dbusutil.Service, sender dbus.Sender, method string, args ...Arg) *Call {
+	c := &Call{
+		entry: Entry{
+			Time:   time.Now(),
+			Method: method,
+			Sender: string(sender),
+		},
+	}
+	if len(args) > 0 {
+		c.entry.Args = make(map[string]string, len(args))
+		for _, arg := range args {
+			c.entry.Args[arg.Name] = arg.String()
+		}
+	}
+
+	if service == nil || sender == "" {
+		return c
+	}
+	uid, err := service.GetConnUID(string(sender))
+	if err != nil {
+		logger.Warning(err)
+	} else {
+		c.entry.UID = uid
+	}
+	pid, err := service.GetConnPID(string(sender))
+	if err != nil {
+		logger.Warning(err)
+		return c
+	}
+	c.entry.PID = pid
+	c.entry.Exe = getExe(pid)
+	return c
+}
+
+// getExe 调用者在调用过程中被更新时，路径会带有 (deleted) 后缀
+func getExe(pid uint32) string {
+	exe, err := procfs.Process(pid).Exe()
+	if err != nil {
+		if pErr, ok := err.(*os.PathError); ok {
+			return strings.TrimSpace(strings.Replace(pErr.Path, "(deleted)", "", -1))
+		}
+		logger.Debug(err)
+	}
+	return exe
+}
+
+// SetAuthResult 记录鉴权结果，err 为 nil 表示鉴权通过
+func (c *Call) SetAuthResult(err error) {
+	if err != nil {
+		c.entry.Auth = AuthDenied
+	} else {
+		c.entry.Auth = AuthAuthorized
+	}
+}
+
+// End 写入审计记录，通常在 defer 中以方法的返回值调用
+func (c *Call) End(busErr *dbus.Error) {
+	if busErr != nil {
+		c.entry.Error = busErr.Error()
+	}
+	err := getWriter().write(&c.entry)
+	if err != nil {
+		logger.Warning("write audit log failed:", err)
+	}
+}
+
+type writer struct {
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	maxSize    int64
+	maxBackups int
+}
+
+func getWriter() *writer {
+	_writerOnce.Do(func() {
+		_writer = &writer{
+			maxSize:    defaultMaxSize,
+			maxBackups: defaultMaxBackups,
+		}
+	})
+	return _writer
+}
+
+func logFile() string {
+	return filepath.Join(Dir, filepath.Base(os.Args[0])+".log")
+}
+
+func (w *writer) open() error {
+	err := os.MkdirAll(Dir, 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(logFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// rotate 将 x.log 依次重命名为 x.log.1 ... x.log.N，超出 maxBackups 的最旧文件被覆盖
+func (w *writer) rotate() error {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	name := logFile()
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", name, i), fmt.Sprintf("%s.%d", name, i+1))
+	}
+	err := os.Rename(name, name+".1")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return w.open()
+}
+
+func (w *writer) write(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		err = w.open()
+		if err != nil {
+			return err
+		}
+	}
+	if w.size > 0 && w.size+int64(len(data)) > w.maxSize {
+		err = w.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return err
+}
+
+// Query 返回所有进程审计日志中 since 之后的记录，按时间排序，limit 大于 0 时只返回最新的 limit 条
+func Query(since time.Time, limit int) ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(Dir, "*.log*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		err = readEntries(file, since, &entries)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+func readEntries(file string, since time.Time, entries *[]Entry) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// 忽略写入时被截断的行
+			continue
+		}
+		if entry.Time.Before(since) {
+			continue
+		}
+		*entries = append(*entries, entry)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resetWriter(t *testing.T, maxSize int64) {
+	Dir = t.TempDir()
+	_writerOnce = sync.Once{}
+	getWriter().maxSize = maxSize
+	t.Cleanup(func() {
+		if _writer.file != nil {
+			_ = _writer.file.Close()
+		}
+	})
+}
+
+func TestArg(t *testing.T) {
+	assert.Equal(t, "3", NewArg("n", 3).String())
+	assert.Equal(t, "true", NewArg("live", true).String())
+	assert.Equal(t, redacted, NewSecretArg("password", "123456").String())
+	assert.Equal(t, "", NewSecretArg("password", "").String())
+}
+
+func TestCall(t *testing.T) {
+	resetWriter(t, defaultMaxSize)
+
+	call := Begin(nil, ":1.10", "Accounts1.User.SetPassword",
+		NewArg("user", "test"), NewSecretArg("password", "secret"))
+	call.SetAuthResult(errors.New("not authorized"))
+	call.End(dbus.MakeFailedError(errors.New("access denied")))
+
+	call = Begin(nil, ":1.11", "Grub2.SetDefaultEntry", NewArg("entry", "deepin"))
+	call.SetAuthResult(nil)
+	call.End(nil)
+
+	data, err := os.ReadFile(logFile())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+
+	entries, err := Query(time.Time{}, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Accounts1.User.SetPassword", entries[0].Method)
+	assert.Equal(t, AuthDenied, entries[0].Auth)
+	assert.Equal(t, redacted, entries[0].Args["password"])
+	assert.Equal(t, "access denied", entries[0].Error)
+	assert.Equal(t, AuthAuthorized, entries[1].Auth)
+	assert.Equal(t, "deepin", entries[1].Args["entry"])
+
+	entries, err = Query(time.Time{}, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Grub2.SetDefaultEntry", entries[0].Method)
+
+	entries, err = Query(time.Now().Add(time.Hour), 0)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRotate(t *testing.T) {
+	resetWriter(t, 512)
+
+	for i := 0; i < 20; i++ {
+		Begin(nil, ":1.10", "Timedate1.SetNTPServer", NewArg("server", "ntp.example.com")).End(nil)
+	}
+	files, err := filepath.Glob(filepath.Join(Dir, "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, defaultMaxBackups+1)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(512))
+	}
+
+	entries, err := Query(time.Time{}, 0)
+	require.NoError(t, err)
+	assert.NotEmpty(t, entries)
+	assert.Less(t, len(entries), 20)
+}
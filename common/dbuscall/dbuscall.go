@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package dbuscall 解析并执行文本形式的 D-Bus 方法调用，供快捷键和手势的 D-Bus 调用动作使用。
+//
+// 格式为 <bus> <destination> <path> <interface.method> [type:value ...]，例如：
+//
+//	session org.deepin.dde.Osd1 /org/deepin/dde/Osd1 org.deepin.dde.Osd1.ShowOSD string:CapsLockOn
+//
+// bus 为 session 或 system，参数类型与 dbus-send 相同，包含空白的值可以用单引号或双引号括起来。
+package dbuscall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	BusSession = "session"
+	BusSystem  = "system"
+
+	callTimeout = 25 * time.Second
+)
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+type Call struct {
+	Bus    string
+	Dest   string
+	Path   dbus.ObjectPath
+	Method string // 包含接口名
+	Args   []interface{}
+}
+
+func (c *Call) String() string {
+	return fmt.Sprintf("%s %s %s %s %v", c.Bus, c.Dest, c.Path, c.Method, c.Args)
+}
+
+func Parse(str string) (*Call, error) {
+	fields, err := splitFields(str)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("invalid dbus call %q: need bus, destination, path and method", str)
+	}
+
+	c := &Call{
+		Bus:    fields[0],
+		Dest:   fields[1],
+		Path:   dbus.ObjectPath(fields[2]),
+		Method: fields[3],
+	}
+	if c.Bus != BusSession && c.Bus != BusSystem {
+		return nil, fmt.Errorf("invalid bus %q", c.Bus)
+	}
+	if !c.Path.IsValid() {
+		return nil, fmt.Errorf("invalid object path %q", c.Path)
+	}
+	idx := strings.LastIndex(c.Method, ".")
+	if idx <= 0 || idx == len(c.Method)-1 {
+		return nil, fmt.Errorf("invalid method %q: need interface.method", c.Method)
+	}
+
+	for _, field := range fields[4:] {
+		arg, err := parseArg(field)
+		if err != nil {
+			return nil, err
+		}
+		c.Args = append(c.Args, arg)
+	}
+	return c, nil
+}
+
+// parseArg 解析 type:value 形式的参数
+func parseArg(field string) (interface{}, error) {
+	typ, value, ok := strings.Cut(field, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid argument %q: need type:value", field)
+	}
+
+	var arg interface{}
+	var err error
+	switch typ {
+	case "string":
+		arg = value
+	case "objpath":
+		path := dbus.ObjectPath(value)
+		if !path.IsValid() {
+			return nil, fmt.Errorf("invalid object path %q", value)
+		}
+		arg = path
+	case "boolean":
+		arg, err = strconv.ParseBool(value)
+	case "byte":
+		var v uint64
+		v, err = strconv.ParseUint(value, 0, 8)
+		arg = byte(v)
+	case "int16":
+		var v int64
+		v, err = strconv.ParseInt(value, 0, 16)
+		arg = int16(v)
+	case "uint16":
+		var v uint64
+		v, err = strconv.ParseUint(value, 0, 16)
+		arg = uint16(v)
+	case "int32":
+		var v int64
+		v, err = strconv.ParseInt(value, 0, 32)
+		arg = int32(v)
+	case "uint32":
+		var v uint64
+		v, err = strconv.ParseUint(value, 0, 32)
+		arg = uint32(v)
+	case "int64":
+		arg, err = strconv.ParseInt(value, 0, 64)
+	case "uint64":
+		arg, err = strconv.ParseUint(value, 0, 64)
+	case "double":
+		arg, err = strconv.ParseFloat(value, 64)
+	default:
+		return nil, fmt.Errorf("invalid argument type %q", typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid argument %q: %v", field, err)
+	}
+	return arg, nil
+}
+
+// splitFields 按空白分割，单引号、双引号内的空白不分割，反斜杠转义下一个字符
+func splitFields(str string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quote rune
+	escaped := false
+	for _, r := range str {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inField = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				field.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errUnterminatedQuote
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// Do 连接指定的总线并调用方法，忽略返回值
+func (c *Call) Do() error {
+	var conn *dbus.Conn
+	var err error
+	if c.Bus == BusSystem {
+		conn, err = dbus.SystemBus()
+	} else {
+		conn, err = dbus.SessionBus()
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	return conn.Object(c.Dest, c.Path).CallWithContext(ctx, c.Method, 0, c.Args...).Err
+}
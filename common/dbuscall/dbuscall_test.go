@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dbuscall
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse(`session org.deepin.dde.Osd1 /org/deepin/dde/Osd1 org.deepin.dde.Osd1.ShowOSD string:CapsLockOn`)
+	require.NoError(t, err)
+	assert.Equal(t, &Call{
+		Bus:    BusSession,
+		Dest:   "org.deepin.dde.Osd1",
+		Path:   "/org/deepin/dde/Osd1",
+		Method: "org.deepin.dde.Osd1.ShowOSD",
+		Args:   []interface{}{"CapsLockOn"},
+	}, c)
+
+	c, err = Parse(`system org.foo /org/foo org.foo.Bar  "string:hello world" 'string:a "b"' string:c\ d` +
+		` int16:-2 uint16:2 int32:-3 uint32:0x10 int64:-5 uint64:6 double:1.5 byte:255 boolean:true objpath:/a/b`)
+	require.NoError(t, err)
+	assert.Equal(t, BusSystem, c.Bus)
+	assert.Equal(t, []interface{}{"hello world", `a "b"`, "c d",
+		int16(-2), uint16(2), int32(-3), uint32(16), int64(-5), uint64(6),
+		1.5, byte(255), true, dbus.ObjectPath("/a/b")}, c.Args)
+
+	for _, str := range []string{
+		"",
+		"session org.foo /org/foo",
+		"user org.foo /org/foo org.foo.Bar",
+		"session org.foo org/foo org.foo.Bar",
+		"session org.foo /org/foo Bar",
+		"session org.foo /org/foo org.foo.Bar hello",
+		"session org.foo /org/foo org.foo.Bar int32:abc",
+		"session org.foo /org/foo org.foo.Bar byte:256",
+		"session org.foo /org/foo org.foo.Bar variant:1",
+		`session org.foo /org/foo org.foo.Bar "string:a`,
+	} {
+		_, err = Parse(str)
+		assert.Error(t, err, str)
+	}
+}
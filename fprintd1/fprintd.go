@@ -44,7 +44,7 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
-	err = service.Export(dbusPath, d.manager)
+	err = d.Export(dbusPath, d.manager)
 	if err != nil {
 		return err
 	}
@@ -18,6 +18,10 @@ const (
 	ActionTypeShortcut    = "shortcut"
 	ActionTypeCommandline = "commandline"
 	ActionTypeBuiltin     = "built-in"
+	// Action 为 dbuscall 格式的 D-Bus 方法调用
+	ActionTypeDBusCall = "dbus-call"
+	// Action 为按键，触发这个按键对应的快捷键
+	ActionTypeKeyRemap = "key-remap"
 )
 
 var (
@@ -51,7 +51,7 @@ func (d *Daemon) Start() error {
 	}
 
 	service := loader.GetService()
-	err = service.Export(dbusServicePath, d.manager)
+	err = d.Export(dbusServicePath, d.manager)
 	if err != nil {
 		logger.Error("failed to export gesture:", err)
 		return err
@@ -16,6 +16,7 @@ import (
 	"sync"
 
 	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/common/dbuscall"
 	dock "github.com/linuxdeepin/go-dbus-factory/session/com.deepin.dde.daemon.dock"
 	notification "github.com/linuxdeepin/go-dbus-factory/session/com.deepin.dde.notification"
 	wm "github.com/linuxdeepin/go-dbus-factory/session/com.deepin.wm"
@@ -439,6 +440,14 @@ func (m *Manager) Exec(evInfo EventInfo) error {
 		cmd = fmt.Sprintf("xdotool key %s", cmd)
 	case ActionTypeBuiltin:
 		return m.handleBuiltinAction(cmd)
+	case ActionTypeDBusCall:
+		call, err := dbuscall.Parse(cmd)
+		if err != nil {
+			return err
+		}
+		return call.Do()
+	case ActionTypeKeyRemap:
+		return emitKeystroke(cmd)
 	default:
 		return fmt.Errorf("invalid action type: %s", info.Action.Type)
 	}
@@ -482,6 +491,18 @@ func (m *Manager) listenGSettingsChanged() {
 	})
 }
 
+// emitKeystroke 通过 keybinding 触发按键对应的快捷键
+func emitKeystroke(keystroke string) error {
+	call := &dbuscall.Call{
+		Bus:    dbuscall.BusSession,
+		Dest:   "org.deepin.dde.Keybinding1",
+		Path:   "/org/deepin/dde/Keybinding1",
+		Method: "org.deepin.dde.Keybinding1.EmitKeystroke",
+		Args:   []interface{}{keystroke},
+	}
+	return call.Do()
+}
+
 func (m *Manager) handleBuiltinAction(cmd string) error {
 	fn := m.builtinSets[cmd]
 	if fn == nil {
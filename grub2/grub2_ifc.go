@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	dbus "github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/common/audit"
 	"github.com/linuxdeepin/dde-daemon/grub_common"
 	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/procfs"
@@ -94,7 +95,12 @@ func (g *Grub2) GetAvailableGfxmodes(sender dbus.Sender) (gfxModes []string, bus
 	return gfxModes, nil
 }
 
-func (g *Grub2) SetDefaultEntry(sender dbus.Sender, entry string) *dbus.Error {
+func (g *Grub2) SetDefaultEntry(sender dbus.Sender, entry string) (busErr *dbus.Error) {
+	call := audit.Begin(g.service, sender, "Grub2.SetDefaultEntry", audit.NewArg("entry", entry))
+	defer func() {
+		call.End(busErr)
+	}()
+
 	err := checkInvokePermission(g.service, sender)
 	if err != nil {
 		return dbusutil.ToError(err)
@@ -102,6 +108,7 @@ func (g *Grub2) SetDefaultEntry(sender dbus.Sender, entry string) *dbus.Error {
 	g.service.DelayAutoQuit()
 
 	err = g.checkAuth(sender, polikitActionIdCommon)
+	call.SetAuthResult(err)
 	if err != nil {
 		return dbusutil.ToError(err)
 	}
@@ -5,10 +5,16 @@
 package image_effect
 
 import (
+	"time"
+
 	"github.com/linuxdeepin/dde-daemon/loader"
+	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/log"
 )
 
+// idleTimeout 超过该时间没有调用则停止模块，下次调用时再启动
+const idleTimeout = 5 * time.Minute
+
 func init() {
 	loader.Register(newModule())
 }
@@ -37,10 +43,38 @@ func (m *Module) Start() error {
 }
 
 func (m *Module) Stop() error {
-	// TODO
+	if m.ie == nil {
+		return nil
+	}
+
+	service := m.ie.service
+	err := service.StopExport(m.ie)
+	if err != nil {
+		logger.Warning(err)
+	}
+	err = service.ReleaseName(dbusServiceName)
+	if err != nil {
+		logger.Warning(err)
+	}
+	m.ie = nil
 	return nil
 }
 
+func (m *Module) GetLazyActivation() *loader.LazyActivation {
+	return &loader.LazyActivation{
+		ServiceName: dbusServiceName,
+		Path:        dbusPath,
+		Prototype:   &ImageEffect{},
+		Object: func() dbusutil.ImplementerExt {
+			if m.ie == nil {
+				return nil
+			}
+			return m.ie
+		},
+		IdleTimeout: idleTimeout,
+	}
+}
+
 const moduleName = "image_effect"
 
 var logger = log.NewLogger("daemon/" + moduleName)
@@ -54,7 +88,7 @@ func newModule() *Module {
 func start() (*ImageEffect, error) {
 	logger.Debug("module image_effect start")
 	ie := newImageEffect()
-	service := loader.GetService()
+	service := loader.GetModuleService(moduleName)
 	ie.service = service
 	err := service.Export(dbusPath, ie)
 	if err != nil {
@@ -0,0 +1,557 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package inputdevices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	dxutils "github.com/linuxdeepin/dde-api/dxinput/utils"
+	"github.com/linuxdeepin/dde-daemon/common/dbuscall"
+	"github.com/linuxdeepin/dde-daemon/keybinding1/shortcuts"
+	kwin "github.com/linuxdeepin/go-dbus-factory/session/org.kde.kwin"
+	"github.com/linuxdeepin/go-lib/keyfile"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/ext/input"
+	"github.com/linuxdeepin/go-x11-client/ext/test"
+	"github.com/linuxdeepin/go-x11-client/util/keysyms"
+)
+
+// 鼠标按键重映射，只能重映射侧键（BTN_SIDE、BTN_EXTRA，X11 中为 8、9）及更高的按键，重映射的动作：
+// button:N  作为按键 N，disabled  禁用按键，
+// key:<Control>c  模拟按下组合键，shortcut:<type>:<id>  触发 keybinding1 中的快捷键。
+// X11 下按键和禁用通过 XInput 的 button map 实现，组合键和快捷键通过 XI2 在设备上被动抓取按键实现；
+// Wayland 下写入 KWin 的 ButtonRebinds 配置，KWin 的配置不区分设备，所有鼠标使用相同的重映射，也不支持触发快捷键。
+
+const (
+	minRemapButton = 8
+	maxRemapButton = 32
+
+	buttonActionPrefixButton   = "button:"
+	buttonActionPrefixKey      = "key:"
+	buttonActionPrefixShortcut = "shortcut:"
+	buttonActionDisabled       = "disabled"
+
+	kwinInputConfigFile    = "kcminputrc"
+	kwinButtonRebindsGroup = "ButtonRebinds][Mouse"
+	// 记录 dde 写入 KWin 配置的项，只修改这些项，不影响用户在 KWin 中的设置
+	kwinButtonRebindsFile = "deepin/dde-daemon/inputdevices/kwin_button_rebinds.json"
+)
+
+const (
+	buttonActionButton = iota
+	buttonActionDisable
+	buttonActionKey
+	buttonActionShortcut
+)
+
+var (
+	errInvalidButtonAction     = errors.New("invalid button action")
+	errButtonRemapNotSupported = errors.New("button remapping is only supported by mouse")
+)
+
+type buttonAction struct {
+	Type         int
+	Button       uint8
+	Mods         []string // key 的修饰键，如 Control、Shift
+	Key          string
+	ShortcutId   string
+	ShortcutType int32
+}
+
+func parseButtonAction(str string) (*buttonAction, error) {
+	switch {
+	case str == buttonActionDisabled:
+		return &buttonAction{Type: buttonActionDisable}, nil
+
+	case strings.HasPrefix(str, buttonActionPrefixButton):
+		button, err := strconv.ParseUint(str[len(buttonActionPrefixButton):], 10, 8)
+		if err != nil || button == 0 || button > maxRemapButton {
+			return nil, fmt.Errorf("%w: %q", errInvalidButtonAction, str)
+		}
+		return &buttonAction{Type: buttonActionButton, Button: uint8(button)}, nil
+
+	case strings.HasPrefix(str, buttonActionPrefixKey):
+		// 与 keybinding1 的快捷键格式相同，不支持多键序列
+		ks, err := shortcuts.ParseKeystroke(str[len(buttonActionPrefixKey):])
+		if err != nil || len(ks.Sequence) > 0 || ks.Keysym == 0 {
+			return nil, fmt.Errorf("%w: %q", errInvalidButtonAction, str)
+		}
+		return &buttonAction{Type: buttonActionKey, Mods: keystrokeMods(ks.Mods), Key: ks.Keystr}, nil
+
+	case strings.HasPrefix(str, buttonActionPrefixShortcut):
+		typeStr, id, ok := strings.Cut(str[len(buttonActionPrefixShortcut):], ":")
+		type0, err := strconv.ParseInt(typeStr, 10, 32)
+		if !ok || err != nil || id == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidButtonAction, str)
+		}
+		return &buttonAction{Type: buttonActionShortcut, ShortcutId: id, ShortcutType: int32(type0)}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", errInvalidButtonAction, str)
+}
+
+var keystrokeModKeysyms = map[string]string{
+	"Control": "Control_L",
+	"Shift":   "Shift_L",
+	"Alt":     "Alt_L",
+	"Super":   "Super_L",
+}
+
+// keystrokeMods 按 Control、Shift、Alt、Super 的顺序返回组合键的修饰键
+func keystrokeMods(mods shortcuts.Modifiers) []string {
+	var result []string
+	for _, mod := range []struct {
+		mask shortcuts.Modifiers
+		name string
+	}{
+		{keysyms.ModMaskControl, "Control"},
+		{keysyms.ModMaskShift, "Shift"},
+		{keysyms.ModMaskAlt, "Alt"},
+		{keysyms.ModMaskSuper, "Super"},
+	} {
+		if mods&mod.mask != 0 {
+			result = append(result, mod.name)
+		}
+	}
+	return result
+}
+
+// buttonActions 返回解析后的按键重映射，保存前已经检查过，这里忽略无效的项
+func (p *deviceProfile) buttonActions() map[uint8]*buttonAction {
+	if p == nil {
+		return nil
+	}
+	result := make(map[uint8]*buttonAction, len(p.Buttons))
+	for button, str := range p.Buttons {
+		action, err := parseButtonAction(str)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		result[button] = action
+	}
+	return result
+}
+
+// buildButtonMap 根据重映射修改设备的 button map，只修改重映射为按键或禁用的按键。
+// saved 为之前修改过的按键原来的值，不再重映射的按键恢复为原来的值，返回新的 button map 和新的 saved。
+func buildButtonMap(btnMap []byte, actions map[uint8]*buttonAction, saved map[uint8]byte) ([]byte, map[uint8]byte) {
+	result := make([]byte, len(btnMap))
+	copy(result, btnMap)
+	for button, value := range saved {
+		if int(button) <= len(result) {
+			result[button-1] = value
+		}
+	}
+
+	newSaved := make(map[uint8]byte)
+	for button, action := range actions {
+		if int(button) > len(result) {
+			continue
+		}
+		var value byte
+		switch action.Type {
+		case buttonActionButton:
+			value = action.Button
+		case buttonActionDisable:
+			value = 0
+		default:
+			continue
+		}
+		newSaved[button] = result[button-1]
+		result[button-1] = value
+	}
+	return result, newSaved
+}
+
+type buttonGrab struct {
+	deviceId int32
+	button   uint8
+}
+
+type buttonMapper struct {
+	conn       *x.Conn
+	keySymbols *keysyms.KeySymbols
+
+	mu sync.Mutex
+	// 设备 id -> 修改过的按键原来的值，取消重映射后需要恢复
+	saved map[int32]map[uint8]byte
+	grabs map[buttonGrab]*buttonAction
+}
+
+func newButtonMapper() (*buttonMapper, error) {
+	conn, err := x.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	_, err = input.XIQueryVersion(conn, input.MajorVersion, input.MinorVersion).Reply(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	bm := &buttonMapper{
+		conn:       conn,
+		keySymbols: keysyms.NewKeySymbols(conn),
+		saved:      make(map[int32]map[uint8]byte),
+		grabs:      make(map[buttonGrab]*buttonAction),
+	}
+	go bm.handleXEvent()
+	return bm, nil
+}
+
+func (bm *buttonMapper) handleXEvent() {
+	eventChan := make(chan x.GenericEvent, 10)
+	bm.conn.AddEventChan(eventChan)
+	inputExtData := bm.conn.GetExtensionData(input.Ext())
+	for ev := range eventChan {
+		switch ev.GetEventCode() {
+		case x.MappingNotifyEventCode:
+			event, _ := x.NewMappingNotifyEvent(ev)
+			bm.keySymbols.RefreshKeyboardMapping(event)
+		case x.GeGenericEventCode:
+			geEvent, _ := x.NewGeGenericEvent(ev)
+			if geEvent.Extension != inputExtData.MajorOpcode ||
+				geEvent.EventType != input.ButtonPressEventCode {
+				continue
+			}
+			e, err := input.NewButtonPressEvent(geEvent.Data)
+			if err != nil {
+				logger.Warning(err)
+				continue
+			}
+			bm.mu.Lock()
+			action := bm.grabs[buttonGrab{int32(e.DeviceId), uint8(e.Detail)}]
+			bm.mu.Unlock()
+			if action != nil {
+				go bm.doAction(action)
+			}
+		}
+	}
+}
+
+func (bm *buttonMapper) doAction(action *buttonAction) {
+	var err error
+	switch action.Type {
+	case buttonActionKey:
+		err = bm.emitKeystroke(action.Mods, action.Key)
+	case buttonActionShortcut:
+		err = activateShortcut(action.ShortcutId, action.ShortcutType)
+	}
+	if err != nil {
+		logger.Warning("failed to do button action:", err)
+	}
+}
+
+func keysymNames(mods []string) []string {
+	result := make([]string, 0, len(mods)+1)
+	for _, mod := range mods {
+		result = append(result, keystrokeModKeysyms[mod])
+	}
+	return result
+}
+
+// emitKeystroke 通过 XTest 依次按下修饰键和按键，再以相反的顺序释放
+func (bm *buttonMapper) emitKeystroke(mods []string, key string) error {
+	var codes []x.Keycode
+	for _, str := range append(keysymNames(mods), key) {
+		keyCodes, err := bm.keySymbols.StringToKeycodes(str)
+		if err != nil {
+			return err
+		}
+		if len(keyCodes) == 0 {
+			return fmt.Errorf("no keycode for %q", str)
+		}
+		codes = append(codes, keyCodes[0])
+	}
+
+	var err error
+	rootWin := bm.conn.GetDefaultScreen().Root
+	for _, code := range codes {
+		err = test.FakeInputChecked(bm.conn, x.KeyPressEventCode, uint8(code), x.TimeCurrentTime, rootWin, 0, 0, 0).Check(bm.conn)
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(codes) - 1; i >= 0; i-- {
+		err = test.FakeInputChecked(bm.conn, x.KeyReleaseEventCode, uint8(codes[i]), x.TimeCurrentTime, rootWin, 0, 0, 0).Check(bm.conn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func activateShortcut(id string, type0 int32) error {
+	call := &dbuscall.Call{
+		Bus:    dbuscall.BusSession,
+		Dest:   "org.deepin.dde.Keybinding1",
+		Path:   "/org/deepin/dde/Keybinding1",
+		Method: "org.deepin.dde.Keybinding1.ActivateShortcut",
+		Args:   []interface{}{id, type0},
+	}
+	return call.Do()
+}
+
+// apply 设置设备的 button map 和抓取的按键，devices 为所有鼠标的 id、名字和重映射
+func (bm *buttonMapper) apply(devices []*mouseInfo) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	rootWin := bm.conn.GetDefaultScreen().Root
+	for grab := range bm.grabs {
+		err := input.XIPassiveUngrabDeviceChecked(bm.conn, rootWin, uint32(grab.button),
+			input.DeviceId(grab.deviceId), input.GrabTypeButton,
+			[]uint32{input.ModifierMaskAny}).Check(bm.conn)
+		if err != nil {
+			logger.Debug(err)
+		}
+	}
+	bm.grabs = make(map[buttonGrab]*buttonAction)
+
+	for _, dev := range devices {
+		actions := getDeviceProfile(dev.key).buttonActions()
+		if len(actions) == 0 && len(bm.saved[dev.Id]) == 0 {
+			continue
+		}
+
+		btnMap, err := dxutils.GetButtonMap(uint32(dev.Id), dev.Name)
+		if err != nil {
+			logger.Warningf("failed to get button map of '%d - %v': %v", dev.Id, dev.Name, err)
+			continue
+		}
+		newBtnMap, saved := buildButtonMap(btnMap, actions, bm.saved[dev.Id])
+		if string(newBtnMap) != string(btnMap) {
+			err = dxutils.SetButtonMap(uint32(dev.Id), dev.Name, newBtnMap)
+			if err != nil {
+				logger.Warningf("failed to set button map of '%d - %v': %v", dev.Id, dev.Name, err)
+				continue
+			}
+		}
+		bm.saved[dev.Id] = saved
+
+		for button, action := range actions {
+			if action.Type != buttonActionKey && action.Type != buttonActionShortcut {
+				continue
+			}
+			reply, err := input.XIPassiveGrabDevice(bm.conn, rootWin, x.None, uint32(button),
+				input.DeviceId(dev.Id), input.GrabTypeButton, input.GrabMode22Async, x.GrabModeAsync,
+				false, []uint32{input.XIEventMaskButtonPress | input.XIEventMaskButtonRelease},
+				[]uint32{input.ModifierMaskAny}).Reply(bm.conn)
+			if err != nil || len(reply.Modifiers) > 0 {
+				logger.Warningf("failed to grab button %d of '%d - %v': %v", button, dev.Id, dev.Name, err)
+				continue
+			}
+			bm.grabs[buttonGrab{dev.Id, button}] = action
+		}
+	}
+}
+
+// xButtonToQtButton 将 X11 的按键转换为 KWin 配置中使用的 Qt::MouseButton
+func xButtonToQtButton(button uint8) uint32 {
+	switch button {
+	case 1:
+		return 0x1
+	case 2:
+		return 0x4
+	case 3:
+		return 0x2
+	}
+	if button >= 8 {
+		return 0x8 << (button - 8)
+	}
+	return 0
+}
+
+// keystrokeToQtSequence 将 <Control>c 转换为 KWin 配置中使用的 Ctrl+C
+func keystrokeToQtSequence(mods []string, key string) string {
+	qtMods := map[string]string{
+		"Control": "Ctrl",
+		"Shift":   "Shift",
+		"Alt":     "Alt",
+		"Super":   "Meta",
+	}
+	var parts []string
+	for _, mod := range mods {
+		parts = append(parts, qtMods[mod])
+	}
+	if len(key) == 1 {
+		key = strings.ToUpper(key)
+	}
+	return strings.Join(append(parts, key), "+")
+}
+
+// kwinButtonRebinds 返回 KWin ButtonRebinds 配置中 ExtraButtonN 的值，不支持的动作返回空字符串
+func kwinButtonRebinds(actions map[uint8]*buttonAction) map[string]string {
+	result := make(map[string]string)
+	for button, action := range actions {
+		var value string
+		switch action.Type {
+		case buttonActionButton:
+			value = fmt.Sprintf("MouseButton,%d", xButtonToQtButton(action.Button))
+		case buttonActionDisable:
+			value = "Disabled"
+		case buttonActionKey:
+			value = "Key," + keystrokeToQtSequence(action.Mods, action.Key)
+		default:
+			logger.Warningf("button action %d is not supported on wayland", action.Type)
+			continue
+		}
+		result[fmt.Sprintf("ExtraButton%d", button-minRemapButton+1)] = value
+	}
+	return result
+}
+
+// applyKWinButtonRebinds 合并所有鼠标的重映射写入 KWin 的配置，同一个按键有多个重映射时使用 id 最小的设备的
+func applyKWinButtonRebinds(devices []*mouseInfo) error {
+	sorted := make([]*mouseInfo, len(devices))
+	copy(sorted, devices)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Id < sorted[j].Id
+	})
+	rebinds := make(map[string]string)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		for k, v := range kwinButtonRebinds(getDeviceProfile(sorted[i].key).buttonActions()) {
+			rebinds[k] = v
+		}
+	}
+
+	ownedFile := filepath.Join(basedir.GetUserConfigDir(), kwinButtonRebindsFile)
+	owned := loadKWinButtonRebinds(ownedFile)
+	if len(rebinds) == 0 && len(owned) == 0 {
+		return nil
+	}
+
+	file := filepath.Join(basedir.GetUserConfigDir(), kwinInputConfigFile)
+	kf := keyfile.NewKeyFile()
+	err := kf.LoadFromFile(file)
+	if err != nil {
+		logger.Debug(err)
+	}
+	changed := mergeKWinButtonRebinds(kf, owned, rebinds)
+	if changed {
+		err = kf.SaveToFile(file)
+		if err != nil {
+			return err
+		}
+	}
+	if !isStringMapEqual(owned, rebinds) {
+		err = saveKWinButtonRebinds(ownedFile, rebinds)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	sessionBus, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	return kwin.NewKWin(sessionBus).Reconfigure(0)
+}
+
+// mergeKWinButtonRebinds 在 KWin 配置中删除 dde 之前写入、现在不再需要的项，并写入 rebinds，
+// 已被用户在 KWin 中修改的项不删除，返回配置是否有变化
+func mergeKWinButtonRebinds(kf *keyfile.KeyFile, owned, rebinds map[string]string) bool {
+	changed := false
+	for k, v := range owned {
+		if _, ok := rebinds[k]; ok {
+			continue
+		}
+		if old, err := kf.GetValue(kwinButtonRebindsGroup, k); err == nil && old == v {
+			kf.DeleteKey(kwinButtonRebindsGroup, k)
+			changed = true
+		}
+	}
+	for k, v := range rebinds {
+		if old, err := kf.GetValue(kwinButtonRebindsGroup, k); err != nil || old != v {
+			kf.SetValue(kwinButtonRebindsGroup, k, v)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func loadKWinButtonRebinds(file string) map[string]string {
+	var rebinds map[string]string
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return nil
+	}
+	err = json.Unmarshal(data, &rebinds)
+	if err != nil {
+		logger.Warning("failed to load kwin button rebinds:", err)
+	}
+	return rebinds
+}
+
+func saveKWinButtonRebinds(file string, rebinds map[string]string) error {
+	data, err := json.Marshal(rebinds)
+	if err != nil {
+		return err
+	}
+	// #nosec G301
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	// #nosec G306
+	return os.WriteFile(file, data, 0644)
+}
+
+func isStringMapEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Mouse) applyButtonMap() {
+	if globalWayland {
+		err := applyKWinButtonRebinds(m.devInfos)
+		if err != nil {
+			logger.Warning("failed to apply button rebinds:", err)
+		}
+		return
+	}
+
+	if m.buttonMapper == nil {
+		hasActions := false
+		for _, v := range m.devInfos {
+			if len(getDeviceProfile(v.key).buttonActions()) > 0 {
+				hasActions = true
+				break
+			}
+		}
+		if !hasActions {
+			return
+		}
+		var err error
+		m.buttonMapper, err = newButtonMapper()
+		if err != nil {
+			logger.Warning("failed to init button mapper:", err)
+			return
+		}
+	}
+	m.buttonMapper.apply(m.devInfos)
+}
@@ -0,0 +1,529 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package inputdevices
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// 用户自定义的键盘布局，XKB symbols 文件安装到 ~/.config/xkb/symbols/ 下，
+// libxkbcommon 默认会搜索这个目录，所以 Wayland 下可以直接使用；
+// X11 下 setxkbmap 只搜索系统目录，需要通过 xkbcomp -I 指定目录后编译并上传到 X server。
+// 文件中每个 xkb_symbols 段是一个变体，标记为 default 的段（没有时为第一个段）是布局本身，
+// 段内 name[Group1] 的值作为描述。
+
+const (
+	customLayoutsFile = "deepin/dde-daemon/keyboard/custom_layouts.json"
+	systemXkbDir      = "/usr/share/X11/xkb"
+
+	cmdXkbComp = "/usr/bin/xkbcomp"
+
+	maxCustomSymbolsSize = 1024 * 1024
+)
+
+var (
+	errInvalidCustomLayoutName = errors.New("invalid custom layout name")
+	errCustomLayoutConflict    = errors.New("custom layout name conflicts with a system layout")
+	errCustomLayoutNotFound    = errors.New("custom layout not found")
+	errNoXkbSymbols            = errors.New("no xkb_symbols section found")
+	errCustomSymbolsTooLarge   = errors.New("xkb symbols file is too large")
+	errXkbCompNotFound         = errors.New("xkbcomp not found, can not check xkb symbols")
+
+	customLayoutNameReg = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	xkbSymbolsReg       = regexp.MustCompile(`((?:[a-z_]+\s+)*)xkb_symbols\s+"([^"]*)"\s*\{`)
+	// 段名会作为变体传给 setxkbmap 和 xkbcomp，只允许这些字符
+	xkbSectionNameReg = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	xkbGroupNameReg   = regexp.MustCompile(`name\[[Gg]roup1\]\s*=\s*"([^"]*)"`)
+)
+
+type xkbSymbolsSection struct {
+	Name        string
+	Default     bool
+	Description string
+}
+
+// parseXkbSymbols 解析 symbols 文件中的所有 xkb_symbols 段，第一个段为默认段
+func parseXkbSymbols(content string) ([]xkbSymbolsSection, error) {
+	content = stripXkbComments(content)
+	if err := checkXkbBraces(content); err != nil {
+		return nil, err
+	}
+
+	var sections []xkbSymbolsSection
+	matches := xkbSymbolsReg.FindAllStringSubmatchIndex(content, -1)
+	for i, match := range matches {
+		flags := strings.Fields(content[match[2]:match[3]])
+		section := xkbSymbolsSection{
+			Name: content[match[4]:match[5]],
+		}
+		if !xkbSectionNameReg.MatchString(section.Name) {
+			return nil, fmt.Errorf("invalid xkb_symbols section name %q", section.Name)
+		}
+		for _, flag := range flags {
+			if flag == "default" {
+				section.Default = true
+			}
+		}
+		for _, s := range sections {
+			if s.Name == section.Name {
+				return nil, fmt.Errorf("duplicate xkb_symbols section %q", section.Name)
+			}
+		}
+
+		end := len(content)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		if m := xkbGroupNameReg.FindStringSubmatch(content[match[1]:end]); m != nil {
+			section.Description = m[1]
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		return nil, errNoXkbSymbols
+	}
+
+	for i, s := range sections {
+		if s.Default {
+			sections[0], sections[i] = sections[i], sections[0]
+			break
+		}
+	}
+	sections[0].Default = true
+	return sections, nil
+}
+
+// stripXkbComments 删除 // 和 /* */ 注释，保留字符串中的内容
+func stripXkbComments(content string) string {
+	var sb strings.Builder
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			sb.WriteByte(c)
+			if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+			sb.WriteByte(c)
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			sb.WriteByte('\n')
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := strings.Index(content[i+2:], "*/")
+			if end == -1 {
+				return sb.String()
+			}
+			i += end + 3
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func checkXkbBraces(content string) error {
+	depth := 0
+	inString := false
+	for _, c := range content {
+		switch {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth < 0 {
+				return errors.New("unbalanced braces in xkb symbols")
+			}
+		}
+	}
+	if depth != 0 || inString {
+		return errors.New("unbalanced braces in xkb symbols")
+	}
+	return nil
+}
+
+// compileXkbSymbols 使用 xkbcomp 编译包含指定布局的完整 keymap，检查 symbols 文件是否有效
+func compileXkbSymbols(xkbDir, name, variant string) error {
+	keymap := fmt.Sprintf(`xkb_keymap {
+	xkb_keycodes { include "evdev+aliases(qwerty)" };
+	xkb_types { include "complete" };
+	xkb_compat { include "complete" };
+	xkb_symbols { include "pc+%s(%s)+inet(evdev)" };
+};
+`, name, variant)
+	// #nosec G204
+	cmd := exec.Command(cmdXkbComp, "-w", "0", "-I"+xkbDir, "-I"+systemXkbDir,
+		"-xkm", "-", "-o", os.DevNull)
+	cmd.Stdin = strings.NewReader(keymap)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("invalid xkb symbols %s(%s): %s", name, variant, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+type customLayout struct {
+	Name     string
+	Sections []xkbSymbolsSection
+}
+
+// layouts 返回布局和描述，键与系统布局相同，为 layout;variant 的形式
+func (cl *customLayout) layouts() map[string]string {
+	result := make(map[string]string)
+	for _, s := range cl.Sections {
+		key := cl.Name + layoutDelim
+		if !s.Default {
+			key += s.Name
+		}
+		desc := s.Description
+		if desc == "" {
+			desc = strings.TrimSuffix(key, layoutDelim)
+		}
+		result[key] = desc
+	}
+	return result
+}
+
+// variantOf 返回布局对应的 xkb_symbols 段名，默认段在系统布局中的变体为空
+func (cl *customLayout) variantOf(variant string) (string, bool) {
+	for _, s := range cl.Sections {
+		if (variant == "" && s.Default) || (variant == s.Name && !s.Default) {
+			return s.Name, true
+		}
+	}
+	return "", false
+}
+
+type customLayoutManager struct {
+	mu      sync.RWMutex
+	file    string
+	xkbDir  string
+	layouts map[string]*customLayout
+}
+
+func newCustomLayoutManager(file, xkbDir string) *customLayoutManager {
+	clm := &customLayoutManager{
+		file:    file,
+		xkbDir:  xkbDir,
+		layouts: make(map[string]*customLayout),
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return clm
+	}
+	var list []*customLayout
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		logger.Warning("failed to load custom layouts:", err)
+		return clm
+	}
+	for _, cl := range list {
+		clm.layouts[cl.Name] = cl
+	}
+	return clm
+}
+
+func (clm *customLayoutManager) symbolsFile(name string) string {
+	return filepath.Join(clm.xkbDir, "symbols", name)
+}
+
+// save 调用前需要持有 mu
+func (clm *customLayoutManager) save() error {
+	list := make([]*customLayout, 0, len(clm.layouts))
+	for _, cl := range clm.layouts {
+		list = append(list, cl)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	// #nosec G301
+	err = os.MkdirAll(filepath.Dir(clm.file), 0755)
+	if err != nil {
+		return err
+	}
+	// #nosec G306
+	return os.WriteFile(clm.file, data, 0644)
+}
+
+// install 检查并安装 symbols 文件，已存在同名的自定义布局时替换
+func (clm *customLayoutManager) install(name, symbols string) (*customLayout, error) {
+	if len(symbols) > maxCustomSymbolsSize {
+		return nil, errCustomSymbolsTooLarge
+	}
+	sections, err := parseXkbSymbols(symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先在临时目录中编译检查，避免无效的文件影响已安装的布局；
+	// 没有 xkbcomp 时无法检查，X11 下也无法应用，拒绝安装
+	if _, err := os.Stat(cmdXkbComp); err != nil {
+		return nil, errXkbCompNotFound
+	}
+	tmpDir, err := os.MkdirTemp("", "dde-xkb-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	err = writeSymbolsFile(filepath.Join(tmpDir, "symbols", name), symbols)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sections {
+		err = compileXkbSymbols(tmpDir, name, s.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clm.mu.Lock()
+	defer clm.mu.Unlock()
+	err = writeSymbolsFile(clm.symbolsFile(name), symbols)
+	if err != nil {
+		return nil, err
+	}
+	cl := &customLayout{Name: name, Sections: sections}
+	clm.layouts[name] = cl
+	return cl, clm.save()
+}
+
+func writeSymbolsFile(file, symbols string) error {
+	// #nosec G301
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	// #nosec G306
+	return os.WriteFile(file, []byte(symbols), 0644)
+}
+
+func (clm *customLayoutManager) remove(name string) (*customLayout, error) {
+	clm.mu.Lock()
+	defer clm.mu.Unlock()
+	cl, ok := clm.layouts[name]
+	if !ok {
+		return nil, errCustomLayoutNotFound
+	}
+	err := os.Remove(clm.symbolsFile(name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	delete(clm.layouts, name)
+	return cl, clm.save()
+}
+
+// get 按 layout;variant 查找自定义布局，返回布局和对应的 xkb_symbols 段名
+func (clm *customLayoutManager) get(layout string) (*customLayout, string, bool) {
+	name, variant, ok := strings.Cut(layout, layoutDelim)
+	if !ok {
+		return nil, "", false
+	}
+	clm.mu.RLock()
+	defer clm.mu.RUnlock()
+	cl := clm.layouts[name]
+	if cl == nil {
+		return nil, "", false
+	}
+	section, ok := cl.variantOf(variant)
+	return cl, section, ok
+}
+
+func (clm *customLayoutManager) list() map[string]string {
+	result := make(map[string]string)
+	clm.mu.RLock()
+	defer clm.mu.RUnlock()
+	for _, cl := range clm.layouts {
+		for layout, desc := range cl.layouts() {
+			result[layout] = desc
+		}
+	}
+	return result
+}
+
+func (kbd *Keyboard) initCustomLayouts() {
+	kbd.customLayouts = newCustomLayoutManager(filepath.Join(basedir.GetUserConfigDir(), customLayoutsFile),
+		filepath.Join(basedir.GetUserConfigDir(), "xkb"))
+}
+
+// getLayoutDesc 查找系统布局和自定义布局的描述
+func (kbd *Keyboard) getLayoutDesc(layout string) (string, bool) {
+	if detail, ok := kbd.layoutMap[layout]; ok {
+		return detail.Description, true
+	}
+	cl, _, ok := kbd.customLayouts.get(layout)
+	if !ok {
+		return "", false
+	}
+	return cl.layouts()[layout], true
+}
+
+// applyCustomLayout 在 X11 下编译并上传自定义布局，选项也一起设置，单独执行 setxkbmap -option 会丢失自定义布局
+func (kbd *Keyboard) applyCustomLayout(name, variant string) error {
+	layout := name
+	if name != "us" {
+		layout += ",us"
+		variant += ","
+	}
+	args := []string{"-layout", layout, "-variant", variant, "-option", ""}
+	for _, opt := range kbd.UserOptionList.Get() {
+		args = append(args, "-option", opt)
+	}
+	args = append(args, "-print")
+	return runXkbPipe(args, []string{"-w", "0", "-I" + kbd.customLayouts.xkbDir, "-", os.Getenv("DISPLAY")})
+}
+
+// runXkbPipe 执行 setxkbmap -print | xkbcomp，参数直接传给命令，不经过 shell
+func runXkbPipe(setKbdArgs, xkbCompArgs []string) error {
+	// #nosec G204
+	setKbd := exec.Command(cmdSetKbd, setKbdArgs...)
+	// #nosec G204
+	xkbComp := exec.Command(cmdXkbComp, xkbCompArgs...)
+	var setKbdErr, xkbCompOut bytes.Buffer
+	setKbd.Stderr = &setKbdErr
+	xkbComp.Stdout = &xkbCompOut
+	xkbComp.Stderr = &xkbCompOut
+
+	pipe, err := setKbd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	xkbComp.Stdin = pipe
+	err = setKbd.Start()
+	if err != nil {
+		return err
+	}
+	err = xkbComp.Start()
+	if err != nil {
+		_ = setKbd.Process.Kill()
+		_ = setKbd.Wait()
+		return err
+	}
+	// 先等待 xkbcomp 读完管道，再关闭读端，xkbcomp 提前退出时 setxkbmap 不会阻塞在写入上
+	xkbCompErr := xkbComp.Wait()
+	_ = pipe.Close()
+	err = setKbd.Wait()
+	if err != nil {
+		return fmt.Errorf("%s: %v", strings.TrimSpace(setKbdErr.String()), err)
+	}
+	if xkbCompErr != nil {
+		return fmt.Errorf("%s: %v", strings.TrimSpace(xkbCompOut.String()), xkbCompErr)
+	}
+	return nil
+}
+
+func (kbd *Keyboard) installCustomLayout(name, symbols string) ([]string, error) {
+	if !customLayoutNameReg.MatchString(name) {
+		return nil, errInvalidCustomLayoutName
+	}
+	// 与系统布局同名时会遮盖系统的 symbols 文件
+	if _, ok := kbd.layoutMap[name+layoutDelim]; ok {
+		return nil, errCustomLayoutConflict
+	}
+	if _, err := os.Stat(filepath.Join(systemXkbDir, "symbols", name)); err == nil {
+		return nil, errCustomLayoutConflict
+	}
+
+	cl, err := kbd.customLayouts.install(name, symbols)
+	if err != nil {
+		return nil, err
+	}
+	var layouts []string
+	for layout := range cl.layouts() {
+		layouts = append(layouts, layout)
+	}
+	sort.Strings(layouts)
+
+	// 当前正在使用时重新应用
+	kbd.PropsMu.RLock()
+	currentLayout := kbd.CurrentLayout
+	kbd.PropsMu.RUnlock()
+	if strings.HasPrefix(currentLayout, name+layoutDelim) {
+		kbd.applyLayout()
+	}
+	return layouts, nil
+}
+
+func (kbd *Keyboard) removeCustomLayout(name string) error {
+	cl, err := kbd.customLayouts.remove(name)
+	if err != nil {
+		return err
+	}
+
+	kbd.PropsMu.RLock()
+	currentLayout := kbd.CurrentLayout
+	kbd.PropsMu.RUnlock()
+	for layout := range cl.layouts() {
+		kbd.delUserLayout(layout)
+	}
+	if _, ok := cl.layouts()[currentLayout]; !ok {
+		return nil
+	}
+
+	// 正在使用的布局被删除，切换到用户的其他布局，UserLayoutList 由 accounts 的属性变化更新，可能还包含已删除的布局
+	newLayout := kbdDefaultLayout
+	removed := cl.layouts()
+	kbd.PropsMu.RLock()
+	for _, layout := range kbd.UserLayoutList {
+		if _, ok := removed[layout]; !ok {
+			newLayout = layout
+			break
+		}
+	}
+	kbd.PropsMu.RUnlock()
+	kbd.setLayoutForAccountsUser(newLayout)
+	kbd.setLayout(newLayout)
+	return nil
+}
+
+// InstallCustomLayout 安装用户自定义的 XKB symbols 文件，name 为布局名，symbols 为文件内容。
+// 返回安装的布局，可以用于 AddUserLayout 和 CurrentLayout。
+func (kbd *Keyboard) InstallCustomLayout(name, symbols string) (layouts []string, busErr *dbus.Error) {
+	logger.Debug("InstallCustomLayout", name)
+	layouts, err := kbd.installCustomLayout(name, symbols)
+	if err != nil {
+		return nil, dbusutil.ToError(err)
+	}
+	return layouts, nil
+}
+
+func (kbd *Keyboard) RemoveCustomLayout(name string) *dbus.Error {
+	logger.Debug("RemoveCustomLayout", name)
+	return dbusutil.ToError(kbd.removeCustomLayout(name))
+}
+
+func (kbd *Keyboard) ListCustomLayouts() (layouts map[string]string, busErr *dbus.Error) {
+	return kbd.customLayouts.list(), nil
+}
@@ -0,0 +1,427 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package inputdevices
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-api/dxinput"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// 设备的独立配置，按 vendor:product:name 保存，同型号的设备共用一份配置。
+// 配置中只保存与类别配置（Mouse、TrackPoint、Touchpad、Wacom）不同的项，没有设置的项使用类别的配置。
+// 每个设备导出一个 D-Bus 对象，设备插拔后重新导出并应用配置。
+
+const (
+	deviceProfilesFile = "deepin/dde-daemon/inputdevices/device_profiles.json"
+
+	devicePathPrefix       = "/org/deepin/dde/InputDevice1/Device"
+	deviceDBusInterface    = "org.deepin.dde.InputDevice1.Device"
+	deviceTypeMouse        = "mouse"
+	deviceTypeTrackPoint   = "trackpoint"
+	deviceTypeTouchpad     = "touchpad"
+	deviceTypeWacom        = "wacom"
+	deviceSysfsIdDirectory = "device/id"
+)
+
+type deviceProfile struct {
+	LeftHanded           *bool    `json:",omitempty"`
+	NaturalScroll        *bool    `json:",omitempty"`
+	AdaptiveAccelProfile *bool    `json:",omitempty"`
+	MotionAcceleration   *float64 `json:",omitempty"`
+	// Buttons 鼠标按键的重映射，格式见 parseButtonAction
+	Buttons map[uint8]string `json:",omitempty"`
+}
+
+func (p *deviceProfile) isEmpty() bool {
+	return p == nil || (p.LeftHanded == nil && p.NaturalScroll == nil &&
+		p.AdaptiveAccelProfile == nil && p.MotionAcceleration == nil && len(p.Buttons) == 0)
+}
+
+func (p *deviceProfile) leftHanded(def bool) bool {
+	if p == nil || p.LeftHanded == nil {
+		return def
+	}
+	return *p.LeftHanded
+}
+
+func (p *deviceProfile) naturalScroll(def bool) bool {
+	if p == nil || p.NaturalScroll == nil {
+		return def
+	}
+	return *p.NaturalScroll
+}
+
+func (p *deviceProfile) adaptiveAccelProfile(def bool) bool {
+	if p == nil || p.AdaptiveAccelProfile == nil {
+		return def
+	}
+	return *p.AdaptiveAccelProfile
+}
+
+func (p *deviceProfile) motionAcceleration(def float64) float64 {
+	if p == nil || p.MotionAcceleration == nil {
+		return def
+	}
+	return *p.MotionAcceleration
+}
+
+// check 检查配置项的取值范围，并且去掉设备类型不支持的项
+func (p *deviceProfile) check(devType string) error {
+	if p.MotionAcceleration != nil {
+		if accel := *p.MotionAcceleration; accel <= 0 {
+			return fmt.Errorf("invalid motion acceleration %v", accel)
+		}
+	}
+	for button, action := range p.Buttons {
+		if button < minRemapButton || button > maxRemapButton {
+			return fmt.Errorf("can not remap button %d", button)
+		}
+		_, err := parseButtonAction(action)
+		if err != nil {
+			return err
+		}
+	}
+	switch devType {
+	case deviceTypeWacom:
+		p.NaturalScroll = nil
+		p.AdaptiveAccelProfile = nil
+		p.MotionAcceleration = nil
+		p.Buttons = nil
+	case deviceTypeTouchpad, deviceTypeTrackPoint:
+		p.AdaptiveAccelProfile = nil
+		p.Buttons = nil
+	}
+	return nil
+}
+
+type deviceProfileStore struct {
+	file     string
+	mu       sync.Mutex
+	profiles map[string]*deviceProfile
+}
+
+// _deviceProfiles 在创建各类设备前初始化，为 nil 时所有设备使用类别的配置
+var _deviceProfiles *deviceProfileStore
+
+func newDeviceProfileStore(file string) *deviceProfileStore {
+	s := &deviceProfileStore{
+		file:     file,
+		profiles: make(map[string]*deviceProfile),
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return s
+	}
+	err = json.Unmarshal(data, &s.profiles)
+	if err != nil {
+		logger.Warning("failed to load device profiles:", err)
+		s.profiles = make(map[string]*deviceProfile)
+	}
+	return s
+}
+
+func (s *deviceProfileStore) get(key string) *deviceProfile {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profiles[key]
+	if p == nil {
+		return nil
+	}
+	result := *p
+	return &result
+}
+
+// set 保存设备的配置，配置为空时删除
+func (s *deviceProfileStore) set(key string, p *deviceProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.isEmpty() {
+		if _, ok := s.profiles[key]; !ok {
+			return nil
+		}
+		delete(s.profiles, key)
+	} else {
+		s.profiles[key] = p
+	}
+	return s.save()
+}
+
+// save 调用前需要持有 mu
+func (s *deviceProfileStore) save() error {
+	data, err := json.Marshal(s.profiles)
+	if err != nil {
+		return err
+	}
+	// #nosec G301
+	err = os.MkdirAll(filepath.Dir(s.file), 0755)
+	if err != nil {
+		return err
+	}
+	// #nosec G306
+	return os.WriteFile(s.file, data, 0644)
+}
+
+func getDeviceProfile(key string) *deviceProfile {
+	return _deviceProfiles.get(key)
+}
+
+// getDeviceKey 通过 sysfs 中的 id/vendor 和 id/product 生成设备的标识，读取失败时只使用设备名
+func getDeviceKey(sysfsPath, name string) string {
+	var vendor, product string
+	if sysfsPath != "" {
+		vendor = readSysfsId(filepath.Join(sysfsPath, deviceSysfsIdDirectory, "vendor"))
+		product = readSysfsId(filepath.Join(sysfsPath, deviceSysfsIdDirectory, "product"))
+	}
+	return fmt.Sprintf("%s:%s:%s", vendor, product, name)
+}
+
+func readSysfsId(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func getWacomKey(dw *dxinput.Wacom) string {
+	_, sysfsPath, _ := getExtraInfo(dw.Id)
+	return getDeviceKey(sysfsPath, dw.Name)
+}
+
+type InputDevice struct {
+	service *dbusutil.Service
+	manager *Manager
+	PropsMu sync.RWMutex
+
+	Id   int32
+	Type string
+	Name string
+	// Key 为 vendor:product:name，相同的 Key 共用一份配置
+	Key string
+	// Profile 为 JSON 格式的设备配置，只包含与类别配置不同的项
+	Profile string
+}
+
+func (*InputDevice) GetInterfaceName() string {
+	return deviceDBusInterface
+}
+
+func (d *InputDevice) getPath() dbus.ObjectPath {
+	return getDevicePath(d.Type, d.Id)
+}
+
+func getDevicePath(devType string, id int32) dbus.ObjectPath {
+	// 不同类型的设备 id 也不会重复，加上类型只是为了便于区分
+	return dbus.ObjectPath(fmt.Sprintf("%s/%s%d", devicePathPrefix, devType, id))
+}
+
+func (d *InputDevice) updateProfile() {
+	p := getDeviceProfile(d.Key)
+	if p == nil {
+		p = &deviceProfile{}
+	}
+	data, _ := json.Marshal(p)
+	d.PropsMu.Lock()
+	d.setPropProfile(string(data))
+	d.PropsMu.Unlock()
+}
+
+// SetProfile 设置设备的配置，profile 为 JSON 格式，可以包含 LeftHanded、NaturalScroll、
+// AdaptiveAccelProfile、MotionAcceleration 和 Buttons（后两项只支持鼠标），没有包含的项使用类别的配置。
+func (d *InputDevice) SetProfile(profile string) *dbus.Error {
+	logger.Debug("SetProfile", d.Key, profile)
+	var p deviceProfile
+	dec := json.NewDecoder(strings.NewReader(profile))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&p)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = p.check(d.Type)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = _deviceProfiles.set(d.Key, &p)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	d.manager.applyDeviceProfile(d.Key)
+	return nil
+}
+
+// SetButtonAction 设置鼠标按键 button 的重映射，action 为空时取消重映射
+func (d *InputDevice) SetButtonAction(button uint8, action string) *dbus.Error {
+	logger.Debug("SetButtonAction", d.Key, button, action)
+	if d.Type != deviceTypeMouse {
+		return dbusutil.ToError(errButtonRemapNotSupported)
+	}
+	p := getDeviceProfile(d.Key)
+	if p == nil {
+		p = &deviceProfile{}
+	}
+	buttons := make(map[uint8]string, len(p.Buttons)+1)
+	for k, v := range p.Buttons {
+		buttons[k] = v
+	}
+	if action == "" {
+		delete(buttons, button)
+	} else {
+		buttons[button] = action
+	}
+	p.Buttons = buttons
+	err := p.check(d.Type)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = _deviceProfiles.set(d.Key, p)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	d.manager.applyDeviceProfile(d.Key)
+	return nil
+}
+
+// ResetProfile 删除设备的配置，恢复使用类别的配置
+func (d *InputDevice) ResetProfile() *dbus.Error {
+	return d.SetProfile("{}")
+}
+
+func (m *Manager) initDeviceProfiles() {
+	_deviceProfiles = newDeviceProfileStore(filepath.Join(basedir.GetUserConfigDir(), deviceProfilesFile))
+	m.devices = make(map[dbus.ObjectPath]*InputDevice)
+}
+
+type deviceItem struct {
+	id      int32
+	devType string
+	name    string
+	key     string
+}
+
+// listDeviceItems 调用前需要持有 devicesMu，设备插拔的处理可能在不同的 goroutine 中同时进行
+func (m *Manager) listDeviceItems() []deviceItem {
+	var items []deviceItem
+	for _, v := range m.mouse.devInfos {
+		items = append(items, deviceItem{v.Id, deviceTypeMouse, v.Name, v.key})
+	}
+	for _, v := range m.trackPoint.devInfos {
+		items = append(items, deviceItem{v.Id, deviceTypeTrackPoint, v.Name, v.key})
+	}
+	for _, v := range m.tpad.devInfos {
+		items = append(items, deviceItem{v.Id, deviceTypeTouchpad, v.Name, v.key})
+	}
+	for _, v := range m.wacom.devInfos {
+		items = append(items, deviceItem{v.Id, deviceTypeWacom, v.Name, getWacomKey(v)})
+	}
+	return items
+}
+
+// updateDevices 在设备插拔后导出新设备的对象，删除已拔出设备的对象
+func (m *Manager) updateDevices() {
+	m.devicesMu.Lock()
+	defer m.devicesMu.Unlock()
+	items := m.listDeviceItems()
+	alive := make(map[dbus.ObjectPath]bool, len(items))
+	for _, item := range items {
+		path := getDevicePath(item.devType, item.id)
+		alive[path] = true
+		if d, ok := m.devices[path]; ok && d.Key == item.key {
+			continue
+		} else if ok {
+			// 同一个 id 换成了其他设备
+			m.stopExportDevice(d)
+		}
+
+		d := &InputDevice{
+			service: m.service,
+			manager: m,
+			Id:      item.id,
+			Type:    item.devType,
+			Name:    item.name,
+			Key:     item.key,
+		}
+		d.updateProfile()
+		err := m.module.Export(path, d)
+		if err != nil {
+			logger.Warning("failed to export device:", err)
+			continue
+		}
+		m.devices[path] = d
+	}
+	for path, d := range m.devices {
+		if !alive[path] {
+			m.stopExportDevice(d)
+		}
+	}
+
+	paths := make([]dbus.ObjectPath, 0, len(m.devices))
+	for path := range m.devices {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i] < paths[j]
+	})
+	m.PropsMu.Lock()
+	m.setPropDevices(paths)
+	m.PropsMu.Unlock()
+}
+
+// stopExportDevice 调用前需要持有 devicesMu
+func (m *Manager) stopExportDevice(d *InputDevice) {
+	err := m.service.StopExport(d)
+	if err != nil {
+		logger.Warning(err)
+	}
+	delete(m.devices, d.getPath())
+}
+
+// applyDeviceProfile 配置变化后重新应用设备所属类别的配置，类别的配置中会读取每个设备的配置
+func (m *Manager) applyDeviceProfile(key string) {
+	types := make(map[string]bool)
+	m.devicesMu.Lock()
+	for _, d := range m.devices {
+		if d.Key == key {
+			d.updateProfile()
+			types[d.Type] = true
+		}
+	}
+	m.devicesMu.Unlock()
+
+	if types[deviceTypeMouse] {
+		m.mouse.enableLeftHanded()
+		m.mouse.enableNaturalScroll()
+		m.mouse.enableAdaptiveAccelProfile()
+		m.mouse.motionAcceleration()
+		m.mouse.applyButtonMap()
+	}
+	if types[deviceTypeTrackPoint] {
+		m.trackPoint.enableLeftHanded()
+		m.trackPoint.motionAcceleration()
+	}
+	if types[deviceTypeTouchpad] {
+		m.tpad.enableLeftHanded()
+		m.tpad.enableNaturalScroll()
+		m.tpad.motionAcceleration()
+	}
+	if types[deviceTypeWacom] {
+		m.wacom.enableLeftHanded()
+	}
+}
@@ -67,11 +67,14 @@ func (kbd *Keyboard) Reset() *dbus.Error {
 func (kbd *Keyboard) LayoutList() (map[string]string, *dbus.Error) {
 	locales := langselector.GetLocales()
 	result := kbd.layoutMap.filterByLocales(locales)
+	for layout, desc := range kbd.customLayouts.list() {
+		result[layout] = desc
+	}
 
 	kbd.PropsMu.RLock()
 	for _, layout := range kbd.UserLayoutList {
-		layoutDetail := kbd.layoutMap[layout]
-		result[layout] = layoutDetail.Description
+		desc, _ := kbd.getLayoutDesc(layout)
+		result[layout] = desc
 	}
 	kbd.PropsMu.RUnlock()
 
@@ -83,12 +86,12 @@ func (kbd *Keyboard) GetLayoutDesc(layout string) (string, *dbus.Error) {
 		return "", nil
 	}
 
-	value, ok := kbd.layoutMap[layout]
+	desc, ok := kbd.getLayoutDesc(layout)
 	if !ok {
 		return "", nil
 	}
 
-	return value.Description, nil
+	return desc, nil
 }
 
 func (kbd *Keyboard) AddUserLayout(layout string) *dbus.Error {
@@ -9,8 +9,8 @@ import (
 	"github.com/linuxdeepin/go-lib/log"
 )
 
-//go:generate dbusutil-gen -type Keyboard,Mouse,Touchpad,TrackPoint,Wacom keyboard.go mouse.go touchpad.go trackpoint.go wacom.go
-//go:generate dbusutil-gen em -type Keyboard,Mouse,Touchpad,TrackPoint,Wacom,Manager
+//go:generate dbusutil-gen -type Keyboard,Mouse,Touchpad,TrackPoint,Wacom,Manager,InputDevice keyboard.go mouse.go touchpad.go trackpoint.go wacom.go manager.go device_profile.go
+//go:generate dbusutil-gen em -type Keyboard,Mouse,Touchpad,TrackPoint,Wacom,Manager,InputDevice
 
 var (
 	_manager *Manager
@@ -41,13 +41,14 @@ func (d *Daemon) Start() error {
 
 	service := loader.GetService()
 	_manager = NewManager(service)
+	_manager.module = d
 
-	err := service.Export(dbusPath, _manager, _manager.syncConfig)
+	err := d.Export(dbusPath, _manager, _manager.syncConfig)
 	if err != nil {
 		return err
 	}
 
-	err = service.Export(kbdDBusPath, _manager.kbd)
+	err = d.Export(kbdDBusPath, _manager.kbd)
 	if err != nil {
 		return err
 	}
@@ -58,18 +59,23 @@ func (d *Daemon) Start() error {
 	if err != nil {
 		return err
 	}
+	err = kbdServerObj.SetWriteCallback(_manager.kbd, "LayoutPolicy",
+		_manager.kbd.setLayoutPolicy)
+	if err != nil {
+		return err
+	}
 
-	err = service.Export(wacomDBusPath, _manager.wacom)
+	err = d.Export(wacomDBusPath, _manager.wacom)
 	if err != nil {
 		return err
 	}
 
-	err = service.Export(touchPadDBusPath, _manager.tpad)
+	err = d.Export(touchPadDBusPath, _manager.tpad)
 	if err != nil {
 		return err
 	}
 
-	err = service.Export(mouseDBusPath, _manager.mouse, _manager.trackPoint)
+	err = d.Export(mouseDBusPath, _manager.mouse, _manager.trackPoint)
 	if err != nil {
 		return err
 	}
@@ -6,9 +6,13 @@ package inputdevices
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 
+	"github.com/linuxdeepin/go-lib/keyfile"
+	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_SystemLayout(t *testing.T) {
@@ -60,3 +64,169 @@ func Test_CurveControlPoints(t *testing.T) {
 		fmt.Println("")
 	}
 }
+
+func Test_WindowLayoutMap(t *testing.T) {
+	wl := newWindowLayoutMap()
+	wl.set(1, "us;")
+	wl.set(2, "de;")
+	wl.set(3, "us;")
+
+	layout, ok := wl.get(2)
+	assert.True(t, ok)
+	assert.Equal(t, "de;", layout)
+
+	wl.deleteLayout("us;")
+	_, ok = wl.get(1)
+	assert.False(t, ok)
+
+	wl.set(4, "fr;")
+	wl.prune([]x.Window{4, 5})
+	_, ok = wl.get(2)
+	assert.False(t, ok)
+	layout, ok = wl.get(4)
+	assert.True(t, ok)
+	assert.Equal(t, "fr;", layout)
+}
+
+func Test_ParseXkbSymbols(t *testing.T) {
+	sections, err := parseXkbSymbols(`// company layouts
+partial alphanumeric_keys
+xkb_symbols "dvorak" {
+    include "us(dvorak)"
+    name[Group1]= "Company (Dvorak)";
+};
+
+default partial alphanumeric_keys
+xkb_symbols "basic" {
+    /* { unbalanced in comment */
+    include "us(basic)"
+    name[Group1]= "Company";
+    key <AC10> { [ semicolon, colon ] };
+};
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []xkbSymbolsSection{
+		{Name: "basic", Default: true, Description: "Company"},
+		{Name: "dvorak", Description: "Company (Dvorak)"},
+	}, sections)
+
+	cl := &customLayout{Name: "company", Sections: sections}
+	assert.Equal(t, map[string]string{
+		"company;":       "Company",
+		"company;dvorak": "Company (Dvorak)",
+	}, cl.layouts())
+	variant, ok := cl.variantOf("")
+	assert.True(t, ok)
+	assert.Equal(t, "basic", variant)
+	_, ok = cl.variantOf("basic")
+	assert.False(t, ok)
+
+	_, err = parseXkbSymbols(`xkb_symbols "basic" { include "us(basic)"`)
+	assert.Error(t, err)
+	_, err = parseXkbSymbols(`// xkb_symbols "basic" {};`)
+	assert.Equal(t, errNoXkbSymbols, err)
+	// 段名会作为参数传给 setxkbmap 和 xkbcomp
+	for _, name := range []string{"a b", "x$(id)", "x;y", ""} {
+		_, err = parseXkbSymbols(`xkb_symbols "` + name + `" { include "us(basic)" };`)
+		assert.Error(t, err, name)
+	}
+	_, err = parseXkbSymbols(`xkb_symbols "Dvorak_intl-2" { include "us(basic)" };`)
+	assert.NoError(t, err)
+}
+
+func Test_DeviceProfile(t *testing.T) {
+	assert.Equal(t, "046d:c52b:Logitech USB Receiver",
+		getDeviceKey("testdata/sysfs/event5", "Logitech USB Receiver"))
+	assert.Equal(t, "::Trackball", getDeviceKey("testdata/sysfs/none", "Trackball"))
+
+	var p *deviceProfile
+	assert.True(t, p.leftHanded(true))
+	assert.Equal(t, 1.5, p.motionAcceleration(1.5))
+
+	file := filepath.Join(t.TempDir(), "inputdevices", "device_profiles.json")
+	s := newDeviceProfileStore(file)
+	leftHanded := true
+	accel := 0.5
+	assert.NoError(t, s.set("::Trackball", &deviceProfile{LeftHanded: &leftHanded, MotionAcceleration: &accel}))
+
+	s = newDeviceProfileStore(file)
+	p = s.get("::Trackball")
+	assert.True(t, p.leftHanded(false))
+	assert.False(t, p.naturalScroll(false))
+	assert.Equal(t, 0.5, p.motionAcceleration(1.5))
+	assert.Nil(t, s.get("::Mouse"))
+
+	assert.NoError(t, s.set("::Trackball", &deviceProfile{}))
+	s = newDeviceProfileStore(file)
+	assert.Nil(t, s.get("::Trackball"))
+
+	p = &deviceProfile{NaturalScroll: &leftHanded, MotionAcceleration: &accel}
+	assert.NoError(t, p.check(deviceTypeWacom))
+	assert.True(t, p.isEmpty())
+	accel = 0
+	p = &deviceProfile{MotionAcceleration: &accel}
+	assert.Error(t, p.check(deviceTypeMouse))
+}
+
+func Test_ButtonAction(t *testing.T) {
+	action, err := parseButtonAction("button:2")
+	assert.NoError(t, err)
+	assert.Equal(t, &buttonAction{Type: buttonActionButton, Button: 2}, action)
+
+	action, err = parseButtonAction("key:<Shift><Control>t")
+	assert.NoError(t, err)
+	assert.Equal(t, &buttonAction{Type: buttonActionKey, Mods: []string{"Control", "Shift"}, Key: "t"}, action)
+	assert.Equal(t, "Ctrl+Shift+T", keystrokeToQtSequence(action.Mods, action.Key))
+
+	action, err = parseButtonAction("shortcut:0:screenshot")
+	assert.NoError(t, err)
+	assert.Equal(t, &buttonAction{Type: buttonActionShortcut, ShortcutId: "screenshot"}, action)
+
+	for _, str := range []string{"button:0", "button:x", "key:<Hyper>t", "key:notakey", "key:<Super>w, t", "shortcut:screenshot", "run:ls"} {
+		_, err = parseButtonAction(str)
+		assert.Error(t, err, str)
+	}
+
+	actions := (&deviceProfile{Buttons: map[uint8]string{
+		8:  "button:2",
+		9:  "disabled",
+		10: "key:<Control>c",
+	}}).buttonActions()
+	// 只修改有重映射的按键，其他按键保持原来的值
+	btnMap := []byte{3, 2, 1, 4, 5, 6, 7, 8, 9, 12, 11, 10}
+	newBtnMap, saved := buildButtonMap(btnMap, actions, nil)
+	assert.Equal(t, []byte{3, 2, 1, 4, 5, 6, 7, 2, 0, 12, 11, 10}, newBtnMap)
+	assert.Equal(t, map[uint8]byte{8: 8, 9: 9}, saved)
+	// 取消重映射后恢复原来的值
+	newBtnMap, saved = buildButtonMap(newBtnMap, map[uint8]*buttonAction{9: actions[9]}, saved)
+	assert.Equal(t, []byte{3, 2, 1, 4, 5, 6, 7, 8, 0, 12, 11, 10}, newBtnMap)
+	assert.Equal(t, map[uint8]byte{9: 9}, saved)
+	assert.Equal(t, map[string]string{
+		"ExtraButton1": "MouseButton,4",
+		"ExtraButton2": "Disabled",
+		"ExtraButton3": "Key,Ctrl+C",
+	}, kwinButtonRebinds(actions))
+}
+
+func Test_mergeKWinButtonRebinds(t *testing.T) {
+	kf := keyfile.NewKeyFile()
+	require.NoError(t, kf.LoadFromData([]byte("[ButtonRebinds][Mouse]\n"+
+		"ExtraButton1=Key,Ctrl+C\nExtraButton2=Disabled\nExtraButton4=Key,Meta+E\n")))
+	owned := map[string]string{
+		"ExtraButton1": "Key,Ctrl+C",
+		"ExtraButton2": "MouseButton,4",
+	}
+
+	// 只删除 dde 写入且未被修改的项，用户的设置保持不变
+	assert.True(t, mergeKWinButtonRebinds(kf, owned, map[string]string{"ExtraButton3": "Disabled"}))
+	section, err := kf.GetSection(kwinButtonRebindsGroup)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"ExtraButton2": "Disabled",
+		"ExtraButton3": "Disabled",
+		"ExtraButton4": "Key,Meta+E",
+	}, section)
+
+	assert.False(t, mergeKWinButtonRebinds(kf, map[string]string{"ExtraButton3": "Disabled"},
+		map[string]string{"ExtraButton3": "Disabled"}))
+}
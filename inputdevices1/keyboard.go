@@ -17,6 +17,7 @@ import (
 
 	"github.com/godbus/dbus/v5"
 	"github.com/linuxdeepin/dde-api/dxinput"
+	"github.com/linuxdeepin/dde-daemon/common/dconfig"
 	ddbus "github.com/linuxdeepin/dde-daemon/dbus"
 	accounts "github.com/linuxdeepin/go-dbus-factory/system/org.deepin.dde.accounts1"
 	"github.com/linuxdeepin/go-gir/gio-2.0"
@@ -65,6 +66,13 @@ type Keyboard struct {
 	appLayoutCfg   appLayoutConfig
 	// dbusutil-gen: equal=nil
 	UserLayoutList []string
+	// LayoutPolicy 布局的切换策略，0 全局，1 按应用，2 按窗口
+	LayoutPolicy int32 `prop:"access:rw"`
+
+	windowLayouts     *windowLayoutMap
+	layoutPerWindow   bool
+	dsInputdevices    *dconfig.DConfig
+	atomNetClientList x.Atom
 
 	// dbusutil-gen: ignore-below
 	LayoutScope    gsprop.Enum `prop:"access:rw"`
@@ -78,9 +86,10 @@ type Keyboard struct {
 
 	UserOptionList gsprop.Strv
 
-	setting   *gio.Settings
-	user      accounts.User
-	layoutMap layoutMap
+	setting       *gio.Settings
+	user          accounts.User
+	layoutMap     layoutMap
+	customLayouts *customLayoutManager
 
 	devNumber int
 }
@@ -97,6 +106,8 @@ func newKeyboard(service *dbusutil.Service) *Keyboard {
 	kbd.CapslockToggle.Bind(kbd.setting, kbdKeyCapslockToggle)
 	kbd.UserOptionList.Bind(kbd.setting, kbdKeyLayoutOptions)
 	kbd.LayoutScope.Bind(kbd.setting, kbdKeyLayoutScope)
+	kbd.initLayoutPolicy()
+	kbd.initCustomLayouts()
 
 	var err error
 	err = kbd.loadAppLayoutConfig()
@@ -282,7 +293,12 @@ func (kbd *Keyboard) applyLayout() {
 	currentLayout := kbd.CurrentLayout
 	kbd.PropsMu.RUnlock()
 
-	err := applyLayout(currentLayout)
+	var err error
+	if cl, variant, ok := kbd.customLayouts.get(currentLayout); ok {
+		err = kbd.applyCustomLayout(cl.Name, variant)
+	} else {
+		err = applyLayout(currentLayout)
+	}
 	if err != nil {
 		logger.Warningf("failed to set layout to %q: %v", currentLayout, err)
 		return
@@ -300,6 +316,15 @@ func (kbd *Keyboard) applyOptions() {
 		return
 	}
 
+	kbd.PropsMu.RLock()
+	currentLayout := kbd.CurrentLayout
+	kbd.PropsMu.RUnlock()
+	if _, _, ok := kbd.customLayouts.get(currentLayout); ok {
+		// 自定义布局需要和选项一起编译
+		kbd.applyLayout()
+		return
+	}
+
 	// the old value wouldn't be cleared, so we will force clear it.
 	err := doAction(cmdSetKbd + " -option")
 	if err != nil {
@@ -324,7 +349,7 @@ func (kbd *Keyboard) checkLayout(layout string) error {
 		return dbusutil.ToError(errInvalidLayout)
 	}
 
-	_, ok := kbd.layoutMap[layout]
+	_, ok := kbd.getLayoutDesc(layout)
 	if !ok {
 		return dbusutil.ToError(errInvalidLayout)
 	}
@@ -354,10 +379,13 @@ func (kbd *Keyboard) setCurrentLayout(write *dbusutil.PropertyWrite) *dbus.Error
 	}
 	kbd.addUserLayout(layout)
 
-	if kbd.LayoutScope.Get() == layoutScopeGlobal {
+	switch kbd.getLayoutPolicy() {
+	case layoutPolicyGlobal:
 		kbd.setLayoutForAccountsUser(layout)
-	} else {
+	case layoutPolicyApp:
 		kbd.setLayoutScopeApp(layout)
+	case layoutPolicyWindow:
+		kbd.setLayoutScopeWindow(layout)
 	}
 	return nil
 }
@@ -407,6 +435,7 @@ func (kbd *Keyboard) delUserLayout(layout string) {
 	if kbd.appLayoutCfg.deleteLayout(layout) {
 		kbd.saveAppLayoutConfig()
 	}
+	kbd.windowLayouts.deleteLayout(layout)
 }
 
 func (kbd *Keyboard) addUserOption(option string) {
@@ -632,29 +661,8 @@ func applyXmodmapConfig() error {
 
 func (kbd *Keyboard) listenSettingsChanged() {
 	gsettings.ConnectChanged(kbdSchema, "layout-scope", func(key string) {
-		scope := kbd.LayoutScope.Get()
-		logger.Debug("layout scope changed to", scope)
-		switch scope {
-		case layoutScopeGlobal:
-			if kbd.user == nil {
-				logger.Warning("kbd.user is nil")
-				return
-			}
-
-			layout, err := kbd.user.Layout().Get(0)
-			if err != nil {
-				logger.Warning("failed to get user layout:", err)
-				return
-			}
-
-			kbd.setLayout(layout)
-
-		case layoutScopeApp:
-			layout, ok := kbd.appLayoutCfg.get(kbd.activeWinClass)
-			if ok {
-				kbd.setLayout(layout)
-			}
-		}
+		logger.Debug("layout scope changed to", kbd.LayoutScope.Get())
+		kbd.updateLayoutPolicy()
 	})
 }
 
@@ -669,6 +677,10 @@ func (kbd *Keyboard) listenRootWindowXEvent() {
 	if err != nil {
 		logger.Warning(err)
 	}
+	kbd.atomNetClientList, err = kbd.xConn.GetAtom("_NET_CLIENT_LIST")
+	if err != nil {
+		logger.Warning(err)
+	}
 	kbd.handleActiveWindowChanged()
 }
 
@@ -692,17 +704,21 @@ func (kbd *Keyboard) handleActiveWindowChanged() {
 		return
 	}
 	class := strings.ToLower(wmClass.Class)
-	if class == kbd.activeWinClass || class == "" {
+	if class == "" {
+		return
+	}
+	policy := kbd.getLayoutPolicy()
+	if class == kbd.activeWinClass && policy != layoutPolicyWindow {
 		return
 	}
 	kbd.activeWinClass = class
 	logger.Debug("wm class changed to", class)
 
-	if kbd.LayoutScope.Get() != layoutScopeApp {
+	if policy == layoutPolicyGlobal {
 		return
 	}
 
-	layout, ok := kbd.appLayoutCfg.get(class)
+	layout, ok := kbd.getActiveWindowLayout(policy)
 	if ok {
 		kbd.setLayout(layout)
 	}
@@ -732,7 +748,12 @@ func (kbd *Keyboard) handlePropertyNotifyEvent(ev *x.PropertyNotifyEvent) {
 		return
 	}
 	rootWin := kbd.xConn.GetDefaultScreen().Root
-	if ev.Window == rootWin {
+	if ev.Window != rootWin {
+		return
+	}
+	if ev.Atom != 0 && ev.Atom == kbd.atomNetClientList {
+		kbd.handleClientListChanged()
+	} else {
 		kbd.handleActiveWindowChanged()
 	}
 }
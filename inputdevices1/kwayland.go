@@ -130,6 +130,7 @@ func doHandleKWinDeviceAdded(sysName string) {
 		}
 		_manager.tpad.handleDeviceChanged()
 	}
+	_manager.updateDevices()
 }
 
 func doHandleKWinDeviceRemoved(sysName string) {
@@ -153,6 +154,7 @@ func doHandleKWinDeviceRemoved(sysName string) {
 		logger.Debug("[Device Removed] mouse:", sysName, minfos)
 		_mouseInfos = minfos
 		_manager.mouse.handleDeviceChanged()
+		_manager.updateDevices()
 		return
 	}
 
@@ -168,5 +170,6 @@ func doHandleKWinDeviceRemoved(sysName string) {
 		logger.Debug("[Device Removed] touchpad:", sysName)
 		_tpadInfos = tinfos
 		_manager.tpad.handleDeviceChanged()
+		_manager.updateDevices()
 	}
 }
@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package inputdevices
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/common/dconfig"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/wm/ewmh"
+)
+
+// 键盘布局的切换策略：全局使用一个布局、每个应用记住自己的布局、每个窗口记住自己的布局。
+// 全局和按应用由 gsettings 的 layout-scope 保存，按窗口时 layout-scope 为按应用，另外在 dconfig 中记录。
+// 窗口 id 只在本次会话中有效，按窗口时同时记录应用最后使用的布局，应用新打开的窗口和下次登录后使用这个布局。
+
+const (
+	layoutPolicyGlobal int32 = iota
+	layoutPolicyApp
+	layoutPolicyWindow
+
+	dsettingsKeyLayoutPerWindow = "keyboardLayoutPerWindow"
+)
+
+type windowLayoutMap struct {
+	mu sync.Mutex
+	m  map[x.Window]string
+}
+
+func newWindowLayoutMap() *windowLayoutMap {
+	return &windowLayoutMap{
+		m: make(map[x.Window]string),
+	}
+}
+
+func (wl *windowLayoutMap) get(win x.Window) (layout string, ok bool) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	layout, ok = wl.m[win]
+	return
+}
+
+func (wl *windowLayoutMap) set(win x.Window, layout string) {
+	wl.mu.Lock()
+	wl.m[win] = layout
+	wl.mu.Unlock()
+}
+
+// prune 删除已经关闭的窗口
+func (wl *windowLayoutMap) prune(windows []x.Window) {
+	alive := make(map[x.Window]bool, len(windows))
+	for _, win := range windows {
+		alive[win] = true
+	}
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	for win := range wl.m {
+		if !alive[win] {
+			delete(wl.m, win)
+		}
+	}
+}
+
+func (wl *windowLayoutMap) deleteLayout(layout string) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	for win, l := range wl.m {
+		if l == layout {
+			delete(wl.m, win)
+		}
+	}
+}
+
+func (kbd *Keyboard) initLayoutPolicy() {
+	kbd.windowLayouts = newWindowLayoutMap()
+	ds, err := dconfig.NewDConfig(dsettingsAppID, dsettingsInputdevices, "")
+	if err != nil {
+		logger.Warning(err)
+	} else {
+		kbd.dsInputdevices = ds
+		kbd.layoutPerWindow, err = ds.GetValueBool(dsettingsKeyLayoutPerWindow)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+	kbd.LayoutPolicy = kbd.calcLayoutPolicy()
+}
+
+// calcLayoutPolicy 调用前需要持有 PropsMu
+func (kbd *Keyboard) calcLayoutPolicy() int32 {
+	if kbd.LayoutScope.Get() == layoutScopeGlobal {
+		return layoutPolicyGlobal
+	}
+	if kbd.layoutPerWindow {
+		return layoutPolicyWindow
+	}
+	return layoutPolicyApp
+}
+
+func (kbd *Keyboard) getLayoutPolicy() int32 {
+	kbd.PropsMu.RLock()
+	defer kbd.PropsMu.RUnlock()
+	return kbd.LayoutPolicy
+}
+
+func (kbd *Keyboard) setLayoutPolicy(write *dbusutil.PropertyWrite) *dbus.Error {
+	policy := write.Value.(int32)
+	logger.Debugf("setLayoutPolicy %d", policy)
+	if policy < layoutPolicyGlobal || policy > layoutPolicyWindow {
+		return dbusutil.ToError(fmt.Errorf("invalid layout policy %d", policy))
+	}
+
+	perWindow := policy == layoutPolicyWindow
+	if kbd.dsInputdevices != nil {
+		err := kbd.dsInputdevices.SetValue(dsettingsKeyLayoutPerWindow, perWindow)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+	scope := int32(layoutScopeApp)
+	if policy == layoutPolicyGlobal {
+		scope = layoutScopeGlobal
+	}
+
+	kbd.PropsMu.Lock()
+	kbd.layoutPerWindow = perWindow
+	kbd.PropsMu.Unlock()
+	// layout-scope 的变化会触发 updateLayoutPolicy，这里直接更新，从按应用切换到按窗口时 layout-scope 不变
+	kbd.LayoutScope.Set(scope)
+	kbd.updateLayoutPolicy()
+	return nil
+}
+
+// updateLayoutPolicy 在策略变化后切换到当前窗口应该使用的布局
+func (kbd *Keyboard) updateLayoutPolicy() {
+	kbd.PropsMu.Lock()
+	policy := kbd.calcLayoutPolicy()
+	changed := kbd.setPropLayoutPolicy(policy)
+	kbd.PropsMu.Unlock()
+	if !changed {
+		return
+	}
+	logger.Debug("layout policy changed to", policy)
+
+	switch policy {
+	case layoutPolicyGlobal:
+		if kbd.user == nil {
+			logger.Warning("kbd.user is nil")
+			return
+		}
+
+		layout, err := kbd.user.Layout().Get(0)
+		if err != nil {
+			logger.Warning("failed to get user layout:", err)
+			return
+		}
+
+		kbd.setLayout(layout)
+
+	case layoutPolicyApp, layoutPolicyWindow:
+		layout, ok := kbd.getActiveWindowLayout(policy)
+		if ok {
+			kbd.setLayout(layout)
+		}
+	}
+}
+
+// getActiveWindowLayout 按窗口时没有记录的窗口使用应用最后使用的布局
+func (kbd *Keyboard) getActiveWindowLayout(policy int32) (string, bool) {
+	if policy == layoutPolicyWindow {
+		layout, ok := kbd.windowLayouts.get(kbd.activeWindow)
+		if ok {
+			return layout, true
+		}
+	}
+	return kbd.appLayoutCfg.get(kbd.activeWinClass)
+}
+
+func (kbd *Keyboard) setLayoutScopeWindow(layout string) {
+	if kbd.activeWindow != 0 {
+		kbd.windowLayouts.set(kbd.activeWindow, layout)
+	}
+	kbd.setLayoutScopeApp(layout)
+}
+
+func (kbd *Keyboard) handleClientListChanged() {
+	windows, err := ewmh.GetClientList(kbd.xConn).Reply(kbd.xConn)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	kbd.windowLayouts.prune(windows)
+}
@@ -10,6 +10,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
 
 	"github.com/linuxdeepin/dde-daemon/common/dsync"
 	kwin "github.com/linuxdeepin/go-dbus-factory/session/org.kde.kwin"
@@ -35,9 +38,19 @@ type devicePathInfos []*devicePathInfo
 var hasTreeLand = false
 
 type Manager struct {
+	service *dbusutil.Service
+	PropsMu sync.RWMutex
+	// dbusutil-gen: equal=nil
+	Devices []dbus.ObjectPath
+
+	// dbusutil-gen: ignore-below
 	Infos      devicePathInfos // readonly
 	WheelSpeed gsprop.Uint     `prop:"access:rw"`
 
+	devices   map[dbus.ObjectPath]*InputDevice
+	devicesMu sync.Mutex
+	module    *Daemon // 通过模块导出设备对象
+
 	settings          *gio.Settings
 	imWheelConfigFile string
 
@@ -59,6 +72,7 @@ func NewManager(service *dbusutil.Service) *Manager {
 		hasTreeLand = true
 	}
 	var m = new(Manager)
+	m.service = service
 	m.imWheelConfigFile = filepath.Join(basedir.GetUserHomeDir(), ".imwheelrc")
 
 	m.Infos = devicePathInfos{
@@ -83,6 +97,9 @@ func NewManager(service *dbusutil.Service) *Manager {
 	m.settings = gio.NewSettings(gsSchemaInputDevices)
 	m.WheelSpeed.Bind(m.settings, gsKeyWheelSpeed)
 
+	// 设备的独立配置需要在创建设备前加载
+	m.initDeviceProfiles()
+
 	m.kbd = newKeyboard(service)
 	m.wacom = newWacom(service)
 
@@ -208,6 +225,7 @@ func (m *Manager) init() {
 		m.mouse.handleGSettings()
 		m.trackPoint.init()
 		m.trackPoint.handleGSettings()
+		m.updateDevices()
 	}
 
 	m.setWheelSpeed()
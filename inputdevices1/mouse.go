@@ -48,9 +48,10 @@ type Mouse struct {
 	DoubleClick   gsprop.Int `prop:"access:rw"`
 	DragThreshold gsprop.Int `prop:"access:rw"`
 
-	devInfos Mouses
-	setting  *gio.Settings
-	touchPad *Touchpad
+	devInfos     Mouses
+	setting      *gio.Settings
+	touchPad     *Touchpad
+	buttonMapper *buttonMapper
 }
 
 func newMouse(service *dbusutil.Service, touchPad *Touchpad) *Mouse {
@@ -98,6 +99,7 @@ func (m *Mouse) init() {
 	m.enableAdaptiveAccelProfile()
 	m.motionAcceleration()
 	m.motionThreshold()
+	m.applyButtonMap()
 	if m.DisableTpad.Get() && tpad.TPadEnable.Get() {
 		m.disableTouchPad()
 	}
@@ -185,7 +187,7 @@ func (m *Mouse) enable(enabled bool) error {
 func (m *Mouse) enableLeftHanded() {
 	enabled := m.LeftHanded.Get()
 	for _, v := range m.devInfos {
-		err := v.EnableLeftHanded(enabled)
+		err := v.EnableLeftHanded(getDeviceProfile(v.key).leftHanded(enabled))
 		if err != nil {
 			logger.Debugf("Enable left handed for '%d - %v' failed: %v",
 				v.Id, v.Name, err)
@@ -196,7 +198,7 @@ func (m *Mouse) enableLeftHanded() {
 func (m *Mouse) enableNaturalScroll() {
 	enabled := m.NaturalScroll.Get()
 	for _, v := range m.devInfos {
-		err := v.EnableNaturalScroll(enabled)
+		err := v.EnableNaturalScroll(getDeviceProfile(v.key).naturalScroll(enabled))
 		if err != nil {
 			logger.Debugf("Enable natural scroll for '%d - %v' failed: %v",
 				v.Id, v.Name, err)
@@ -226,7 +228,7 @@ func (m *Mouse) enableAdaptiveAccelProfile() {
 			continue
 		}
 
-		err := v.SetUseAdaptiveAccelProfile(enabled)
+		err := v.SetUseAdaptiveAccelProfile(getDeviceProfile(v.key).adaptiveAccelProfile(enabled))
 		if err != nil {
 			logger.Debugf("Enable adaptive accel profile for '%d - %v' failed: %v",
 				v.Id, v.Name, err)
@@ -235,13 +237,13 @@ func (m *Mouse) enableAdaptiveAccelProfile() {
 }
 
 func (m *Mouse) motionAcceleration() {
-	accel := float32(m.MotionAcceleration.Get())
+	accel := m.MotionAcceleration.Get()
 	for _, v := range m.devInfos {
 		if v.TrackPoint {
 			continue
 		}
 
-		err := v.SetMotionAcceleration(accel)
+		err := v.SetMotionAcceleration(float32(getDeviceProfile(v.key).motionAcceleration(accel)))
 		if err != nil {
 			logger.Debugf("Set acceleration for '%d - %v' failed: %v",
 				v.Id, v.Name, err)
@@ -270,7 +270,7 @@ func (tpad *Touchpad) enable(enabled bool) {
 func (tpad *Touchpad) enableLeftHanded() {
 	enabled := tpad.LeftHanded.Get()
 	for _, v := range tpad.devInfos {
-		err := v.EnableLeftHanded(enabled)
+		err := v.EnableLeftHanded(getDeviceProfile(v.key).leftHanded(enabled))
 		if err != nil {
 			logger.Debugf("Enable left handed '%v - %v' failed: %v",
 				v.Id, v.Name, err)
@@ -282,7 +282,7 @@ func (tpad *Touchpad) enableLeftHanded() {
 func (tpad *Touchpad) enableNaturalScroll() {
 	enabled := tpad.NaturalScroll.Get()
 	for _, v := range tpad.devInfos {
-		err := v.EnableNaturalScroll(enabled)
+		err := v.EnableNaturalScroll(getDeviceProfile(v.key).naturalScroll(enabled))
 		if err != nil {
 			logger.Debugf("Enable natural scroll '%v - %v' failed: %v",
 				v.Id, v.Name, err)
@@ -339,9 +339,9 @@ func (tpad *Touchpad) enableTapToClick() {
 }
 
 func (tpad *Touchpad) motionAcceleration() {
-	accel := float32(tpad.MotionAcceleration.Get())
+	accel := tpad.MotionAcceleration.Get()
 	for _, v := range tpad.devInfos {
-		err := v.SetMotionAcceleration(accel)
+		err := v.SetMotionAcceleration(float32(getDeviceProfile(v.key).motionAcceleration(accel)))
 		if err != nil {
 			logger.Debugf("Set acceleration for '%d - %v' failed: %v",
 				v.Id, v.Name, err)
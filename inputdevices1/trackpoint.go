@@ -92,6 +92,11 @@ func (tp *TrackPoint) init() {
 	tp.motionScaling()
 }
 
+func (tp *TrackPoint) handleDeviceChanged() {
+	tp.updateDXMouses()
+	tp.init()
+}
+
 func (tp *TrackPoint) updateDXMouses() {
 	tp.devInfos = Mouses{}
 	for _, info := range getMouseInfos(false) {
@@ -154,7 +159,7 @@ func (tp *TrackPoint) enableWheelHorizScroll() {
 func (tp *TrackPoint) enableLeftHanded() {
 	enabled := tp.LeftHanded.Get()
 	for _, info := range tp.devInfos {
-		err := info.EnableLeftHanded(enabled)
+		err := info.EnableLeftHanded(getDeviceProfile(info.key).leftHanded(enabled))
 		if err != nil {
 			logger.Warningf("Enable left-handed for '%v %s' failed: %v",
 				info.Id, info.Name, err)
@@ -196,9 +201,9 @@ func (tp *TrackPoint) wheelEmulationTimeout() {
 }
 
 func (tp *TrackPoint) motionAcceleration() {
-	accel := float32(tp.MotionAcceleration.Get())
+	accel := tp.MotionAcceleration.Get()
 	for _, v := range tp.devInfos {
-		err := v.SetMotionAcceleration(accel)
+		err := v.SetMotionAcceleration(float32(getDeviceProfile(v.key).motionAcceleration(accel)))
 		if err != nil {
 			logger.Debugf("Set acceleration for '%d - %v' failed: %v",
 				v.Id, v.Name, err)
@@ -389,16 +389,17 @@ func (w *Wacom) setStylusButtonAction(btnNum int, action string) {
 }
 
 func (w *Wacom) enableLeftHanded() {
-	var rotate string = "none"
-	if w.LeftHanded.Get() {
-		rotate = "half"
-	}
+	enabled := w.LeftHanded.Get()
 	// set rotate for stylus and eraser
 	// Rotation is a tablet-wide option:
 	// rotation of one tool affects all other tools associated with the same tablet.
 	for _, v := range w.devInfos {
 		devType := v.QueryType()
 		if devType == dxinput.WacomTypeStylus || devType == dxinput.WacomTypeEraser {
+			var rotate string = "none"
+			if getDeviceProfile(getWacomKey(v)).leftHanded(enabled) {
+				rotate = "half"
+			}
 			err := v.SetRotate(rotate)
 			if err != nil {
 				logger.Warningf("Set rotate for '%v - %v' failed: %v",
@@ -27,6 +27,7 @@ type mouseInfo struct {
 	devNode   string
 	sysfsPath string
 	phys      string
+	key       string // 设备独立配置的标识
 }
 
 type touchpadInfo struct {
@@ -34,6 +35,7 @@ type touchpadInfo struct {
 	devNode   string
 	sysfsPath string
 	phys      string
+	key       string
 }
 
 type Mouses []*mouseInfo
@@ -78,7 +80,9 @@ func handleDeviceChanged() {
 	_manager.tpad.handleDeviceChanged()
 	_manager.mouse.handleDeviceChanged()
 	_manager.wacom.handleDeviceChanged()
+	_manager.trackPoint.handleDeviceChanged()
 	_manager.kbd.handleDeviceChanged()
+	_manager.updateDevices()
 
 	_manager.setWheelSpeed()
 }
@@ -145,6 +149,7 @@ func getTouchpadInfoByDxTouchpad(tmp *dxinput.Touchpad) *touchpadInfo {
 	}
 
 	m.devNode, m.sysfsPath, m.phys = getExtraInfo(tmp.Id)
+	m.key = getDeviceKey(m.sysfsPath, tmp.Name)
 
 	return m
 }
@@ -155,6 +160,7 @@ func getMouseInfoByDxMouse(tmp *dxinput.Mouse) *mouseInfo {
 	}
 
 	m.devNode, m.sysfsPath, m.phys = getExtraInfo(tmp.Id)
+	m.key = getDeviceKey(m.sysfsPath, tmp.Name)
 
 	return m
 }
@@ -49,7 +49,7 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
-	err = service.Export(dbusPath, d.manager)
+	err = d.Export(dbusPath, d.manager)
 	if err != nil {
 		d.manager.destroy()
 		d.manager = nil
@@ -63,7 +63,8 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
-	go func() {
+	d.Go(d.manager.shortcutManager.RecordEventLoop)
+	d.Go(func() {
 		m := d.manager
 		m.initHandlers()
 
@@ -77,7 +78,7 @@ func (d *Daemon) Start() error {
 
 		m.eliminateKeystrokeConflict()
 		m.shortcutManager.EventLoop()
-	}()
+	})
 
 	return nil
 }
@@ -8,6 +8,11 @@ import (
 
 func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 	return dbusutil.ExportedMethods{
+		{
+			Name:   "ActivateShortcut",
+			Fn:     v.ActivateShortcut,
+			InArgs: []string{"id", "type0"},
+		},
 		{
 			Name:    "Add",
 			Fn:      v.Add,
@@ -46,6 +51,11 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.DeleteCustomShortcut,
 			InArgs: []string{"id"},
 		},
+		{
+			Name:   "DeleteMacro",
+			Fn:     v.DeleteMacro,
+			InArgs: []string{"name"},
+		},
 		{
 			Name:   "DeleteShortcutKeystroke",
 			Fn:     v.DeleteShortcutKeystroke,
@@ -56,11 +66,21 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.Disable,
 			InArgs: []string{"id", "type0"},
 		},
+		{
+			Name:   "EmitKeystroke",
+			Fn:     v.EmitKeystroke,
+			InArgs: []string{"keystroke"},
+		},
 		{
 			Name:   "EnableSystemShortcut",
 			Fn:     v.EnableSystemShortcut,
 			InArgs: []string{"shortcuts", "enabled", "isPersistent"},
 		},
+		{
+			Name:    "ExportShortcutProfile",
+			Fn:      v.ExportShortcutProfile,
+			OutArgs: []string{"profile"},
+		},
 		{
 			Name:    "GetCapsLockState",
 			Fn:      v.GetCapsLockState,
@@ -72,10 +92,21 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			InArgs:  []string{"id", "type0"},
 			OutArgs: []string{"shortcut"},
 		},
+		{
+			Name:    "GetShortcutUsage",
+			Fn:      v.GetShortcutUsage,
+			OutArgs: []string{"usage"},
+		},
 		{
 			Name: "GrabScreen",
 			Fn:   v.GrabScreen,
 		},
+		{
+			Name:    "ImportShortcutProfile",
+			Fn:      v.ImportShortcutProfile,
+			InArgs:  []string{"profile", "dryRun", "resolutions"},
+			OutArgs: []string{"report"},
+		},
 		{
 			Name:    "List",
 			Fn:      v.List,
@@ -86,6 +117,11 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:      v.ListAllShortcuts,
 			OutArgs: []string{"shortcuts"},
 		},
+		{
+			Name:    "ListMacros",
+			Fn:      v.ListMacros,
+			OutArgs: []string{"macros"},
+		},
 		{
 			Name:    "ListShortcutsByType",
 			Fn:      v.ListShortcutsByType,
@@ -109,6 +145,11 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.ModifyCustomShortcut,
 			InArgs: []string{"id", "name", "cmd", "keystroke"},
 		},
+		{
+			Name:   "PlayMacro",
+			Fn:     v.PlayMacro,
+			InArgs: []string{"name"},
+		},
 		{
 			Name:    "Query",
 			Fn:      v.Query,
@@ -119,6 +160,11 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Name: "Reset",
 			Fn:   v.Reset,
 		},
+		{
+			Name:   "ResetShortcutUsage",
+			Fn:     v.ResetShortcutUsage,
+			InArgs: []string{"id", "type0"},
+		},
 		{
 			Name:    "SearchShortcuts",
 			Fn:      v.SearchShortcuts,
@@ -134,10 +180,24 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.SetCapsLockState,
 			InArgs: []string{"state"},
 		},
+		{
+			Name:   "SetCustomShortcutAppScope",
+			Fn:     v.SetCustomShortcutAppScope,
+			InArgs: []string{"id", "appScope"},
+		},
 		{
 			Name:   "SetNumLockState",
 			Fn:     v.SetNumLockState,
 			InArgs: []string{"state"},
 		},
+		{
+			Name: "StartMacroRecording",
+			Fn:   v.StartMacroRecording,
+		},
+		{
+			Name:   "StopMacroRecording",
+			Fn:     v.StopMacroRecording,
+			InArgs: []string{"name"},
+		},
 	}
 }
@@ -0,0 +1,394 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package keybinding
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/keybinding1/util"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/ext/test"
+)
+
+// 按键宏，录制一段按键的按下、释放和间隔时间，保存后可以通过 D-Bus 或自定义快捷键（macro:name）回放。
+// 录制通过 XRecord 读取按键，只支持 X11；回放在 X11 下使用 XTest，
+// Wayland 下使用 kwayland 的 WlSimulateKey，该接口只能模拟一次完整的按下和释放，
+// 无法保持按键按下，因此包含组合键（按住一个键时按下另一个键）的宏在 Wayland 下拒绝回放。
+
+const (
+	macroConfigFile = "deepin/dde-daemon/keybinding/macros.json"
+
+	maxMacroEvents     = 1000
+	maxMacroEventDelay = 5 * time.Second
+	// 回放前等待触发快捷键的修饰键释放的最长时间
+	macroModifierReleaseTimeout = time.Second
+)
+
+var (
+	errMacroRecording    = errors.New("a macro is being recorded")
+	errMacroNotRecording = errors.New("no macro is being recorded")
+	errMacroPlaying      = errors.New("a macro is being played")
+	errMacroNotFound     = errors.New("macro not found")
+	errMacroEmpty        = errors.New("no key is recorded")
+	errMacroEmptyName    = errors.New("macro name is empty")
+	errMacroRecordX11    = errors.New("macro recording is only supported on X11")
+	errMacroChordWayland = errors.New("macros with key combinations can not be played on Wayland")
+)
+
+type macroEvent struct {
+	Pressed bool
+	Keycode uint8  // X11 的 keycode
+	Delay   uint32 // 距离上一个事件的毫秒数
+}
+
+type macroInfo struct {
+	Name   string
+	Events []macroEvent
+}
+
+type macroStore struct {
+	file   string
+	mu     sync.Mutex
+	macros map[string][]macroEvent
+}
+
+func newMacroStore(file string) *macroStore {
+	ms := &macroStore{
+		file:   file,
+		macros: make(map[string][]macroEvent),
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return ms
+	}
+	// 旧版本保存的文件其他用户可读
+	err = os.Chmod(file, 0600)
+	if err != nil {
+		logger.Warning(err)
+	}
+	err = json.Unmarshal(data, &ms.macros)
+	if err != nil {
+		logger.Warning("failed to load macros:", err)
+		ms.macros = make(map[string][]macroEvent)
+	}
+	return ms
+}
+
+func (ms *macroStore) get(name string) ([]macroEvent, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	events, ok := ms.macros[name]
+	return events, ok
+}
+
+func (ms *macroStore) list() []macroInfo {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	result := make([]macroInfo, 0, len(ms.macros))
+	for name, events := range ms.macros {
+		result = append(result, macroInfo{Name: name, Events: events})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (ms *macroStore) set(name string, events []macroEvent) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.macros[name] = events
+	return ms.save()
+}
+
+func (ms *macroStore) delete(name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.macros[name]; !ok {
+		return errMacroNotFound
+	}
+	delete(ms.macros, name)
+	return ms.save()
+}
+
+// save 调用前需要持有 mu
+func (ms *macroStore) save() error {
+	data, err := json.Marshal(ms.macros)
+	if err != nil {
+		return err
+	}
+	// #nosec G301
+	err = os.MkdirAll(filepath.Dir(ms.file), 0755)
+	if err != nil {
+		return err
+	}
+	// 宏可能记录了输入的密码，只允许用户自己读写
+	return os.WriteFile(ms.file, data, 0600)
+}
+
+type macroRecorder struct {
+	mu      sync.Mutex
+	events  []macroEvent
+	pressed map[uint8]bool
+	last    time.Time
+}
+
+func newMacroRecorder() *macroRecorder {
+	return &macroRecorder{
+		pressed: make(map[uint8]bool),
+	}
+}
+
+func (r *macroRecorder) handleKeyEvent(pressed bool, code uint8, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pressed == r.pressed[code] {
+		// 开始录制前已经按下的按键的释放，或者按住不放时的自动重复
+		return
+	}
+	if len(r.events) >= maxMacroEvents {
+		return
+	}
+
+	var delay time.Duration
+	if !r.last.IsZero() {
+		delay = t.Sub(r.last)
+		if delay > maxMacroEventDelay {
+			delay = maxMacroEventDelay
+		} else if delay < 0 {
+			delay = 0
+		}
+	}
+	r.last = t
+	r.pressed[code] = pressed
+	r.events = append(r.events, macroEvent{
+		Pressed: pressed,
+		Keycode: code,
+		Delay:   uint32(delay / time.Millisecond),
+	})
+}
+
+// finish 返回录制的事件，并补上停止录制时仍然按下的按键的释放，避免回放后按键一直处于按下状态
+func (r *macroRecorder) finish() []macroEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var codes []int
+	for code, pressed := range r.pressed {
+		if pressed {
+			codes = append(codes, int(code))
+		}
+	}
+	sort.Ints(codes)
+	events := r.events
+	for _, code := range codes {
+		events = append(events, macroEvent{Keycode: uint8(code)})
+	}
+	return events
+}
+
+func (m *Manager) startRecordMacro() error {
+	if _useWayland {
+		return errMacroRecordX11
+	}
+	m.macroMu.Lock()
+	defer m.macroMu.Unlock()
+	if m.macroRecorder != nil {
+		return errMacroRecording
+	}
+	if m.macroPlaying {
+		return errMacroPlaying
+	}
+
+	recorder := newMacroRecorder()
+	err := m.shortcutManager.SetRecordKeyEventCallback(func(pressed bool, code uint8, state uint16) {
+		recorder.handleKeyEvent(pressed, code, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	m.macroRecorder = recorder
+	return nil
+}
+
+// stopRecordMacro 停止录制，name 为空时丢弃录制的按键
+func (m *Manager) stopRecordMacro(name string) error {
+	m.macroMu.Lock()
+	recorder := m.macroRecorder
+	m.macroRecorder = nil
+	m.macroMu.Unlock()
+	if recorder == nil {
+		return errMacroNotRecording
+	}
+	err := m.shortcutManager.SetRecordKeyEventCallback(nil)
+	if err != nil {
+		logger.Warning(err)
+	}
+
+	events := recorder.finish()
+	if name == "" {
+		return nil
+	}
+	if len(events) == 0 {
+		return errMacroEmpty
+	}
+	return m.macroStore.set(name, events)
+}
+
+// startPlayMacro 检查后在新的 goroutine 中回放，同时只能回放一个宏，回放的按键不会再次触发宏
+func (m *Manager) startPlayMacro(name string) error {
+	events, ok := m.macroStore.get(name)
+	if !ok {
+		return errMacroNotFound
+	}
+	if _useWayland && hasMacroChord(events) {
+		return errMacroChordWayland
+	}
+
+	m.macroMu.Lock()
+	defer m.macroMu.Unlock()
+	if m.macroRecorder != nil {
+		return errMacroRecording
+	}
+	if m.macroPlaying {
+		return errMacroPlaying
+	}
+	m.macroPlaying = true
+
+	go func() {
+		var err error
+		if _useWayland {
+			err = playMacroWayland(func(code int32) error {
+				return m.waylandOutputMgr.WlSimulateKey(0, code)
+			}, events)
+		} else {
+			err = playMacroX11(m.conn, events)
+		}
+		if err != nil {
+			logger.Warningf("failed to play macro %q: %v", name, err)
+		}
+		m.macroMu.Lock()
+		m.macroPlaying = false
+		m.macroMu.Unlock()
+	}()
+	return nil
+}
+
+func playMacroX11(conn *x.Conn, events []macroEvent) error {
+	waitModifiersReleased(conn)
+	rootWin := conn.GetDefaultScreen().Root
+	for _, ev := range events {
+		time.Sleep(time.Duration(ev.Delay) * time.Millisecond)
+		var evType uint8 = x.KeyReleaseEventCode
+		if ev.Pressed {
+			evType = x.KeyPressEventCode
+		}
+		err := test.FakeInputChecked(conn, evType, ev.Keycode, x.TimeCurrentTime, rootWin, 0, 0, 0).Check(conn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitModifiersReleased 等待触发快捷键的修饰键释放，否则回放的按键会与修饰键组合
+func waitModifiersReleased(conn *x.Conn) {
+	const modMask = x.ModMaskShift | x.ModMaskControl | x.ModMask1 | x.ModMask4
+	rootWin := conn.GetDefaultScreen().Root
+	deadline := time.Now().Add(macroModifierReleaseTimeout)
+	for time.Now().Before(deadline) {
+		reply, err := x.QueryPointer(conn, rootWin).Reply(conn)
+		if err != nil {
+			logger.Warning(err)
+			return
+		}
+		if reply.Mask&modMask == 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	logger.Debug("modifiers are still pressed, play macro anyway")
+}
+
+// hasMacroChord 检查宏中是否有按住一个键时按下另一个键的情况
+func hasMacroChord(events []macroEvent) bool {
+	pressed := make(map[uint8]bool)
+	for _, ev := range events {
+		if !ev.Pressed {
+			delete(pressed, ev.Keycode)
+			continue
+		}
+		if len(pressed) > 0 {
+			return true
+		}
+		pressed[ev.Keycode] = true
+	}
+	return false
+}
+
+// playMacroWayland 按顺序回放按下的按键，simulateKey 同时模拟按下和释放，释放事件只累加间隔时间。
+// 调用前需要用 hasMacroChord 检查，组合键无法回放。
+func playMacroWayland(simulateKey func(code int32) error, events []macroEvent) error {
+	var delay uint32
+	for _, ev := range events {
+		delay += ev.Delay
+		if !ev.Pressed {
+			continue
+		}
+		time.Sleep(time.Duration(delay) * time.Millisecond)
+		delay = 0
+		// kwin 使用 evdev 的 keycode，比 X11 的 keycode 小 8
+		err := simulateKey(int32(ev.Keycode) - 8)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartMacroRecording 开始录制按键宏，之后所有的按键按下和释放都会被录制，直到调用 StopMacroRecording
+func (m *Manager) StartMacroRecording() *dbus.Error {
+	logger.Debug("StartMacroRecording")
+	return dbusutil.ToError(m.startRecordMacro())
+}
+
+// StopMacroRecording 停止录制并保存为名为 name 的宏，已存在同名的宏时覆盖，name 为空时丢弃录制的按键
+func (m *Manager) StopMacroRecording(name string) *dbus.Error {
+	logger.Debug("StopMacroRecording", name)
+	return dbusutil.ToError(m.stopRecordMacro(strings.TrimSpace(name)))
+}
+
+func (m *Manager) ListMacros() (macros string, busErr *dbus.Error) {
+	ret, err := util.MarshalJSON(m.macroStore.list())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return ret, nil
+}
+
+func (m *Manager) DeleteMacro(name string) *dbus.Error {
+	logger.Debug("DeleteMacro", name)
+	return dbusutil.ToError(m.macroStore.delete(name))
+}
+
+// PlayMacro 回放宏，回放在后台进行，方法立即返回
+func (m *Manager) PlayMacro(name string) *dbus.Error {
+	logger.Debug("PlayMacro", name)
+	if name == "" {
+		return dbusutil.ToError(errMacroEmptyName)
+	}
+	return dbusutil.ToError(m.startPlayMacro(name))
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package keybinding
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMacroRecorder(t *testing.T) {
+	r := newMacroRecorder()
+	t0 := time.Now()
+	// 开始录制前按下的按键只有释放
+	r.handleKeyEvent(false, 133, t0)
+	r.handleKeyEvent(true, 37, t0.Add(100*time.Millisecond))
+	r.handleKeyEvent(true, 54, t0.Add(150*time.Millisecond))
+	// 自动重复
+	r.handleKeyEvent(true, 54, t0.Add(200*time.Millisecond))
+	r.handleKeyEvent(false, 54, t0.Add(250*time.Millisecond))
+	r.handleKeyEvent(true, 38, t0.Add(time.Minute))
+
+	assert.Equal(t, []macroEvent{
+		{Pressed: true, Keycode: 37, Delay: 0},
+		{Pressed: true, Keycode: 54, Delay: 50},
+		{Pressed: false, Keycode: 54, Delay: 100},
+		{Pressed: true, Keycode: 38, Delay: uint32(maxMacroEventDelay / time.Millisecond)},
+		{Pressed: false, Keycode: 37},
+		{Pressed: false, Keycode: 38},
+	}, r.finish())
+}
+
+func TestMacroStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keybinding", "macros.json")
+	ms := newMacroStore(file)
+	assert.Empty(t, ms.list())
+
+	events := []macroEvent{{Pressed: true, Keycode: 38}, {Keycode: 38, Delay: 20}}
+	require.NoError(t, ms.set("b", events))
+	require.NoError(t, ms.set("a", events[:1]))
+
+	fi, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// 加载时收紧旧文件的权限
+	require.NoError(t, os.Chmod(file, 0644))
+	ms = newMacroStore(file)
+	fi, err = os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	got, ok := ms.get("b")
+	assert.True(t, ok)
+	assert.Equal(t, events, got)
+	list := ms.list()
+	require.Len(t, list, 2)
+	assert.Equal(t, "a", list[0].Name)
+	assert.Equal(t, "b", list[1].Name)
+
+	require.NoError(t, ms.delete("a"))
+	assert.Equal(t, errMacroNotFound, ms.delete("a"))
+	ms = newMacroStore(file)
+	_, ok = ms.get("a")
+	assert.False(t, ok)
+}
+
+func TestPlayMacroWayland(t *testing.T) {
+	r := newMacroRecorder()
+	t0 := time.Now()
+	// 依次按下 a、s，停止录制时 d 仍然按下，finish 补上 d 的释放
+	r.handleKeyEvent(true, 38, t0)
+	r.handleKeyEvent(false, 38, t0.Add(time.Millisecond))
+	r.handleKeyEvent(true, 39, t0.Add(2*time.Millisecond))
+	r.handleKeyEvent(false, 39, t0.Add(3*time.Millisecond))
+	r.handleKeyEvent(true, 40, t0.Add(4*time.Millisecond))
+	events := r.finish()
+	require.Len(t, events, 6)
+	assert.Equal(t, macroEvent{Keycode: 40}, events[5])
+	assert.False(t, hasMacroChord(events))
+
+	var codes []int32
+	err := playMacroWayland(func(code int32) error {
+		codes = append(codes, code)
+		return nil
+	}, events)
+	require.NoError(t, err)
+	// 只回放按下的按键，顺序不变，keycode 转换为 evdev 的值
+	assert.Equal(t, []int32{30, 31, 32}, codes)
+
+	// Ctrl+C 按住 Ctrl 时按下 C，是组合键；finish 补上两个键的释放
+	r = newMacroRecorder()
+	r.handleKeyEvent(true, 37, t0)
+	r.handleKeyEvent(true, 54, t0.Add(time.Millisecond))
+	events = r.finish()
+	assert.Equal(t, []macroEvent{
+		{Pressed: true, Keycode: 37},
+		{Pressed: true, Keycode: 54, Delay: 1},
+		{Pressed: false, Keycode: 37},
+		{Pressed: false, Keycode: 54},
+	}, events)
+	assert.True(t, hasMacroChord(events))
+}
@@ -15,6 +15,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	dbus "github.com/godbus/dbus/v5"
@@ -179,6 +180,12 @@ type Manager struct {
 	delayUpdateRfTimer   *time.Timer
 	grabScreenKeystroke  *shortcuts.Keystroke
 
+	// 按键宏
+	macroStore    *macroStore
+	macroRecorder *macroRecorder
+	macroPlaying  bool
+	macroMu       sync.Mutex
+
 	// for switch kbd layout
 	switchKbdLayoutState SKLState
 	sklWaitQuit          chan int
@@ -344,6 +351,7 @@ func (m *Manager) init() {
 	customConfigFilePath := filepath.Join(basedir.GetUserConfigDir(), customConfigFile)
 	m.customShortcutManager = shortcuts.NewCustomShortcutManager(customConfigFilePath)
 	m.shortcutManager.AddCustom(m.customShortcutManager, m.wm)
+	m.macroStore = newMacroStore(filepath.Join(basedir.GetUserConfigDir(), macroConfigFile))
 
 	// init controllers
 	m.backlightHelper = backlight.NewBacklight(sysBus)
@@ -609,6 +617,12 @@ func (m *Manager) listenGlobalAccel(sessionBus *dbus.Conn) error {
 					logger.Debug("WaylandCustomShortCutMap", m.shortcutCmd)
 					if m.shortcutCmd == "" {
 						m.handleKeyEventByWayland(waylandMediaIdMap[m.shortcutKeyCmd])
+					} else if action, err := shortcuts.ParseCustomAction(m.shortcutCmd); action != nil || err != nil {
+						if err != nil {
+							logger.Warning(err)
+							return
+						}
+						m.handleKeyEvent(&shortcuts.KeyEvent{Shortcut: shortcuts.NewFakeShortcut(action)})
 					} else {
 						if strings.HasSuffix(m.shortcutCmd, ".desktop") {
 							err := m.runDesktopFile(m.shortcutCmd)
@@ -1116,7 +1130,8 @@ func (m *Manager) destroy() {
 }
 
 func (m *Manager) handleKeyEvent(ev *shortcuts.KeyEvent) {
-	if !m.checkKeyEventInterval() {
+	// 按键重映射紧跟在触发它的按键之后，不检查间隔
+	if !ev.Remapped && !m.checkKeyEventInterval() {
 		return
 	}
 	logger.Debugf("handleKeyEvent ev: %#v", ev)
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/linuxdeepin/dde-daemon/common/dbuscall"
 	. "github.com/linuxdeepin/dde-daemon/keybinding1/shortcuts"
 )
 
@@ -60,6 +61,53 @@ func (m *Manager) initHandlers() {
 		}()
 	}
 
+	m.handlers[ActionTypeDBusCall] = func(ev *KeyEvent) {
+		action := ev.Shortcut.GetAction()
+		call, ok := action.Arg.(*dbuscall.Call)
+		if !ok {
+			logger.Warning(ErrTypeAssertionFail)
+			return
+		}
+
+		go func() {
+			err := call.Do()
+			if err != nil {
+				logger.Warningf("dbus call %s error: %v", call, err)
+			}
+		}()
+	}
+
+	m.handlers[ActionTypeKeyRemap] = func(ev *KeyEvent) {
+		action := ev.Shortcut.GetAction()
+		ks, ok := action.Arg.(*Keystroke)
+		if !ok {
+			logger.Warning(ErrTypeAssertionFail)
+			return
+		}
+
+		// 处理按键事件时持有 eventCbMu，需要在新的 goroutine 中触发
+		go func() {
+			err := m.shortcutManager.EmitKeystroke(ks)
+			if err != nil {
+				logger.Warning("remap key error:", err)
+			}
+		}()
+	}
+
+	m.handlers[ActionTypeMacro] = func(ev *KeyEvent) {
+		action := ev.Shortcut.GetAction()
+		name, ok := action.Arg.(string)
+		if !ok {
+			logger.Warning(ErrTypeAssertionFail)
+			return
+		}
+
+		err := m.startPlayMacro(name)
+		if err != nil {
+			logger.Warningf("failed to play macro %q: %v", name, err)
+		}
+	}
+
 	m.handlers[ActionTypeShowNumLockOSD] = func(ev *KeyEvent) {
 		if _useWayland {
 			m.handleKeyEventByWayland("numlock")
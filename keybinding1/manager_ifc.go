@@ -138,7 +138,8 @@ func (m *Manager) Reset() *dbus.Error {
 		var newKeystrokes []*shortcuts.Keystroke
 		modifyFlag := false
 		for _, keystroke := range keystrokes {
-			conflictKeystroke, err := m.shortcutManager.FindConflictingKeystroke(keystroke)
+			conflictKeystroke, err := m.shortcutManager.FindConflictingKeystrokeInScope(keystroke,
+				shortcuts.GetAppScope(cs))
 			if err != nil {
 				logger.Warning(err)
 				modifyFlag = true
@@ -205,6 +206,9 @@ func (m *Manager) ListShortcutsByType(type0 int32) (shortcuts string, busErr *db
 	return ret, nil
 }
 
+// AddCustomShortcut 添加自定义快捷键
+//
+// keystroke 可以是多键序列，按键之间用逗号分隔，例如 <Super>w, t
 func (m *Manager) AddCustomShortcut(name, action, keystroke string) (id string,
 	type0 int32, busErr *dbus.Error) {
 
@@ -215,6 +219,12 @@ func (m *Manager) AddCustomShortcut(name, action, keystroke string) (id string,
 		busErr = dbusutil.ToError(err)
 		return
 	}
+	_, err = shortcuts.ParseCustomAction(action)
+	if err != nil {
+		logger.Warning(err)
+		busErr = dbusutil.ToError(err)
+		return
+	}
 
 	exist := m.shortcutManager.GetByIdType(name, shortcuts.ShortcutTypeCustom)
 	if exist != nil {
@@ -237,6 +247,16 @@ func (m *Manager) AddCustomShortcut(name, action, keystroke string) (id string,
 		return
 	}
 
+	if _useWayland {
+		// 在保存之前检查 KWin 是否支持这个按键
+		_, err = ks.ToKWinAccel()
+		if err != nil {
+			logger.Warning(err)
+			busErr = dbusutil.ToError(err)
+			return
+		}
+	}
+
 	shortcut, err := m.customShortcutManager.Add(name, action, []*shortcuts.Keystroke{ks}, m.wm)
 	if err != nil {
 		logger.Warning(err)
@@ -244,7 +264,7 @@ func (m *Manager) AddCustomShortcut(name, action, keystroke string) (id string,
 		return
 	}
 	if _useWayland {
-		err := m.processWaylandCustomShortcut(name, action, keystroke)
+		err := m.processWaylandCustomShortcut(name, action, ks)
 		if err != nil {
 			logger.Warning(err)
 			busErr = dbusutil.ToError(err)
@@ -265,6 +285,7 @@ func (m *Manager) DeleteCustomShortcut(id string) *dbus.Error {
 		return dbusutil.ToError(err)
 	}
 	m.shortcutManager.Delete(shortcut)
+	m.shortcutManager.ResetUsage(shortcut)
 	if _useWayland {
 		id += "-cs"
 		logger.Debug("RemoveAccel id: ", id)
@@ -316,11 +337,21 @@ func (m *Manager) LookupConflictingShortcut(keystroke string) (shortcut string,
 	return "", nil
 }
 
-func (m *Manager) processWaylandCustomShortcut(id, cmd, keystroke string) *dbus.Error {
-	logger.Debugf("WaylandCustomShortcut id: %q, cmd: %q, keystroke: %q", id, cmd, keystroke)
+// processWaylandCustomShortcut 把自定义快捷键设置给 KWin，ks 为 nil 时清除快捷键。
+// 多键序列转换为 KWin 使用的 QKeySequence 格式，不支持的按键返回错误。
+func (m *Manager) processWaylandCustomShortcut(id, cmd string, ks *shortcuts.Keystroke) *dbus.Error {
+	logger.Debugf("WaylandCustomShortcut id: %q, cmd: %q, keystroke: %v", id, cmd, ks)
 	wlname := id + "-cs"
-	keystrokeStrv := make([]string, 0)
-	keystrokeStrv = append(keystrokeStrv, keystroke)
+	keystroke := ""
+	if ks != nil {
+		var err error
+		keystroke, err = ks.ToKWinAccel()
+		if err != nil {
+			logger.Warning(err)
+			return dbusutil.ToError(err)
+		}
+	}
+	keystrokeStrv := []string{keystroke}
 	accelJson, err := util.MarshalJSON(util.KWinAccel{
 		Id:         wlname,
 		Keystrokes: keystrokeStrv,
@@ -357,7 +388,7 @@ func (m *Manager) processWaylandCustomShortcut(id, cmd, keystroke string) *dbus.
 // id: shortcut id
 // name: new name
 // cmd: new commandline
-// keystroke: new keystroke
+// keystroke: new keystroke, or key sequence like <Super>w, t
 func (m *Manager) ModifyCustomShortcut(id, name, cmd, keystroke string) *dbus.Error {
 	logger.Debugf("ModifyCustomShortcut id: %q, name: %q, cmd: %q, keystroke: %q", id, name, cmd, keystroke)
 	const ty = shortcuts.ShortcutTypeCustom
@@ -370,15 +401,20 @@ func (m *Manager) ModifyCustomShortcut(id, name, cmd, keystroke string) *dbus.Er
 	if !ok {
 		return dbusutil.ToError(errTypeAssertionFail)
 	}
+	if _, err := shortcuts.ParseCustomAction(cmd); err != nil {
+		return dbusutil.ToError(err)
+	}
 
 	var keystrokes []*shortcuts.Keystroke
+	var ks *shortcuts.Keystroke
 	if keystroke != "" {
-		ks, err := shortcuts.ParseKeystroke(keystroke)
+		var err error
+		ks, err = shortcuts.ParseKeystroke(keystroke)
 		if err != nil {
 			return dbusutil.ToError(err)
 		}
 		// check conflicting
-		conflictKeystroke, err := m.shortcutManager.FindConflictingKeystroke(ks)
+		conflictKeystroke, err := m.shortcutManager.FindConflictingKeystrokeInScope(ks, customShortcut.GetAppScope())
 		if err != nil {
 			return dbusutil.ToError(err)
 		}
@@ -389,7 +425,7 @@ func (m *Manager) ModifyCustomShortcut(id, name, cmd, keystroke string) *dbus.Er
 	}
 
 	if _useWayland {
-		err := m.processWaylandCustomShortcut(id, cmd, keystroke)
+		err := m.processWaylandCustomShortcut(id, cmd, ks)
 		if err != nil {
 			return err
 		}
@@ -407,6 +443,43 @@ func (m *Manager) ModifyCustomShortcut(id, name, cmd, keystroke string) *dbus.Er
 	return nil
 }
 
+// SetCustomShortcutAppScope 设置自定义快捷键的应用范围，快捷键只在这些应用的窗口激活时生效，
+// 并覆盖相同按键的全局快捷键。appScope 中为 WM_CLASS 或可执行文件名，为空时恢复为全局生效。
+func (m *Manager) SetCustomShortcutAppScope(id string, appScope []string) *dbus.Error {
+	logger.Debugf("SetCustomShortcutAppScope id: %q, appScope: %v", id, appScope)
+	if _useWayland {
+		return dbusutil.ToError(errors.New("app scope is only supported on X11"))
+	}
+	const ty = shortcuts.ShortcutTypeCustom
+	shortcut := m.shortcutManager.GetByIdType(id, ty)
+	if shortcut == nil {
+		return dbusutil.ToError(ErrShortcutNotFound{id, ty})
+	}
+	customShortcut, ok := shortcut.(*shortcuts.CustomShortcut)
+	if !ok {
+		return dbusutil.ToError(errTypeAssertionFail)
+	}
+
+	appScope = shortcuts.NormalizeAppScope(appScope)
+	for _, ks := range customShortcut.GetKeystrokes() {
+		conflictKeystroke, err := m.shortcutManager.FindConflictingKeystrokeInScope(ks, appScope)
+		if err != nil {
+			return dbusutil.ToError(err)
+		}
+		if conflictKeystroke != nil && conflictKeystroke.Shortcut != shortcut {
+			return dbusutil.ToError(errKeystrokeUsed)
+		}
+	}
+
+	m.shortcutManager.SetAppScope(customShortcut, appScope)
+	err := customShortcut.Save()
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	m.emitShortcutSignal(shortcutSignalChanged, shortcut)
+	return nil
+}
+
 func (m *Manager) AddShortcutKeystroke(id string, type0 int32, keystroke string) *dbus.Error {
 	logger.Debug("AddShortcutKeystroke", id, type0, keystroke)
 	shortcut := m.shortcutManager.GetByIdType(id, type0)
@@ -432,7 +505,7 @@ func (m *Manager) AddShortcutKeystroke(id string, type0 int32, keystroke string)
 		}
 	}
 
-	conflictKeystroke, err := m.shortcutManager.FindConflictingKeystroke(ks)
+	conflictKeystroke, err := m.shortcutManager.FindConflictingKeystrokeInScope(ks, shortcuts.GetAppScope(shortcut))
 	if err != nil {
 		return dbusutil.ToError(err)
 	}
@@ -492,6 +565,52 @@ func (m *Manager) GetShortcut(id string, type0 int32) (shortcut string, busErr *
 	return detail, nil
 }
 
+// EmitKeystroke 触发按键对应的快捷键，与按下这个按键的效果相同，用于手势等其他模块的按键重映射
+func (m *Manager) EmitKeystroke(keystroke string) *dbus.Error {
+	logger.Debug("EmitKeystroke", keystroke)
+	ks, err := shortcuts.ParseKeystroke(keystroke)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.shortcutManager.EmitKeystroke(ks)
+	return dbusutil.ToError(err)
+}
+
+// ActivateShortcut 触发指定的快捷键，与按下它的按键的效果相同
+func (m *Manager) ActivateShortcut(id string, type0 int32) *dbus.Error {
+	logger.Debug("ActivateShortcut", id, type0)
+	shortcut := m.shortcutManager.GetByIdType(id, type0)
+	if shortcut == nil {
+		return dbusutil.ToError(ErrShortcutNotFound{id, type0})
+	}
+	err := m.shortcutManager.ActivateShortcut(shortcut)
+	return dbusutil.ToError(err)
+}
+
+// GetShortcutUsage 返回所有快捷键的触发次数和最后一次触发的时间，从未使用的快捷键 Count 为 0
+func (m *Manager) GetShortcutUsage() (usage string, busErr *dbus.Error) {
+	ret, err := util.MarshalJSON(m.shortcutManager.GetUsage())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return ret, nil
+}
+
+// ResetShortcutUsage 清空快捷键的使用统计，id 为空时清空所有快捷键的统计
+func (m *Manager) ResetShortcutUsage(id string, type0 int32) *dbus.Error {
+	logger.Debug("ResetShortcutUsage", id, type0)
+	if id == "" {
+		m.shortcutManager.ResetUsage(nil)
+		return nil
+	}
+	shortcut := m.shortcutManager.GetByIdType(id, type0)
+	if shortcut == nil {
+		return dbusutil.ToError(ErrShortcutNotFound{id, type0})
+	}
+	m.shortcutManager.ResetUsage(shortcut)
+	return nil
+}
+
 func (m *Manager) SelectKeystroke() *dbus.Error {
 	logger.Debug("SelectKeystroke")
 	err := m.selectKeystroke()
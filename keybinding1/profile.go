@@ -0,0 +1,476 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package keybinding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/keybinding1/shortcuts"
+	"github.com/linuxdeepin/dde-daemon/keybinding1/util"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/strv"
+)
+
+// 快捷键配置文件，用于在不同的机器之间迁移用户修改过的快捷键。
+// 导入时先检查冲突，冲突的处理方式由调用者按项目选择：覆盖会移除冲突快捷键的按键，跳过则不导入该项目。
+
+const (
+	shortcutProfileVersion = 1
+
+	profileResolutionOverwrite = "overwrite"
+	profileResolutionSkip      = "skip"
+
+	profileStatusUnchanged   = "unchanged"
+	profileStatusApply       = "apply"    // dry-run 时没有冲突，将会导入
+	profileStatusConflict    = "conflict" // dry-run 时存在冲突，需要选择覆盖或跳过
+	profileStatusApplied     = "applied"
+	profileStatusOverwritten = "overwritten"
+	profileStatusSkipped     = "skipped"
+	profileStatusFailed      = "failed"
+)
+
+var errUnsupportedProfileVersion = errors.New("unsupported shortcut profile version")
+
+type shortcutProfile struct {
+	Version   int
+	Shortcuts []profileShortcut
+}
+
+type profileShortcut struct {
+	Id       string
+	Type     int32
+	Name     string `json:",omitempty"`
+	Accels   []string
+	Exec     string   `json:",omitempty"`
+	AppScope []string `json:",omitempty"`
+}
+
+// key 导入报告和 resolutions 参数中使用的项目标识
+func (item *profileShortcut) key() string {
+	return fmt.Sprintf("%d:%s", item.Type, item.Id)
+}
+
+type profileConflict struct {
+	Accel string
+	Id    string
+	Type  int32
+	Name  string
+}
+
+type profileImportResult struct {
+	Key       string
+	Id        string
+	Type      int32
+	Status    string
+	Conflicts []profileConflict `json:",omitempty"`
+	Error     string            `json:",omitempty"`
+}
+
+type profileImportReport struct {
+	DryRun bool
+	Items  []profileImportResult
+}
+
+type profilePlan struct {
+	item       *profileShortcut
+	shortcut   shortcuts.Shortcut // 为 nil 时新建自定义快捷键
+	keystrokes []*shortcuts.Keystroke
+	appScope   []string
+	conflicts  []*shortcuts.Keystroke
+	result     profileImportResult
+}
+
+func getKeystrokesStrv(keystrokes []*shortcuts.Keystroke) []string {
+	result := make([]string, 0, len(keystrokes))
+	for _, ks := range keystrokes {
+		result = append(result, ks.String())
+	}
+	return result
+}
+
+// ExportShortcutProfile 导出所有修改过的系统、媒体、窗口管理器快捷键和全部自定义快捷键
+func (m *Manager) ExportShortcutProfile() (profile string, busErr *dbus.Error) {
+	p := shortcutProfile{
+		Version:   shortcutProfileVersion,
+		Shortcuts: []profileShortcut{},
+	}
+	for _, shortcut := range m.shortcutManager.List() {
+		if shortcut.GetType() == shortcuts.ShortcutTypeFake || !shortcuts.IsShortcutModified(shortcut) {
+			continue
+		}
+		item := profileShortcut{
+			Id:     shortcut.GetId(),
+			Type:   shortcut.GetType(),
+			Name:   shortcut.GetName(),
+			Accels: getKeystrokesStrv(shortcut.GetKeystrokes()),
+		}
+		if cs, ok := shortcut.(*shortcuts.CustomShortcut); ok {
+			item.Exec = cs.Cmd
+			item.AppScope = cs.GetAppScope()
+		}
+		p.Shortcuts = append(p.Shortcuts, item)
+	}
+	sort.Slice(p.Shortcuts, func(i, j int) bool {
+		a, b := p.Shortcuts[i], p.Shortcuts[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Id < b.Id
+	})
+
+	ret, err := util.MarshalJSON(p)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return ret, nil
+}
+
+// ImportShortcutProfile 导入 ExportShortcutProfile 导出的配置，返回每个项目的导入结果。
+//
+// dryRun 为 true 时只检查冲突，不做修改。
+// resolutions 的键为报告中的 Key，值为 overwrite 或 skip，指定冲突项目的处理方式，未指定时跳过。
+func (m *Manager) ImportShortcutProfile(profile string, dryRun bool,
+	resolutions map[string]string) (report string, busErr *dbus.Error) {
+
+	logger.Debugf("ImportShortcutProfile dryRun: %v, resolutions: %v", dryRun, resolutions)
+	var p shortcutProfile
+	err := json.Unmarshal([]byte(profile), &p)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	if p.Version <= 0 || p.Version > shortcutProfileVersion {
+		return "", dbusutil.ToError(errUnsupportedProfileVersion)
+	}
+
+	plans := m.planShortcutProfile(p.Shortcuts)
+	if !dryRun {
+		m.applyShortcutProfile(plans, resolutions)
+	}
+
+	r := profileImportReport{
+		DryRun: dryRun,
+		Items:  make([]profileImportResult, 0, len(plans)),
+	}
+	for _, plan := range plans {
+		r.Items = append(r.Items, plan.result)
+	}
+	ret, err := util.MarshalJSON(r)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return ret, nil
+}
+
+func (m *Manager) planShortcutProfile(items []profileShortcut) []*profilePlan {
+	plans := make([]*profilePlan, 0, len(items))
+	// uid -> 配置中的新按键，用于判断冲突的快捷键是否也会被修改
+	newKeystrokesMap := make(map[string][]*shortcuts.Keystroke)
+	for i := range items {
+		plan := m.newProfilePlan(&items[i])
+		if plan.result.Status == "" {
+			// 配置中的项目之间也不能使用相同的按键，后面的项目导入失败
+			err := m.findProfileItemConflict(plan, plans)
+			if err != nil {
+				plan.result.Status = profileStatusFailed
+				plan.result.Error = err.Error()
+			}
+		}
+		plans = append(plans, plan)
+		if plan.result.Status == "" && plan.shortcut != nil {
+			newKeystrokesMap[plan.shortcut.GetUid()] = plan.keystrokes
+		}
+	}
+
+	for _, plan := range plans {
+		if plan.result.Status != "" {
+			continue
+		}
+		err := m.findProfilePlanConflicts(plan, newKeystrokesMap)
+		if err != nil {
+			plan.result.Status = profileStatusFailed
+			plan.result.Error = err.Error()
+			continue
+		}
+		if len(plan.conflicts) > 0 {
+			plan.result.Status = profileStatusConflict
+		} else {
+			plan.result.Status = profileStatusApply
+		}
+	}
+	return plans
+}
+
+// newProfilePlan 检查项目并解析按键，无法导入或无需修改时设置 result.Status
+func (m *Manager) newProfilePlan(item *profileShortcut) *profilePlan {
+	plan := &profilePlan{
+		item: item,
+		result: profileImportResult{
+			Key:  item.key(),
+			Id:   item.Id,
+			Type: item.Type,
+		},
+	}
+	fail := func(err error) *profilePlan {
+		plan.result.Status = profileStatusFailed
+		plan.result.Error = err.Error()
+		return plan
+	}
+
+	switch item.Type {
+	case shortcuts.ShortcutTypeSystem, shortcuts.ShortcutTypeMedia, shortcuts.ShortcutTypeWM,
+		shortcuts.ShortcutTypeCustom:
+	default:
+		return fail(ErrInvalidShortcutType{item.Type})
+	}
+	if item.Id == "" {
+		return fail(errors.New("shortcut id is empty"))
+	}
+
+	plan.shortcut = m.shortcutManager.GetByIdType(item.Id, item.Type)
+	if plan.shortcut == nil && item.Type != shortcuts.ShortcutTypeCustom {
+		return fail(ErrShortcutNotFound{item.Id, item.Type})
+	}
+	if plan.shortcut != nil && !plan.shortcut.GetKeystrokesModifiable() {
+		return fail(errShortcutKeystrokesUnmodifiable)
+	}
+
+	for _, accel := range item.Accels {
+		ks, err := shortcuts.ParseKeystroke(accel)
+		if err != nil {
+			return fail(err)
+		}
+		plan.keystrokes = append(plan.keystrokes, ks)
+	}
+
+	if item.Type == shortcuts.ShortcutTypeCustom {
+		if item.Exec == "" {
+			return fail(errors.New("exec of custom shortcut is empty"))
+		}
+		if _, err := shortcuts.ParseCustomAction(item.Exec); err != nil {
+			return fail(err)
+		}
+		if !_useWayland {
+			plan.appScope = shortcuts.NormalizeAppScope(item.AppScope)
+		}
+	}
+
+	if plan.shortcut != nil && m.isProfilePlanUnchanged(plan) {
+		plan.result.Status = profileStatusUnchanged
+	}
+	return plan
+}
+
+func (m *Manager) isProfilePlanUnchanged(plan *profilePlan) bool {
+	shortcut := plan.shortcut
+	if !strv.Strv(getKeystrokesStrv(shortcut.GetKeystrokes())).Equal(getKeystrokesStrv(plan.keystrokes)) {
+		return false
+	}
+	cs, ok := shortcut.(*shortcuts.CustomShortcut)
+	if !ok {
+		return true
+	}
+	item := plan.item
+	return (item.Name == "" || item.Name == cs.GetName()) && item.Exec == cs.Cmd &&
+		strv.Strv(cs.GetAppScope()).Equal(plan.appScope)
+}
+
+// findProfilePlanConflicts 与 LookupConflictingShortcut 相同的方式查找冲突，
+// 忽略配置中同时修改且不再使用该按键的快捷键
+func (m *Manager) findProfilePlanConflicts(plan *profilePlan,
+	newKeystrokesMap map[string][]*shortcuts.Keystroke) error {
+
+	for _, ks := range plan.keystrokes {
+		conflictKeystroke, err := m.shortcutManager.FindConflictingKeystrokeInScope(ks, plan.appScope)
+		if err != nil {
+			return err
+		}
+		if conflictKeystroke == nil || conflictKeystroke.Shortcut == nil ||
+			conflictKeystroke.Shortcut == plan.shortcut {
+			continue
+		}
+
+		owner := conflictKeystroke.Shortcut
+		if newKeystrokes, ok := newKeystrokesMap[owner.GetUid()]; ok {
+			stillUsed := false
+			for _, ks0 := range newKeystrokes {
+				if ks0.Equal(m.keySymbols, conflictKeystroke) {
+					stillUsed = true
+					break
+				}
+			}
+			if !stillUsed {
+				continue
+			}
+		}
+
+		plan.conflicts = append(plan.conflicts, conflictKeystroke)
+		plan.result.Conflicts = append(plan.result.Conflicts, profileConflict{
+			Accel: ks.String(),
+			Id:    owner.GetId(),
+			Type:  owner.GetType(),
+			Name:  owner.GetName(),
+		})
+	}
+	return nil
+}
+
+// findProfileItemConflict 查找配置中前面将要导入的项目是否已经在相同的范围内使用了 plan 的按键，
+// 与 FindConflictingKeystrokeInScope 相同，全局快捷键与限定应用范围的快捷键不冲突
+func (m *Manager) findProfileItemConflict(plan *profilePlan, plans []*profilePlan) error {
+	for _, other := range plans {
+		if other.result.Status != "" || !isProfileAppScopeOverlapped(plan.appScope, other.appScope) {
+			continue
+		}
+		for _, ks := range plan.keystrokes {
+			for _, ks0 := range other.keystrokes {
+				if ks.Equal(m.keySymbols, ks0) {
+					return fmt.Errorf("keystroke %s is also used by %s in the profile", ks, other.result.Key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isProfileAppScopeOverlapped(appScope1, appScope2 []string) bool {
+	if len(appScope1) == 0 || len(appScope2) == 0 {
+		return len(appScope1) == len(appScope2)
+	}
+	for _, app := range appScope1 {
+		if strv.Strv(appScope2).Contains(app) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) applyShortcutProfile(plans []*profilePlan, resolutions map[string]string) {
+	m.enableListenGSettingsChanged(false)
+	defer m.enableListenGSettingsChanged(true)
+
+	var applyPlans []*profilePlan
+	for _, plan := range plans {
+		switch plan.result.Status {
+		case profileStatusApply:
+			plan.result.Status = profileStatusApplied
+			applyPlans = append(applyPlans, plan)
+		case profileStatusConflict:
+			resolution := resolutions[plan.result.Key]
+			if resolution != profileResolutionOverwrite {
+				if resolution != "" && resolution != profileResolutionSkip {
+					logger.Warningf("unknown resolution %q for %s", resolution, plan.result.Key)
+				}
+				plan.result.Status = profileStatusSkipped
+				continue
+			}
+			m.removeProfileConflicts(plan)
+			plan.result.Status = profileStatusOverwritten
+			applyPlans = append(applyPlans, plan)
+		}
+	}
+
+	// 先释放所有将要修改的快捷键的按键，配置中的快捷键之间交换按键时才不会冲突
+	oldKeystrokesMap := make(map[*profilePlan][]*shortcuts.Keystroke)
+	for _, plan := range applyPlans {
+		if plan.shortcut != nil {
+			oldKeystrokesMap[plan] = plan.shortcut.GetKeystrokes()
+			m.shortcutManager.ModifyShortcutKeystrokes(plan.shortcut, nil)
+		}
+	}
+
+	for _, plan := range applyPlans {
+		err := m.applyProfilePlan(plan)
+		if err != nil {
+			logger.Warningf("failed to import shortcut %s: %v", plan.result.Key, err)
+			plan.result.Status = profileStatusFailed
+			plan.result.Error = err.Error()
+			if oldKeystrokes, ok := oldKeystrokesMap[plan]; ok {
+				m.shortcutManager.ModifyShortcutKeystrokes(plan.shortcut, oldKeystrokes)
+			}
+		}
+	}
+}
+
+// removeProfileConflicts 从冲突的快捷键中删除冲突的按键
+func (m *Manager) removeProfileConflicts(plan *profilePlan) {
+	for _, ks := range plan.conflicts {
+		owner := ks.Shortcut
+		if owner == nil {
+			continue
+		}
+		logger.Debugf("remove conflicting keystroke %s from %s", ks, owner.GetUid())
+		m.shortcutManager.DeleteShortcutKeystroke(owner, ks)
+		err := owner.SaveKeystrokes()
+		if err != nil {
+			logger.Warning(err)
+		}
+		if owner.ShouldEmitSignalChanged() {
+			m.emitShortcutSignal(shortcutSignalChanged, owner)
+		}
+	}
+}
+
+func (m *Manager) applyProfilePlan(plan *profilePlan) error {
+	item := plan.item
+	if item.Type != shortcuts.ShortcutTypeCustom {
+		m.shortcutManager.ModifyShortcutKeystrokes(plan.shortcut, plan.keystrokes)
+		err := plan.shortcut.SaveKeystrokes()
+		if err != nil {
+			return err
+		}
+		if plan.shortcut.ShouldEmitSignalChanged() {
+			m.emitShortcutSignal(shortcutSignalChanged, plan.shortcut)
+		}
+		return nil
+	}
+
+	// 先在 KWin 中注册，失败时还没有修改配置文件和内存中的快捷键
+	if _useWayland && len(plan.keystrokes) > 0 {
+		busErr := m.processWaylandCustomShortcut(item.Id, item.Exec, plan.keystrokes[0])
+		if busErr != nil {
+			return busErr
+		}
+	}
+
+	signal := shortcutSignalChanged
+	var cs *shortcuts.CustomShortcut
+	if plan.shortcut == nil {
+		shortcut, err := m.customShortcutManager.Add(item.Id, item.Exec, plan.keystrokes, m.wm)
+		if err != nil {
+			return err
+		}
+		cs = shortcut.(*shortcuts.CustomShortcut)
+		// 还没有添加到 ShortcutManager，不需要重新抓取按键
+		cs.SetAppScope(plan.appScope)
+		plan.shortcut = cs
+		signal = shortcutSignalAdded
+	} else {
+		var ok bool
+		cs, ok = plan.shortcut.(*shortcuts.CustomShortcut)
+		if !ok {
+			return errTypeAssertionFail
+		}
+		cs.Cmd = item.Exec
+		m.shortcutManager.SetAppScope(cs, plan.appScope)
+		m.shortcutManager.ModifyShortcutKeystrokes(cs, plan.keystrokes)
+	}
+	if item.Name != "" && item.Name != cs.GetName() {
+		cs.SetName(item.Name)
+	}
+
+	err := cs.Save()
+	if err != nil {
+		return err
+	}
+	if signal == shortcutSignalAdded {
+		m.shortcutManager.Add(cs)
+	}
+	m.emitShortcutSignal(signal, cs)
+	return nil
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package keybinding
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/dde-daemon/keybinding1/shortcuts"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/keysyms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_shortcutProfile(t *testing.T) {
+	data := `{"Version":1,"Shortcuts":[
+{"Id":"terminal","Type":0,"Accels":["<Control><Alt>T"]},
+{"Id":"browser","Type":1,"Name":"Browser","Accels":["<Super>w, b"],"Exec":"firefox","AppScope":["deepin-terminal"]}]}`
+	var p shortcutProfile
+	err := json.Unmarshal([]byte(data), &p)
+	require.NoError(t, err)
+	assert.Equal(t, shortcutProfileVersion, p.Version)
+	require.Len(t, p.Shortcuts, 2)
+	assert.Equal(t, "0:terminal", p.Shortcuts[0].key())
+	assert.Equal(t, "1:browser", p.Shortcuts[1].key())
+	assert.Equal(t, []string{"deepin-terminal"}, p.Shortcuts[1].AppScope)
+
+	ks, err := shortcuts.ParseKeystroke(p.Shortcuts[1].Accels[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"<Super>w, b"}, getKeystrokesStrv([]*shortcuts.Keystroke{ks}))
+	assert.Equal(t, []string{}, getKeystrokesStrv(nil))
+}
+
+func newTestProfileManager(t *testing.T) *Manager {
+	conn, err := x.NewConn()
+	if err != nil {
+		t.Skip("failed to connect x")
+	}
+	t.Cleanup(conn.Close)
+	service, err := dbusutil.NewSessionService()
+	if err != nil {
+		t.Skip("session bus is not available")
+	}
+
+	keySymbols := keysyms.NewKeySymbols(conn)
+	m := &Manager{
+		service:    service,
+		conn:       conn,
+		keySymbols: keySymbols,
+		customShortcutManager: shortcuts.NewCustomShortcutManager(
+			filepath.Join(t.TempDir(), "custom.ini")),
+	}
+	m.shortcutManager = shortcuts.NewShortcutManager(conn, keySymbols, func(ev *shortcuts.KeyEvent) {})
+	t.Cleanup(func() {
+		m.shortcutManager.UngrabAll()
+		m.shortcutManager.Destroy()
+	})
+
+	ks, err := shortcuts.ParseKeystroke("<Control><Alt><Super>F9")
+	require.NoError(t, err)
+	shortcut, err := m.customShortcutManager.Add("old", "true", []*shortcuts.Keystroke{ks}, nil)
+	require.NoError(t, err)
+	m.shortcutManager.Add(shortcut)
+	return m
+}
+
+func importTestProfile(t *testing.T, m *Manager, dryRun bool, resolutions map[string]string) profileImportReport {
+	profile := `{"Version":1,"Shortcuts":[
+{"Id":"new","Type":1,"Accels":["<Control><Alt><Super>F9"],"Exec":"false"},
+{"Id":"scoped","Type":1,"Accels":["<Control><Alt><Super>F10"],"Exec":"false","AppScope":[" Deepin-Terminal"]}]}`
+	ret, busErr := m.ImportShortcutProfile(profile, dryRun, resolutions)
+	require.Nil(t, busErr)
+	var report profileImportReport
+	require.NoError(t, json.Unmarshal([]byte(ret), &report))
+	require.Len(t, report.Items, 2)
+	return report
+}
+
+func getTestAccels(m *Manager, id string) []string {
+	shortcut := m.shortcutManager.GetByIdType(id, shortcuts.ShortcutTypeCustom)
+	if shortcut == nil {
+		return nil
+	}
+	return getKeystrokesStrv(shortcut.GetKeystrokes())
+}
+
+func Test_ImportShortcutProfile(t *testing.T) {
+	m := newTestProfileManager(t)
+
+	// dry-run 只报告冲突，不做修改
+	report := importTestProfile(t, m, true, map[string]string{"1:new": profileResolutionOverwrite})
+	assert.True(t, report.DryRun)
+	assert.Equal(t, profileStatusConflict, report.Items[0].Status)
+	assert.Equal(t, []profileConflict{{Accel: "<Control><Alt><Super>F9", Id: "old",
+		Type: shortcuts.ShortcutTypeCustom, Name: "old"}}, report.Items[0].Conflicts)
+	assert.Equal(t, profileStatusApply, report.Items[1].Status)
+	assert.Equal(t, []string{"<Control><Alt><Super>F9"}, getTestAccels(m, "old"))
+	assert.Nil(t, m.shortcutManager.GetByIdType("new", shortcuts.ShortcutTypeCustom))
+	assert.Nil(t, m.shortcutManager.GetByIdType("scoped", shortcuts.ShortcutTypeCustom))
+
+	// 未指定处理方式时跳过冲突的项目，没有冲突的项目照常导入
+	report = importTestProfile(t, m, false, nil)
+	assert.Equal(t, profileStatusSkipped, report.Items[0].Status)
+	assert.Equal(t, profileStatusApplied, report.Items[1].Status)
+	assert.Nil(t, m.shortcutManager.GetByIdType("new", shortcuts.ShortcutTypeCustom))
+	scoped, ok := m.shortcutManager.GetByIdType("scoped", shortcuts.ShortcutTypeCustom).(*shortcuts.CustomShortcut)
+	require.True(t, ok)
+	assert.Equal(t, []string{"deepin-terminal"}, scoped.GetAppScope())
+
+	// 覆盖时移除冲突快捷键的按键
+	report = importTestProfile(t, m, false, map[string]string{"1:new": profileResolutionOverwrite})
+	assert.Equal(t, profileStatusOverwritten, report.Items[0].Status)
+	assert.Equal(t, profileStatusUnchanged, report.Items[1].Status)
+	assert.Equal(t, []string{}, getTestAccels(m, "old"))
+	assert.Equal(t, []string{"<Control><Alt><Super>F9"}, getTestAccels(m, "new"))
+}
+
+func Test_isProfileAppScopeOverlapped(t *testing.T) {
+	assert.True(t, isProfileAppScopeOverlapped(nil, nil))
+	assert.False(t, isProfileAppScopeOverlapped(nil, []string{"deepin-terminal"}))
+	assert.False(t, isProfileAppScopeOverlapped([]string{"deepin-terminal"}, nil))
+	assert.True(t, isProfileAppScopeOverlapped([]string{"firefox", "deepin-terminal"},
+		[]string{"deepin-terminal"}))
+	assert.False(t, isProfileAppScopeOverlapped([]string{"firefox"}, []string{"deepin-terminal"}))
+}
+
+func Test_ImportShortcutProfileItemConflict(t *testing.T) {
+	m := newTestProfileManager(t)
+
+	// 配置中的项目之间使用相同的按键时，后面的项目导入失败，应用范围不重叠时不冲突
+	profile := `{"Version":1,"Shortcuts":[
+{"Id":"a","Type":1,"Accels":["<Control><Alt><Super>F11"],"Exec":"false"},
+{"Id":"b","Type":1,"Accels":["<Control><Alt><Super>F11"],"Exec":"false"},
+{"Id":"c","Type":1,"Accels":["<Control><Alt><Super>F11"],"Exec":"false","AppScope":["deepin-terminal"]},
+{"Id":"d","Type":1,"Accels":["<Control><Alt><Super>F11"],"Exec":"false","AppScope":["Deepin-Terminal"]},
+{"Id":"e","Type":1,"Accels":["<Control><Alt><Super>F12"],"Exec":"key-remap:<Control>a, b"}]}`
+	ret, busErr := m.ImportShortcutProfile(profile, false, nil)
+	require.Nil(t, busErr)
+	var report profileImportReport
+	require.NoError(t, json.Unmarshal([]byte(ret), &report))
+	require.Len(t, report.Items, 5)
+	assert.Equal(t, profileStatusApplied, report.Items[0].Status)
+	assert.Equal(t, profileStatusFailed, report.Items[1].Status)
+	assert.Contains(t, report.Items[1].Error, "1:a")
+	assert.Equal(t, profileStatusApplied, report.Items[2].Status)
+	assert.Equal(t, profileStatusFailed, report.Items[3].Status)
+	assert.Contains(t, report.Items[3].Error, "1:c")
+	// 与 AddCustomShortcut 相同，检查命令中的自定义动作
+	assert.Equal(t, profileStatusFailed, report.Items[4].Status)
+	assert.Equal(t, []string{"<Control><Alt><Super>F11"}, getTestAccels(m, "a"))
+	assert.Nil(t, m.shortcutManager.GetByIdType("b", shortcuts.ShortcutTypeCustom))
+	assert.Nil(t, m.shortcutManager.GetByIdType("d", shortcuts.ShortcutTypeCustom))
+}
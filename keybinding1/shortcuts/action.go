@@ -32,6 +32,10 @@ const (
 
 	ActionTypeCallback // 触发回调函数点Action
 
+	ActionTypeDBusCall // 调用 D-Bus 方法
+	ActionTypeKeyRemap // 触发另一个按键对应的快捷键
+	ActionTypeMacro    // 回放录制的按键宏
+
 	// end
 	actionTypeMax
 )
@@ -0,0 +1,263 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package shortcuts
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/linuxdeepin/dde-daemon/common/activewindow"
+	"github.com/linuxdeepin/go-lib/strv"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/wm/ewmh"
+)
+
+// 只在指定应用的窗口激活时生效的快捷键，目前只有自定义快捷键可以设置应用范围，只支持 X11。
+// AppScope 中的每一项与激活窗口 WM_CLASS 的 class、instance 或可执行文件名比较，不区分大小写。
+// 与全局快捷键使用相同按键时，在范围内的应用中覆盖全局快捷键；
+// 没有全局快捷键使用这个按键时，只在范围内的应用激活时才抓取按键，其他应用仍能收到这个按键。
+
+var ErrAppScopeKeySequence = errors.New("key sequence can not be scoped to applications")
+
+// GetAppScope 返回快捷键的应用范围，为空表示全局生效
+func GetAppScope(shortcut Shortcut) []string {
+	if cs, ok := shortcut.(*CustomShortcut); ok {
+		return cs.GetAppScope()
+	}
+	return nil
+}
+
+// NormalizeAppScope 转为小写，去掉空白、空项和重复项
+func NormalizeAppScope(appScope []string) []string {
+	var result []string
+	for _, app := range appScope {
+		app = strings.ToLower(strings.TrimSpace(app))
+		if app == "" || strv.Strv(result).Contains(app) {
+			continue
+		}
+		result = append(result, app)
+	}
+	return result
+}
+
+func isAppInScope(appScope, appNames []string) bool {
+	for _, app := range appScope {
+		for _, name := range appNames {
+			if strings.EqualFold(app, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listenActiveWindow 监听根窗口的属性变化，在 EventLoop 中处理激活窗口的变化
+func (sm *ShortcutManager) listenActiveWindow() {
+	var err error
+	sm.atomNetActiveWindow, err = sm.conn.GetAtom("_NET_ACTIVE_WINDOW")
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	rootWin := sm.conn.GetDefaultScreen().Root
+	err = x.ChangeWindowAttributesChecked(sm.conn, rootWin, x.CWEventMask,
+		[]uint32{x.EventMaskPropertyChange}).Check(sm.conn)
+	if err != nil {
+		logger.Warning(err)
+	}
+	sm.handleActiveWindowChanged()
+}
+
+func (sm *ShortcutManager) handlePropertyNotifyEvent(ev *x.PropertyNotifyEvent) {
+	if ev.Window == sm.conn.GetDefaultScreen().Root && ev.Atom == sm.atomNetActiveWindow {
+		sm.handleActiveWindowChanged()
+	}
+}
+
+func (sm *ShortcutManager) handleActiveWindowChanged() {
+	sm.keyKeystrokeMapMu.Lock()
+	if len(sm.keyScopedMap) == 0 {
+		// 没有限定范围的快捷键时不需要获取激活的应用，添加限定范围的快捷键时再获取
+		sm.activeWindow = 0
+		sm.activeAppNames = nil
+		sm.keyKeystrokeMapMu.Unlock()
+		return
+	}
+	sm.keyKeystrokeMapMu.Unlock()
+
+	activeWin, err := ewmh.GetActiveWindow(sm.conn).Reply(sm.conn)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	changed := activeWin != sm.activeWindow
+	sm.keyKeystrokeMapMu.Unlock()
+	if !changed {
+		return
+	}
+
+	// 获取应用名需要查询窗口属性和读取 /proc，不能持有 keyKeystrokeMapMu，否则会阻塞按键处理
+	var appNames []string
+	if activeWin != 0 {
+		appNames = activewindow.GetWindowAppNames(sm.conn, activeWin)
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	defer sm.keyKeystrokeMapMu.Unlock()
+	sm.activeWindow = activeWin
+	sm.activeAppNames = appNames
+	logger.Debugf("active window changed to %d, app names: %v", activeWin, sm.activeAppNames)
+	sm.updateScopedGrabs()
+}
+
+// updateScopedGrabs 根据激活的应用抓取或释放只有限定范围快捷键使用的按键，调用前需要持有 keyKeystrokeMapMu
+func (sm *ShortcutManager) updateScopedGrabs() {
+	for key, list := range sm.keyScopedMap {
+		if _, ok := sm.keyKeystrokeMap[key]; ok {
+			// 由全局快捷键抓取
+			delete(sm.scopedGrabbedKeys, key)
+			continue
+		}
+
+		need := false
+		for _, ks := range list {
+			if isAppInScope(GetAppScope(ks.Shortcut), sm.activeAppNames) {
+				need = true
+				break
+			}
+		}
+		grabbed := sm.scopedGrabbedKeys[key]
+		if need == grabbed || dummyGrab(list[0].Shortcut, list[0]) {
+			continue
+		}
+		if need {
+			err := key.Grab(sm.conn)
+			if err != nil {
+				logger.Debug(err)
+				continue
+			}
+			sm.scopedGrabbedKeys[key] = true
+		} else {
+			key.Ungrab(sm.conn)
+			delete(sm.scopedGrabbedKeys, key)
+		}
+	}
+
+	for key := range sm.scopedGrabbedKeys {
+		if _, ok := sm.keyScopedMap[key]; !ok {
+			key.Ungrab(sm.conn)
+			delete(sm.scopedGrabbedKeys, key)
+		}
+	}
+}
+
+func (sm *ShortcutManager) grabScopedKeystroke(shortcut Shortcut, ks *Keystroke) {
+	keyList, err := ks.ToKeyList(sm.keySymbols)
+	if err != nil {
+		logger.Debugf("grabScopedKeystroke failed, shortcut: %v, ks: %v, err: %v", shortcut.GetId(), ks, err)
+		return
+	}
+	ks.Shortcut = shortcut
+
+	sm.keyKeystrokeMapMu.Lock()
+	first := len(sm.keyScopedMap) == 0
+	for _, key := range keyList {
+		logger.Debugf("grabScopedKeystroke shortcut: %s, ks: %s, key: %s", shortcut.GetId(), ks, key)
+		sm.keyScopedMap[key] = append(sm.keyScopedMap[key], ks)
+	}
+	sm.updateScopedGrabs()
+	sm.keyKeystrokeMapMu.Unlock()
+
+	if first {
+		// 之前没有限定范围的快捷键，没有记录激活的应用
+		sm.handleActiveWindowChanged()
+	}
+}
+
+func (sm *ShortcutManager) ungrabScopedKeystroke(shortcut Shortcut, ks *Keystroke) {
+	keyList, err := ks.ToKeyList(sm.keySymbols)
+	if err != nil {
+		logger.Debug(err)
+		return
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	defer sm.keyKeystrokeMapMu.Unlock()
+	for _, key := range keyList {
+		var newList []*Keystroke
+		for _, ks0 := range sm.keyScopedMap[key] {
+			if ks0.Shortcut != shortcut || !ks.Equal(sm.keySymbols, ks0) {
+				newList = append(newList, ks0)
+			}
+		}
+		if len(newList) > 0 {
+			sm.keyScopedMap[key] = newList
+		} else {
+			delete(sm.keyScopedMap, key)
+		}
+	}
+	sm.updateScopedGrabs()
+}
+
+// findScopedKeystroke 查找在激活的应用中生效的快捷键，调用前需要持有 keyKeystrokeMapMu
+func (sm *ShortcutManager) findScopedKeystroke(key Key) *Keystroke {
+	for _, ks := range sm.keyScopedMap[key] {
+		if isAppInScope(GetAppScope(ks.Shortcut), sm.activeAppNames) {
+			return ks
+		}
+	}
+	return nil
+}
+
+// findRecordKeystroke 查找 XRecord 截获的按键对应的快捷键，与 findKeystroke 一样考虑应用范围。
+// XRecord 的事件在单独的 goroutine 中处理，激活窗口的变化可能还没有在 EventLoop 中处理，
+// 按键有限定范围的快捷键时先刷新激活的应用。
+func (sm *ShortcutManager) findRecordKeystroke(key Key) *Keystroke {
+	sm.keyKeystrokeMapMu.Lock()
+	_, scoped := sm.keyScopedMap[key]
+	sm.keyKeystrokeMapMu.Unlock()
+	if scoped {
+		sm.handleActiveWindowChanged()
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	defer sm.keyKeystrokeMapMu.Unlock()
+	return sm.findKeystroke(key)
+}
+
+// SetAppScope 修改快捷键的应用范围并重新抓取按键
+func (sm *ShortcutManager) SetAppScope(shortcut *CustomShortcut, appScope []string) {
+	logger.Debug("ShortcutManager.SetAppScope", shortcut, appScope)
+	sm.ungrabShortcut(shortcut)
+	shortcut.SetAppScope(appScope)
+	sm.grabShortcut(shortcut)
+}
+
+// FindConflictingKeystrokeInScope 与 FindConflictingKeystroke 相同，appScope 不为空时只与应用范围有交集的快捷键冲突
+func (sm *ShortcutManager) FindConflictingKeystrokeInScope(ks *Keystroke, appScope []string) (*Keystroke, error) {
+	if len(appScope) == 0 {
+		return sm.FindConflictingKeystroke(ks)
+	}
+	if ks.isKeySequence() {
+		return nil, ErrAppScopeKeySequence
+	}
+	keyList, err := ks.ToKeyList(sm.keySymbols)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	defer sm.keyKeystrokeMapMu.Unlock()
+	for _, key := range keyList {
+		for _, ks1 := range sm.keyScopedMap[key] {
+			if isAppInScope(appScope, GetAppScope(ks1.Shortcut)) {
+				return ks1, nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package shortcuts
+
+import (
+	"path/filepath"
+	"testing"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/keysyms"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeAppScope(t *testing.T) {
+	assert.Equal(t, []string{"deepin-terminal", "firefox"},
+		NormalizeAppScope([]string{" Deepin-Terminal", "", "firefox", "FireFox "}))
+	assert.Nil(t, NormalizeAppScope([]string{" "}))
+}
+
+func TestIsAppInScope(t *testing.T) {
+	// 可执行文件名、WM_CLASS 的 instance 和 class
+	appNames := []string{"deepin-terminal", "deepin-terminal", "Deepin-terminal"}
+	assert.True(t, isAppInScope([]string{"firefox", "deepin-terminal"}, appNames))
+	assert.False(t, isAppInScope([]string{"firefox"}, appNames))
+	assert.False(t, isAppInScope(nil, appNames))
+	assert.False(t, isAppInScope([]string{"firefox"}, nil))
+}
+
+func TestScopedKeystrokeDispatch(t *testing.T) {
+	global := &CustomShortcut{BaseShortcut: BaseShortcut{Id: "global", Type: ShortcutTypeCustom}}
+	scoped := &CustomShortcut{
+		BaseShortcut: BaseShortcut{Id: "scoped", Type: ShortcutTypeCustom},
+		AppScope:     []string{"deepin-terminal"},
+	}
+	key := Key{Mods: keysyms.ModMaskControl, Code: 38}
+	globalKey := Key{Mods: keysyms.ModMaskControl, Code: 39}
+
+	var emitted []string
+	sm := &ShortcutManager{
+		keyKeystrokeMap: map[Key]*Keystroke{globalKey: {Shortcut: global}},
+		keyScopedMap: map[Key][]*Keystroke{
+			key:       {{Shortcut: scoped}},
+			globalKey: {{Shortcut: scoped}},
+		},
+		eventCb: func(ev *KeyEvent) {
+			emitted = append(emitted, ev.Shortcut.GetId())
+		},
+		usage: newUsageStats(filepath.Join(t.TempDir(), "usage.json")),
+	}
+
+	// 激活的应用不在范围内，只有限定范围的快捷键使用的按键被跳过，全局快捷键不被覆盖
+	sm.activeAppNames = []string{"firefox", "navigator"}
+	sm.emitKeyEvent(0, key)
+	sm.emitKeyEvent(0, globalKey)
+	assert.Equal(t, []string{"global"}, emitted)
+
+	// 在范围内的应用中覆盖全局快捷键
+	emitted = nil
+	sm.activeAppNames = []string{"deepin-terminal", "deepin-terminal", "deepin-terminal"}
+	sm.emitKeyEvent(0, key)
+	sm.emitKeyEvent(0, globalKey)
+	assert.Equal(t, []string{"scoped", "scoped"}, emitted)
+}
+
+func TestHandleActiveWindowChangedWithoutScoped(t *testing.T) {
+	// 没有限定范围的快捷键时不查询激活窗口，conn 为 nil 也不会被使用
+	sm := &ShortcutManager{
+		keyScopedMap:   map[Key][]*Keystroke{},
+		activeWindow:   1,
+		activeAppNames: []string{"deepin-terminal"},
+	}
+	sm.handleActiveWindowChanged()
+	assert.Equal(t, x.Window(0), sm.activeWindow)
+	assert.Nil(t, sm.activeAppNames)
+}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package shortcuts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linuxdeepin/dde-daemon/common/dbuscall"
+)
+
+// 自定义快捷键的命令以下面的前缀开头时不执行命令，而是执行对应的动作：
+// dbus-call:session org.foo /org/foo org.foo.Iface.Method string:hi int32:3  格式见 dbuscall 包
+// key-remap:<Control>c  触发按下 <Control>c 时的快捷键
+// macro:name  回放名为 name 的按键宏
+
+const (
+	DBusCallPrefix = "dbus-call:"
+	KeyRemapPrefix = "key-remap:"
+	MacroPrefix    = "macro:"
+)
+
+var (
+	errKeyRemapSequence = errors.New("can not remap to a key sequence")
+	errKeyRemapLoop     = errors.New("can not remap to a shortcut which remaps keys")
+	errEmptyMacroName   = errors.New("macro name is empty")
+)
+
+func NewDBusCallAction(call *dbuscall.Call) *Action {
+	return &Action{
+		Type: ActionTypeDBusCall,
+		Arg:  call,
+	}
+}
+
+func NewKeyRemapAction(ks *Keystroke) *Action {
+	return &Action{
+		Type: ActionTypeKeyRemap,
+		Arg:  ks,
+	}
+}
+
+func NewMacroAction(name string) *Action {
+	return &Action{
+		Type: ActionTypeMacro,
+		Arg:  name,
+	}
+}
+
+// ParseCustomAction 解析 dbus-call:、key-remap: 和 macro: 开头的命令，其他命令返回 nil, nil
+func ParseCustomAction(cmd string) (*Action, error) {
+	if str, ok := strings.CutPrefix(cmd, DBusCallPrefix); ok {
+		call, err := dbuscall.Parse(str)
+		if err != nil {
+			return nil, err
+		}
+		return NewDBusCallAction(call), nil
+	}
+
+	if str, ok := strings.CutPrefix(cmd, KeyRemapPrefix); ok {
+		ks, err := ParseKeystroke(strings.TrimSpace(str))
+		if err != nil {
+			return nil, err
+		}
+		if ks.isKeySequence() {
+			return nil, errKeyRemapSequence
+		}
+		return NewKeyRemapAction(ks), nil
+	}
+
+	if str, ok := strings.CutPrefix(cmd, MacroPrefix); ok {
+		name := strings.TrimSpace(str)
+		if name == "" {
+			return nil, errEmptyMacroName
+		}
+		return NewMacroAction(name), nil
+	}
+	return nil, nil
+}
+
+// EmitKeystroke 触发 ks 对应按键的快捷键，与按下这个按键的效果相同，不能触发另一个按键重映射
+func (sm *ShortcutManager) EmitKeystroke(ks *Keystroke) error {
+	if ks.isKeySequence() {
+		return errKeyRemapSequence
+	}
+	key, err := ks.ToKey(sm.keySymbols)
+	if err != nil {
+		return err
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	keystroke := sm.findKeystroke(key)
+	sm.keyKeystrokeMapMu.Unlock()
+	if keystroke == nil {
+		return fmt.Errorf("no shortcut uses keystroke %s", ks)
+	}
+	if action := keystroke.Shortcut.GetAction(); action != nil && action.Type == ActionTypeKeyRemap {
+		return errKeyRemapLoop
+	}
+
+	logger.Debugf("EmitKeystroke %s, shortcut: %s", ks, keystroke.Shortcut.GetUid())
+	sm.callEventCallback(&KeyEvent{
+		Mods:     key.Mods,
+		Code:     key.Code,
+		Shortcut: keystroke.Shortcut,
+		Remapped: true,
+	})
+	return nil
+}
+
+// ActivateShortcut 触发快捷键，与按下它的按键的效果相同，用于鼠标按键等其他模块的重映射
+func (sm *ShortcutManager) ActivateShortcut(shortcut Shortcut) error {
+	if action := shortcut.GetAction(); action != nil && action.Type == ActionTypeKeyRemap {
+		return errKeyRemapLoop
+	}
+	logger.Debugf("ActivateShortcut %s", shortcut.GetUid())
+	sm.callEventCallback(&KeyEvent{
+		Shortcut: shortcut,
+		Remapped: true,
+	})
+	return nil
+}
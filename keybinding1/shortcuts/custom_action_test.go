@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package shortcuts
+
+import (
+	"testing"
+
+	"github.com/linuxdeepin/dde-daemon/common/dbuscall"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCustomAction(t *testing.T) {
+	action, err := ParseCustomAction("dbus-call:session org.foo /org/foo org.foo.Bar.Baz string:hi int32:3")
+	require.NoError(t, err)
+	assert.Equal(t, ActionTypeDBusCall, action.Type)
+	call, ok := action.Arg.(*dbuscall.Call)
+	require.True(t, ok)
+	assert.Equal(t, "org.foo.Bar.Baz", call.Method)
+	assert.Equal(t, []interface{}{"hi", int32(3)}, call.Args)
+
+	action, err = ParseCustomAction("key-remap: <Control>c")
+	require.NoError(t, err)
+	assert.Equal(t, ActionTypeKeyRemap, action.Type)
+	ks, ok := action.Arg.(*Keystroke)
+	require.True(t, ok)
+	assert.Equal(t, "<Control>c", ks.String())
+
+	_, err = ParseCustomAction("key-remap:<Super>w, t")
+	assert.Equal(t, errKeyRemapSequence, err)
+	_, err = ParseCustomAction("dbus-call:session org.foo")
+	assert.Error(t, err)
+
+	action, err = ParseCustomAction("macro: greeting ")
+	require.NoError(t, err)
+	assert.Equal(t, NewMacroAction("greeting"), action)
+	_, err = ParseCustomAction("macro:")
+	assert.Equal(t, errEmptyMacroName, err)
+
+	action, err = ParseCustomAction("deepin-terminal")
+	assert.NoError(t, err)
+	assert.Nil(t, action)
+}
@@ -18,13 +18,29 @@ const (
 	kfKeyName       = "Name"
 	kfKeyKeystrokes = "Accels"
 	kfKeyAction     = "Action"
+	kfKeyAppScope   = "AppScope"
 )
 
 type CustomShortcut struct {
 	BaseShortcut
 	manager *CustomShortcutManager
 	Cmd     string `json:"Exec"`
-	wm      wm.Wm
+	// AppScope 快捷键只在这些应用的窗口激活时生效，为空时全局生效
+	AppScope []string `json:",omitempty"`
+	wm       wm.Wm
+}
+
+func (cs *CustomShortcut) GetAppScope() []string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.AppScope
+}
+
+// SetAppScope 只修改应用范围，不重新抓取按键，已经添加到 ShortcutManager 的快捷键需要使用 ShortcutManager.SetAppScope
+func (cs *CustomShortcut) SetAppScope(appScope []string) {
+	cs.mu.Lock()
+	cs.AppScope = appScope
+	cs.mu.Unlock()
 }
 
 func (cs *CustomShortcut) Marshal() (string, error) {
@@ -63,11 +79,25 @@ func (cs *CustomShortcut) Save() error {
 	kfile.SetString(section, kfKeyName, cs.Name)
 	kfile.SetString(section, kfKeyAction, cs.Cmd)
 	kfile.SetStringList(section, kfKeyKeystrokes, cs.getKeystrokesStrv())
+	if appScope := cs.GetAppScope(); len(appScope) > 0 {
+		kfile.SetStringList(section, kfKeyAppScope, appScope)
+	} else {
+		kfile.DeleteKey(section, kfKeyAppScope)
+	}
 	return cs.manager.Save()
 }
 
 func (cs *CustomShortcut) GetAction() *Action {
-	_, err := os.Stat(cs.Cmd)
+	action, err := ParseCustomAction(cs.Cmd)
+	if err != nil {
+		logger.Warningf("invalid action of custom shortcut %s: %v", cs.Id, err)
+		return ActionNoOp
+	}
+	if action != nil {
+		return action
+	}
+
+	_, err = os.Stat(cs.Cmd)
 	if !os.IsNotExist(err) {
 		if strings.HasSuffix(cs.Cmd, ".desktop") {
 			return &Action{
@@ -137,6 +167,7 @@ func (csm *CustomShortcutManager) List() []Shortcut {
 		name, _ := kfile.GetString(section, kfKeyName)
 		cmd, _ := kfile.GetString(section, kfKeyAction)
 		keystrokes, _ := kfile.GetStringList(section, kfKeyKeystrokes)
+		appScope, _ := kfile.GetStringList(section, kfKeyAppScope)
 
 		shortcut := &CustomShortcut{
 			BaseShortcut: BaseShortcut{
@@ -145,8 +176,9 @@ func (csm *CustomShortcutManager) List() []Shortcut {
 				Keystrokes: ParseKeystrokes(keystrokes),
 				Name:       name,
 			},
-			manager: csm,
-			Cmd:     cmd,
+			manager:  csm,
+			Cmd:      cmd,
+			AppScope: NormalizeAppScope(appScope),
 		}
 
 		ret = append(ret, shortcut)
@@ -48,6 +48,11 @@ func (gs *GSettingsShortcut) SaveKeystrokes() error {
 	return nil
 }
 
+// IsModified 用户是否修改过 gsettings 中的按键
+func (gs *GSettingsShortcut) IsModified() bool {
+	return gs.gsettings.GetUserValue(gs.Id) != nil
+}
+
 func keystrokesEqual(s1 []*Keystroke, s2 []*Keystroke) bool {
 	l1 := len(s1)
 	l2 := len(s2)
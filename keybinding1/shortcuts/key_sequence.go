@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package shortcuts
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/keybind"
+	"github.com/linuxdeepin/go-x11-client/util/keysyms"
+)
+
+// 多键序列快捷键，例如 <Super>w, t 表示先按下 <Super>w，松开后在超时之前再按下 t。
+// X11 下只抓取第一个按键，按下后主动抓取键盘读取后续按键，键盘已被其他程序抓取时通过 XRecord 读取；
+// Wayland 下由 KWin 处理，序列转换为 QKeySequence 的文本格式后交给 KWin，见 ToKWinAccel。
+
+const (
+	keySequenceSep = ","
+	// 与 QKeySequence 支持的最大长度一致
+	maxKeySequenceLength = 4
+	keySequenceTimeout   = 1500 * time.Millisecond
+)
+
+var errKeySequenceTooLong = errors.New("key sequence is too long")
+
+// <Super>w, t
+// <Control>x, <Control>c
+func parseKeySequence(keystroke string) (*Keystroke, error) {
+	parts := strings.Split(keystroke, keySequenceSep)
+	if len(parts) > maxKeySequenceLength {
+		return nil, errKeySequenceTooLong
+	}
+
+	var strokes []*Keystroke
+	for _, part := range parts {
+		ks, err := parseSingleKeystroke(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		// 单独的修饰键只能在释放时触发，不能作为序列的一部分
+		if keysyms.IsModifierKey(ks.Keysym) {
+			return nil, errors.New("modifier key " + ks.Keystr + " in key sequence")
+		}
+		strokes = append(strokes, ks)
+	}
+	first := strokes[0]
+	first.Sequence = strokes[1:]
+	return first, nil
+}
+
+func (ks *Keystroke) isKeySequence() bool {
+	return len(ks.Sequence) > 0
+}
+
+// qtKeyNames X11 按键名与 QKeySequence 按键名不同的部分
+var qtKeyNames = map[string]string{
+	"space":     "Space",
+	"Escape":    "Esc",
+	"BackSpace": "Backspace",
+	"Delete":    "Del",
+	"Insert":    "Ins",
+	"Page_Up":   "PgUp",
+	"Page_Down": "PgDown",
+	"Prior":     "PgUp",
+	"Next":      "PgDown",
+}
+
+// ToKWinAccel 返回设置给 KWin 的快捷键字符串。单个按键保持原来的格式，由 KWin 转换；
+// 多键序列转换为 QKeySequence 的文本格式，例如 <Super>w, t 转换为 Meta+W, T。
+func (ks *Keystroke) ToKWinAccel() (string, error) {
+	if !ks.isKeySequence() {
+		return ks.String(), nil
+	}
+	strokes := append([]*Keystroke{ks}, ks.Sequence...)
+	parts := make([]string, 0, len(strokes))
+	for _, stroke := range strokes {
+		part, err := stroke.qtKeyString()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, keySequenceSep+" "), nil
+}
+
+// getKWinAccels 返回快捷键所有按键设置给 KWin 的字符串
+func getKWinAccels(keystrokes []*Keystroke) ([]string, error) {
+	accels := make([]string, len(keystrokes))
+	for i, ks := range keystrokes {
+		accel, err := ks.ToKWinAccel()
+		if err != nil {
+			return nil, err
+		}
+		accels[i] = accel
+	}
+	return accels, nil
+}
+
+// qtKeyString 返回单个按键在 QKeySequence 中的文本，不包括 Sequence
+func (ks *Keystroke) qtKeyString() (string, error) {
+	var keys []string
+	mods := ks.Mods
+	if mods&keysyms.ModMaskControl > 0 {
+		keys = append(keys, "Ctrl")
+	}
+	if mods&keysyms.ModMaskAlt > 0 {
+		keys = append(keys, "Alt")
+	}
+	if mods&keysyms.ModMaskShift > 0 {
+		keys = append(keys, "Shift")
+	}
+	if mods&keysyms.ModMaskSuper > 0 {
+		keys = append(keys, "Meta")
+	}
+
+	var key string
+	if name, ok := qtKeyNames[ks.Keystr]; ok {
+		key = name
+	} else if char, ok := keysyms.KeysymVisibleCharMap[ks.Keysym]; ok {
+		// 逗号和加号在 QKeySequence 中用作分隔符
+		if char == ',' || char == '+' {
+			return "", errors.New("key " + ks.Keystr + " is not supported in key sequence on wayland")
+		}
+		key = strings.ToUpper(string(char))
+	} else if ks.Keystr != "" && !ks.isKeystrAboveTab {
+		key = ks.Keystr
+	} else {
+		return "", errors.New("key " + ks.Keystr + " is not supported in key sequence on wayland")
+	}
+	keys = append(keys, key)
+	return strings.Join(keys, "+"), nil
+}
+
+// isKeySequencePrefix 检查 a 和 b 之中是否有一个是另一个的前缀，调用前已确认第一个按键相同。
+// 按下共同的部分后无法确定触发哪一个，所以视为冲突。
+func isKeySequencePrefix(keySymbols *keysyms.KeySymbols, a, b *Keystroke) bool {
+	n := len(a.Sequence)
+	if len(b.Sequence) < n {
+		n = len(b.Sequence)
+	}
+	for i := 0; i < n; i++ {
+		if !a.Sequence[i].equalStroke(keySymbols, b.Sequence[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+type pendingKeySequence struct {
+	// candidates 已匹配的部分相同的所有序列
+	candidates []*Keystroke
+	// index 下一个按键在 Sequence 中的位置
+	index int
+	// viaRecord 为 true 时从 XRecord 读取后续按键，否则从主动抓取键盘收到的事件读取
+	viaRecord bool
+	timer     *time.Timer
+}
+
+func (sm *ShortcutManager) grabKeySequence(shortcut Shortcut, ks *Keystroke, dummy bool) {
+	keyList, err := ks.ToKeyList(sm.keySymbols)
+	if err != nil {
+		logger.Debugf("grabKeySequence failed, shortcut: %v, ks: %v, err: %v", shortcut.GetId(), ks, err)
+		return
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	defer sm.keyKeystrokeMapMu.Unlock()
+	for _, key := range keyList {
+		logger.Debugf("grabKeySequence shortcut: %s, ks: %s, key: %s, dummy: %v", shortcut.GetId(), ks, key, dummy)
+		if _, ok := sm.keyKeystrokeMap[key]; ok {
+			logger.Debugf("key %v is grabbed by single keystroke", key)
+			continue
+		}
+
+		list, grabbed := sm.keySequenceMap[key]
+		if !grabbed && !dummy {
+			err = key.Grab(sm.conn)
+			if err != nil {
+				logger.Debug(err)
+				continue
+			}
+		}
+		sm.keySequenceMap[key] = append(list, ks)
+	}
+}
+
+func (sm *ShortcutManager) ungrabKeySequence(ks *Keystroke, dummy bool) {
+	keyList, err := ks.ToKeyList(sm.keySymbols)
+	if err != nil {
+		logger.Debug(err)
+		return
+	}
+
+	sm.keyKeystrokeMapMu.Lock()
+	defer sm.keyKeystrokeMapMu.Unlock()
+	for _, key := range keyList {
+		list, ok := sm.keySequenceMap[key]
+		if !ok {
+			continue
+		}
+		var newList []*Keystroke
+		for _, ks0 := range list {
+			if !ks.Equal(sm.keySymbols, ks0) {
+				newList = append(newList, ks0)
+			}
+		}
+		if len(newList) > 0 {
+			sm.keySequenceMap[key] = newList
+			continue
+		}
+		delete(sm.keySequenceMap, key)
+		if !dummy {
+			key.Ungrab(sm.conn)
+		}
+	}
+}
+
+// handleKeySequenceEvent 处理按键按下事件，返回 true 表示事件属于多键序列，不再按单个按键处理。
+// fromRecord 表示事件来自 XRecord。
+func (sm *ShortcutManager) handleKeySequenceEvent(key Key, fromRecord bool) bool {
+	sm.pendingSequenceMu.Lock()
+	p := sm.pendingSequence
+	if p == nil {
+		sm.pendingSequenceMu.Unlock()
+		if fromRecord {
+			return false
+		}
+		sm.keyKeystrokeMapMu.Lock()
+		candidates := sm.keySequenceMap[key]
+		// 限定应用范围的快捷键优先
+		scoped := sm.findScopedKeystroke(key)
+		sm.keyKeystrokeMapMu.Unlock()
+		if len(candidates) == 0 || scoped != nil {
+			return false
+		}
+		sm.startKeySequence(candidates)
+		return true
+	}
+
+	if fromRecord != p.viaRecord {
+		sm.pendingSequenceMu.Unlock()
+		// 主动抓取键盘期间收到的事件都属于序列
+		return !fromRecord
+	}
+	// 按下后续按键的修饰键
+	if keysyms.IsModifierKey(sm.keySymbols.GetKeysym(x.Keycode(key.Code), 0)) {
+		sm.pendingSequenceMu.Unlock()
+		return true
+	}
+
+	var matched *Keystroke
+	var candidates []*Keystroke
+	for _, ks := range p.candidates {
+		if !sm.isKeyOfKeystroke(key, ks.Sequence[p.index]) {
+			continue
+		}
+		if p.index == len(ks.Sequence)-1 {
+			matched = ks
+			break
+		}
+		candidates = append(candidates, ks)
+	}
+
+	if matched == nil && len(candidates) > 0 {
+		logger.Debugf("key sequence continue, index: %d, candidates: %v", p.index+1, candidates)
+		p.candidates = candidates
+		p.index++
+		p.timer.Reset(keySequenceTimeout)
+		sm.pendingSequenceMu.Unlock()
+		return true
+	}
+	sm.stopKeySequence(p)
+	sm.pendingSequenceMu.Unlock()
+
+	if matched == nil {
+		logger.Debug("key sequence not matched:", key)
+		return true
+	}
+	logger.Debugf("key sequence matched: %s", matched.DebugString())
+	sm.callEventCallback(&KeyEvent{
+		Mods:     key.Mods,
+		Code:     key.Code,
+		Shortcut: matched.Shortcut,
+	})
+	return true
+}
+
+func (sm *ShortcutManager) startKeySequence(candidates []*Keystroke) {
+	// 抓取键盘，避免后续按键被当前窗口收到
+	viaRecord := false
+	err := keybind.GrabKeyboard(sm.conn, sm.conn.GetDefaultScreen().Root)
+	if err != nil {
+		if sm.dataConn == nil {
+			logger.Warning("failed to start key sequence:", err)
+			return
+		}
+		logger.Debug("grab keyboard failed, read key sequence from record:", err)
+		viaRecord = true
+	}
+
+	p := &pendingKeySequence{
+		candidates: candidates,
+		viaRecord:  viaRecord,
+	}
+	p.timer = time.AfterFunc(keySequenceTimeout, func() {
+		sm.pendingSequenceMu.Lock()
+		defer sm.pendingSequenceMu.Unlock()
+		if sm.pendingSequence == p {
+			logger.Debug("key sequence timeout")
+			sm.stopKeySequence(p)
+		}
+	})
+
+	sm.pendingSequenceMu.Lock()
+	sm.pendingSequence = p
+	sm.pendingSequenceMu.Unlock()
+	logger.Debugf("key sequence start, candidates: %v, viaRecord: %v", candidates, viaRecord)
+}
+
+// stopKeySequence 调用前需要持有 pendingSequenceMu
+func (sm *ShortcutManager) stopKeySequence(p *pendingKeySequence) {
+	p.timer.Stop()
+	sm.pendingSequence = nil
+	if p.viaRecord {
+		return
+	}
+	err := keybind.UngrabKeyboard(sm.conn)
+	if err != nil {
+		logger.Warning("ungrabKeyboard Failed:", err)
+	}
+}
+
+func (sm *ShortcutManager) isKeyOfKeystroke(key Key, ks *Keystroke) bool {
+	keyList, err := ks.ToKeyList(sm.keySymbols)
+	if err != nil {
+		logger.Debug(err)
+		return false
+	}
+	for _, k := range keyList {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -21,6 +21,8 @@ type Keystroke struct {
 	Keystr   string
 	Keysym   x.Keysym
 	Shortcut Shortcut
+	// Sequence 多键序列中第一个按键之后的按键，例如 <Super>w, t 中的 t
+	Sequence []*Keystroke
 
 	isKeystrAboveTab bool
 }
@@ -35,6 +37,22 @@ func (ks *Keystroke) DebugString() string {
 }
 
 func (a *Keystroke) Equal(keySymbols *keysyms.KeySymbols, b *Keystroke) bool {
+	if len(a.Sequence) != len(b.Sequence) {
+		return false
+	}
+	if !a.equalStroke(keySymbols, b) {
+		return false
+	}
+	for i, next := range a.Sequence {
+		if !next.equalStroke(keySymbols, b.Sequence[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalStroke 只比较单个按键，不比较 Sequence
+func (a *Keystroke) equalStroke(keySymbols *keysyms.KeySymbols, b *Keystroke) bool {
 	logger.Debug(a, " equal? ", b)
 	if a.Mods != b.Mods {
 		logger.Debug("Mods no equal, return false")
@@ -212,7 +230,16 @@ func splitKeystroke(str string) ([]string, error) {
 // Print mods() key Print
 // <Control>Print mods(Control) key Print
 // check Keystroke.Keystr valid later
+//
+// <Super>w, t 为多键序列，见 parseKeySequence
 func ParseKeystroke(keystroke string) (*Keystroke, error) {
+	if strings.Contains(keystroke, keySequenceSep) {
+		return parseKeySequence(keystroke)
+	}
+	return parseSingleKeystroke(keystroke)
+}
+
+func parseSingleKeystroke(keystroke string) (*Keystroke, error) {
 	parts, err := splitKeystroke(keystroke)
 	if err != nil {
 		return nil, err
@@ -291,7 +318,11 @@ func (ks *Keystroke) String() string {
 	}
 
 	keys = append(keys, ks.Keystr)
-	return strings.Join(keys, "")
+	str := strings.Join(keys, "")
+	for _, next := range ks.Sequence {
+		str += keySequenceSep + " " + next.String()
+	}
+	return str
 }
 
 func (ks *Keystroke) searchString() string {
@@ -322,6 +353,9 @@ func (ks *Keystroke) searchString() string {
 		strs = append(strs, strings.ToLower(keyStr))
 	}
 
+	for _, next := range ks.Sequence {
+		strs = append(strs, next.searchString())
+	}
 	return strings.Join(strs, "")
 }
 
@@ -7,8 +7,10 @@ package shortcuts
 import (
 	"testing"
 
+	"github.com/linuxdeepin/go-lib/log"
 	"github.com/linuxdeepin/go-x11-client/util/keysyms"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSplitKeystroke(t *testing.T) {
@@ -189,3 +191,67 @@ func TestParseMediaKey(t *testing.T) {
 		assert.Equal(t, ks.String(), key)
 	}
 }
+
+func TestParseKeySequence(t *testing.T) {
+	ks, err := ParseKeystroke("<Super>w, t")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(keysyms.ModMaskSuper), uint16(ks.Mods))
+	assert.Equal(t, "w", ks.Keystr)
+	assert.Len(t, ks.Sequence, 1)
+	assert.Equal(t, "t", ks.Sequence[0].Keystr)
+	assert.Equal(t, "<Super>w, t", ks.String())
+
+	ks, err = ParseKeystroke("<control>x,<control>c")
+	assert.NoError(t, err)
+	assert.Equal(t, "<Control>x, <Control>c", ks.String())
+
+	_, err = ParseKeystroke("<Super>w, a, b, c, d")
+	assert.Equal(t, errKeySequenceTooLong, err)
+
+	_, err = ParseKeystroke("<Super>w, Super_L")
+	assert.Error(t, err)
+
+	_, err = ParseKeystroke("<Super>w, ")
+	assert.Error(t, err)
+
+	keystrokes := ParseKeystrokes([]string{"<Super>w, t", "<Super>S"})
+	assert.Len(t, keystrokes, 2)
+}
+
+func TestKeystrokeToKWinAccel(t *testing.T) {
+	for keystroke, accel := range map[string]string{
+		"<Super>w":                "<Super>w",
+		"<Super>w, t":             "Meta+W, T",
+		"<Control>x, <Control>c":  "Ctrl+X, Ctrl+C",
+		"<Control><Alt>Delete, 1": "Ctrl+Alt+Del, 1",
+		"<Shift><Super>F1, space": "Shift+Meta+F1, Space",
+		"<Super>w, Return, minus": "Meta+W, Return, -",
+	} {
+		ks, err := ParseKeystroke(keystroke)
+		require.NoError(t, err)
+		got, err := ks.ToKWinAccel()
+		assert.NoError(t, err)
+		assert.Equal(t, accel, got, keystroke)
+	}
+
+	ks, err := ParseKeystroke("<Super>w, comma")
+	require.NoError(t, err)
+	_, err = ks.ToKWinAccel()
+	assert.Error(t, err)
+}
+
+func TestIsKeySequencePrefix(t *testing.T) {
+	SetLogger(log.NewLogger("daemon/keybinding/shortcuts"))
+	a, err := ParseKeystroke("<Super>w, t")
+	assert.NoError(t, err)
+	b, err := ParseKeystroke("<Super>w, t, f")
+	assert.NoError(t, err)
+	single, err := ParseKeystroke("<Super>w")
+	assert.NoError(t, err)
+
+	assert.True(t, isKeySequencePrefix(nil, a, b))
+	assert.True(t, isKeySequencePrefix(nil, b, a))
+	assert.True(t, isKeySequencePrefix(nil, single, a))
+	assert.True(t, a.Equal(nil, a))
+	assert.False(t, a.Equal(nil, b))
+}
@@ -15,10 +15,11 @@ import (
 
 type kWinShortcut struct {
 	BaseShortcut
-	wm wm.Wm
+	wm                wm.Wm
+	defaultKeystrokes []*Keystroke
 }
 
-func newKWinShortcut(id, name string, keystrokes []string, wm wm.Wm) *kWinShortcut {
+func newKWinShortcut(id, name string, keystrokes, defaultKeystrokes []string, wm wm.Wm) *kWinShortcut {
 	return &kWinShortcut{
 		BaseShortcut: BaseShortcut{
 			Id:         id,
@@ -26,10 +27,15 @@ func newKWinShortcut(id, name string, keystrokes []string, wm wm.Wm) *kWinShortc
 			Name:       name,
 			Keystrokes: ParseKeystrokes(keystrokes),
 		},
-		wm: wm,
+		wm:                wm,
+		defaultKeystrokes: ParseKeystrokes(defaultKeystrokes),
 	}
 }
 
+func (ks *kWinShortcut) IsModified() bool {
+	return !keystrokesEqual(ks.GetKeystrokes(), ks.defaultKeystrokes)
+}
+
 func (ks *kWinShortcut) ReloadKeystrokes() bool {
 	oldVal := ks.GetKeystrokes()
 	keystrokes, err := ks.wm.GetAccel(0, ks.Id)
@@ -132,6 +132,15 @@ type Shortcut interface {
 	ShouldEmitSignalChanged() bool
 }
 
+// IsShortcutModified 快捷键的按键是否与默认值不同，自定义快捷键没有默认值，总是返回 true
+func IsShortcutModified(shortcut Shortcut) bool {
+	if shortcut.GetType() == ShortcutTypeCustom {
+		return true
+	}
+	m, ok := shortcut.(interface{ IsModified() bool })
+	return ok && m.IsModified()
+}
+
 // errors:
 var ErrOpNotSupported = errors.New("operation is not supported")
 var ErrTypeAssertionFail = errors.New("type assertion failed")
@@ -5,9 +5,11 @@
 package shortcuts
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +25,7 @@ import (
 	"github.com/linuxdeepin/go-lib/log"
 	"github.com/linuxdeepin/go-lib/strv"
 	dutils "github.com/linuxdeepin/go-lib/utils"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/record"
 	"github.com/linuxdeepin/go-x11-client/util/keybind"
@@ -111,6 +114,9 @@ func setUseWayland(value bool) {
 
 type KeyEventFunc func(ev *KeyEvent)
 
+// RecordKeyEventFunc 接收 XRecord 读取到的所有按键事件
+type RecordKeyEventFunc func(pressed bool, code uint8, state uint16)
+
 type ShortcutManager struct {
 	conn         *x.Conn
 	dataConn     *x.Conn // conn for receive record event
@@ -119,11 +125,15 @@ type ShortcutManager struct {
 	idShortcutMap     map[string]Shortcut
 	idShortcutMapMu   sync.Mutex
 	keyKeystrokeMap   map[Key]*Keystroke
+	keySequenceMap    map[Key][]*Keystroke // 多键序列按第一个按键索引，与 keyKeystrokeMap 共用锁
+	keyScopedMap      map[Key][]*Keystroke // 限定应用范围的快捷键，与 keyKeystrokeMap 共用锁
+	scopedGrabbedKeys map[Key]bool
 	keyKeystrokeMapMu sync.Mutex
 	keySymbols        *keysyms.KeySymbols
 
 	recordEnable        bool
 	recordEnableMu      sync.Mutex
+	recordKeyEventCb    RecordKeyEventFunc // 由 recordEnableMu 保护
 	recordContext       record.Context
 	xRecordEventHandler *XRecordEventHandler
 	eventCb             KeyEventFunc
@@ -131,6 +141,16 @@ type ShortcutManager struct {
 	layoutChanged       chan struct{}
 	pinyinEnabled       bool
 
+	pendingSequence   *pendingKeySequence
+	pendingSequenceMu sync.Mutex
+
+	usage *usageStats
+
+	// 以下字段由 keyKeystrokeMapMu 保护
+	atomNetActiveWindow x.Atom
+	activeWindow        x.Window
+	activeAppNames      []string
+
 	ConflictingKeystrokes []*Keystroke
 	EliminateConflictDone bool
 
@@ -141,6 +161,8 @@ type KeyEvent struct {
 	Mods     Modifiers
 	Code     Keycode
 	Shortcut Shortcut
+	// Remapped 为 true 表示由按键重映射触发，不是真实的按键
+	Remapped bool
 }
 
 func NewShortcutManager(conn *x.Conn, keySymbols *keysyms.KeySymbols, eventCb KeyEventFunc) *ShortcutManager {
@@ -152,9 +174,13 @@ func NewShortcutManager(conn *x.Conn, keySymbols *keysyms.KeySymbols, eventCb Ke
 		keySymbols:               keySymbols,
 		recordEnable:             true,
 		keyKeystrokeMap:          make(map[Key]*Keystroke),
+		keySequenceMap:           make(map[Key][]*Keystroke),
+		keyScopedMap:             make(map[Key][]*Keystroke),
+		scopedGrabbedKeys:        make(map[Key]bool),
 		layoutChanged:            make(chan struct{}),
 		pinyinEnabled:            isZH(),
 		WaylandCustomShortCutMap: make(map[string]string),
+		usage:                    newUsageStats(filepath.Join(basedir.GetUserConfigDir(), usageFile)),
 	}
 
 	ss.xRecordEventHandler = NewXRecordEventHandler(keySymbols)
@@ -166,11 +192,11 @@ func NewShortcutManager(conn *x.Conn, keySymbols *keysyms.KeySymbols, eventCb Ke
 			if isGrabbed {
 				return
 			}
-			ss.emitKeyEvent(0, Key{Code: Keycode(code)})
+			ss.emitRecordKeyEvent(Key{Code: Keycode(code)})
 
 		case keysyms.ModMaskNumLock:
 			// num_lock
-			ss.emitKeyEvent(0, Key{Code: Keycode(code)})
+			ss.emitRecordKeyEvent(Key{Code: Keycode(code)})
 
 		case keysyms.ModMaskControl | keysyms.ModMaskShift:
 			// ctrl-shift
@@ -187,15 +213,14 @@ func NewShortcutManager(conn *x.Conn, keySymbols *keysyms.KeySymbols, eventCb Ke
 			ss.emitFakeKeyEvent(&Action{Type: ActionTypeSwitchKbdLayout, Arg: SKLAltShift})
 		}
 	}
-	// init record
+	// init record，事件循环由 RecordEventLoop 启动
 	err := ss.initRecord()
-	if err == nil {
-		logger.Debug("start record event loop")
-		go ss.recordEventLoop()
-	} else {
+	if err != nil {
 		logger.Warning("init record failed: ", err)
 	}
 
+	ss.listenActiveWindow()
+
 	err = ss.initSysDaemon()
 	if err != nil {
 		logger.Warning("init system D-BUS failed: ", err)
@@ -204,7 +229,12 @@ func NewShortcutManager(conn *x.Conn, keySymbols *keysyms.KeySymbols, eventCb Ke
 	return ss
 }
 
-func (sm *ShortcutManager) recordEventLoop() {
+// RecordEventLoop 处理 XRecord 截获的事件，XRecord 不可用时直接返回
+func (sm *ShortcutManager) RecordEventLoop() {
+	if sm.dataConn == nil {
+		return
+	}
+	logger.Debug("start record event loop")
 	// enable context
 	cookie := record.EnableContext(sm.dataConn, sm.recordContext)
 
@@ -306,6 +336,18 @@ func (sm *ShortcutManager) EnableRecord(val bool) {
 	sm.recordEnableMu.Unlock()
 }
 
+// SetRecordKeyEventCallback 设置接收所有按键事件的回调函数，用于录制按键宏，cb 为 nil 时取消。
+// 没有可用的 XRecord 时返回错误。
+func (sm *ShortcutManager) SetRecordKeyEventCallback(cb RecordKeyEventFunc) error {
+	if cb != nil && sm.dataConn == nil {
+		return errors.New("record is not available")
+	}
+	sm.recordEnableMu.Lock()
+	sm.recordKeyEventCb = cb
+	sm.recordEnableMu.Unlock()
+	return nil
+}
+
 func (sm *ShortcutManager) isRecordEnabled() bool {
 	sm.recordEnableMu.Lock()
 	ret := sm.recordEnable
@@ -318,7 +360,15 @@ func (sm *ShortcutManager) NotifyLayoutChanged() {
 }
 
 func (sm *ShortcutManager) Destroy() {
-	// TODO
+	err := sm.usage.flush()
+	if err != nil {
+		logger.Warning("failed to save shortcut usage:", err)
+	}
+
+	// 关闭数据连接后 RecordEventLoop 退出
+	if sm.dataConn != nil {
+		sm.dataConn.Close()
+	}
 }
 
 func (sm *ShortcutManager) List() (list []Shortcut) {
@@ -387,6 +437,14 @@ func (sm *ShortcutManager) storeConflictingKeystroke(ks *Keystroke) {
 }
 
 func (sm *ShortcutManager) grabKeystroke(shortcut Shortcut, ks *Keystroke, dummy bool) {
+	if len(GetAppScope(shortcut)) > 0 && !ks.isKeySequence() {
+		sm.grabScopedKeystroke(shortcut, ks)
+		return
+	}
+	if ks.isKeySequence() {
+		sm.grabKeySequence(shortcut, ks, dummy)
+		return
+	}
 	keyList, err := ks.ToKeyList(sm.keySymbols)
 	if err != nil {
 		logger.Debugf("grabKeystroke failed, shortcut: %v, ks: %v, err: %v", shortcut.GetId(), ks, err)
@@ -398,6 +456,7 @@ func (sm *ShortcutManager) grabKeystroke(shortcut Shortcut, ks *Keystroke, dummy
 	for i, key := range keyList {
 		sm.keyKeystrokeMapMu.Lock()
 		conflictKeystroke, ok := sm.keyKeystrokeMap[key]
+		_, isSequenceKey := sm.keySequenceMap[key]
 		sm.keyKeystrokeMapMu.Unlock()
 
 		logger.Debugf("grabKeystroke shortcut: %s, ks: %s, key: %s, dummy: %v", shortcut.GetId(), ks, key, dummy)
@@ -412,6 +471,11 @@ func (sm *ShortcutManager) grabKeystroke(shortcut Shortcut, ks *Keystroke, dummy
 			}
 			continue
 		}
+		if isSequenceKey {
+			conflictCount++
+			logger.Debugf("key %v is grabbed by key sequence", key)
+			continue
+		}
 
 		// no conflict
 		if !dummy {
@@ -425,6 +489,8 @@ func (sm *ShortcutManager) grabKeystroke(shortcut Shortcut, ks *Keystroke, dummy
 		}
 		sm.keyKeystrokeMapMu.Lock()
 		sm.keyKeystrokeMap[key] = ks
+		// 重复抓取时替换了之前的抓取，之后由全局快捷键负责
+		delete(sm.scopedGrabbedKeys, key)
 		sm.keyKeystrokeMapMu.Unlock()
 	}
 
@@ -441,7 +507,15 @@ func (sm *ShortcutManager) grabKeystroke(shortcut Shortcut, ks *Keystroke, dummy
 	}
 }
 
-func (sm *ShortcutManager) ungrabKeystroke(ks *Keystroke, dummy bool) {
+func (sm *ShortcutManager) ungrabKeystroke(shortcut Shortcut, ks *Keystroke, dummy bool) {
+	if len(GetAppScope(shortcut)) > 0 && !ks.isKeySequence() {
+		sm.ungrabScopedKeystroke(shortcut, ks)
+		return
+	}
+	if ks.isKeySequence() {
+		sm.ungrabKeySequence(ks, dummy)
+		return
+	}
 	keyList, err := ks.ToKeyList(sm.keySymbols)
 	if err != nil {
 		logger.Debug(err)
@@ -459,6 +533,8 @@ func (sm *ShortcutManager) ungrabKeystroke(ks *Keystroke, dummy bool) {
 			key.Ungrab(sm.conn)
 		}
 	}
+	// 按键可能还被限定范围的快捷键使用
+	sm.updateScopedGrabs()
 }
 
 func (sm *ShortcutManager) grabShortcut(shortcut Shortcut) {
@@ -477,7 +553,7 @@ func (sm *ShortcutManager) ungrabShortcut(shortcut Shortcut) {
 
 	for _, ks := range shortcut.GetKeystrokes() {
 		dummy := dummyGrab(shortcut, ks)
-		sm.ungrabKeystroke(ks, dummy)
+		sm.ungrabKeystroke(shortcut, ks, dummy)
 		ks.Shortcut = nil
 	}
 }
@@ -525,7 +601,7 @@ func (sm *ShortcutManager) DeleteShortcutKeystroke(shortcut Shortcut, ks *Keystr
 
 	// ungrab keystroke
 	dummy := dummyGrab(shortcut, ks)
-	sm.ungrabKeystroke(ks, dummy)
+	sm.ungrabKeystroke(shortcut, ks, dummy)
 	ks.Shortcut = nil
 }
 
@@ -550,9 +626,21 @@ func (sm *ShortcutManager) UngrabAll() {
 			key.Ungrab(sm.conn)
 		}
 	}
+	for key, list := range sm.keySequenceMap {
+		dummy := dummyGrab(list[0].Shortcut, list[0])
+		if !dummy {
+			key.Ungrab(sm.conn)
+		}
+	}
+	for key := range sm.scopedGrabbedKeys {
+		key.Ungrab(sm.conn)
+	}
 	// new map
 	count := len(sm.keyKeystrokeMap)
 	sm.keyKeystrokeMap = make(map[Key]*Keystroke, count)
+	sm.keySequenceMap = make(map[Key][]*Keystroke, len(sm.keySequenceMap))
+	sm.keyScopedMap = make(map[Key][]*Keystroke, len(sm.keyScopedMap))
+	sm.scopedGrabbedKeys = make(map[Key]bool)
 	sm.keyKeystrokeMapMu.Unlock()
 }
 
@@ -618,6 +706,8 @@ func combineStateCode2Key(state uint16, code uint8) Key {
 }
 
 func (sm *ShortcutManager) callEventCallback(ev *KeyEvent) {
+	// 所有按键触发的快捷键都经过这里，在此统计使用次数
+	sm.recordUsage(ev.Shortcut)
 	sm.eventCbMu.Lock()
 	sm.eventCb(ev)
 	sm.eventCbMu.Unlock()
@@ -629,6 +719,9 @@ func (sm *ShortcutManager) handleKeyEvent(pressed bool, detail x.Keycode, state
 
 	if pressed {
 		// key press
+		if sm.handleKeySequenceEvent(key, false) {
+			return
+		}
 		sm.emitKeyEvent(Modifiers(state), key)
 	}
 }
@@ -640,11 +733,29 @@ func (sm *ShortcutManager) emitFakeKeyEvent(action *Action) {
 	sm.callEventCallback(keyEvent)
 }
 
+// findKeystroke 调用前需要持有 keyKeystrokeMapMu
+func (sm *ShortcutManager) findKeystroke(key Key) *Keystroke {
+	// 在激活的应用中覆盖全局快捷键
+	if scoped := sm.findScopedKeystroke(key); scoped != nil {
+		return scoped
+	}
+	return sm.keyKeystrokeMap[key]
+}
+
 func (sm *ShortcutManager) emitKeyEvent(mods Modifiers, key Key) {
 	sm.keyKeystrokeMapMu.Lock()
-	keystroke, ok := sm.keyKeystrokeMap[key]
+	keystroke := sm.findKeystroke(key)
 	sm.keyKeystrokeMapMu.Unlock()
-	if ok {
+	sm.emitKeystrokeEvent(mods, key, keystroke)
+}
+
+// emitRecordKeyEvent 触发 XRecord 截获的单独修饰键对应的快捷键
+func (sm *ShortcutManager) emitRecordKeyEvent(key Key) {
+	sm.emitKeystrokeEvent(0, key, sm.findRecordKeystroke(key))
+}
+
+func (sm *ShortcutManager) emitKeystrokeEvent(mods Modifiers, key Key, keystroke *Keystroke) {
+	if keystroke != nil {
 		logger.Debugf("emitKeyEvent keystroke: %#v", keystroke)
 		keyEvent := &KeyEvent{
 			Mods:     mods,
@@ -760,15 +871,25 @@ func (sm *ShortcutManager) getActiveWindowCmd() string {
 }
 
 func (sm *ShortcutManager) handleXRecordKeyEvent(pressed bool, code uint8, state uint16) {
+	sm.recordEnableMu.Lock()
+	recordKeyEventCb := sm.recordKeyEventCb
+	sm.recordEnableMu.Unlock()
+	if recordKeyEventCb != nil {
+		recordKeyEventCb(pressed, code, state)
+	}
+
 	sm.xRecordEventHandler.handleKeyEvent(pressed, code, state)
 
 	if pressed {
-		// Special handling screenshot* shortcuts
 		key := combineStateCode2Key(state, code)
-		sm.keyKeystrokeMapMu.Lock()
-		keystroke, ok := sm.keyKeystrokeMap[key]
-		sm.keyKeystrokeMapMu.Unlock()
-		if ok {
+		if sm.handleKeySequenceEvent(key, true) {
+			return
+		}
+
+		// Special handling screenshot* shortcuts
+		// 在激活的应用中被限定范围的快捷键覆盖时不再按全局快捷键处理
+		keystroke := sm.findRecordKeystroke(key)
+		if keystroke != nil {
 			shortcut := keystroke.Shortcut
 			if shortcut != nil && shortcut.GetType() == ShortcutTypeSystem &&
 				(strings.HasPrefix(shortcut.GetId(), "screenshot") ||
@@ -813,6 +934,9 @@ func (sm *ShortcutManager) EventLoop() {
 			event, _ := x.NewKeyReleaseEvent(ev)
 			logger.Debug(event)
 			sm.handleKeyEvent(false, event.Detail, event.State)
+		case x.PropertyNotifyEventCode:
+			event, _ := x.NewPropertyNotifyEvent(ev)
+			sm.handlePropertyNotifyEvent(event)
 		case x.MappingNotifyEventCode:
 			event, _ := x.NewMappingNotifyEvent(ev)
 			logger.Debug(event)
@@ -917,6 +1041,15 @@ func (sm *ShortcutManager) FindConflictingKeystroke(ks *Keystroke) (*Keystroke,
 	if count == len(keyList) {
 		return ks1, nil
 	}
+
+	// 第一个按键相同时，单个按键与多键序列冲突，多键序列之间有一个是另一个的前缀时冲突
+	for _, key := range keyList {
+		for _, seq := range sm.keySequenceMap[key] {
+			if isKeySequencePrefix(sm.keySymbols, ks, seq) {
+				return seq, nil
+			}
+		}
+	}
 	return nil, nil
 }
 
@@ -1140,7 +1273,10 @@ func setShortForWayland(shortcut Shortcut, wmObj wm.Wm) (bool, error) {
 	if isCustom {
 		id += "-cs"
 	}
-	keystrokesStrv := shortcut.getKeystrokesStrv()
+	keystrokesStrv, err := getKWinAccels(shortcut.GetKeystrokes())
+	if err != nil {
+		return false, err
+	}
 	logger.Debugf("Id: %+v, keystrokesStrv: %+v", id, keystrokesStrv)
 	accelJson, err := util.MarshalJSON(util.KWinAccel{
 		Id:         id,
@@ -1210,7 +1346,7 @@ func (sm *ShortcutManager) AddKWin(wmObj wm.Wm) {
 			name = accel.Id
 		}
 
-		ks := newKWinShortcut(accel.Id, name, accel.Keystrokes, wmObj)
+		ks := newKWinShortcut(accel.Id, name, accel.Keystrokes, accel.DefaultKeystrokes, wmObj)
 		sm.addWithoutLock(ks)
 	}
 }
@@ -1264,7 +1400,7 @@ func (sm *ShortcutManager) AddKWinForWayland(wmObj wm.Wm) {
 				keystrokes[i] = strings.Replace(keystrokes[i], "Esc", "Escape", 1)
 			}
 		}
-		ks := newKWinShortcut(accel.Id, name, keystrokes, wmObj)
+		ks := newKWinShortcut(accel.Id, name, keystrokes, accel.DefaultKeystrokes, wmObj)
 		sm.addWithoutLock(ks)
 	}
 }
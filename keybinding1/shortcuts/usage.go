@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package shortcuts
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 统计每个快捷键的触发次数，按 uid 保存，供控制中心找出从未使用的快捷键。
+// 只统计由本程序抓取按键触发的快捷键，Wayland 下由 KWin 处理的快捷键不会统计。
+
+const (
+	usageFile = "deepin/dde-daemon/keybinding/usage.json"
+	// 触发快捷键后延迟保存，避免每次按键都写文件
+	usageSaveDelay = 30 * time.Second
+)
+
+type ShortcutUsage struct {
+	Count    uint64
+	LastUsed int64 // unix 时间，单位秒，0 表示从未使用
+}
+
+type usageStats struct {
+	file      string
+	mu        sync.Mutex
+	m         map[string]*ShortcutUsage
+	saveTimer *time.Timer
+}
+
+func newUsageStats(file string) *usageStats {
+	us := &usageStats{
+		file: file,
+		m:    make(map[string]*ShortcutUsage),
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return us
+	}
+	err = json.Unmarshal(data, &us.m)
+	if err != nil {
+		logger.Warning("failed to load shortcut usage:", err)
+		us.m = make(map[string]*ShortcutUsage)
+	}
+	return us
+}
+
+func (us *usageStats) record(uid string, t time.Time) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	usage := us.m[uid]
+	if usage == nil {
+		usage = &ShortcutUsage{}
+		us.m[uid] = usage
+	}
+	usage.Count++
+	usage.LastUsed = t.Unix()
+	us.saveLater()
+}
+
+func (us *usageStats) get(uid string) ShortcutUsage {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if usage := us.m[uid]; usage != nil {
+		return *usage
+	}
+	return ShortcutUsage{}
+}
+
+// reset uid 为空时清空所有统计
+func (us *usageStats) reset(uid string) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if uid == "" {
+		us.m = make(map[string]*ShortcutUsage)
+	} else if _, ok := us.m[uid]; ok {
+		delete(us.m, uid)
+	} else {
+		return
+	}
+	us.saveLater()
+}
+
+// saveLater 调用前需要持有 mu
+func (us *usageStats) saveLater() {
+	if us.saveTimer != nil {
+		return
+	}
+	us.saveTimer = time.AfterFunc(usageSaveDelay, func() {
+		err := us.save()
+		if err != nil {
+			logger.Warning("failed to save shortcut usage:", err)
+		}
+	})
+}
+
+func (us *usageStats) save() error {
+	us.mu.Lock()
+	if us.saveTimer != nil {
+		us.saveTimer.Stop()
+		us.saveTimer = nil
+	}
+	data, err := json.Marshal(us.m)
+	us.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// #nosec G301
+	err = os.MkdirAll(filepath.Dir(us.file), 0755)
+	if err != nil {
+		return err
+	}
+	tmpFile := us.file + ".tmp"
+	// #nosec G306
+	err = os.WriteFile(tmpFile, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, us.file)
+}
+
+// flush 有未保存的统计时立即保存
+func (us *usageStats) flush() error {
+	us.mu.Lock()
+	pending := us.saveTimer != nil
+	us.mu.Unlock()
+	if !pending {
+		return nil
+	}
+	return us.save()
+}
+
+type ShortcutUsageInfo struct {
+	Id     string
+	Type   int32
+	Name   string
+	Accels []string
+	ShortcutUsage
+}
+
+func (sm *ShortcutManager) recordUsage(shortcut Shortcut) {
+	if shortcut == nil || shortcut.GetType() == ShortcutTypeFake {
+		return
+	}
+	sm.usage.record(shortcut.GetUid(), time.Now())
+}
+
+// GetUsage 返回所有快捷键的使用统计，包括从未使用的快捷键，按使用次数从少到多排序
+func (sm *ShortcutManager) GetUsage() []*ShortcutUsageInfo {
+	var result []*ShortcutUsageInfo
+	for _, shortcut := range sm.List() {
+		result = append(result, &ShortcutUsageInfo{
+			Id:            shortcut.GetId(),
+			Type:          shortcut.GetType(),
+			Name:          shortcut.GetName(),
+			Accels:        shortcut.getKeystrokesStrv(),
+			ShortcutUsage: sm.usage.get(shortcut.GetUid()),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Count != b.Count {
+			return a.Count < b.Count
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Id < b.Id
+	})
+	return result
+}
+
+// ResetUsage 清空快捷键的使用统计，shortcut 为 nil 时清空所有快捷键的统计
+func (sm *ShortcutManager) ResetUsage(shortcut Shortcut) {
+	if shortcut == nil {
+		sm.usage.reset("")
+		return
+	}
+	sm.usage.reset(shortcut.GetUid())
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package shortcuts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageStats(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keybinding", "usage.json")
+	us := newUsageStats(file)
+	assert.Equal(t, ShortcutUsage{}, us.get("0terminal"))
+
+	t1 := time.Unix(1700000000, 0)
+	us.record("0terminal", t1)
+	us.record("0terminal", t1.Add(time.Minute))
+	us.record("1launcher", t1)
+	assert.Equal(t, ShortcutUsage{Count: 2, LastUsed: t1.Unix() + 60}, us.get("0terminal"))
+
+	require.NoError(t, us.flush())
+	us = newUsageStats(file)
+	assert.Equal(t, ShortcutUsage{Count: 2, LastUsed: t1.Unix() + 60}, us.get("0terminal"))
+	assert.Equal(t, uint64(1), us.get("1launcher").Count)
+
+	us.reset("0terminal")
+	assert.Equal(t, ShortcutUsage{}, us.get("0terminal"))
+	assert.Equal(t, uint64(1), us.get("1launcher").Count)
+	us.reset("")
+	assert.Equal(t, ShortcutUsage{}, us.get("1launcher"))
+
+	require.NoError(t, us.flush())
+	us = newUsageStats(file)
+	assert.Empty(t, us.m)
+}
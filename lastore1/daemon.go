@@ -107,7 +107,7 @@ func (d *Daemon) Start() error {
 			return err
 		}
 		d.lastore = lastoreObj
-		err = service.Export(dbusPath, lastoreObj, lastoreObj.syncConfig)
+		err = d.Export(dbusPath, lastoreObj, lastoreObj.syncConfig)
 		if err != nil {
 			logger.Warning(err)
 			return err
@@ -5,6 +5,7 @@
 package launcher
 
 import (
+	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/log"
 	"github.com/linuxdeepin/dde-daemon/loader"
 )
@@ -31,7 +32,7 @@ func (d *Module) GetDependencies() []string {
 }
 
 func (d *Module) start() error {
-	service := loader.GetService()
+	service := loader.GetModuleService(d.Name())
 
 	var err error
 	d.manager, err = NewManager(service)
@@ -39,7 +40,7 @@ func (d *Module) start() error {
 		return err
 	}
 
-	err = service.Export(dbusObjPath, d.manager, d.manager.syncConfig)
+	err = d.Export(dbusObjPath, d.manager, d.manager.syncConfig)
 	if err != nil {
 		return err
 	}
@@ -56,6 +57,23 @@ func (d *Module) start() error {
 	return nil
 }
 
+// GetLazyActivation 启动器在第一次被调用时才加载应用列表。
+// 启动后不再因空闲而停止：启动器前端缓存了应用列表，依赖 ItemChanged 等信号更新，
+// 占位对象无法发出这些信号。
+func (d *Module) GetLazyActivation() *loader.LazyActivation {
+	return &loader.LazyActivation{
+		ServiceName: dbusServiceName,
+		Path:        dbusObjPath,
+		Prototype:   &Manager{},
+		Object: func() dbusutil.ImplementerExt {
+			if d.manager == nil {
+				return nil
+			}
+			return d.manager
+		},
+	}
+}
+
 func (d *Module) Start() error {
 	return d.start()
 }
@@ -65,7 +83,7 @@ func (d *Module) Stop() error {
 		return nil
 	}
 
-	service := loader.GetService()
+	service := loader.GetModuleService(d.Name())
 	err := service.ReleaseName(dbusServiceName)
 	if err != nil {
 		logger.Warning(err)
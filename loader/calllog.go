@@ -0,0 +1,332 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	ConfigManager "github.com/linuxdeepin/go-dbus-factory/org.desktopspec.ConfigManager"
+	"github.com/linuxdeepin/go-lib/log"
+)
+
+const (
+	dsettingsKeyLogFormat = "logFormat"
+
+	// LogFormatText 默认格式，不记录导出方法的调用，模块日志为普通文本
+	LogFormatText = "text"
+	// LogFormatJSON 每次调用导出方法时向标准错误输出一行 JSON，模块日志保持原样
+	LogFormatJSON = "json"
+	// LogFormatJournald 导出方法的调用以 journald 原生字段写入日志，模块日志只经由 syslog 写入 journald
+	LogFormatJournald = "journald"
+
+	journalSocket    = "/run/systemd/journal/socket"
+	callLogQueueSize = 256
+)
+
+// CallRecord 一次导出方法调用的结构化日志
+type CallRecord struct {
+	Time      time.Time `json:"time"`
+	Module    string    `json:"module,omitempty"`
+	Sender    string    `json:"sender"`
+	Path      string    `json:"path"`
+	Interface string    `json:"interface,omitempty"`
+	Method    string    `json:"method"`
+}
+
+type callLogger struct {
+	mu      sync.Mutex
+	format  string
+	monitor *dbus.Conn
+	journal net.Conn
+	out     io.Writer
+
+	pathModules map[dbus.ObjectPath]string // 模块通过 ModuleBase.Export 导出的路径 -> 模块名
+
+	logMode string                 // 模块日志当前的输出格式，无法连接 journald 时为 json
+	loggers map[*log.Logger]string // 模块的日志对象 -> 模块名
+}
+
+func (l *Loader) getCallLogger() *callLogger {
+	l.callLogOnce.Do(func() {
+		l.callLog = &callLogger{
+			format:      LogFormatText,
+			logMode:     LogFormatText,
+			out:         os.Stderr,
+			pathModules: make(map[dbus.ObjectPath]string),
+			loggers:     make(map[*log.Logger]string),
+		}
+	})
+	return l.callLog
+}
+
+// SetLogFormat 设置导出方法调用日志和模块日志的格式，text 表示不记录调用，模块日志保持原样
+func (l *Loader) SetLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText:
+		format = LogFormatText
+	case LogFormatJSON, LogFormatJournald:
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	c := l.getCallLogger()
+	c.mu.Lock()
+	changed, journalErr, err := l.setLogFormatLocked(c, format)
+	c.mu.Unlock()
+
+	// 日志不在持有 c.mu 时输出
+	if journalErr != nil {
+		l.log.Warning("connect journald failed, fallback to json:", journalErr)
+	}
+	if changed {
+		l.log.Info("set log format", format)
+	}
+	return err
+}
+
+// setLogFormatLocked 返回格式是否改变，以及连接 journald 失败的错误。
+// 调用者需要持有 c.mu。
+func (l *Loader) setLogFormatLocked(c *callLogger, format string) (changed bool, journalErr, err error) {
+	if c.format == format {
+		return false, nil, nil
+	}
+	oldFormat := c.format
+	c.format = format
+
+	if c.journal != nil && format != LogFormatJournald {
+		_ = c.journal.Close()
+		c.journal = nil
+	}
+	if format == LogFormatText {
+		if c.monitor != nil {
+			_ = c.monitor.Close()
+			c.monitor = nil
+		}
+		l.switchModuleLogs(c)
+		return true, nil, nil
+	}
+	if format == LogFormatJournald && c.journal == nil {
+		c.journal, journalErr = net.Dial("unixgram", journalSocket)
+	}
+	if c.monitor == nil {
+		monitor, err := l.startCallMonitor()
+		if err != nil {
+			c.format = oldFormat
+			return false, journalErr, err
+		}
+		c.monitor = monitor
+	}
+	l.switchModuleLogs(c)
+	return true, journalErr, nil
+}
+
+// watchLogFormat 读取 org.deepin.dde.daemon.logger 配置中的 logFormat，并监听其变化
+func (l *Loader) watchLogFormat(dsManager ConfigManager.Manager) {
+	load := func() {
+		format := LogFormatText
+		if v, err := dsManager.Value(0, dsettingsKeyEnabled); err != nil {
+			l.log.Warning(err)
+			return
+		} else if enabled, _ := v.Value().(bool); enabled {
+			v, err := dsManager.Value(0, dsettingsKeyLogFormat)
+			if err != nil {
+				l.log.Warning(err)
+				return
+			}
+			format, _ = v.Value().(string)
+		}
+		err := l.SetLogFormat(format)
+		if err != nil {
+			l.log.Warning(err)
+		}
+	}
+	load()
+
+	dsManager.ConnectValueChanged(func(key string) {
+		if key == dsettingsKeyLogFormat || key == dsettingsKeyEnabled {
+			load()
+		}
+	})
+}
+
+// startCallMonitor 使用独立连接监视发往本进程主连接的方法调用，不影响调用的处理。
+// 按需启动的模块使用各自的独立连接，其调用在连接的拦截器中记录。
+func (l *Loader) startCallMonitor() (*dbus.Conn, error) {
+	if l.service == nil {
+		return nil, errors.New("service is not set")
+	}
+	// destination 匹配的是接收者的唯一名，发往本进程服务名的调用也能匹配
+	rule := fmt.Sprintf("type='method_call',destination='%s'", uniqueName(l.service.Conn()))
+
+	conn, err := l.newPrivateConn()
+	if err != nil {
+		return nil, err
+	}
+
+	// 成为 monitor 后连接不能再发送消息，所有消息都交给 ch 处理，也不等待 BecomeMonitor 的回复
+	ch := make(chan *dbus.Message, callLogQueueSize)
+	conn.Eavesdrop(ch)
+	call := conn.BusObject().Call("org.freedesktop.DBus.Monitoring.BecomeMonitor", dbus.FlagNoReplyExpected,
+		[]string{rule}, uint32(0))
+	if call.Err != nil {
+		_ = conn.Close()
+		return nil, call.Err
+	}
+
+	go func() {
+		for msg := range ch {
+			record, ok := newCallRecord(msg)
+			if !ok {
+				continue
+			}
+			record.Module = l.getPathModule(dbus.ObjectPath(record.Path))
+			l.writeCallRecord(record)
+		}
+	}()
+	return conn, nil
+}
+
+// newCallRecord 从方法调用消息生成调用日志，不是方法调用时返回 false
+func newCallRecord(msg *dbus.Message) (*CallRecord, bool) {
+	if msg.Type != dbus.TypeMethodCall {
+		return nil, false
+	}
+	var sender, ifc, member string
+	var path dbus.ObjectPath
+	_ = msg.Headers[dbus.FieldSender].Store(&sender)
+	_ = msg.Headers[dbus.FieldPath].Store(&path)
+	_ = msg.Headers[dbus.FieldMember].Store(&member)
+	if v, ok := msg.Headers[dbus.FieldInterface]; ok {
+		_ = v.Store(&ifc)
+	}
+	return &CallRecord{
+		Time:      time.Now(),
+		Sender:    sender,
+		Path:      string(path),
+		Interface: ifc,
+		Method:    member,
+	}, true
+}
+
+// logLazyCall 记录发往按需启动模块独立连接的调用，在连接的拦截器中调用
+func (l *Loader) logLazyCall(name string, msg *dbus.Message) {
+	c := l.getCallLogger()
+	c.mu.Lock()
+	format := c.format
+	c.mu.Unlock()
+	if format == LogFormatText {
+		return
+	}
+	record, ok := newCallRecord(msg)
+	if !ok {
+		return
+	}
+	record.Module = name
+	l.writeCallRecord(record)
+}
+
+// registerPath 记录模块导出的对象路径，子路径上的对象也归属于该模块
+func (l *Loader) registerPath(path dbus.ObjectPath, module string) {
+	c := l.getCallLogger()
+	c.mu.Lock()
+	c.pathModules[path] = module
+	c.mu.Unlock()
+}
+
+// getPathModule 返回导出该路径或其最近的父路径的模块，找不到时返回空字符串
+func (l *Loader) getPathModule(path dbus.ObjectPath) string {
+	c := l.getCallLogger()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return findPathModule(path, c.pathModules)
+}
+
+func findPathModule(path dbus.ObjectPath, pathModules map[dbus.ObjectPath]string) string {
+	p := string(path)
+	for {
+		if module, ok := pathModules[dbus.ObjectPath(p)]; ok {
+			return module
+		}
+		idx := strings.LastIndexByte(p, '/')
+		if idx <= 0 {
+			return ""
+		}
+		p = p[:idx]
+	}
+}
+
+func uniqueName(conn *dbus.Conn) string {
+	names := conn.Names()
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+func (l *Loader) writeCallRecord(record *CallRecord) {
+	c := l.getCallLogger()
+	c.mu.Lock()
+	var err error
+	switch {
+	case c.format == LogFormatText:
+	case c.format == LogFormatJournald && c.journal != nil:
+		_, err = c.journal.Write(formatJournalRecord(record))
+	default:
+		var data []byte
+		data, err = json.Marshal(record)
+		if err == nil {
+			_, err = c.out.Write(append(data, '\n'))
+		}
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		l.log.Debug("write call record failed:", err)
+	}
+}
+
+// formatJournalRecord 按 journald 原生协议编码调用日志
+func formatJournalRecord(record *CallRecord) []byte {
+	var buf bytes.Buffer
+	method := record.Method
+	if record.Interface != "" {
+		method = record.Interface + "." + record.Method
+	}
+	writeJournalField(&buf, "MESSAGE", fmt.Sprintf("%s call %s %s", record.Sender, record.Path, method))
+	writeJournalField(&buf, "PRIORITY", "6")
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", syslogIdentifier())
+	writeJournalField(&buf, "DDE_MODULE", record.Module)
+	writeJournalField(&buf, "DBUS_SENDER", record.Sender)
+	writeJournalField(&buf, "DBUS_PATH", record.Path)
+	writeJournalField(&buf, "DBUS_INTERFACE", record.Interface)
+	writeJournalField(&buf, "DBUS_METHOD", record.Method)
+	return buf.Bytes()
+}
+
+// writeJournalField 字段值中的换行符替换为空格，因此都使用 KEY=VALUE 的简单格式
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if value == "" {
+		return
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	buf.WriteString(strings.ReplaceAll(value, "\n", " "))
+	buf.WriteByte('\n')
+}
+
+func syslogIdentifier() string {
+	return filepath.Base(os.Args[0])
+}
@@ -0,0 +1,291 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/linuxdeepin/dde-daemon/graph"
+)
+
+// ModuleInfo 模块运行时状态，用于 D-Bus 接口导出
+type ModuleInfo struct {
+	Name         string
+	Enabled      bool
+	Lazy         bool
+	Failed       bool
+	RestartCount int
+	Dependencies []string
+	Dependents   []string
+}
+
+// buildFullDAG 根据所有已注册模块构建依赖图，边的方向为 依赖 -> 被依赖者。
+// 未注册的依赖会被忽略，与启动时 EnableFlagIgnoreMissingModule 的行为一致。
+// 调用者需要持有 l.lock。
+func (l *Loader) buildFullDAG() *graph.Data {
+	dag := graph.New()
+	for name := range l.modules {
+		dag.AddNode(graph.NewNode(name))
+	}
+	for name, module := range l.modules {
+		for _, dependency := range module.GetDependencies() {
+			depNode := dag.GetNodeByID(dependency)
+			if depNode == nil {
+				l.log.Debugf("dependency %s of module %s is not registered", dependency, name)
+				continue
+			}
+			dag.UpdateEdgeWeight(depNode, dag.GetNodeByID(name), 0)
+		}
+	}
+	return dag
+}
+
+// sortedNodes 返回拓扑排序后的节点，依赖排在被依赖者前面
+func sortedNodes(dag *graph.Data) (graph.Nodes, error) {
+	nodes, ok := dag.TopologicalDag()
+	if !ok {
+		return nil, &EnableError{Code: ErrorCircleDependencies}
+	}
+	return nodes, nil
+}
+
+// collectDependents 返回直接或间接依赖 name 的模块集合（不包含 name 本身）
+func collectDependents(dag *graph.Data, name string) map[string]struct{} {
+	result := make(map[string]struct{})
+	node := dag.GetNodeByID(name)
+	if node == nil {
+		return result
+	}
+	queue := []*graph.Node{node}
+	for len(queue) != 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for to := range n.WeightTo {
+			if _, ok := result[to.ID]; ok {
+				continue
+			}
+			result[to.ID] = struct{}{}
+			queue = append(queue, to)
+		}
+	}
+	return result
+}
+
+// collectDependencies 返回 name 直接或间接依赖的模块集合（不包含 name 本身）
+func collectDependencies(dag *graph.Data, name string) map[string]struct{} {
+	result := make(map[string]struct{})
+	node := dag.GetNodeByID(name)
+	if node == nil {
+		return result
+	}
+	queue := []*graph.Node{node}
+	for len(queue) != 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for from := range n.WeightFrom {
+			if _, ok := result[from.ID]; ok {
+				continue
+			}
+			result[from.ID] = struct{}{}
+			queue = append(queue, from)
+		}
+	}
+	return result
+}
+
+func (l *Loader) ListModuleInfos() []ModuleInfo {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	dag := l.buildFullDAG()
+	infos := make([]ModuleInfo, 0, len(l.modules))
+	for name, module := range l.modules {
+		info := ModuleInfo{
+			Name:         name,
+			Enabled:      module.IsEnable(),
+			Lazy:         l.getLazyModule(name) != nil,
+			Failed:       module.IsFailed(),
+			RestartCount: l.GetRestartCount(name),
+			Dependencies: module.GetDependencies(),
+		}
+		for dependent := range dag.GetNodeByID(name).WeightTo {
+			info.Dependents = append(info.Dependents, dependent.ID)
+		}
+		sort.Strings(info.Dependents)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// StartModule 启动模块，未启动的依赖会按拓扑顺序先行启动
+func (l *Loader) StartModule(name string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.modules[name]; !ok {
+		return &EnableError{ModuleName: name, Code: ErrorMissingModule}
+	}
+	l.resetRestartCount(name)
+	return l.startModuleWithDependencies(name)
+}
+
+// startModuleWithDependencies 调用者需要持有 l.lock
+func (l *Loader) startModuleWithDependencies(name string) error {
+	dag := l.buildFullDAG()
+	nodes, err := sortedNodes(dag)
+	if err != nil {
+		return err
+	}
+
+	dependencies := collectDependencies(dag, name)
+	dependencies[name] = struct{}{}
+	var names []string
+	for _, node := range nodes {
+		if _, ok := dependencies[node.ID]; ok {
+			names = append(names, node.ID)
+		}
+	}
+	return l.startModules(names)
+}
+
+// StopModule 停止模块，依赖它的模块会按逆拓扑顺序先行停止
+func (l *Loader) StopModule(name string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, err := l.stopModuleWithDependents(name)
+	if lm := l.getLazyModule(name); lm != nil {
+		// 显式停止时不再占位等待激活
+		l.closeLazyService(lm)
+	}
+	return err
+}
+
+// RestartModule 重启模块，依赖它的模块会先按逆拓扑顺序停止，再按拓扑顺序重新启动
+func (l *Loader) RestartModule(name string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	stopped, err := l.stopModuleWithDependents(name)
+	if err != nil {
+		return err
+	}
+	l.resetRestartCount(name)
+	if len(stopped) == 0 {
+		// 模块本身未启动，直接启动它
+		stopped = []string{name}
+	}
+
+	// stopped 为逆拓扑序，反转后即为启动顺序
+	names := make([]string, len(stopped))
+	for i, n := range stopped {
+		names[len(stopped)-1-i] = n
+	}
+	return l.startModules(names)
+}
+
+// stopModuleWithDependents 返回按停止顺序排列的、实际被停止的模块。
+// 调用者需要持有 l.lock。
+func (l *Loader) stopModuleWithDependents(name string) ([]string, error) {
+	if _, ok := l.modules[name]; !ok {
+		return nil, &EnableError{ModuleName: name, Code: ErrorMissingModule}
+	}
+	dag := l.buildFullDAG()
+	nodes, err := sortedNodes(dag)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := collectDependents(dag, name)
+	dependents[name] = struct{}{}
+	var stopped []string
+	for i := len(nodes) - 1; i >= 0; i-- {
+		id := nodes[i].ID
+		if _, ok := dependents[id]; !ok {
+			continue
+		}
+		module := l.modules[id]
+		if !module.IsEnable() {
+			continue
+		}
+		l.log.Info("stop module", id)
+		var err error
+		if lm := l.getLazyModule(id); lm != nil {
+			err = l.stopLazyModule(lm)
+		} else {
+			err = module.Enable(false)
+		}
+		if err != nil {
+			return stopped, fmt.Errorf("stop module %s failed: %w", id, err)
+		}
+		stopped = append(stopped, id)
+	}
+	return stopped, nil
+}
+
+// StopAll 按逆拓扑顺序停止所有已启动的模块
+func (l *Loader) StopAll() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var names []string
+	nodes, err := sortedNodes(l.buildFullDAG())
+	if err != nil {
+		l.log.Warning("stop modules without dependency order:", err)
+		for name := range l.modules {
+			names = append(names, name)
+		}
+	} else {
+		for i := len(nodes) - 1; i >= 0; i-- {
+			names = append(names, nodes[i].ID)
+		}
+	}
+
+	for _, name := range names {
+		module := l.modules[name]
+		lm := l.getLazyModule(name)
+		if lm != nil && !module.IsEnable() {
+			l.closeLazyService(lm)
+		}
+		if !module.IsEnable() {
+			continue
+		}
+		var err error
+		if lm != nil {
+			err = l.stopLazyModule(lm)
+		} else {
+			err = module.Enable(false)
+		}
+		if err != nil {
+			l.log.Warningf("stop module %s failed: %v", name, err)
+		}
+	}
+}
+
+// startModules 按顺序同步启动尚未启动的模块。
+// 调用者需要持有 l.lock。
+func (l *Loader) startModules(names []string) error {
+	for _, n := range names {
+		module := l.modules[n]
+		if module.IsEnable() {
+			continue
+		}
+		l.log.Info("start module", n)
+		var err error
+		if lm := l.getLazyModule(n); lm != nil {
+			err = l.startLazyModule(lm)
+		} else {
+			err = module.Enable(true)
+		}
+		if err != nil {
+			return &EnableError{ModuleName: n, Code: ErrorInternalError, detail: err.Error()}
+		}
+	}
+	return nil
+}
@@ -73,10 +73,43 @@ func StartAll() {
 	_ = getLoader().EnableModules(modules, []string{}, EnableFlagNone)
 }
 
-// TODO: check dependencies
+func SetModuleFailedHandler(handler ModuleFailedHandler) {
+	getLoader().SetModuleFailedHandler(handler)
+}
+
+// LoadRestartPolicy 从 dconfig 中加载模块崩溃后的自动重启策略
+func LoadRestartPolicy() {
+	getLoader().loadRestartPolicy()
+}
+
+func GetStartupProfile() *StartupProfile {
+	return getLoader().GetStartupProfile()
+}
+
 func StopAll() {
-	modules := getLoader().List()
-	for _, module := range modules {
-		_ = module.Enable(false)
-	}
+	getLoader().StopAll()
+}
+
+func ListModuleInfos() []ModuleInfo {
+	return getLoader().ListModuleInfos()
+}
+
+func StartModule(name string) error {
+	return getLoader().StartModule(name)
+}
+
+func StopModule(name string) error {
+	return getLoader().StopModule(name)
+}
+
+func RestartModule(name string) error {
+	return getLoader().RestartModule(name)
+}
+
+func GetModuleService(name string) *dbusutil.Service {
+	return getLoader().GetModuleService(name)
+}
+
+func SetLogFormat(format string) error {
+	return getLoader().SetLogFormat(format)
 }
@@ -0,0 +1,409 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+const propertiesInterface = "org.freedesktop.DBus.Properties"
+
+// LazyActivation 描述按需启动的模块。loader 会提前占用 ServiceName 并在 Path 上导出与 Prototype
+// 方法签名相同的占位对象，收到第一次方法调用或属性访问时才真正调用模块的 Start，
+// 之后超过 IdleTimeout 没有调用且没有已启动的模块依赖它时，停止模块并重新占位。
+type LazyActivation struct {
+	ServiceName string
+	Path        dbus.ObjectPath
+	// Prototype 仅用于获取导出方法的名称和签名，可以是零值对象
+	Prototype dbusutil.ImplementerExt
+	// Object 返回模块启动后真正导出的对象
+	Object      func() dbusutil.ImplementerExt
+	IdleTimeout time.Duration
+}
+
+func (a *LazyActivation) interfaceName() string {
+	if v20, ok := a.Prototype.(dbusutil.ImplementerV20); ok {
+		return v20.GetInterfaceName()
+	}
+	return a.ServiceName
+}
+
+// LazyModule 由需要按需启动的模块实现，返回 nil 表示按普通模块处理。
+// 按需启动的模块必须通过 GetModuleService 获取导出对象所用的 Service。
+type LazyModule interface {
+	GetLazyActivation() *LazyActivation
+}
+
+type lazyModule struct {
+	name       string
+	module     Module
+	activation *LazyActivation
+
+	service    *dbusutil.Service
+	armed      bool
+	lastActive int64 // unix nano，最近一次收到方法调用的时间
+	idleTimer  *time.Timer
+}
+
+func getLazyActivation(module Module) *LazyActivation {
+	lm, ok := module.(LazyModule)
+	if !ok {
+		return nil
+	}
+	activation := lm.GetLazyActivation()
+	if activation == nil || activation.Prototype == nil || activation.Object == nil {
+		return nil
+	}
+	return activation
+}
+
+// getLazyModule 调用者需要持有 l.lock
+func (l *Loader) getLazyModule(name string) *lazyModule {
+	l.lazyMu.Lock()
+	defer l.lazyMu.Unlock()
+
+	if lm, ok := l.lazyModules[name]; ok {
+		return lm
+	}
+	module, ok := l.modules[name]
+	if !ok {
+		return nil
+	}
+	activation := getLazyActivation(module)
+	if activation == nil {
+		return nil
+	}
+	if l.lazyModules == nil {
+		l.lazyModules = make(map[string]*lazyModule)
+	}
+	lm := &lazyModule{
+		name:       name,
+		module:     module,
+		activation: activation,
+	}
+	l.lazyModules[name] = lm
+	return lm
+}
+
+// GetModuleService 返回模块导出对象所用的 Service，按需启动的模块使用独立的连接，以便统计调用和在空闲时整体释放。
+// 按需启动的模块在 Start 之前已经创建了连接，这里不持有 l.lock，以便在 Start 中调用。
+func (l *Loader) GetModuleService(name string) *dbusutil.Service {
+	l.lazyMu.Lock()
+	defer l.lazyMu.Unlock()
+
+	lm, ok := l.lazyModules[name]
+	if !ok || lm.service == nil {
+		return l.service
+	}
+	return lm.service
+}
+
+// ensureLazyService 为模块创建独立的总线连接。
+// 调用者需要持有 l.lock。
+func (l *Loader) ensureLazyService(lm *lazyModule) error {
+	if lm.service != nil {
+		return nil
+	}
+
+	interceptor := dbus.WithIncomingInterceptor(func(msg *dbus.Message) {
+		if msg.Type == dbus.TypeMethodCall {
+			atomic.StoreInt64(&lm.lastActive, time.Now().UnixNano())
+			l.logLazyCall(lm.name, msg)
+		}
+	})
+
+	conn, err := l.newPrivateConn(interceptor)
+	if err != nil {
+		return err
+	}
+	l.lazyMu.Lock()
+	lm.service = dbusutil.NewService(conn)
+	l.lazyMu.Unlock()
+	return nil
+}
+
+// newPrivateConn 创建与 loader 的 Service 总线类型相同的独立连接
+func (l *Loader) newPrivateConn(opts ...dbus.ConnOption) (*dbus.Conn, error) {
+	var conn *dbus.Conn
+	systemBus, err := dbus.SystemBus()
+	if err == nil && l.service != nil && l.service.Conn() == systemBus {
+		conn, err = dbus.SystemBusPrivate(opts...)
+	} else {
+		conn, err = dbus.SessionBusPrivate(opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Auth(nil)
+	if err == nil {
+		err = conn.Hello()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// closeLazyService 关闭模块的独立连接，模块导出的对象和占用的服务名随之释放。
+// 调用者需要持有 l.lock。
+func (l *Loader) closeLazyService(lm *lazyModule) {
+	if lm.service == nil {
+		return
+	}
+	err := lm.service.Conn().Close()
+	if err != nil {
+		l.log.Warning(err)
+	}
+	l.lazyMu.Lock()
+	lm.service = nil
+	l.lazyMu.Unlock()
+	lm.armed = false
+}
+
+// armLazyModule 占用服务名并导出占位对象。
+// 调用者需要持有 l.lock。
+func (l *Loader) armLazyModule(lm *lazyModule) error {
+	if lm.armed {
+		return nil
+	}
+	err := l.ensureLazyService(lm)
+	if err != nil {
+		return err
+	}
+
+	conn := lm.service.Conn()
+	activation := lm.activation
+	ifcName := activation.interfaceName()
+	err = conn.ExportMethodTable(l.newStubMethods(lm), activation.Path, ifcName)
+	if err != nil {
+		return err
+	}
+	err = conn.ExportMethodTable(l.newStubPropertiesMethods(lm, ifcName), activation.Path, propertiesInterface)
+	if err != nil {
+		return err
+	}
+	err = lm.service.RequestName(activation.ServiceName)
+	if err != nil {
+		return err
+	}
+	lm.armed = true
+	l.log.Infof("module %s is waiting for activation on %s", lm.name, activation.ServiceName)
+	return nil
+}
+
+// disarmLazyModule 撤销占位对象并释放服务名，以便模块 Start 时自行导出和申请。
+// 调用者需要持有 l.lock。
+func (l *Loader) disarmLazyModule(lm *lazyModule) error {
+	if !lm.armed {
+		return nil
+	}
+	conn := lm.service.Conn()
+	activation := lm.activation
+	_ = conn.ExportMethodTable(nil, activation.Path, activation.interfaceName())
+	_ = conn.ExportMethodTable(nil, activation.Path, propertiesInterface)
+	err := lm.service.ReleaseName(activation.ServiceName)
+	if err != nil {
+		return err
+	}
+	lm.armed = false
+	return nil
+}
+
+// enableLazyModule 启动阶段只占位，不调用 Start
+func (l *Loader) enableLazyModule(lm *lazyModule) {
+	l.WaitDependencies(lm.module)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if lm.module.IsEnable() {
+		return
+	}
+	err := l.armLazyModule(lm)
+	if err != nil {
+		l.log.Warningf("arm module %s failed: %v, start it now", lm.name, err)
+		l.closeLazyService(lm)
+		err = l.startLazyModule(lm)
+		if err != nil {
+			l.log.Warningf("enable module %s failed: %v", lm.name, err)
+		}
+	}
+}
+
+// activateLazyModule 启动按需启动的模块并返回其导出的对象
+func (l *Loader) activateLazyModule(lm *lazyModule) (dbusutil.ImplementerExt, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !lm.module.IsEnable() {
+		err := l.startModuleWithDependencies(lm.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	obj := lm.activation.Object()
+	if obj == nil {
+		return nil, fmt.Errorf("module %s exports nothing", lm.name)
+	}
+	return obj, nil
+}
+
+// startLazyModule 由 startModules 调用，调用者需要持有 l.lock
+func (l *Loader) startLazyModule(lm *lazyModule) error {
+	err := l.disarmLazyModule(lm)
+	if err != nil {
+		return err
+	}
+	err = l.ensureLazyService(lm)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&lm.lastActive, time.Now().UnixNano())
+	err = lm.module.Enable(true)
+	if err != nil {
+		return err
+	}
+	l.log.Infof("module %s is activated", lm.name)
+	l.watchIdle(lm)
+	return nil
+}
+
+// stopLazyModule 由 stopModuleWithDependents 调用，调用者需要持有 l.lock
+func (l *Loader) stopLazyModule(lm *lazyModule) error {
+	if lm.idleTimer != nil {
+		lm.idleTimer.Stop()
+		lm.idleTimer = nil
+	}
+	err := lm.module.Enable(false)
+	l.closeLazyService(lm)
+	return err
+}
+
+// watchIdle 在模块空闲超过 IdleTimeout 后停止模块并重新占位。
+// 有已启动的模块依赖它时不停止，否则依赖它的模块会随之停止且不会重新启动。
+// 调用者需要持有 l.lock。
+func (l *Loader) watchIdle(lm *lazyModule) {
+	timeout := lm.activation.IdleTimeout
+	if timeout <= 0 {
+		return
+	}
+	if lm.idleTimer != nil {
+		lm.idleTimer.Stop()
+	}
+	var check func()
+	check = func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		if !lm.module.IsEnable() {
+			return
+		}
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&lm.lastActive)))
+		if idle < timeout {
+			lm.idleTimer = time.AfterFunc(timeout-idle, check)
+			return
+		}
+
+		if dependent := l.getEnabledDependent(lm.name); dependent != "" {
+			l.log.Debugf("module %s is idle, but keep it running for %s", lm.name, dependent)
+			lm.idleTimer = time.AfterFunc(timeout, check)
+			return
+		}
+
+		l.log.Infof("module %s is idle for %s, stop it", lm.name, idle)
+		_, err := l.stopModuleWithDependents(lm.name)
+		if err != nil {
+			l.log.Warning(err)
+			return
+		}
+		err = l.armLazyModule(lm)
+		if err != nil {
+			l.log.Warning(err)
+		}
+	}
+	lm.idleTimer = time.AfterFunc(timeout, check)
+}
+
+// getEnabledDependent 返回一个依赖 name 且已启动的模块，没有时返回空字符串。
+// 调用者需要持有 l.lock。
+func (l *Loader) getEnabledDependent(name string) string {
+	for id := range collectDependents(l.buildFullDAG(), name) {
+		if module, ok := l.modules[id]; ok && module.IsEnable() {
+			return id
+		}
+	}
+	return ""
+}
+
+// newStubMethods 根据 Prototype 生成签名相同的方法表，调用时先启动模块，再转发给真正的对象，
+// 因此 dbus.Sender 等参数能够原样传递。
+func (l *Loader) newStubMethods(lm *lazyModule) map[string]interface{} {
+	methods := lm.activation.Prototype.GetExportedMethods()
+	table := make(map[string]interface{}, len(methods))
+	for _, method := range methods {
+		name := method.Name
+		fnType := reflect.TypeOf(method.Fn)
+		table[name] = reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+			obj, err := l.activateLazyModule(lm)
+			if err != nil {
+				return errorResults(fnType, err)
+			}
+			for _, m := range obj.GetExportedMethods() {
+				if m.Name == name {
+					return reflect.ValueOf(m.Fn).Call(args)
+				}
+			}
+			return errorResults(fnType, fmt.Errorf("no such method %s", name))
+		}).Interface()
+	}
+	return table
+}
+
+// newStubPropertiesMethods 属性访问同样会启动模块，随后通过总线转发给模块导出的 Properties 接口
+func (l *Loader) newStubPropertiesMethods(lm *lazyModule, ifcName string) map[string]interface{} {
+	forward := func(method string, args ...interface{}) (*dbus.Call, error) {
+		_, err := l.activateLazyModule(lm)
+		if err != nil {
+			return nil, err
+		}
+		l.lock.Lock()
+		service := lm.service
+		l.lock.Unlock()
+		if service == nil {
+			return nil, errors.New("module is stopped")
+		}
+		call := service.Conn().Object(lm.activation.ServiceName, lm.activation.Path).
+			Call(propertiesInterface+"."+method, 0, args...)
+		return call, call.Err
+	}
+
+	return map[string]interface{}{
+		"Get": func(ifc, property string) (value dbus.Variant, busErr *dbus.Error) {
+			call, err := forward("Get", ifc, property)
+			if err == nil {
+				err = call.Store(&value)
+			}
+			return value, dbusutil.ToError(err)
+		},
+		"GetAll": func(ifc string) (props map[string]dbus.Variant, busErr *dbus.Error) {
+			call, err := forward("GetAll", ifc)
+			if err == nil {
+				err = call.Store(&props)
+			}
+			return props, dbusutil.ToError(err)
+		},
+		"Set": func(ifc, property string, value dbus.Variant) *dbus.Error {
+			_, err := forward("Set", ifc, property, value)
+			return dbusutil.ToError(err)
+		},
+	}
+}
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	lazyTestService = "org.deepin.dde.daemon.LazyTest1"
+	lazyTestPath    = "/org/deepin/dde/daemon/LazyTest1"
+)
+
+type lazyTestObject struct {
+	PropsMu sync.RWMutex
+	Name    string
+}
+
+func (*lazyTestObject) GetInterfaceName() string {
+	return lazyTestService
+}
+
+func (o *lazyTestObject) GetExportedMethods() dbusutil.ExportedMethods {
+	return dbusutil.ExportedMethods{
+		{
+			Name:    "Hello",
+			Fn:      o.Hello,
+			InArgs:  []string{"name"},
+			OutArgs: []string{"value"},
+		},
+	}
+}
+
+func (o *lazyTestObject) Hello(name string) (string, *dbus.Error) {
+	return "hello " + name, nil
+}
+
+type lazyTestModule struct {
+	*ModuleBase
+	obj         *lazyTestObject
+	starts      int32
+	idleTimeout time.Duration
+}
+
+func (*lazyTestModule) GetDependencies() []string {
+	return nil
+}
+
+func (m *lazyTestModule) Start() error {
+	obj := &lazyTestObject{Name: "lazy"}
+	err := m.Export(lazyTestPath, obj)
+	if err != nil {
+		return err
+	}
+	err = GetModuleService(m.Name()).RequestName(lazyTestService)
+	if err != nil {
+		return err
+	}
+	m.obj = obj
+	atomic.AddInt32(&m.starts, 1)
+	return nil
+}
+
+func (m *lazyTestModule) Stop() error {
+	service := GetModuleService(m.Name())
+	_ = service.ReleaseName(lazyTestService)
+	_ = service.StopExport(m.obj)
+	m.obj = nil
+	return nil
+}
+
+func (m *lazyTestModule) GetLazyActivation() *LazyActivation {
+	return &LazyActivation{
+		ServiceName: lazyTestService,
+		Path:        lazyTestPath,
+		Prototype:   &lazyTestObject{},
+		Object: func() dbusutil.ImplementerExt {
+			if m.obj == nil {
+				return nil
+			}
+			return m.obj
+		},
+		IdleTimeout: m.idleTimeout,
+	}
+}
+
+func hasNameOwner(conn *dbus.Conn, name string) bool {
+	var has bool
+	err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, name).Store(&has)
+	return err == nil && has
+}
+
+func Test_LazyModule(t *testing.T) {
+	service, err := dbusutil.NewSessionService()
+	if err != nil {
+		t.Skip("session bus is not available")
+	}
+	_loader = &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	SetService(service)
+	m := &lazyTestModule{idleTimeout: 300 * time.Millisecond}
+	m.ModuleBase = NewModuleBase("lazy_test", m, log.NewLogger("lazy_test"))
+	Register(m)
+	defer func() {
+		_ = StopModule("lazy_test")
+	}()
+
+	// 启动阶段只占用服务名，不调用 Start
+	require.NoError(t, EnableModules([]string{"lazy_test"}, nil, EnableFlagNone))
+	conn := service.Conn()
+	require.Eventually(t, func() bool {
+		return hasNameOwner(conn, lazyTestService)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, m.IsEnable())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&m.starts))
+
+	// 第一次调用启动模块，并转发给模块导出的对象
+	obj := conn.Object(lazyTestService, lazyTestPath)
+	var value string
+	require.NoError(t, obj.Call(lazyTestService+".Hello", 0, "dde").Store(&value))
+	assert.Equal(t, "hello dde", value)
+	assert.True(t, m.IsEnable())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&m.starts))
+	assert.Same(t, _loader.lazyModules["lazy_test"].service, GetModuleService("lazy_test"))
+
+	// 空闲超时后停止模块，并重新占位
+	require.Eventually(t, func() bool {
+		return !m.IsEnable()
+	}, 5*time.Second, 20*time.Millisecond)
+	_loader.lock.Lock()
+	armed := _loader.lazyModules["lazy_test"].armed
+	_loader.lock.Unlock()
+	assert.True(t, armed)
+	assert.True(t, hasNameOwner(conn, lazyTestService))
+
+	// 属性访问同样启动模块，占位对象通过总线转发给模块导出的 Properties 接口
+	prop, err := obj.GetProperty(lazyTestService + ".Name")
+	require.NoError(t, err)
+	assert.Equal(t, "lazy", prop.Value())
+	assert.True(t, m.IsEnable())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&m.starts))
+}
+
+func Test_LazyModuleDependent(t *testing.T) {
+	service, err := dbusutil.NewSessionService()
+	if err != nil {
+		t.Skip("session bus is not available")
+	}
+	_loader = &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	SetService(service)
+	m := &lazyTestModule{idleTimeout: 100 * time.Millisecond}
+	m.ModuleBase = NewModuleBase("lazy_test", m, log.NewLogger("lazy_test"))
+	Register(m)
+	var events []string
+	Register(newRecordModule("lazy_dependent", &events, "lazy_test"))
+	defer func() {
+		_ = StopModule("lazy_test")
+	}()
+
+	// 依赖它的普通模块运行时，空闲超时也不停止
+	require.NoError(t, StartModule("lazy_dependent"))
+	assert.True(t, m.IsEnable())
+	time.Sleep(400 * time.Millisecond)
+	assert.True(t, m.IsEnable())
+	assert.True(t, _loader.GetModule("lazy_dependent").IsEnable())
+
+	// 依赖它的模块停止后，空闲超时停止并重新占位
+	require.NoError(t, StopModule("lazy_dependent"))
+	require.Eventually(t, func() bool {
+		return !m.IsEnable()
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return hasNameOwner(service.Conn(), lazyTestService)
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -61,6 +61,21 @@ type Loader struct {
 	log     *log.Logger
 	lock    sync.Mutex
 	service *dbusutil.Service
+
+	// enableLock 保证同一时间只有一次 EnableModules，等待模块启动期间不持有 lock，
+	// 以便模块崩溃后 supervisor 能够重启它
+	enableLock     sync.Mutex
+	supervisorOnce sync.Once
+	supervisor     *supervisor
+	profilerOnce   sync.Once
+	profiler       *profiler
+	callLogOnce    sync.Once
+	callLog        *callLogger
+
+	// lazyMu 保护 lazyModules 和 lazyModule.service 的修改。模块在 Start 中调用 GetModuleService，
+	// 此时 lock 已被持有，所以 GetModuleService 只使用 lazyMu
+	lazyMu      sync.Mutex
+	lazyModules map[string]*lazyModule
 }
 
 func (l *Loader) SetLogLevel(pri log.Priority) {
@@ -111,18 +126,41 @@ func (l *Loader) GetModule(name string) Module {
 
 func (l *Loader) WaitDependencies(module Module) {
 	for _, dependencyName := range module.GetDependencies() {
+		l.lock.Lock()
+		lm := l.getLazyModule(dependencyName)
+		l.lock.Unlock()
+		if lm != nil {
+			// 被其他模块依赖的按需启动模块需要立即启动
+			_, err := l.activateLazyModule(lm)
+			if err != nil {
+				l.log.Warning(err)
+			}
+		}
 		l.modules[dependencyName].WaitEnable()
 	}
 }
 
+// failedDependency 返回 WaitDependencies 之后仍未启动的依赖，即已被 supervisor 放弃的模块
+func (l *Loader) failedDependency(module Module) string {
+	for _, name := range module.GetDependencies() {
+		if dependency, ok := l.modules[name]; ok && !dependency.IsEnable() {
+			return name
+		}
+	}
+	return ""
+}
+
 func (l *Loader) EnableModules(enablingModules []string, disableModules []string, flag EnableFlag) error {
-	l.lock.Lock()
-	defer l.lock.Unlock()
+	l.enableLock.Lock()
+	defer l.enableLock.Unlock()
 
 	// build a dag
 	startTime := time.Now()
+	l.getProfiler().markBegin(startTime)
+	l.lock.Lock()
 	builder := NewDAGBuilder(l, enablingModules, disableModules, flag)
 	dag, err := builder.Execute()
+	l.lock.Unlock()
 	if err != nil {
 		return err
 	}
@@ -147,6 +185,14 @@ func (l *Loader) EnableModules(enablingModules []string, disableModules []string
 		module := l.modules[node.ID]
 		name := node.ID
 
+		l.lock.Lock()
+		lm := l.getLazyModule(name)
+		l.lock.Unlock()
+		if lm != nil {
+			go l.enableLazyModule(lm)
+			continue
+		}
+
 		go func() {
 			l.log.Info("enable module", name)
 			startTime := time.Now()
@@ -155,9 +201,21 @@ func (l *Loader) EnableModules(enablingModules []string, disableModules []string
 			l.WaitDependencies(module)
 			endTime := time.Now()
 			duration := endTime.Sub(startTime)
+			waitCost := duration
 			l.log.Info("module", name, "wait done, cost", duration)
+			if dependency := l.failedDependency(module); dependency != "" {
+				l.log.Errorf("enable module %s failed: dependency %s failed", name, dependency)
+				if m, ok := module.(abandoner); ok {
+					m.abandon()
+				}
+				return
+			}
 
+			alreadyEnabled := module.IsEnable()
 			err := module.Enable(true)
+			if !alreadyEnabled {
+				l.getProfiler().record(name, startTime, waitCost, time.Since(endTime), err)
+			}
 			endTime = time.Now()
 			duration = endTime.Sub(startTime)
 			if err != nil {
@@ -170,6 +228,9 @@ func (l *Loader) EnableModules(enablingModules []string, disableModules []string
 
 	for _, n := range nodes {
 		m := l.modules[n.ID]
+		if getLazyActivation(m) != nil {
+			continue
+		}
 		m.WaitEnable()
 	}
 
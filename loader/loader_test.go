@@ -5,13 +5,21 @@
 package loader
 
 import (
+	"errors"
+	"io"
 	"math/rand"
+	"net"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/linuxdeepin/go-lib/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type Test_Module struct {
@@ -100,3 +108,440 @@ func Test_Loader(t *testing.T) {
 		assert.Equal(t, err, data.output)
 	}
 }
+
+type recordModule struct {
+	*ModuleBase
+	dependencies []string
+	events       *[]string
+}
+
+func newRecordModule(name string, events *[]string, dependencies ...string) *recordModule {
+	m := &recordModule{
+		dependencies: dependencies,
+		events:       events,
+	}
+	m.ModuleBase = NewModuleBase(name, m, log.NewLogger(name))
+	return m
+}
+
+func (m *recordModule) GetDependencies() []string {
+	return m.dependencies
+}
+
+func (m *recordModule) Start() error {
+	*m.events = append(*m.events, "start "+m.Name())
+	return nil
+}
+
+func (m *recordModule) Stop() error {
+	*m.events = append(*m.events, "stop "+m.Name())
+	return nil
+}
+
+func Test_RestartModule(t *testing.T) {
+	var events []string
+	l := &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	l.AddModule(newRecordModule("a", &events))
+	l.AddModule(newRecordModule("b", &events, "a"))
+	l.AddModule(newRecordModule("c", &events, "b"))
+	l.AddModule(newRecordModule("d", &events))
+
+	err := l.StartModule("c")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"start a", "start b", "start c"}, events)
+	assert.False(t, l.GetModule("d").IsEnable())
+
+	events = nil
+	err = l.RestartModule("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stop c", "stop b", "stop a", "start a", "start b", "start c"}, events)
+
+	events = nil
+	err = l.StopModule("b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stop c", "stop b"}, events)
+	assert.True(t, l.GetModule("a").IsEnable())
+
+	err = l.StopModule("x")
+	assert.Equal(t, &EnableError{ModuleName: "x", Code: ErrorMissingModule}, err)
+
+	infos := l.ListModuleInfos()
+	assert.Len(t, infos, 4)
+	assert.Equal(t, "a", infos[0].Name)
+	assert.Equal(t, []string{"b"}, infos[0].Dependents)
+}
+
+type panicModule struct {
+	*ModuleBase
+	starts int
+	mu     sync.Mutex
+}
+
+func (m *panicModule) GetDependencies() []string {
+	return nil
+}
+
+func (m *panicModule) Start() error {
+	m.mu.Lock()
+	m.starts++
+	starts := m.starts
+	m.mu.Unlock()
+	if starts == 1 {
+		panic("start failed")
+	}
+	return nil
+}
+
+func (m *panicModule) Stop() error {
+	return nil
+}
+
+func Test_Supervisor(t *testing.T) {
+	_loader = &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	m := &panicModule{}
+	m.ModuleBase = NewModuleBase("panic", m, log.NewLogger("panic"))
+	Register(m)
+
+	failed := make(chan string, 10)
+	_loader.SetRestartPolicy(1, 10*time.Millisecond)
+	SetModuleFailedHandler(func(name string, reason string, restartCount int, willRestart bool) {
+		failed <- reason
+	})
+
+	err := StartModule("panic")
+	assert.Error(t, err)
+	assert.True(t, m.IsFailed())
+	assert.Equal(t, "start failed", <-failed)
+
+	// supervisor 重启后模块恢复正常
+	m.WaitEnable()
+	assert.True(t, m.IsEnable())
+	assert.False(t, m.IsFailed())
+	assert.Equal(t, 1, _loader.GetRestartCount("panic"))
+
+	// 达到重启次数上限后不再重启
+	m.Go(func() {
+		panic("goroutine failed")
+	})
+	assert.Equal(t, "goroutine failed", <-failed)
+	assert.True(t, m.IsFailed())
+	assert.True(t, m.IsEnable())
+}
+
+// brokenModule 在 broken 为 true 时启动会崩溃
+type brokenModule struct {
+	*ModuleBase
+	mu     sync.Mutex
+	broken bool
+}
+
+func (m *brokenModule) GetDependencies() []string {
+	return nil
+}
+
+func (m *brokenModule) setBroken(broken bool) {
+	m.mu.Lock()
+	m.broken = broken
+	m.mu.Unlock()
+}
+
+func (m *brokenModule) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.broken {
+		panic("start failed")
+	}
+	return nil
+}
+
+func (m *brokenModule) Stop() error {
+	return nil
+}
+
+func Test_SupervisorGiveUp(t *testing.T) {
+	_loader = &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	var events []string
+	m := &brokenModule{broken: true}
+	m.ModuleBase = NewModuleBase("broken", m, log.NewLogger("broken"))
+	Register(m)
+	Register(newRecordModule("dependent", &events, "broken"))
+
+	type failure struct {
+		count       int
+		willRestart bool
+	}
+	failed := make(chan failure, 10)
+	_loader.SetRestartPolicy(1, 10*time.Millisecond)
+	SetModuleFailedHandler(func(name string, reason string, restartCount int, willRestart bool) {
+		failed <- failure{restartCount, willRestart}
+	})
+
+	// 达到重启次数上限后放弃模块，EnableModules 不会一直等待
+	done := make(chan error)
+	go func() {
+		done <- EnableModules([]string{"broken", "dependent"}, nil, EnableFlagNone)
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("EnableModules is blocked by the failed module")
+	}
+	assert.Equal(t, failure{1, true}, <-failed)
+	assert.Equal(t, failure{1, false}, <-failed)
+	assert.True(t, m.IsFailed())
+	assert.False(t, m.IsEnable())
+	assert.False(t, GetModule("dependent").IsEnable())
+	assert.Empty(t, events)
+
+	// 距上次崩溃超过 stableUptime 后重新计算重启次数，重启成功后模块恢复正常
+	m.setBroken(false)
+	_loader.getSupervisor().mu.Lock()
+	_loader.getSupervisor().stableUptime = time.Millisecond
+	_loader.getSupervisor().mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	_loader.moduleFailed("broken", errors.New("crash"))
+	assert.Equal(t, failure{1, true}, <-failed)
+	assert.Eventually(t, m.IsEnable, 5*time.Second, 10*time.Millisecond)
+	m.WaitEnable()
+	assert.False(t, m.IsFailed())
+}
+
+// goroutineModule 第一次启动时，Go 启动的协程会崩溃
+type goroutineModule struct {
+	*ModuleBase
+	starts chan int
+	count  int
+}
+
+func (m *goroutineModule) GetDependencies() []string {
+	return nil
+}
+
+func (m *goroutineModule) Start() error {
+	m.count++
+	count := m.count
+	m.Go(func() {
+		if count == 1 {
+			panic("event loop failed")
+		}
+		m.starts <- count
+	})
+	return nil
+}
+
+func (m *goroutineModule) Stop() error {
+	return nil
+}
+
+func (m *goroutineModule) Hello(name string) (string, *dbus.Error) {
+	if name == "" {
+		panic("empty name")
+	}
+	return "hello " + name, nil
+}
+
+func Test_SupervisorGoroutine(t *testing.T) {
+	_loader = &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	m := &goroutineModule{starts: make(chan int, 10)}
+	m.ModuleBase = NewModuleBase("goroutine", m, log.NewLogger("goroutine"))
+	Register(m)
+
+	failed := make(chan string, 10)
+	_loader.SetRestartPolicy(2, 10*time.Millisecond)
+	SetModuleFailedHandler(func(name string, reason string, restartCount int, willRestart bool) {
+		failed <- reason
+	})
+
+	require.NoError(t, StartModule("goroutine"))
+	assert.Equal(t, "event loop failed", <-failed)
+
+	// supervisor 重启模块，新的协程正常运行
+	select {
+	case count := <-m.starts:
+		assert.Equal(t, 2, count)
+	case <-time.After(5 * time.Second):
+		t.Fatal("module is not restarted")
+	}
+	assert.True(t, m.IsEnable())
+	assert.False(t, m.IsFailed())
+	assert.Equal(t, 1, _loader.GetRestartCount("goroutine"))
+
+	// 导出方法中的 panic 作为 D-Bus 错误返回，并触发重启
+	hello := m.safeMethod(m.Hello).(func(string) (string, *dbus.Error))
+	value, busErr := hello("dde")
+	assert.Nil(t, busErr)
+	assert.Equal(t, "hello dde", value)
+
+	value, busErr = hello("")
+	require.NotNil(t, busErr)
+	assert.Equal(t, "", value)
+	assert.Contains(t, busErr.Error(), "empty name")
+	assert.Equal(t, "empty name", <-failed)
+	select {
+	case count := <-m.starts:
+		assert.Equal(t, 3, count)
+	case <-time.After(5 * time.Second):
+		t.Fatal("module is not restarted")
+	}
+	assert.Equal(t, 2, _loader.GetRestartCount("goroutine"))
+}
+
+func Test_criticalPath(t *testing.T) {
+	starts := map[string]time.Duration{
+		"a": 10 * time.Millisecond,
+		"b": 50 * time.Millisecond,
+		"c": 20 * time.Millisecond,
+		"d": 5 * time.Millisecond,
+	}
+	dependencies := map[string][]string{
+		"c": {"a", "b"},
+		"d": {"c", "missing"},
+	}
+	path, cost := criticalPath(starts, dependencies)
+	assert.Equal(t, []string{"b", "c", "d"}, path)
+	assert.Equal(t, 75*time.Millisecond, cost)
+
+	// 耗时相同的路径按名称选择，不受 map 遍历顺序影响
+	starts = map[string]time.Duration{
+		"x": 10 * time.Millisecond,
+		"y": 10 * time.Millisecond,
+		"z": 10 * time.Millisecond,
+		"p": 10 * time.Millisecond,
+		"q": 10 * time.Millisecond,
+	}
+	dependencies = map[string][]string{
+		"z": {"y", "x"},
+		"q": {"p"},
+	}
+	for i := 0; i < 20; i++ {
+		path, cost = criticalPath(starts, dependencies)
+		assert.Equal(t, []string{"p", "q"}, path)
+		assert.Equal(t, 20*time.Millisecond, cost)
+	}
+	dependencies["q"] = nil
+	for i := 0; i < 20; i++ {
+		path, _ = criticalPath(starts, dependencies)
+		assert.Equal(t, []string{"x", "z"}, path)
+	}
+
+	path, cost = criticalPath(nil, nil)
+	assert.Nil(t, path)
+	assert.Equal(t, time.Duration(0), cost)
+}
+
+func Test_errorResults(t *testing.T) {
+	fn := func(sender dbus.Sender, name string) (value int32, path string, busErr *dbus.Error) {
+		return
+	}
+	results := errorResults(reflect.TypeOf(fn), errors.New("activate failed"))
+	assert.Len(t, results, 3)
+	assert.Equal(t, int32(0), results[0].Interface())
+	assert.Equal(t, "", results[1].Interface())
+	busErr := results[2].Interface().(*dbus.Error)
+	assert.NotNil(t, busErr)
+	assert.Equal(t, "activate failed", busErr.Error())
+}
+
+func Test_findPathModule(t *testing.T) {
+	pathModules := map[dbus.ObjectPath]string{
+		"/org/deepin/dde/Audio1":              "audio",
+		"/org/deepin/dde/InputDevices1":       "inputdevices",
+		"/org/deepin/dde/InputDevices1/Mouse": "mouse",
+	}
+	assert.Equal(t, "audio", findPathModule("/org/deepin/dde/Audio1", pathModules))
+	assert.Equal(t, "audio", findPathModule("/org/deepin/dde/Audio1/Sink0", pathModules))
+	assert.Equal(t, "inputdevices", findPathModule("/org/deepin/dde/InputDevices1/Keyboard", pathModules))
+	assert.Equal(t, "mouse", findPathModule("/org/deepin/dde/InputDevices1/Mouse", pathModules))
+	assert.Equal(t, "", findPathModule("/org/deepin/dde/Audio", pathModules))
+	assert.Equal(t, "", findPathModule("/org/deepin/dde/Daemon1", pathModules))
+	assert.Equal(t, "", findPathModule("/", pathModules))
+}
+
+// captureStdout 返回 fn 执行期间写入标准输出的内容
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func Test_switchModuleLogs(t *testing.T) {
+	l := &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	c := l.getCallLogger()
+	logger := log.NewLogger("test/modulelog")
+	logger.RemoveBackendSyslog()
+	l.registerModuleLogger("modulelog", logger)
+	assert.Equal(t, "modulelog", c.loggers[logger])
+
+	// 无法连接 journald 时按 json 格式处理，模块日志保持原样
+	c.mu.Lock()
+	c.format = LogFormatJournald
+	l.switchModuleLogs(c)
+	c.mu.Unlock()
+	assert.Equal(t, LogFormatJSON, c.logMode)
+	assert.Contains(t, captureStdout(t, func() { logger.Info("json") }), "json")
+
+	// journald 格式下模块日志不再输出到控制台
+	journal, peer := net.Pipe()
+	defer peer.Close()
+	c.mu.Lock()
+	c.journal = journal
+	l.switchModuleLogs(c)
+	c.mu.Unlock()
+	assert.Equal(t, LogFormatJournald, c.logMode)
+	assert.Empty(t, captureStdout(t, func() { logger.Info("journald") }))
+
+	// 之后创建的模块同样生效
+	logger2 := log.NewLogger("test/modulelog2")
+	logger2.RemoveBackendSyslog()
+	l.registerModuleLogger("modulelog2", logger2)
+	assert.Empty(t, captureStdout(t, func() { logger2.Info("journald") }))
+
+	require.NoError(t, l.SetLogFormat(LogFormatText))
+	assert.Equal(t, LogFormatText, c.logMode)
+	assert.Nil(t, c.journal)
+	assert.Contains(t, captureStdout(t, func() { logger.Info("text") }), "text")
+	assert.Contains(t, captureStdout(t, func() { logger2.Info("text") }), "text")
+}
+
+func Test_formatJournalRecord(t *testing.T) {
+	record := &CallRecord{
+		Module:    "audio",
+		Sender:    ":1.42",
+		Path:      "/org/deepin/dde/Audio1",
+		Interface: "org.deepin.dde.Audio1",
+		Method:    "SetPort",
+	}
+	data := string(formatJournalRecord(record))
+	assert.Contains(t, data, "MESSAGE=:1.42 call /org/deepin/dde/Audio1 org.deepin.dde.Audio1.SetPort\n")
+	assert.Contains(t, data, "DDE_MODULE=audio\n")
+	assert.Contains(t, data, "DBUS_SENDER=:1.42\n")
+	assert.Contains(t, data, "DBUS_METHOD=SetPort\n")
+	assert.True(t, strings.HasSuffix(data, "\n"))
+
+	record.Module = ""
+	assert.NotContains(t, string(formatJournalRecord(record)), "DDE_MODULE=")
+}
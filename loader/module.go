@@ -6,6 +6,7 @@ package loader
 
 import (
 	"fmt"
+	"reflect"
 	"sync"
 
 	"github.com/godbus/dbus/v5"
@@ -21,7 +22,8 @@ type Module interface {
 	GetDependencies() []string
 	SetLogLevel(log.Priority)
 	LogLevel() log.Priority
-	WaitEnable() // TODO: should this function return when modules enable failed?
+	WaitEnable() // 模块启动完成，或崩溃后达到重启次数上限时返回
+	IsFailed() bool
 	ModuleImpl
 }
 
@@ -35,9 +37,15 @@ type ModuleImpl interface {
 type ModuleBase struct {
 	impl    ModuleImpl
 	enabled bool
+	failed  bool
 	name    string
 	log     *log.Logger
 	wg      sync.WaitGroup
+	mu      sync.Mutex
+
+	// released 未启动时已被 abandon 释放了 WaitEnable 的等待者，再次启动成功时不能重复 Done
+	released        bool
+	dsgLogLevelOnce sync.Once
 }
 
 const (
@@ -50,6 +58,7 @@ const (
 var (
 	sysSigLoop     *dbusutil.SignalLoop
 	sysSigLoopOnce sync.Once
+	logFormatOnce  sync.Once
 )
 
 func getLogPriority(level string) log.Priority {
@@ -101,21 +110,25 @@ func NewModuleBase(name string, impl ModuleImpl, logger *log.Logger) *ModuleBase
 	// 其他依赖当前模块的模块启动时，可能还没有调用过当前模块的 Enable，所以不能放在 Enable 中。
 	m.wg.Add(1)
 
+	getLoader().registerModuleLogger(name, logger)
 	return m
 }
 
-func (d *ModuleBase) setupDSGLogLeveL() {
+func getSysSigLoop(logger *log.Logger) *dbusutil.SignalLoop {
 	sysSigLoopOnce.Do(func() {
 		conn, err := dbus.SystemBus()
 		if err != nil {
-			d.log.Warning(err)
+			logger.Warning(err)
 			return
 		}
 		sysSigLoop = dbusutil.NewSignalLoop(conn, 10)
 		sysSigLoop.Start()
 	})
+	return sysSigLoop
+}
 
-	if sysSigLoop == nil {
+func (d *ModuleBase) setupDSGLogLeveL() {
+	if getSysSigLoop(d.log) == nil {
 		return
 	}
 
@@ -173,6 +186,11 @@ func (d *ModuleBase) setupDSGLogLeveL() {
 			fn(key == dsettingsKeyEnabled)
 		}
 	})
+
+	// 日志格式对所有模块生效，只需由第一个启动的模块监听
+	logFormatOnce.Do(func() {
+		getLoader().watchLogFormat(dsManager)
+	})
 }
 
 func (d *ModuleBase) doEnable(enable bool) error {
@@ -182,20 +200,42 @@ func (d *ModuleBase) doEnable(enable bool) error {
 			fn = d.impl.Start
 		}
 
-		if err := fn(); err != nil {
+		if err := d.callSafely(fn); err != nil {
+			if _, ok := err.(*PanicError); ok {
+				d.failed = true
+				if !enable {
+					// Stop 时崩溃，模块状态已不可信，视为已停止
+					d.enabled = false
+					d.wg.Add(1)
+				}
+				go getLoader().moduleFailed(d.name, err)
+			}
 			return err
 		}
 
 		if enable {
-			d.setupDSGLogLeveL()
-			d.wg.Done()
+			d.dsgLogLevelOnce.Do(d.setupDSGLogLeveL)
+			if d.released {
+				d.released = false
+			} else {
+				d.wg.Done()
+			}
+		} else if d.enabled {
+			// 模块被停止后需要重新进入等待状态，以便运行时重启时依赖它的模块能够正确等待
+			d.wg.Add(1)
 		}
 	}
 	d.enabled = enable
+	if enable {
+		d.failed = false
+	}
 	return nil
 }
 
 func (d *ModuleBase) Enable(enable bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	if d.enabled == enable {
 		return fmt.Errorf("%s daemon is already started", d.name)
 	}
@@ -203,9 +243,125 @@ func (d *ModuleBase) Enable(enable bool) error {
 }
 
 func (d *ModuleBase) IsEnable() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	return d.enabled
 }
 
+// IsFailed 模块在 Start、Stop 或 Go 启动的协程中崩溃后返回 true，直到模块再次成功启动
+func (d *ModuleBase) IsFailed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.failed
+}
+
+// Go 在新的协程中执行 fn，fn 中的 panic 会被恢复并交由 loader 重启模块，不会导致整个进程退出
+func (d *ModuleBase) Go(fn func()) {
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				getLoader().moduleFailed(d.name, d.panicked(v))
+			}
+		}()
+		fn()
+	}()
+}
+
+// Export 与 dbusutil.Service.Export 相同，但导出方法中的 panic 会被恢复，
+// 调用方收到 D-Bus 错误，模块交由 loader 重启。path 及其子路径上的调用日志都记为该模块。
+// 按需启动的模块导出到其独立的连接上，见 GetModuleService。
+func (d *ModuleBase) Export(path dbus.ObjectPath, impls ...dbusutil.Implementer) error {
+	service := getLoader().GetModuleService(d.name)
+	err := service.Export(path, impls...)
+	if err != nil {
+		return err
+	}
+
+	getLoader().registerPath(path, d.name)
+
+	for _, impl := range impls {
+		implExt, ok := impl.(dbusutil.ImplementerExt)
+		if !ok {
+			continue
+		}
+		// 用包装后的方法表覆盖 dbusutil 导出的方法，属性和 Introspectable 接口不受影响
+		methods := implExt.GetExportedMethods()
+		table := make(map[string]interface{}, len(methods))
+		for _, method := range methods {
+			table[method.Name] = d.safeMethod(method.Fn)
+		}
+		err = service.Conn().ExportMethodTable(table, path, impl.(dbusutil.ImplementerV20).GetInterfaceName())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *ModuleBase) safeMethod(fn interface{}) interface{} {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) (results []reflect.Value) {
+		defer func() {
+			if v := recover(); v != nil {
+				err := d.panicked(v)
+				results = errorResults(fnType, err)
+				go getLoader().moduleFailed(d.name, err)
+			}
+		}()
+		if fnType.IsVariadic() {
+			return fnValue.CallSlice(args)
+		}
+		return fnValue.Call(args)
+	}).Interface()
+}
+
+// panicked 记录 panic 并将模块标记为失败
+// errorResults 构造方法的返回值，除最后的 *dbus.Error 外均为零值
+func errorResults(fnType reflect.Type, err error) []reflect.Value {
+	results := make([]reflect.Value, fnType.NumOut())
+	for i := range results {
+		results[i] = reflect.Zero(fnType.Out(i))
+	}
+	if n := len(results); n > 0 {
+		results[n-1] = reflect.ValueOf(dbusutil.ToError(err))
+	}
+	return results
+}
+
+func (d *ModuleBase) panicked(v interface{}) *PanicError {
+	err := newPanicError(d.name, v)
+	d.log.Errorf("%v\n%s", err, err.Stack)
+	d.mu.Lock()
+	d.failed = true
+	d.mu.Unlock()
+	return err
+}
+
+func (d *ModuleBase) callSafely(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicErr := newPanicError(d.name, v)
+			d.log.Errorf("%v\n%s", panicErr, panicErr.Stack)
+			err = panicErr
+		}
+	}()
+	return fn()
+}
+
+// abandon 模块不会再被自动启动，标记为失败并释放 WaitEnable 的等待者，
+// 以免 EnableModules 和依赖它的模块一直等待
+func (d *ModuleBase) abandon() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failed = true
+	if d.enabled || d.released {
+		return
+	}
+	d.released = true
+	d.wg.Done()
+}
+
 func (d *ModuleBase) WaitEnable() {
 	d.wg.Wait()
 }
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+// 结构化日志模式下模块日志的输出方式。
+// go-lib/log 的后端接口不能在包外实现，loader 不截获模块日志，只调整每个模块日志对象自身的后端，
+// 不修改环境变量和标准输出等进程级的状态：
+// journald 格式下去掉控制台后端，模块日志只经由各自的 syslog 后端写入 journald，
+// 带有日志级别，SYSLOG_IDENTIFIER 为日志名；json 格式下模块日志保持文本格式。
+
+import (
+	"github.com/linuxdeepin/go-lib/log"
+)
+
+// registerModuleLogger 在创建模块时记录模块的日志对象和模块名，切换日志格式时一并切换
+func (l *Loader) registerModuleLogger(module string, logger *log.Logger) {
+	if logger == nil {
+		return
+	}
+	c := l.getCallLogger()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loggers[logger] = module
+	setLoggerMode(logger, LogFormatText, c.logMode)
+}
+
+func setLoggerMode(logger *log.Logger, oldMode, mode string) {
+	if mode == LogFormatJournald && oldMode != LogFormatJournald {
+		logger.RemoveBackendConsole()
+	} else if oldMode == LogFormatJournald && mode != LogFormatJournald {
+		logger.AddBackendConsole()
+	}
+}
+
+// switchModuleLogs 按当前格式切换模块日志的输出方式，无法连接 journald 时按 json 格式处理。
+// 调用者需要持有 c.mu。
+func (l *Loader) switchModuleLogs(c *callLogger) {
+	mode := c.format
+	if mode == LogFormatJournald && c.journal == nil {
+		mode = LogFormatJSON
+	}
+	if mode == c.logMode {
+		return
+	}
+
+	oldMode := c.logMode
+	c.logMode = mode
+	for logger := range c.loggers {
+		setLoggerMode(logger, oldMode, mode)
+	}
+	setLoggerMode(l.log, oldMode, mode)
+}
@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linuxdeepin/dde-daemon/graph"
+)
+
+type moduleProfile struct {
+	waitBegin time.Time
+	wait      time.Duration // WaitDependencies 等待依赖的耗时
+	start     time.Duration // Start 的耗时
+	finish    time.Time
+	err       string
+}
+
+type profiler struct {
+	mu      sync.Mutex
+	begin   time.Time
+	modules map[string]*moduleProfile
+}
+
+// ModuleProfile 单个模块的启动耗时，时间单位均为毫秒
+type ModuleProfile struct {
+	Name         string
+	Dependencies []string
+	WaitBegin    float64 // 相对于首次 EnableModules 的偏移
+	Wait         float64
+	Start        float64
+	Finish       float64 // 相对于首次 EnableModules 的偏移
+	Error        string  `json:",omitempty"`
+}
+
+// StartupProfile 启动耗时报告，CriticalPath 为依赖图中 Start 耗时之和最长的路径，按启动顺序排列
+type StartupProfile struct {
+	Total            float64
+	Modules          []ModuleProfile
+	CriticalPath     []string
+	CriticalPathCost float64
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (l *Loader) getProfiler() *profiler {
+	l.profilerOnce.Do(func() {
+		l.profiler = &profiler{
+			modules: make(map[string]*moduleProfile),
+		}
+	})
+	return l.profiler
+}
+
+func (p *profiler) markBegin(t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.begin.IsZero() {
+		p.begin = t
+	}
+}
+
+func (p *profiler) record(name string, waitBegin time.Time, wait, start time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.begin.IsZero() {
+		p.begin = waitBegin
+	}
+	mp := &moduleProfile{
+		waitBegin: waitBegin,
+		wait:      wait,
+		start:     start,
+		finish:    waitBegin.Add(wait + start),
+	}
+	if err != nil {
+		mp.err = err.Error()
+	}
+	p.modules[name] = mp
+}
+
+func (l *Loader) GetStartupProfile() *StartupProfile {
+	p := l.getProfiler()
+	p.mu.Lock()
+	modules := make(map[string]moduleProfile, len(p.modules))
+	for name, mp := range p.modules {
+		modules[name] = *mp
+	}
+	begin := p.begin
+	p.mu.Unlock()
+
+	l.lock.Lock()
+	dependencies := make(map[string][]string, len(modules))
+	for name := range modules {
+		if m, ok := l.modules[name]; ok {
+			dependencies[name] = m.GetDependencies()
+		}
+	}
+	l.lock.Unlock()
+
+	result := &StartupProfile{}
+	var last time.Time
+	for name, mp := range modules {
+		result.Modules = append(result.Modules, ModuleProfile{
+			Name:         name,
+			Dependencies: dependencies[name],
+			WaitBegin:    toMilliseconds(mp.waitBegin.Sub(begin)),
+			Wait:         toMilliseconds(mp.wait),
+			Start:        toMilliseconds(mp.start),
+			Finish:       toMilliseconds(mp.finish.Sub(begin)),
+			Error:        mp.err,
+		})
+		if mp.finish.After(last) {
+			last = mp.finish
+		}
+	}
+	sort.Slice(result.Modules, func(i, j int) bool {
+		return result.Modules[i].WaitBegin < result.Modules[j].WaitBegin ||
+			(result.Modules[i].WaitBegin == result.Modules[j].WaitBegin &&
+				result.Modules[i].Name < result.Modules[j].Name)
+	})
+	if !last.IsZero() {
+		result.Total = toMilliseconds(last.Sub(begin))
+	}
+
+	starts := make(map[string]time.Duration, len(modules))
+	for name, mp := range modules {
+		starts[name] = mp.start
+	}
+	path, cost := criticalPath(starts, dependencies)
+	result.CriticalPath = path
+	result.CriticalPathCost = toMilliseconds(cost)
+	return result
+}
+
+// criticalPath 计算依赖图中 Start 耗时之和最长的路径，未记录耗时的依赖会被忽略。
+// 耗时相同的路径按名称排序选择，结果不受 map 遍历顺序影响。
+func criticalPath(starts map[string]time.Duration, dependencies map[string][]string) ([]string, time.Duration) {
+	names := make([]string, 0, len(starts))
+	for name := range starts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dag := graph.New()
+	for _, name := range names {
+		dag.AddNode(graph.NewNode(name))
+	}
+	sortedDeps := make(map[string][]string, len(names))
+	for _, name := range names {
+		var deps []string
+		for _, dependency := range dependencies[name] {
+			depNode := dag.GetNodeByID(dependency)
+			if depNode == nil {
+				continue
+			}
+			dag.UpdateEdgeWeight(depNode, dag.GetNodeByID(name), 0)
+			deps = append(deps, dependency)
+		}
+		sort.Strings(deps)
+		sortedDeps[name] = deps
+	}
+	nodes, ok := dag.TopologicalDag()
+	if !ok {
+		return nil, 0
+	}
+
+	cost := make(map[string]time.Duration, len(nodes))
+	prev := make(map[string]string, len(nodes))
+	var end string
+	for _, node := range nodes {
+		var longest time.Duration
+		for _, from := range sortedDeps[node.ID] {
+			if c := cost[from]; c > longest || prev[node.ID] == "" {
+				longest = c
+				prev[node.ID] = from
+			}
+		}
+		cost[node.ID] = longest + starts[node.ID]
+		if end == "" || cost[node.ID] > cost[end] || (cost[node.ID] == cost[end] && node.ID < end) {
+			end = node.ID
+		}
+	}
+	if end == "" {
+		return nil, 0
+	}
+
+	var path []string
+	for n := end; n != ""; n = prev[n] {
+		path = append([]string{n}, path...)
+	}
+	return path, cost[end]
+}
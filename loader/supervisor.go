@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	ConfigManager "github.com/linuxdeepin/go-dbus-factory/org.desktopspec.ConfigManager"
+)
+
+const (
+	dsettingsLoaderResource          = "org.deepin.dde.daemon.loader"
+	DSettingsKeyModuleMaxRestarts    = "moduleMaxRestarts"
+	DSettingsKeyModuleRestartBackoff = "moduleRestartBackoff"
+
+	defaultMaxRestarts    = 5
+	defaultRestartBackoff = time.Second
+	maxRestartBackoff     = 5 * time.Minute
+	// 距上次崩溃超过这个时间后再次崩溃，重新开始计算重启次数
+	defaultStableUptime = 10 * time.Minute
+)
+
+// PanicError 模块崩溃时的错误，保存了 panic 的值和调用栈
+type PanicError struct {
+	ModuleName string
+	Value      interface{}
+	Stack      []byte
+}
+
+func newPanicError(name string, v interface{}) *PanicError {
+	return &PanicError{
+		ModuleName: name,
+		Value:      v,
+		Stack:      debug.Stack(),
+	}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("module %s panic: %v", e.ModuleName, e.Value)
+}
+
+// ModuleFailedHandler 模块崩溃时的回调，restartCount 为已经尝试重启的次数，
+// willRestart 为 false 表示已达到重启次数上限，模块将保持失败状态。
+type ModuleFailedHandler func(name string, reason string, restartCount int, willRestart bool)
+
+type supervisor struct {
+	mu             sync.Mutex
+	maxRestarts    int
+	restartBackoff time.Duration
+	stableUptime   time.Duration
+	restartCounts  map[string]int
+	lastFailures   map[string]time.Time
+	timers         map[string]*time.Timer
+	failedHandler  ModuleFailedHandler
+}
+
+// abandoner 由 ModuleBase 实现，模块达到重启次数上限时调用
+type abandoner interface {
+	abandon()
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{
+		maxRestarts:    defaultMaxRestarts,
+		restartBackoff: defaultRestartBackoff,
+		stableUptime:   defaultStableUptime,
+		restartCounts:  make(map[string]int),
+		lastFailures:   make(map[string]time.Time),
+		timers:         make(map[string]*time.Timer),
+	}
+}
+
+func (l *Loader) getSupervisor() *supervisor {
+	l.supervisorOnce.Do(func() {
+		if l.supervisor == nil {
+			l.supervisor = newSupervisor()
+		}
+	})
+	return l.supervisor
+}
+
+// backoff 第 n 次重启前的等待时间，每次翻倍，最长不超过 maxRestartBackoff
+func (s *supervisor) backoff(n int) time.Duration {
+	d := s.restartBackoff
+	for i := 1; i < n; i++ {
+		d *= 2
+		if d >= maxRestartBackoff {
+			return maxRestartBackoff
+		}
+	}
+	return d
+}
+
+func (l *Loader) SetModuleFailedHandler(handler ModuleFailedHandler) {
+	s := l.getSupervisor()
+	s.mu.Lock()
+	s.failedHandler = handler
+	s.mu.Unlock()
+}
+
+// SetRestartPolicy 设置模块崩溃后的最大重启次数和首次重启的等待时间，maxRestarts 为 0 表示不自动重启
+func (l *Loader) SetRestartPolicy(maxRestarts int, backoff time.Duration) {
+	s := l.getSupervisor()
+	s.mu.Lock()
+	s.maxRestarts = maxRestarts
+	if backoff > 0 {
+		s.restartBackoff = backoff
+	}
+	s.mu.Unlock()
+}
+
+func (l *Loader) GetRestartCount(name string) int {
+	s := l.getSupervisor()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restartCounts[name]
+}
+
+// resetRestartCount 手动启动或重启模块后，重新开始计算重启次数
+func (l *Loader) resetRestartCount(name string) {
+	s := l.getSupervisor()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.restartCounts, name)
+	delete(s.lastFailures, name)
+	if timer, ok := s.timers[name]; ok {
+		timer.Stop()
+		delete(s.timers, name)
+	}
+}
+
+// moduleFailed 记录模块失败，并在未达到重启次数上限时按指数退避安排重启，
+// 达到上限后放弃该模块，不再阻塞等待它启动的调用者
+func (l *Loader) moduleFailed(name string, reason error) {
+	s := l.getSupervisor()
+	s.mu.Lock()
+	if _, ok := s.timers[name]; ok {
+		// 已经安排了重启
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if last, ok := s.lastFailures[name]; ok && now.Sub(last) > s.stableUptime {
+		// 模块已经稳定运行了一段时间，之前的崩溃不再计入
+		delete(s.restartCounts, name)
+	}
+	s.lastFailures[name] = now
+	count := s.restartCounts[name]
+	maxRestarts := s.maxRestarts
+	willRestart := count < maxRestarts
+	var delay time.Duration
+	if willRestart {
+		count++
+		s.restartCounts[name] = count
+		delay = s.backoff(count)
+		s.timers[name] = time.AfterFunc(delay, func() {
+			s.mu.Lock()
+			delete(s.timers, name)
+			s.mu.Unlock()
+			l.restartFailedModule(name)
+		})
+	}
+	handler := s.failedHandler
+	s.mu.Unlock()
+
+	if willRestart {
+		l.log.Warningf("module %s failed, restart it after %s (%d/%d)", name, delay, count, maxRestarts)
+	} else {
+		l.log.Errorf("module %s failed, reached restart limit %d", name, maxRestarts)
+		if m, ok := l.GetModule(name).(abandoner); ok {
+			m.abandon()
+		}
+	}
+
+	if handler != nil {
+		msg := reason.Error()
+		var panicErr *PanicError
+		if errors.As(reason, &panicErr) {
+			msg = fmt.Sprint(panicErr.Value)
+		}
+		handler(name, msg, count, willRestart)
+	}
+}
+
+func (l *Loader) restartFailedModule(name string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	stopped, err := l.stopModuleWithDependents(name)
+	if err != nil {
+		l.log.Warning(err)
+	}
+	names := []string{name}
+	for i := len(stopped) - 1; i >= 0; i-- {
+		if stopped[i] != name {
+			names = append(names, stopped[i])
+		}
+	}
+	l.log.Info("restart failed module", name)
+	err = l.startModules(names)
+	if err != nil {
+		for _, n := range names {
+			if l.modules[n].IsFailed() {
+				// panic 已经在 doEnable 中上报过
+				return
+			}
+		}
+		go l.moduleFailed(name, err)
+	}
+}
+
+// loadRestartPolicy 从 org.deepin.dde.daemon.loader 配置中读取重启策略，并监听其变化
+func (l *Loader) loadRestartPolicy() {
+	sigLoop := getSysSigLoop(l.log)
+	if sigLoop == nil {
+		return
+	}
+
+	ds := ConfigManager.NewConfigManager(sigLoop.Conn())
+	dsPath, err := ds.AcquireManager(0, dsettingsAppID, dsettingsLoaderResource, "")
+	if err != nil {
+		l.log.Warning(err)
+		return
+	}
+
+	dsManager, err := ConfigManager.NewManager(sigLoop.Conn(), dsPath)
+	if err != nil {
+		l.log.Warning(err)
+		return
+	}
+
+	getInt := func(key string) (int, bool) {
+		v, err := dsManager.Value(0, key)
+		if err != nil {
+			l.log.Warning(err)
+			return 0, false
+		}
+		switch val := v.Value().(type) {
+		case int64:
+			return int(val), true
+		case float64:
+			return int(val), true
+		}
+		return 0, false
+	}
+
+	load := func() {
+		maxRestarts, ok := getInt(DSettingsKeyModuleMaxRestarts)
+		if !ok {
+			maxRestarts = defaultMaxRestarts
+		}
+		backoff := defaultRestartBackoff
+		if ms, ok := getInt(DSettingsKeyModuleRestartBackoff); ok && ms > 0 {
+			backoff = time.Duration(ms) * time.Millisecond
+		}
+		l.log.Infof("module restart policy: max restarts %d, backoff %s", maxRestarts, backoff)
+		l.SetRestartPolicy(maxRestarts, backoff)
+	}
+	load()
+
+	dsManager.InitSignalExt(sigLoop, true)
+	dsManager.ConnectValueChanged(func(key string) {
+		if key == DSettingsKeyModuleMaxRestarts || key == DSettingsKeyModuleRestartBackoff {
+			load()
+		}
+	})
+}
@@ -83,7 +83,7 @@ func (d *Module) start() error {
 	}
 
 	manager.proxyChainsManager = proxychains.NewManager(service)
-	err = service.Export(proxychains.DBusPath, manager.proxyChainsManager)
+	err = d.Export(proxychains.DBusPath, manager.proxyChainsManager)
 	if err != nil {
 		logger.Warning("failed to export proxyChainsManager:", err)
 		manager.proxyChainsManager = nil
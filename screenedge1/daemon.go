@@ -35,7 +35,7 @@ func (d *Daemon) Start() error {
 	service := loader.GetService()
 	d.manager = newManager(service)
 
-	err := service.Export(dbusPath, d.manager, d.manager.syncConfig)
+	err := d.Export(dbusPath, d.manager, d.manager.syncConfig)
 	if err != nil {
 		return err
 	}
@@ -51,7 +51,7 @@ func (m *Module) Start() error {
 		return err
 	}
 
-	err = service.Export(dbusPath, m.sSaver)
+	err = m.Export(dbusPath, m.sSaver)
 	if err != nil {
 		return err
 	}
@@ -62,7 +62,7 @@ func (m *Module) Start() error {
 	}
 
 	m.syncConfig = dsync.NewConfig("screensaver", &syncConfig{}, m.sSaver.sigLoop, dScreenSaverPath, logger)
-	err = service.Export(dScreenSaverPath, m.syncConfig)
+	err = m.Export(dScreenSaverPath, m.syncConfig)
 	if err != nil {
 		return err
 	}
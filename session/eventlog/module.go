@@ -66,7 +66,7 @@ func (m *Module) Start() error {
 	if m.eventlog == nil {
 		return errors.New("failed to create eventlog")
 	}
-	err = service.Export(dbusPath, m.eventlog)
+	err = m.Export(dbusPath, m.eventlog)
 	if err != nil {
 		return err
 	}
@@ -43,7 +43,7 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
-	err = service.Export(dbusPath, d.manager,
+	err = d.Export(dbusPath, d.manager,
 		d.manager.warnLevelConfig, d.manager.syncConfig)
 	if err != nil {
 		return err
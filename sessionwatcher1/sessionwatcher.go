@@ -46,7 +46,7 @@ func (d *Daemon) Start() error {
 
 	d.manager.initUserSessions()
 
-	err = service.Export(dbusPath, d.manager)
+	err = d.Export(dbusPath, d.manager)
 	if err != nil {
 		return err
 	}
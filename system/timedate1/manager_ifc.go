@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/godbus/dbus/v5"
+	"github.com/linuxdeepin/dde-daemon/common/audit"
 	"github.com/linuxdeepin/dde-daemon/timedate1/zoneinfo"
 	"github.com/linuxdeepin/go-lib/dbusutil"
 )
@@ -107,8 +108,14 @@ func (m *Manager) SetNTP(sender dbus.Sender, enabled bool, message string) *dbus
 	return dbusutil.ToError(err)
 }
 
-func (m *Manager) SetNTPServer(sender dbus.Sender, server, message string) *dbus.Error {
+func (m *Manager) SetNTPServer(sender dbus.Sender, server, message string) (busErr *dbus.Error) {
+	call := audit.Begin(m.service, sender, "Timedate1.SetNTPServer", audit.NewArg("server", server))
+	defer func() {
+		call.End(busErr)
+	}()
+
 	err := m.checkAuthorization("SetNTPServer", message, sender)
+	call.SetAuthResult(err)
 	if err != nil {
 		return dbusutil.ToError(err)
 	}
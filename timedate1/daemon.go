@@ -42,7 +42,7 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
-	err = service.Export(dbusPath, d.manager)
+	err = d.Export(dbusPath, d.manager)
 	if err != nil {
 		return err
 	}
@@ -57,7 +57,7 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
-	err = service.Export(dbusFormatPath, d.managerFormat)
+	err = d.Export(dbusFormatPath, d.managerFormat)
 	if err != nil {
 		return err
 	}
@@ -59,7 +59,7 @@ func (d *Daemon) Start() error {
 
 		d.manager = NewTrayManager(service)
 
-		err = service.Export(dbusPath, d.manager)
+		err = d.Export(dbusPath, d.manager)
 		if err != nil {
 			return err
 		}
@@ -83,7 +83,7 @@ func (d *Daemon) Start() error {
 	if os.Getenv("DDE_DISABLE_STATUS_NOTIFIER_WATCHER") != "1" {
 		d.snw = newStatusNotifierWatcher(service, d.sigLoop)
 		d.snw.listenDBusNameOwnerChanged()
-		err = service.Export(snwDBusPath, d.snw)
+		err = d.Export(snwDBusPath, d.snw)
 		if err != nil {
 			return err
 		}
@@ -64,7 +64,7 @@ func (d *Daemon) Start() error {
 		go m.handleXEvent()
 	}
 
-	err = service.Export(dbusPath, m)
+	err = d.Export(dbusPath, m)
 	if err != nil {
 		return err
 	}